@@ -1,11 +1,14 @@
 package consumer
 
 import (
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/sirupsen/logrus"
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/helper"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
 	"github.com/steffsas/doe-hunter/lib/storage"
@@ -21,6 +24,13 @@ type CertificateProcessEventHandler struct {
 	EventProcessHandler
 
 	QueryHandler CertificateQueryHandler
+
+	// VerificationStorage stores the verified discovery verdicts of certificate scans scheduled by DDR scans (optional)
+	VerificationStorage storage.StorageHandler
+
+	// CertificateStorage stores each certificate once by fingerprint,
+	// scans then only reference the certificates by fingerprint (optional)
+	CertificateStorage storage.CertificateStorageHandler
 }
 
 func (ph *CertificateProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
@@ -42,6 +52,9 @@ func (ph *CertificateProcessEventHandler) Process(msg *kafka.Message, storage st
 		certificateScan.Meta.AddError(qErr)
 	}
 
+	ph.verifyDiscovery(certificateScan)
+	ph.storeCertificates(certificateScan)
+
 	// store
 	err := storage.Store(certificateScan)
 	if err != nil {
@@ -50,7 +63,70 @@ func (ph *CertificateProcessEventHandler) Process(msg *kafka.Message, storage st
 	return err
 }
 
-func NewKafkaCertificateEventConsumer(config *KafkaConsumerConfig, storageHandler storage.StorageHandler, queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+// verifyDiscovery checks and stores whether verified discovery (RFC 9462) succeeds for the designated resolver
+func (ph *CertificateProcessEventHandler) verifyDiscovery(certificateScan *scan.CertificateScan) {
+	if ph.VerificationStorage == nil {
+		return
+	}
+
+	verification := scan.NewDDRVerification(certificateScan)
+	if verification == nil {
+		// not scheduled by a DDR scan
+		return
+	}
+
+	var certs []*x509.Certificate
+	if certificateScan.Result != nil {
+		var err error
+		certs, err = certificateScan.Result.X509Certificates()
+		if err != nil {
+			logrus.Errorf("failed to parse certificates of %s: %v", certificateScan.Meta.ScanId, err)
+		}
+	}
+
+	verification.Verify(certs, nil)
+
+	err := ph.VerificationStorage.Store(verification)
+	if err != nil {
+		logrus.Errorf("failed to store DDR verification of %s: %v", certificateScan.Meta.ScanId, err)
+		certificateScan.Meta.AddError(custom_errors.NewGenericError(err, false))
+	}
+}
+
+// storeCertificates upserts the presented certificates into the certificate store and
+// drops them from the scan on success so that the scan only references them by fingerprint
+func (ph *CertificateProcessEventHandler) storeCertificates(certificateScan *scan.CertificateScan) {
+	if ph.CertificateStorage == nil || certificateScan.Result == nil || len(certificateScan.Result.Certificates) == 0 {
+		return
+	}
+
+	endpoint := fmt.Sprintf("%s/%s", helper.GetFullHostFromHostPort(certificateScan.Query.Host, certificateScan.Query.Port), certificateScan.Query.Protocol)
+
+	for _, cert := range certificateScan.Result.Certificates {
+		err := ph.CertificateStorage.StoreCertificate(&storage.CertificateSighting{
+			Fingerprint:  cert.SHA256Fingerprint,
+			Certificate:  cert,
+			VantagePoint: certificateScan.Meta.VantagePoint,
+			Endpoint:     endpoint,
+			Timestamp:    certificateScan.Meta.Finished,
+		})
+		if err != nil {
+			// keep the certificates in the scan so that nothing is lost
+			logrus.Errorf("failed to store certificate %s of %s: %v", cert.SHA256Fingerprint, certificateScan.Meta.ScanId, err)
+			certificateScan.Meta.AddError(custom_errors.NewGenericError(err, false))
+			return
+		}
+	}
+
+	certificateScan.Result.Certificates = nil
+}
+
+func NewKafkaCertificateEventConsumer(
+	config *KafkaConsumerConfig,
+	storageHandler storage.StorageHandler,
+	verificationStorageHandler storage.StorageHandler,
+	certificateStorageHandler storage.CertificateStorageHandler,
+	queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
 	if config != nil && config.ConsumerGroup == "" {
 		config.ConsumerGroup = DEFAULT_CERTIFICATE_CONSUMER_GROUP
 	}
@@ -62,7 +138,9 @@ func NewKafkaCertificateEventConsumer(config *KafkaConsumerConfig, storageHandle
 		}
 
 		return &CertificateProcessEventHandler{
-			QueryHandler: qh,
+			QueryHandler:        qh,
+			VerificationStorage: verificationStorageHandler,
+			CertificateStorage:  certificateStorageHandler,
 		}, nil
 	}
 
@@ -10,6 +10,7 @@ import (
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -33,6 +34,25 @@ func (msh *mockedStorageHandler) Close() error {
 	return args.Error(0)
 }
 
+type mockedCertificateStorageHandler struct {
+	mock.Mock
+}
+
+func (mcs *mockedCertificateStorageHandler) StoreCertificate(sighting *storage.CertificateSighting) error {
+	args := mcs.Called(sighting)
+	return args.Error(0)
+}
+
+func (mcs *mockedCertificateStorageHandler) Open() error {
+	args := mcs.Called()
+	return args.Error(0)
+}
+
+func (mcs *mockedCertificateStorageHandler) Close() error {
+	args := mcs.Called()
+	return args.Error(0)
+}
+
 type mockedCertificateQueryHandler struct {
 	mock.Mock
 }
@@ -179,6 +199,104 @@ func TestCertificate_Process(t *testing.T) {
 	})
 }
 
+func TestCertificate_ProcessDDRVerification(t *testing.T) {
+	t.Parallel()
+
+	newCertScanMessage := func(originResolver string) *kafka.Message {
+		certScan := &scan.CertificateScan{
+			Meta: &scan.CertificateScanMetaInformation{
+				ScanMetaInformation: scan.ScanMetaInformation{
+					ScanId:     "test",
+					RootScanId: "ddr",
+				},
+				OriginResolver: originResolver,
+				TargetName:     "dns.example.com",
+			},
+			Query: &query.CertificateQuery{
+				Host: "8.8.8.8",
+				Port: 443,
+			},
+		}
+
+		certScanBytes, _ := json.Marshal(certScan)
+		return &kafka.Message{Value: certScanBytes}
+	}
+
+	t.Run("store verdict of DDR certificate scan", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		vsh := &mockedStorageHandler{}
+		vsh.On("Store", mock.Anything).Return(nil)
+
+		cqh := &mockedCertificateQueryHandler{}
+		cqh.On("Query", mock.Anything).Return(&query.CertificateResponse{}, nil)
+
+		cc := &consumer.CertificateProcessEventHandler{
+			QueryHandler:        cqh,
+			VerificationStorage: vsh,
+		}
+
+		err := cc.Process(newCertScanMessage("8.8.8.8"), msh)
+
+		assert.Nil(t, err)
+		msh.AssertCalled(t, "Store", mock.Anything)
+		vsh.AssertCalled(t, "Store", mock.MatchedBy(func(v *scan.DDRVerification) bool {
+			return v.DDRScanId == "ddr" && v.CertificateScanId == "test" && v.Verdict == scan.DDR_VERIFICATION_FAILED
+		}))
+	})
+
+	t.Run("no verdict without origin resolver", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		vsh := &mockedStorageHandler{}
+		vsh.On("Store", mock.Anything).Return(nil)
+
+		cqh := &mockedCertificateQueryHandler{}
+		cqh.On("Query", mock.Anything).Return(&query.CertificateResponse{}, nil)
+
+		cc := &consumer.CertificateProcessEventHandler{
+			QueryHandler:        cqh,
+			VerificationStorage: vsh,
+		}
+
+		err := cc.Process(newCertScanMessage(""), msh)
+
+		assert.Nil(t, err)
+		vsh.AssertNotCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("verification storage error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		vsh := &mockedStorageHandler{}
+		vsh.On("Store", mock.Anything).Return(errors.New("storage error"))
+
+		cqh := &mockedCertificateQueryHandler{}
+		cqh.On("Query", mock.Anything).Return(&query.CertificateResponse{}, nil)
+
+		cc := &consumer.CertificateProcessEventHandler{
+			QueryHandler:        cqh,
+			VerificationStorage: vsh,
+		}
+
+		err := cc.Process(newCertScanMessage("8.8.8.8"), msh)
+
+		assert.Nil(t, err, "verification storage errors should not fail the certificate scan")
+		msh.AssertCalled(t, "Store", mock.MatchedBy(func(s *scan.CertificateScan) bool {
+			return len(s.Meta.Errors) == 1
+		}))
+	})
+}
+
 func TestCertificateEventConsumer_New(t *testing.T) {
 	t.Parallel()
 
@@ -190,7 +308,7 @@ func TestCertificateEventConsumer_New(t *testing.T) {
 
 		config := &consumer.KafkaConsumerConfig{}
 
-		kec, err := consumer.NewKafkaCertificateEventConsumer(config, msh, mqh)
+		kec, err := consumer.NewKafkaCertificateEventConsumer(config, msh, nil, nil, mqh)
 
 		assert.Error(t, err, "should return an error on missing kafka server information")
 		assert.NotEmpty(t, config.ConsumerGroup, "should have added the default consumer group")
@@ -203,7 +321,7 @@ func TestCertificateEventConsumer_New(t *testing.T) {
 		msh := &mockedStorageHandler{}
 		mqh := &query.QueryConfig{}
 
-		kec, err := consumer.NewKafkaCertificateEventConsumer(nil, msh, mqh)
+		kec, err := consumer.NewKafkaCertificateEventConsumer(nil, msh, nil, nil, mqh)
 
 		assert.Error(t, err, "should return an error on empty config since kafka connection details are missing")
 		assert.Nil(t, kec, "should return nil")
@@ -218,7 +336,7 @@ func TestCertificateEventConsumer_New(t *testing.T) {
 			ConsumerGroup: "test-group",
 		}
 
-		kec, err := consumer.NewKafkaCertificateEventConsumer(config, nil, mqh)
+		kec, err := consumer.NewKafkaCertificateEventConsumer(config, nil, nil, nil, mqh)
 
 		assert.Error(t, err, "should return an error on empty storage handler")
 		assert.Nil(t, kec, "should not return a valid KafkaEventConsumer")
@@ -233,9 +351,119 @@ func TestCertificateEventConsumer_New(t *testing.T) {
 			ConsumerGroup: "test-group",
 		}
 
-		kec, err := consumer.NewKafkaCertificateEventConsumer(config, msh, nil)
+		kec, err := consumer.NewKafkaCertificateEventConsumer(config, msh, nil, nil, nil)
 
 		assert.Error(t, err, "should return an error on empty process handler")
 		assert.Nil(t, kec, "should not return a valid KafkaEventConsumer")
 	})
 }
+
+func TestCertificate_ProcessCertificateStorage(t *testing.T) {
+	t.Parallel()
+
+	newCertScanMessage := func() *kafka.Message {
+		certScan := &scan.CertificateScan{
+			Meta: &scan.CertificateScanMetaInformation{
+				ScanMetaInformation: scan.ScanMetaInformation{
+					ScanId:       "test",
+					VantagePoint: "vp",
+				},
+			},
+			Query: &query.CertificateQuery{
+				Host:     "8.8.8.8",
+				Port:     853,
+				Protocol: query.TLS_PROTOCOL_TCP,
+			},
+		}
+
+		certScanBytes, _ := json.Marshal(certScan)
+		return &kafka.Message{Value: certScanBytes}
+	}
+
+	newResponse := func() *query.CertificateResponse {
+		return &query.CertificateResponse{
+			Certificates: []*query.CertificateInfo{
+				{SHA256Fingerprint: "leaf"},
+				{SHA256Fingerprint: "ca"},
+			},
+			Fingerprints: []string{"leaf", "ca"},
+		}
+	}
+
+	t.Run("reference certificates by fingerprint", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		csh := &mockedCertificateStorageHandler{}
+		csh.On("StoreCertificate", mock.Anything).Return(nil)
+
+		cqh := &mockedCertificateQueryHandler{}
+		cqh.On("Query", mock.Anything).Return(newResponse(), nil)
+
+		cc := &consumer.CertificateProcessEventHandler{
+			QueryHandler:       cqh,
+			CertificateStorage: csh,
+		}
+
+		err := cc.Process(newCertScanMessage(), msh)
+
+		assert.Nil(t, err)
+		csh.AssertNumberOfCalls(t, "StoreCertificate", 2)
+		csh.AssertCalled(t, "StoreCertificate", mock.MatchedBy(func(s *storage.CertificateSighting) bool {
+			return s.Fingerprint == "leaf" && s.VantagePoint == "vp" && s.Endpoint == "8.8.8.8:853/tcp"
+		}))
+
+		storedScan := msh.Calls[0].Arguments.Get(0).(*scan.CertificateScan)
+		assert.Nil(t, storedScan.Result.Certificates)
+		assert.Equal(t, []string{"leaf", "ca"}, storedScan.Result.Fingerprints)
+	})
+
+	t.Run("keep certificates on storage error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		csh := &mockedCertificateStorageHandler{}
+		csh.On("StoreCertificate", mock.Anything).Return(errors.New("error"))
+
+		cqh := &mockedCertificateQueryHandler{}
+		cqh.On("Query", mock.Anything).Return(newResponse(), nil)
+
+		cc := &consumer.CertificateProcessEventHandler{
+			QueryHandler:       cqh,
+			CertificateStorage: csh,
+		}
+
+		err := cc.Process(newCertScanMessage(), msh)
+
+		assert.Nil(t, err)
+
+		storedScan := msh.Calls[0].Arguments.Get(0).(*scan.CertificateScan)
+		assert.Len(t, storedScan.Result.Certificates, 2)
+		assert.NotEmpty(t, storedScan.Meta.Errors)
+	})
+
+	t.Run("without certificate storage", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		cqh := &mockedCertificateQueryHandler{}
+		cqh.On("Query", mock.Anything).Return(newResponse(), nil)
+
+		cc := &consumer.CertificateProcessEventHandler{
+			QueryHandler: cqh,
+		}
+
+		err := cc.Process(newCertScanMessage(), msh)
+
+		assert.Nil(t, err)
+
+		storedScan := msh.Calls[0].Arguments.Get(0).(*scan.CertificateScan)
+		assert.Len(t, storedScan.Result.Certificates, 2)
+	})
+}
@@ -24,6 +24,13 @@ type DDRProcessEventHandler struct {
 
 	Producer     producer.ScanProducer
 	QueryHandler query.ConventionalDNSQueryHandlerI
+
+	// ScheduleTLSEnumScans schedules TLS enumeration scans for the discovered DoT and DoH endpoints
+	ScheduleTLSEnumScans bool
+	// ScheduleSessionScans schedules connection reuse and pipelining scans for the discovered DoT, DoH and DoQ endpoints
+	ScheduleSessionScans bool
+	// ScheduleResumptionScans schedules TLS session resumption and 0-RTT scans for the discovered DoT, DoH and DoQ endpoints
+	ScheduleResumptionScans bool
 }
 
 func (ddr *DDRProcessEventHandler) ScheduleScans(ddrScan *scan.DDRScan) {
@@ -38,6 +45,9 @@ func (ddr *DDRProcessEventHandler) ScheduleScans(ddrScan *scan.DDRScan) {
 			// let's parse the SVCB answers
 			logrus.Debugf("got %d SVCB answers, schedule DoE scans", len(ddrScan.Result.Response.ResponseMsg.Answer))
 			// parse DDR response
+			ddrScan.Meta.ScheduleTLSEnumScans = ddrScan.Meta.ScheduleTLSEnumScans || ddr.ScheduleTLSEnumScans
+			ddrScan.Meta.ScheduleSessionScans = ddrScan.Meta.ScheduleSessionScans || ddr.ScheduleSessionScans
+			ddrScan.Meta.ScheduleResumptionScans = ddrScan.Meta.ScheduleResumptionScans || ddr.ScheduleResumptionScans
 			scans, errColl := ddrScan.CreateScansFromResponse()
 			ddrScan.Meta.AddError(errColl...)
 
@@ -86,7 +96,10 @@ func (ddr *DDRProcessEventHandler) ScheduleScans(ddrScan *scan.DDRScan) {
 	// check if ddr scan was based on an IP address
 	ip := net.ParseIP(ddrScan.Query.Host)
 
-	if ip == nil {
+	if ddrScan.Meta.AliasDepth > 0 {
+		logrus.Infof("DDR scan %s follows an alias, PTR scan is scheduled by the origin DDR scan", ddrScan.Meta.ScanId)
+		ddrScan.Meta.PTRScheduled = false
+	} else if ip == nil {
 		logrus.Warnf("DDR scan %s was not based on an IP address, no PTR scan scheduled", ddrScan.Meta.ScanId)
 		ddrScan.Meta.PTRScheduled = false
 	} else {
@@ -159,15 +172,21 @@ func NewKafkaDDREventConsumer(
 	config *KafkaConsumerConfig,
 	prod producer.ScanProducer,
 	storageHandler storage.StorageHandler,
-	queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+	queryConfig *query.QueryConfig,
+	scheduleTLSEnumScans bool,
+	scheduleSessionScans bool,
+	scheduleResumptionScans bool) (kec *KafkaEventConsumer, err error) {
 	if config != nil && config.ConsumerGroup == "" {
 		config.ConsumerGroup = DEFAULT_DDR_CONSUMER_GROUP
 	}
 
 	newPh := func() (EventProcessHandler, error) {
 		return &DDRProcessEventHandler{
-			Producer:     prod,
-			QueryHandler: query.NewDDRQueryHandler(queryConfig),
+			Producer:                prod,
+			QueryHandler:            query.NewDDRQueryHandler(queryConfig),
+			ScheduleTLSEnumScans:    scheduleTLSEnumScans,
+			ScheduleSessionScans:    scheduleSessionScans,
+			ScheduleResumptionScans: scheduleResumptionScans,
 		}, nil
 	}
 
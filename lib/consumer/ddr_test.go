@@ -344,6 +344,109 @@ func TestDDRProcessEventHandler_ScheduleScans(t *testing.T) {
 		mpf.AssertCalled(t, "Produce", mock.Anything, consumer.GetKafkaVPTopic(k.DEFAULT_DOQ_TOPIC, vantagePoint))
 		mpf.AssertCalled(t, "Produce", mock.Anything, consumer.GetKafkaVPTopic(k.DEFAULT_DOT_TOPIC, vantagePoint))
 		mpf.AssertCalled(t, "Produce", mock.Anything, consumer.GetKafkaVPTopic(k.DEFAULT_CERTIFICATE_TOPIC, vantagePoint))
+		mpf.AssertNotCalled(t, "Produce", mock.Anything, consumer.GetKafkaVPTopic(k.DEFAULT_TLS_ENUM_TOPIC, vantagePoint))
+		mpf.AssertNotCalled(t, "Produce", mock.Anything, consumer.GetKafkaVPTopic(k.DEFAULT_SESSION_TOPIC, vantagePoint))
+		mpf.AssertNotCalled(t, "Produce", mock.Anything, consumer.GetKafkaVPTopic(k.DEFAULT_RESUMPTION_TOPIC, vantagePoint))
+	})
+
+	t.Run("schedule TLS enumeration scans", func(t *testing.T) {
+		defer consumer.ScanCache.Clear()
+
+		mpf := &mockedProducerFactory{}
+		mpf.On("Produce", mock.Anything, mock.Anything).Return(nil)
+		mpf.On("Events").Return(make(chan kafka.Event))
+		mpf.On("Flush", mock.Anything).Return(0)
+
+		ph := consumer.DDRProcessEventHandler{
+			Producer:             mpf,
+			ScheduleTLSEnumScans: true,
+		}
+
+		ddrScan := &scan.DDRScan{
+			Meta: &scan.DDRScanMetaInformation{
+				ScanMetaInformation: scan.ScanMetaInformation{
+					VantagePoint: vantagePoint,
+				},
+				ScheduleDoEScans: true,
+			},
+			Query: &query.ConventionalDNSQuery{},
+			Result: &query.ConventionalDNSResponse{
+				Response: &query.DNSResponse{
+					ResponseMsg: &dns.Msg{
+						Answer: []dns.RR{
+							&dns.SVCB{
+								Priority: 1,
+								Target:   "example.com",
+								Value: []dns.SVCBKeyValue{
+									&dns.SVCBAlpn{
+										Alpn: []string{"h2", "dot", "doq"},
+									},
+									&dns.SVCBDoHPath{
+										Template: "/dns-query",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		ph.ScheduleScans(ddrScan)
+
+		assert.True(t, ddrScan.Meta.ScheduleTLSEnumScans)
+		enumScans := 0
+		for _, call := range mpf.Calls {
+			if call.Method == "Produce" && call.Arguments.Get(1) == consumer.GetKafkaVPTopic(k.DEFAULT_TLS_ENUM_TOPIC, vantagePoint) {
+				enumScans++
+			}
+		}
+		assert.Equal(t, 2, enumScans, "should have scheduled TLS enumeration for DoH and DoT only")
+	})
+
+	t.Run("follow AliasMode records", func(t *testing.T) {
+		defer consumer.ScanCache.Clear()
+
+		mpf := &mockedProducerFactory{}
+		mpf.On("Produce", mock.Anything, mock.Anything).Return(nil)
+		mpf.On("Events").Return(make(chan kafka.Event))
+		mpf.On("Flush", mock.Anything).Return(0)
+
+		ph := consumer.DDRProcessEventHandler{
+			Producer: mpf,
+		}
+
+		q := query.NewDDRQuery()
+		q.Host = "8.8.8.8"
+		ddrScan := scan.NewDDRScan(q, true, "runid", vantagePoint)
+		ddrScan.Meta.ScheduleFingerprintScan = false
+		ddrScan.Result = &query.ConventionalDNSResponse{
+			Response: &query.DNSResponse{
+				ResponseMsg: &dns.Msg{
+					Answer: []dns.RR{
+						&dns.SVCB{
+							Priority: 0,
+							Target:   "alias.example.com.",
+						},
+					},
+				},
+			},
+		}
+
+		ph.ScheduleScans(ddrScan)
+
+		require.Len(t, ddrScan.Meta.Children, 2, "should have scheduled the alias DDR scan and the PTR scan")
+		aliasScan, ok := mpf.Calls[0].Arguments.Get(0).(*scan.DDRScan)
+		require.True(t, ok)
+		assert.Equal(t, consumer.GetKafkaVPTopic(k.DEFAULT_DDR_TOPIC, vantagePoint), mpf.Calls[0].Arguments.Get(1))
+
+		// the alias DDR scan must not schedule another PTR scan
+		mpf.Calls = nil
+		aliasScan.Result = &query.ConventionalDNSResponse{}
+		ph.ScheduleScans(aliasScan)
+
+		assert.False(t, aliasScan.Meta.PTRScheduled)
+		mpf.AssertNotCalled(t, "Produce", mock.Anything, consumer.GetKafkaVPTopic(k.DEFAULT_PTR_TOPIC, vantagePoint))
 	})
 
 	t.Run("cache scans", func(t *testing.T) {
@@ -18,6 +18,9 @@ type DDRDNSSECProcessConsumer struct {
 	EventProcessHandler
 
 	QueryHandler query.ConventionalDNSQueryHandlerI
+	Validator    query.DNSSECValidatorI
+	// TransportHandler sends queries over DoT, DoH and DoQ if the scan asks for it
+	TransportHandler *query.DNSTransportHandler
 }
 
 func (dpc *DDRDNSSECProcessConsumer) Process(msg *kafka.Message, sh storage.StorageHandler) error {
@@ -37,13 +40,18 @@ func (dpc *DDRDNSSECProcessConsumer) Process(msg *kafka.Message, sh storage.Stor
 	// process
 	var qErr custom_errors.DoEErrors
 	dnssecScan.Meta.SetStarted()
-	dnssecScan.Result, qErr = dpc.QueryHandler.Query(dnssecScan.Query)
+	dnssecScan.Result, qErr = QueryOverTransport(dpc.QueryHandler, dpc.TransportHandler, dnssecScan.Query, dnssecScan.Transport)
 	dnssecScan.Meta.SetFinished()
 	if qErr != nil {
 		dnssecScan.Meta.AddError(qErr)
 		logrus.Errorf("error processing DoH scan %s to %s:%d: %s", dnssecScan.Meta.ScanId, dnssecScan.Query.Host, dnssecScan.Query.Port, qErr.Error())
 	}
 
+	// validate the chain of trust of the response
+	if dpc.Validator != nil && dnssecScan.Result != nil && dnssecScan.Result.Response != nil && dnssecScan.Result.Response.ResponseMsg != nil {
+		dnssecScan.Validation = dpc.Validator.Validate(dnssecScan.Result.Response.ResponseMsg, dnssecScan.Query.Host, dnssecScan.Query.Port)
+	}
+
 	// store
 	err = sh.Store(dnssecScan)
 	if err != nil {
@@ -53,14 +61,35 @@ func (dpc *DDRDNSSECProcessConsumer) Process(msg *kafka.Message, sh storage.Stor
 	return err
 }
 
-func NewKafkaDDRDNSSECEventConsumer(config *KafkaConsumerConfig, storageHandler storage.StorageHandler, queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+// NewKafkaDDRDNSSECEventConsumer creates the consumer for DDR DNSSEC scans,
+// trustAnchor holds DS/DNSKEY records in zone file format (empty for the root KSKs)
+func NewKafkaDDRDNSSECEventConsumer(config *KafkaConsumerConfig, storageHandler storage.StorageHandler, queryConfig *query.QueryConfig, trustAnchor string) (kec *KafkaEventConsumer, err error) {
 	if config != nil && config.ConsumerGroup == "" {
 		config.ConsumerGroup = DEFAULT_DDR_DNSSEC_CONSUMER_GROUP
 	}
 
+	// fail early on an invalid trust anchor
+	if _, err = query.NewDNSSECValidator(nil, trustAnchor); err != nil {
+		return nil, err
+	}
+
 	newPh := func() (EventProcessHandler, error) {
+		qh := query.NewConventionalDNSQueryHandler(queryConfig)
+
+		validator, err := query.NewDNSSECValidator(qh, trustAnchor)
+		if err != nil {
+			return nil, err
+		}
+
+		th, err := query.NewDNSTransportHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
 		return &DDRDNSSECProcessConsumer{
-			QueryHandler: query.NewConventionalDNSQueryHandler(queryConfig),
+			QueryHandler:     qh,
+			Validator:        validator,
+			TransportHandler: th,
 		}, nil
 	}
 
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/miekg/dns"
 	"github.com/steffsas/doe-hunter/lib/consumer"
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
 	"github.com/steffsas/doe-hunter/lib/query"
@@ -15,9 +16,64 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+type mockedDNSSECValidator struct {
+	mock.Mock
+}
+
+func (mv *mockedDNSSECValidator) Validate(msg *dns.Msg, host string, port int) *query.DNSSECValidation {
+	args := mv.Called(msg, host, port)
+	return args.Get(0).(*query.DNSSECValidation)
+}
+
 func TestDDRDNSSECProcessConsumer_Process(t *testing.T) {
 	t.Parallel()
 
+	t.Run("validate response", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		responseMsg := new(dns.Msg)
+		cqh := mockedConventionalDNSQueryHandler{}
+		cqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{
+			Response: &query.DNSResponse{ResponseMsg: responseMsg},
+		}, nil)
+
+		validation := &query.DNSSECValidation{Status: query.DNSSEC_STATUS_SECURE}
+		mv := mockedDNSSECValidator{}
+		mv.On("Validate", mock.Anything, "8.8.8.8", 53).Return(validation)
+
+		dph := &consumer.DDRDNSSECProcessConsumer{
+			QueryHandler: &cqh,
+			Validator:    &mv,
+		}
+
+		dnssecScan := &scan.DDRDNSSECScan{
+			Meta: &scan.DDRDNSSECScanMetaInformation{
+				ScanMetaInformation: scan.ScanMetaInformation{},
+			},
+			Query: &query.ConventionalDNSQuery{},
+		}
+		dnssecScan.Query.Host = "8.8.8.8"
+		dnssecScan.Query.Port = 53
+
+		// marshal to bytes
+		dnssecScanBytes, _ := json.Marshal(dnssecScan)
+		msg := &kafka.Message{
+			Value: dnssecScanBytes,
+		}
+
+		// test
+		err := dph.Process(msg, &msh)
+
+		assert.NoError(t, err)
+		mv.AssertCalled(t, "Validate", responseMsg, "8.8.8.8", 53)
+
+		storedDNSSECScan := msh.Calls[0].Arguments.Get(0).(*scan.DDRDNSSECScan)
+		assert.Equal(t, validation, storedDNSSECScan.Validation)
+	})
+
 	t.Run("process valid message", func(t *testing.T) {
 		t.Parallel()
 
@@ -167,3 +223,18 @@ func TestDDRDNSSECProcessConsumer_Process(t *testing.T) {
 		msh.AssertCalled(t, "Store", mock.Anything)
 	})
 }
+
+func TestNewKafkaDDRDNSSECEventConsumer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("invalid trust anchor", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+
+		kec, err := consumer.NewKafkaDDRDNSSECEventConsumer(nil, msh, nil, "no dns record")
+
+		assert.ErrorIs(t, err, custom_errors.ErrInvalidTrustAnchor)
+		assert.Nil(t, kec)
+	})
+}
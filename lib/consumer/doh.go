@@ -2,8 +2,11 @@ package consumer
 
 import (
 	"encoding/json"
+	"net"
+	"slices"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
 	"github.com/steffsas/doe-hunter/lib/producer"
@@ -23,6 +26,9 @@ type DoHProcessEventHandler struct {
 
 	Producer     producer.ScanProducer
 	QueryHandler DoHQueryHandler
+
+	// ECHQueryHandler looks up the ECHConfigList in the HTTPS RR of the target name if the scan does not carry one (optional)
+	ECHQueryHandler query.ConventionalDNSQueryHandlerI
 }
 
 func (ph *DoHProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
@@ -34,6 +40,14 @@ func (ph *DoHProcessEventHandler) Process(msg *kafka.Message, storage storage.St
 		return err
 	}
 
+	ph.lookupECHConfigList(dohScan)
+
+	// the query handler modifies the message, keep it for follow-up scans
+	var queryMsg *dns.Msg
+	if dohScan.Query.QueryMsg != nil {
+		queryMsg = dohScan.Query.QueryMsg.Copy()
+	}
+
 	// process
 	var qErr custom_errors.DoEErrors
 	dohScan.Meta.SetStarted()
@@ -51,6 +65,8 @@ func (ph *DoHProcessEventHandler) Process(msg *kafka.Message, storage storage.St
 		ph.Producer,
 	)
 
+	ph.scheduleAltSvcScans(dohScan, queryMsg)
+
 	// store
 	err = storage.Store(dohScan)
 	if err != nil {
@@ -59,6 +75,86 @@ func (ph *DoHProcessEventHandler) Process(msg *kafka.Message, storage storage.St
 	return err
 }
 
+// lookupECHConfigList sets the ECHConfigList announced in the HTTPS RR of the DoH target name
+func (ph *DoHProcessEventHandler) lookupECHConfigList(dohScan *scan.DoHScan) {
+	if ph.ECHQueryHandler == nil || len(dohScan.Query.ECHConfigList) > 0 {
+		return
+	}
+
+	targetName := dohScan.Query.SNI
+	if targetName == "" {
+		targetName = dohScan.Query.Host
+	}
+
+	if targetName == "" || net.ParseIP(targetName) != nil {
+		return
+	}
+
+	echConfigList, err := query.LookupECHConfigList(targetName, RESOLVER, ph.ECHQueryHandler)
+	if err != nil {
+		logrus.Warnf("failed to look up HTTPS RR of %s for DoH scan %s: %v", targetName, dohScan.Meta.ScanId, err)
+		dohScan.Meta.AddError(custom_errors.NewQueryError(custom_errors.ErrHTTPSRRLookupFailed, false).AddInfo(err))
+		return
+	}
+
+	dohScan.Query.ECHConfigList = echConfigList
+}
+
+// scheduleAltSvcScans produces HTTP/3 scans for the h3 alternatives in the Alt-Svc header of HTTP/1.1 and HTTP/2 responses
+func (ph *DoHProcessEventHandler) scheduleAltSvcScans(dohScan *scan.DoHScan, queryMsg *dns.Msg) {
+	if ph.Producer == nil ||
+		dohScan.Query.HTTPVersion == query.HTTP_VERSION_3 ||
+		dohScan.Result == nil ||
+		dohScan.Result.HTTP == nil ||
+		dohScan.Result.HTTP.AltSvc == "" {
+		return
+	}
+
+	rootScanId := dohScan.Meta.RootScanId
+	if rootScanId == "" {
+		rootScanId = dohScan.Meta.ScanId
+	}
+
+	ports := []int{}
+	for _, altSvc := range query.ParseAltSvc(dohScan.Result.HTTP.AltSvc) {
+		// alternatives on other hosts are left out since they need their own resolution
+		if altSvc.ProtocolID != query.ALT_SVC_HTTP3 ||
+			(altSvc.Host != "" && altSvc.Host != dohScan.Query.Host) ||
+			slices.Contains(ports, altSvc.Port) {
+			continue
+		}
+		ports = append(ports, altSvc.Port)
+
+		q := *dohScan.Query
+		q.HTTPVersion = query.HTTP_VERSION_3
+		q.Port = altSvc.Port
+		q.QueryMsg = nil
+		if queryMsg != nil {
+			q.QueryMsg = queryMsg.Copy()
+		}
+
+		altSvcScan := scan.NewDoHScan(&q, dohScan.Meta.ScanId, rootScanId, dohScan.Meta.RunId, dohScan.Meta.VantagePoint)
+		altSvcScan.Meta.AltSvcDiscovered = true
+
+		// use scan cache to only produce scans that haven't been produced yet
+		if scanId, found := ScanCache.ContainsScan(altSvcScan); found {
+			logrus.Debugf("HTTP/3 scan %s already in cache, not producing", scanId)
+			dohScan.Meta.Children = append(dohScan.Meta.Children, scanId)
+			continue
+		}
+
+		if err := ph.Producer.Produce(altSvcScan, GetKafkaTopicFromScan(altSvcScan)); err != nil {
+			logrus.Errorf("failed to produce HTTP/3 scan from Alt-Svc of DoH scan %s: %v", dohScan.Meta.ScanId, err)
+			dohScan.Meta.AddError(custom_errors.NewGenericError(custom_errors.ErrProducerProduceFailed, false).AddInfo(err))
+			continue
+		}
+
+		ScanCache.AddScan(altSvcScan)
+		dohScan.Meta.Children = append(dohScan.Meta.Children, altSvcScan.Meta.ScanId)
+		logrus.Debugf("produced HTTP/3 scan on port %d from Alt-Svc of DoH scan %s", altSvc.Port, dohScan.Meta.ScanId)
+	}
+}
+
 func NewKafkaDoHEventConsumer(
 	config *KafkaConsumerConfig,
 	prod producer.ScanProducer,
@@ -74,8 +170,9 @@ func NewKafkaDoHEventConsumer(
 			return nil, err
 		}
 		return &DoHProcessEventHandler{
-			Producer:     prod,
-			QueryHandler: qh,
+			Producer:        prod,
+			QueryHandler:    qh,
+			ECHQueryHandler: query.NewConventionalDNSQueryHandler(queryConfig),
 		}, nil
 	}
 
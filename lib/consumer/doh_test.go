@@ -6,12 +6,14 @@ import (
 	"testing"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/miekg/dns"
 	"github.com/steffsas/doe-hunter/lib/consumer"
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type mockedDoHQueryHandler struct {
@@ -159,3 +161,221 @@ func TestDoHProcessEventHandler_Process(t *testing.T) {
 		msh.AssertCalled(t, "Store", mock.Anything)
 	})
 }
+
+func TestDoHProcessEventHandler_LookupECHConfigList(t *testing.T) {
+	t.Parallel()
+
+	echConfigList := []byte{0x00, 0x02, 0xfe, 0x0d}
+
+	httpsResponse := &query.ConventionalDNSResponse{
+		Response: &query.DNSResponse{
+			ResponseMsg: &dns.Msg{
+				Answer: []dns.RR{
+					&dns.HTTPS{SVCB: dns.SVCB{
+						Priority: 1,
+						Target:   ".",
+						Value:    []dns.SVCBKeyValue{&dns.SVCBECHConfig{ECH: echConfigList}},
+					}},
+				},
+			},
+		},
+	}
+
+	process := func(t *testing.T, q *query.DoHQuery, echQueryHandler *mockedConventionalDNSQueryHandler) *scan.DoHScan {
+		t.Helper()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		dqh := &mockedDoHQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(&query.DoHResponse{}, nil)
+
+		dph := &consumer.DoHProcessEventHandler{
+			QueryHandler:    dqh,
+			ECHQueryHandler: echQueryHandler,
+		}
+
+		dohScanBytes, _ := json.Marshal(scan.NewDoHScan(q, "parent", "root", "run", "vp"))
+		require.NoError(t, dph.Process(&kafka.Message{Value: dohScanBytes}, msh))
+
+		return msh.Calls[0].Arguments.Get(0).(*scan.DoHScan)
+	}
+
+	t.Run("set ECHConfigList of target name", func(t *testing.T) {
+		t.Parallel()
+
+		mqh := &mockedConventionalDNSQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(httpsResponse, nil)
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+		q.SNI = "dns.example.com"
+
+		stored := process(t, q, mqh)
+
+		assert.Equal(t, echConfigList, stored.Query.ECHConfigList)
+		lookup := mqh.Calls[0].Arguments.Get(0).(*query.ConventionalDNSQuery)
+		assert.Equal(t, "dns.example.com.", lookup.QueryMsg.Question[0].Name)
+		assert.Equal(t, dns.TypeHTTPS, lookup.QueryMsg.Question[0].Qtype)
+	})
+
+	t.Run("keep ECHConfigList of SVCB", func(t *testing.T) {
+		t.Parallel()
+
+		mqh := &mockedConventionalDNSQueryHandler{}
+
+		q := query.NewDoHQuery()
+		q.Host = "dns.example.com"
+		q.ECHConfigList = []byte{0x01}
+
+		stored := process(t, q, mqh)
+
+		assert.Equal(t, []byte{0x01}, stored.Query.ECHConfigList)
+		mqh.AssertNotCalled(t, "Query", mock.Anything)
+	})
+
+	t.Run("no target name", func(t *testing.T) {
+		t.Parallel()
+
+		mqh := &mockedConventionalDNSQueryHandler{}
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+
+		stored := process(t, q, mqh)
+
+		assert.Empty(t, stored.Query.ECHConfigList)
+		mqh.AssertNotCalled(t, "Query", mock.Anything)
+	})
+
+	t.Run("lookup error", func(t *testing.T) {
+		t.Parallel()
+
+		mqh := &mockedConventionalDNSQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(nil, custom_errors.NewQueryError(custom_errors.ErrNoResponse, true))
+
+		q := query.NewDoHQuery()
+		q.Host = "dns.example.com"
+
+		stored := process(t, q, mqh)
+
+		assert.Empty(t, stored.Query.ECHConfigList)
+		require.Len(t, stored.Meta.Errors, 1)
+		assert.False(t, stored.Meta.Errors[0].IsCritical())
+	})
+}
+
+func TestDoHProcessEventHandler_ScheduleAltSvcScans(t *testing.T) {
+	t.Parallel()
+
+	process := func(t *testing.T, q *query.DoHQuery, runId string, res *query.DoHResponse, mpf *mockedProducerFactory) *scan.DoHScan {
+		t.Helper()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		dqh := &mockedDoHQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(res, nil)
+
+		dph := &consumer.DoHProcessEventHandler{
+			Producer:     mpf,
+			QueryHandler: dqh,
+		}
+
+		dohScanBytes, _ := json.Marshal(scan.NewDoHScan(q, "parent", "root", runId, "vp"))
+		require.NoError(t, dph.Process(&kafka.Message{Value: dohScanBytes}, msh))
+
+		return msh.Calls[0].Arguments.Get(0).(*scan.DoHScan)
+	}
+
+	newAltSvcResponse := func(altSvc string) *query.DoHResponse {
+		return &query.DoHResponse{HTTP: &query.DoHHTTPResponse{StatusCode: 200, AltSvc: altSvc}}
+	}
+
+	t.Run("produce HTTP/3 scan", func(t *testing.T) {
+		t.Parallel()
+
+		mpf := &mockedProducerFactory{}
+		mpf.On("Produce", mock.Anything, mock.Anything).Return(nil)
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+		q.SNI = "dns.google"
+
+		stored := process(t, q, "alt-svc-produce", newAltSvcResponse(`h3=":8443"; ma=86400, h3-29=":443", h3="other.example:443"`), mpf)
+
+		mpf.AssertNumberOfCalls(t, "Produce", 1)
+		altSvcScan := mpf.Calls[0].Arguments.Get(0).(*scan.DoHScan)
+		assert.Equal(t, consumer.GetKafkaTopicFromScan(altSvcScan), mpf.Calls[0].Arguments.Get(1))
+		assert.True(t, altSvcScan.Meta.AltSvcDiscovered)
+		assert.Equal(t, query.HTTP_VERSION_3, altSvcScan.Query.HTTPVersion)
+		assert.Equal(t, 8443, altSvcScan.Query.Port)
+		assert.Equal(t, "8.8.8.8", altSvcScan.Query.Host)
+		assert.Equal(t, "dns.google", altSvcScan.Query.SNI)
+		assert.Equal(t, stored.Meta.ScanId, altSvcScan.Meta.ParentScanId)
+		assert.Equal(t, "root", altSvcScan.Meta.RootScanId)
+		assert.Equal(t, []string{altSvcScan.Meta.ScanId}, stored.Meta.Children)
+
+		// the query message is sent as is
+		assert.Nil(t, altSvcScan.Query.QueryMsg.IsEdns0())
+	})
+
+	t.Run("deduplicate through scan cache", func(t *testing.T) {
+		t.Parallel()
+
+		mpf := &mockedProducerFactory{}
+		mpf.On("Produce", mock.Anything, mock.Anything).Return(nil)
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+
+		first := process(t, q, "alt-svc-dedup", newAltSvcResponse(`h3=":443"`), mpf)
+		second := process(t, q, "alt-svc-dedup", newAltSvcResponse(`h3=":443"`), mpf)
+
+		mpf.AssertNumberOfCalls(t, "Produce", 1)
+		assert.Equal(t, first.Meta.Children, second.Meta.Children)
+	})
+
+	t.Run("no Alt-Svc on HTTP/3", func(t *testing.T) {
+		t.Parallel()
+
+		mpf := &mockedProducerFactory{}
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+		q.HTTPVersion = query.HTTP_VERSION_3
+
+		stored := process(t, q, "alt-svc-h3", newAltSvcResponse(`h3=":443"`), mpf)
+
+		mpf.AssertNotCalled(t, "Produce", mock.Anything, mock.Anything)
+		assert.Empty(t, stored.Meta.Children)
+	})
+
+	t.Run("no Alt-Svc header", func(t *testing.T) {
+		t.Parallel()
+
+		mpf := &mockedProducerFactory{}
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+
+		process(t, q, "alt-svc-none", &query.DoHResponse{}, mpf)
+
+		mpf.AssertNotCalled(t, "Produce", mock.Anything, mock.Anything)
+	})
+
+	t.Run("producer error", func(t *testing.T) {
+		t.Parallel()
+
+		mpf := &mockedProducerFactory{}
+		mpf.On("Produce", mock.Anything, mock.Anything).Return(errors.New("producer error"))
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+
+		stored := process(t, q, "alt-svc-error", newAltSvcResponse(`h3=":443"`), mpf)
+
+		assert.Len(t, stored.Meta.Errors, 1)
+		assert.Empty(t, stored.Meta.Children)
+	})
+}
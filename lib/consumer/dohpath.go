@@ -0,0 +1,84 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/storage"
+)
+
+type DoHPathQueryHandler interface {
+	Query(query *query.DoHPathQuery) (response *query.DoHPathResponse, err custom_errors.DoEErrors)
+}
+
+const DEFAULT_DOH_PATH_CONSUMER_GROUP = "doh-path-scan-group"
+
+type DoHPathProcessEventHandler struct {
+	EventProcessHandler
+
+	QueryHandler DoHPathQueryHandler
+
+	// Paths overwrite the paths to probe of all scans (optional)
+	Paths []string
+}
+
+func (ph *DoHPathProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
+	// unmarshal message
+	pathScan := &scan.DoHPathScan{}
+	umErr := json.Unmarshal(msg.Value, pathScan)
+	if umErr != nil {
+		logrus.Errorf("error unmarshalling DoH path scan: %s", umErr)
+		return umErr
+	}
+
+	if pathScan.Query != nil && len(ph.Paths) > 0 {
+		pathScan.Query.Paths = ph.Paths
+	}
+
+	// process
+	var qErr custom_errors.DoEErrors
+	pathScan.Meta.SetStarted()
+	pathScan.Result, qErr = ph.QueryHandler.Query(pathScan.Query)
+	pathScan.Meta.SetFinished()
+	if qErr != nil {
+		logrus.Errorf("error processing DoH path scan %s to %s:%d: %s", pathScan.Meta.ScanId, pathScan.Query.Host, pathScan.Query.Port, qErr.Error())
+		pathScan.Meta.AddError(qErr)
+	}
+
+	// store
+	err := storage.Store(pathScan)
+	if err != nil {
+		logrus.Errorf("failed to store %s: %v", pathScan.Meta.ScanId, err)
+	}
+	return err
+}
+
+func NewKafkaDoHPathEventConsumer(
+	config *KafkaConsumerConfig,
+	storageHandler storage.StorageHandler,
+	queryConfig *query.QueryConfig,
+	paths []string) (kec *KafkaEventConsumer, err error) {
+	if config != nil && config.ConsumerGroup == "" {
+		config.ConsumerGroup = DEFAULT_DOH_PATH_CONSUMER_GROUP
+	}
+
+	newPh := func() (EventProcessHandler, error) {
+		qh, err := query.NewDoHPathQueryHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return &DoHPathProcessEventHandler{
+			QueryHandler: qh,
+			Paths:        paths,
+		}, nil
+	}
+
+	kec, err = NewKafkaEventConsumer(config, newPh, storageHandler)
+
+	return
+}
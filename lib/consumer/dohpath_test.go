@@ -0,0 +1,144 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/steffsas/doe-hunter/lib/consumer"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedDoHPathQueryHandler struct {
+	mock.Mock
+}
+
+func (mqh *mockedDoHPathQueryHandler) Query(q *query.DoHPathQuery) (*query.DoHPathResponse, custom_errors.DoEErrors) {
+	args := mqh.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.DoHPathResponse), nil
+	}
+
+	return args.Get(0).(*query.DoHPathResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+func TestDoHPath_Process(t *testing.T) {
+	t.Parallel()
+
+	getScanBytes := func() []byte {
+		q := query.NewDoHPathQuery()
+		q.Host = "8.8.8.8"
+
+		b, _ := json.Marshal(scan.NewDoHPathScan(q, "parent", "root", "run", "vp"))
+		return b
+	}
+
+	t.Run("process valid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		res := &query.DoHPathResponse{
+			ValidPaths:       []string{"/dns-query"},
+			DefaultPathValid: true,
+		}
+		mqh := &mockedDoHPathQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(res, nil)
+
+		ph := &consumer.DoHPathProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Nil(t, err)
+		require.Len(t, msh.Calls, 1)
+		stored := msh.Calls[0].Arguments.Get(0).(*scan.DoHPathScan)
+		assert.Equal(t, res, stored.Result)
+		assert.Equal(t, query.DEFAULT_DOH_DISCOVERY_PATHS, stored.Query.Paths)
+		assert.Empty(t, stored.Meta.Errors)
+	})
+
+	t.Run("configured paths", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		mqh := &mockedDoHPathQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(&query.DoHPathResponse{}, nil)
+
+		ph := &consumer.DoHPathProcessEventHandler{
+			QueryHandler: mqh,
+			Paths:        []string{"/doh"},
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Nil(t, err)
+		q := mqh.Calls[0].Arguments.Get(0).(*query.DoHPathQuery)
+		assert.Equal(t, []string{"/doh"}, q.Paths)
+	})
+
+	t.Run("process invalid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		mqh := &mockedDoHPathQueryHandler{}
+
+		ph := &consumer.DoHPathProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: []byte("some invalid bytes")}, msh)
+
+		assert.Error(t, err)
+		msh.AssertNotCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("process query error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		mqh := &mockedDoHPathQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(&query.DoHPathResponse{}, custom_errors.NewQueryError(custom_errors.ErrNoValidDoHPath, false))
+
+		ph := &consumer.DoHPathProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Nil(t, err)
+		stored := msh.Calls[0].Arguments.Get(0).(*scan.DoHPathScan)
+		assert.Len(t, stored.Meta.Errors, 1)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(errors.New("storage error"))
+
+		mqh := &mockedDoHPathQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(&query.DoHPathResponse{}, nil)
+
+		ph := &consumer.DoHPathProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Error(t, err)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"slices"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/miekg/dns"
@@ -25,6 +26,14 @@ type EDSRProcessConsumer struct {
 	EventProcessHandler
 
 	QueryHandler query.ConventionalDNSQueryHandlerI
+
+	// handlers to query the hops over the protocol being redirected, hops are queried unencrypted only if nil
+	DoHQueryHandler DoHQueryHandler
+	DoTQueryHandler DoTQueryHandler
+	DoQQueryHandler DoQQueryHandler
+
+	// TransportHandler sends queries over DoT, DoH and DoQ if the scan asks for it
+	TransportHandler *query.DNSTransportHandler
 }
 
 func (edsr *EDSRProcessConsumer) Process(msg *kafka.Message, sh storage.StorageHandler) error {
@@ -82,6 +91,8 @@ func (edsr *EDSRProcessConsumer) StartEDSR(s *scan.EDSRScan) {
 
 	// -1 because NewEDSRHop takes parentHop counter and increments it by 1
 	initialHop := scan.NewEDSRHop(-1, q)
+	initialHop.Transport = s.Transport
+	initialHop.SetEncryptedQuery(s.Protocol, s.TargetName, s.SVCB)
 
 	s.Result.Redirections = append(s.Result.Redirections, initialHop)
 
@@ -128,19 +139,39 @@ func (edsr *EDSRProcessConsumer) QueryHop(
 		return nil, err
 	}
 
-	// query
-	res, err := edsr.QueryHandler.Query(hop.Query)
+	// query over the protocol being redirected
+	encryptedMsg := edsr.queryEncrypted(hop)
+
+	// query unencrypted to compare the answers
+	res, err := QueryOverTransport(edsr.QueryHandler, edsr.TransportHandler, hop.Query, hop.Transport)
 	if err != nil {
 		hop.Errors = append(hop.Errors, err)
-		return nil, err
+		if encryptedMsg == nil {
+			return nil, err
+		}
 	}
 
 	// add result to hop
 	hop.Result = res
 
+	// the encrypted response is authoritative for the redirection, the unencrypted one is the fallback
+	var unencryptedMsg *dns.Msg
+	if res != nil && res.Response != nil {
+		unencryptedMsg = res.Response.ResponseMsg
+	}
+
+	responseMsg := encryptedMsg
+	if responseMsg == nil {
+		responseMsg = unencryptedMsg
+	} else if unencryptedMsg != nil {
+		hop.AnswersDiffer = responsesDiffer(encryptedMsg, unencryptedMsg)
+	}
+
 	// check whether the SVCBs contain the necessary DoE protocol in this hop
 	// errColl will contain a critical error if the resolver does not advertise the protocol
-	svcbRR, errColl := scan.CheckForDoEProtocol(scanId, targetName, protocol, res)
+	svcbRR, errColl := scan.CheckForDoEProtocol(scanId, targetName, protocol, &query.ConventionalDNSResponse{
+		Response: &query.DNSResponse{ResponseMsg: responseMsg},
+	})
 	if len(errColl) > 0 {
 		hop.Errors = append(hop.Errors, errColl...)
 		if custom_errors.ContainsCriticalErr(errColl) {
@@ -151,7 +182,7 @@ func (edsr *EDSRProcessConsumer) QueryHop(
 	// let's safe this for later analysis
 	hop.ConsideredSVCB = svcbRR
 
-	if len(res.Response.ResponseMsg.Extra) == 0 {
+	if len(responseMsg.Extra) == 0 {
 		// we have no glue records, so we can terminate according to the protocol
 		hop.Errors = append(hop.Errors, custom_errors.NewQueryError(custom_errors.ErrNoGlueRecords, false))
 		return nil, nil
@@ -160,7 +191,7 @@ func (edsr *EDSRProcessConsumer) QueryHop(
 	// check if we have a loop
 	intersectingIPs := []*net.IP{}
 	differenceIPs := []*net.IP{}
-	for _, glueRecord := range res.Response.ResponseMsg.Extra {
+	for _, glueRecord := range responseMsg.Extra {
 		resGlueRR := &scan.GlueRecord{
 			IP:   nil,
 			Host: glueRecord.Header().Name,
@@ -209,6 +240,8 @@ func (edsr *EDSRProcessConsumer) QueryHop(
 
 		// create new child node (hop)
 		newChild := scan.NewEDSRHop(hop.Hop, q)
+		newChild.Transport = hop.Transport
+		newChild.SetEncryptedQuery(protocol, targetName, svcbRR)
 
 		// set child node
 		hop.ChildNodes = append(hop.ChildNodes, newChild.Id)
@@ -221,6 +254,69 @@ func (edsr *EDSRProcessConsumer) QueryHop(
 	return
 }
 
+// queryEncrypted queries the hop over the protocol being redirected, it returns nil if the hop could not be queried
+func (edsr *EDSRProcessConsumer) queryEncrypted(hop *scan.EDSRHop) *dns.Msg {
+	var res *query.DoEResponse
+	var err custom_errors.DoEErrors
+
+	switch {
+	case hop.DoHQuery != nil && edsr.DoHQueryHandler != nil:
+		var dohRes *query.DoHResponse
+		dohRes, err = edsr.DoHQueryHandler.Query(hop.DoHQuery)
+		if dohRes != nil {
+			res = &dohRes.DoEResponse
+		}
+	case hop.DoTQuery != nil && edsr.DoTQueryHandler != nil:
+		var dotRes *query.DoTResponse
+		dotRes, err = edsr.DoTQueryHandler.Query(hop.DoTQuery)
+		if dotRes != nil {
+			res = &dotRes.DoEResponse
+		}
+	case hop.DoQQuery != nil && edsr.DoQQueryHandler != nil:
+		var doqRes *query.DoQResponse
+		doqRes, err = edsr.DoQQueryHandler.Query(hop.DoQQuery)
+		if doqRes != nil {
+			res = &doqRes.DoEResponse
+		}
+	default:
+		return nil
+	}
+
+	hop.EncryptedResult = res
+	if err != nil {
+		logrus.Warnf("EDSR: encrypted query to hop %s failed, fall back to unencrypted response: %s", hop.Query.Host, err.Error())
+		hop.Errors = append(hop.Errors, err)
+		if err.IsCritical() {
+			return nil
+		}
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	return res.ResponseMsg
+}
+
+// responsesDiffer compares the answer and glue records of both responses regardless of their order and TTL
+func responsesDiffer(a *dns.Msg, b *dns.Msg) bool {
+	normalize := func(msg *dns.Msg) []string {
+		rrs := []string{}
+		for _, rr := range append(slices.Clone(msg.Answer), msg.Extra...) {
+			if rr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			rr = dns.Copy(rr)
+			rr.Header().Ttl = 0
+			rrs = append(rrs, rr.String())
+		}
+		slices.Sort(rrs)
+		return rrs
+	}
+
+	return !slices.Equal(normalize(a), normalize(b))
+}
+
 func ConnectHops(hops []*scan.EDSRHop) {
 	// connect hops
 	for _, hop := range hops {
@@ -260,8 +356,27 @@ func NewKafkaEDSREventConsumer(config *KafkaConsumerConfig, storageHandler stora
 	}
 
 	newPh := func() (EventProcessHandler, error) {
+		dohQueryHandler, err := query.NewDoHQueryHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		doqQueryHandler, err := query.NewDoQQueryHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		th, err := query.NewDNSTransportHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
 		return &EDSRProcessConsumer{
-			QueryHandler: query.NewConventionalDNSQueryHandler(queryConfig),
+			QueryHandler:     query.NewConventionalDNSQueryHandler(queryConfig),
+			TransportHandler: th,
+			DoHQueryHandler:  dohQueryHandler,
+			DoTQueryHandler:  query.NewDefaultDoTHandler(queryConfig),
+			DoQQueryHandler:  doqQueryHandler,
 		}, nil
 	}
 
@@ -17,6 +17,7 @@ import (
 	"github.com/steffsas/doe-hunter/lib/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type mockedConventionalDNSQueryHandler struct {
@@ -1559,3 +1560,110 @@ func TestEDSR_PRocessScan(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestEDSR_EncryptedHops(t *testing.T) {
+	t.Parallel()
+
+	targetName := "dns.google."
+	host := "8.8.8.8"
+
+	getSVCBResponse := func(glue ...net.IP) *dns.Msg {
+		msg := &dns.Msg{
+			Answer: []dns.RR{
+				&dns.SVCB{
+					Hdr:      dns.RR_Header{Name: targetName, Rrtype: dns.TypeSVCB, Class: dns.ClassINET, Ttl: 300},
+					Priority: 1,
+					Target:   targetName,
+					Value: []dns.SVCBKeyValue{
+						&dns.SVCBAlpn{Alpn: []string{"dot"}},
+						&dns.SVCBPort{Port: 8853},
+					},
+				},
+			},
+		}
+		for _, ip := range glue {
+			msg.Extra = append(msg.Extra, &dns.A{
+				Hdr: dns.RR_Header{Name: targetName, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   ip,
+			})
+		}
+		return msg
+	}
+
+	t.Run("redirect over DoT", func(t *testing.T) {
+		t.Parallel()
+
+		mqh := &mockedConventionalDNSQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{
+			Response: &query.DNSResponse{ResponseMsg: getSVCBResponse()},
+		}, nil)
+
+		mdqh := &mockedDoTQueryHandler{}
+		encryptedRes := &query.DoTResponse{}
+		encryptedRes.ResponseMsg = getSVCBResponse(net.IP{8, 8, 4, 4})
+		mdqh.On("Query", mock.MatchedBy(func(q *query.DoTQuery) bool {
+			return q.Host == host
+		})).Return(encryptedRes, nil)
+		lastRes := &query.DoTResponse{}
+		lastRes.ResponseMsg = getSVCBResponse()
+		mdqh.On("Query", mock.MatchedBy(func(q *query.DoTQuery) bool {
+			return q.Host == "8.8.4.4"
+		})).Return(lastRes, nil)
+
+		s := scan.NewEDSRScan(targetName, host, "dot", "", "", "", "")
+
+		pc := &consumer.EDSRProcessConsumer{
+			QueryHandler:    mqh,
+			DoTQueryHandler: mdqh,
+		}
+
+		pc.StartEDSR(s)
+
+		require.Len(t, s.Result.Redirections, 2, "should have followed the glue records of the encrypted response")
+		assert.True(t, s.Result.EDSRDetected)
+
+		firstHop := s.Result.Redirections[0]
+		require.NotNil(t, firstHop.DoTQuery)
+		assert.Equal(t, query.DEFAULT_DOT_PORT, firstHop.DoTQuery.Port)
+		assert.Equal(t, targetName, firstHop.DoTQuery.SNI)
+		assert.Equal(t, firstHop.Query.QueryMsg.Question, firstHop.DoTQuery.QueryMsg.Question)
+		assert.Equal(t, &encryptedRes.DoEResponse, firstHop.EncryptedResult)
+		assert.True(t, firstHop.AnswersDiffer, "unencrypted response lacks the glue record")
+
+		secondHop := s.Result.Redirections[1]
+		require.NotNil(t, secondHop.DoTQuery)
+		assert.Equal(t, "8.8.4.4", secondHop.DoTQuery.Host)
+		assert.Equal(t, 8853, secondHop.DoTQuery.Port, "should have used the port of the previous hop's SVCB")
+		assert.False(t, secondHop.AnswersDiffer)
+	})
+
+	t.Run("fall back to unencrypted response", func(t *testing.T) {
+		t.Parallel()
+
+		mqh := &mockedConventionalDNSQueryHandler{}
+		mqh.On("Query", mock.MatchedBy(func(q *query.ConventionalDNSQuery) bool {
+			return q.Host == host
+		})).Return(&query.ConventionalDNSResponse{
+			Response: &query.DNSResponse{ResponseMsg: getSVCBResponse(net.IP{8, 8, 4, 4})},
+		}, nil)
+		mqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{
+			Response: &query.DNSResponse{ResponseMsg: getSVCBResponse()},
+		}, nil)
+
+		mdqh := &mockedDoTQueryHandler{}
+		mdqh.On("Query", mock.Anything).Return(&query.DoTResponse{}, custom_errors.NewQueryError(custom_errors.ErrNoResponse, true))
+
+		s := scan.NewEDSRScan(targetName, host, "dot", "", "", "", "")
+
+		pc := &consumer.EDSRProcessConsumer{
+			QueryHandler:    mqh,
+			DoTQueryHandler: mdqh,
+		}
+
+		pc.StartEDSR(s)
+
+		require.Len(t, s.Result.Redirections, 2)
+		assert.NotEmpty(t, s.Result.Redirections[0].Errors, "should have recorded the failed encrypted query")
+		assert.False(t, s.Result.Redirections[0].AnswersDiffer)
+	})
+}
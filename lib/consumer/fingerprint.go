@@ -6,6 +6,7 @@ import (
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/sirupsen/logrus"
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
 	"github.com/steffsas/doe-hunter/lib/storage"
@@ -21,11 +22,30 @@ type DNSQueryHandler interface {
 	Query(query *query.ConventionalDNSQuery) (response *query.ConventionalDNSResponse, err custom_errors.DoEErrors)
 }
 
+type CookieQueryHandler interface {
+	Query(query *query.CookieQuery, transport *query.DNSTransportDescriptor) (response *query.CookieResponse, err custom_errors.DoEErrors)
+}
+
+type BannerQueryHandler interface {
+	Query(query *query.BannerQuery) (response *query.BannerResponse, err custom_errors.DoEErrors)
+}
+
 type FingerprintProcessEventHandler struct {
 	EventProcessHandler
 
-	DNSQueryHandler DNSQueryHandler
-	SSHQueryHandler SSHQueryHandler
+	DNSQueryHandler    DNSQueryHandler
+	SSHQueryHandler    SSHQueryHandler
+	CookieQueryHandler CookieQueryHandler
+	BannerQueryHandler BannerQueryHandler
+	// TransportHandler sends queries over DoT, DoH and DoQ if the scan asks for it
+	TransportHandler *query.DNSTransportHandler
+
+	// RuleSet classifies the software together with the rules of the version patterns (default: fingerprint.DEFAULT_RULE_SET)
+	RuleSet *fingerprint.RuleSet
+	// VersionPatterns normalize the version strings (default: scan.DEFAULT_VERSION_PATTERN_TABLE)
+	VersionPatterns *scan.VersionPatternTable
+	// BannerTargets are grabbed from scans without banner probes (default: none)
+	BannerTargets []*query.BannerTarget
 }
 
 func (ph *FingerprintProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
@@ -48,17 +68,59 @@ func (ph *FingerprintProcessEventHandler) Process(msg *kafka.Message, storage st
 	}
 
 	// query version bind
-	fingerprintScan.VersionBindResult, qErr = ph.DNSQueryHandler.Query(fingerprintScan.VersionBindQuery)
+	fingerprintScan.VersionBindResult, qErr = QueryOverTransport(ph.DNSQueryHandler, ph.TransportHandler, fingerprintScan.VersionBindQuery, fingerprintScan.Transport)
 	if qErr != nil {
 		fingerprintScan.Meta.AddError(qErr)
 	}
 
 	// query version server
-	fingerprintScan.VersionServerResult, qErr = ph.DNSQueryHandler.Query(fingerprintScan.VersionServerQuery)
+	fingerprintScan.VersionServerResult, qErr = QueryOverTransport(ph.DNSQueryHandler, ph.TransportHandler, fingerprintScan.VersionServerQuery, fingerprintScan.Transport)
 	if qErr != nil {
 		fingerprintScan.Meta.AddError(qErr)
 	}
 
+	// query DNS cookie support, scans produced before the cookie facet have no cookie query
+	if fingerprintScan.CookieQuery != nil {
+		fingerprintScan.CookieResult, qErr = ph.CookieQueryHandler.Query(fingerprintScan.CookieQuery, fingerprintScan.Transport)
+		if qErr != nil {
+			fingerprintScan.Meta.AddError(qErr)
+		}
+	}
+
+	// behavioural probes, unanswered probes are observations rather than scan errors
+	for _, probe := range fingerprintScan.Probes {
+		probe.SetUDPSize()
+		probe.Result, qErr = QueryOverTransport(ph.DNSQueryHandler, ph.TransportHandler, probe.Query, fingerprintScan.Transport)
+		if qErr != nil {
+			probe.Error = qErr.Error()
+		}
+	}
+
+	// banner probes, closed ports are observations rather than scan errors
+	if fingerprintScan.Banners == nil && fingerprintScan.SSHQuery != nil {
+		fingerprintScan.Banners = scan.NewFingerprintBanners(fingerprintScan.SSHQuery.Host, ph.BannerTargets)
+	}
+	for _, banner := range fingerprintScan.Banners {
+		banner.Result, qErr = ph.BannerQueryHandler.Query(banner.Query)
+		if qErr != nil {
+			banner.Error = qErr.Error()
+		}
+	}
+
+	ruleSet := ph.RuleSet
+	if ruleSet == nil {
+		ruleSet = fingerprint.DEFAULT_RULE_SET
+	}
+
+	versionPatterns := ph.VersionPatterns
+	if versionPatterns == nil {
+		versionPatterns = scan.DEFAULT_VERSION_PATTERN_TABLE
+	}
+
+	// the version strings are attributed by the pattern table in both cases
+	fingerprintScan.Classify(ruleSet, versionPatterns)
+	fingerprintScan.Normalize(versionPatterns)
+
 	fingerprintScan.Meta.SetFinished()
 
 	// store
@@ -72,15 +134,29 @@ func (ph *FingerprintProcessEventHandler) Process(msg *kafka.Message, storage st
 func NewKafkaFingerprintEventConsumer(
 	config *KafkaConsumerConfig,
 	storageHandler storage.StorageHandler,
-	queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+	queryConfig *query.QueryConfig,
+	ruleSet *fingerprint.RuleSet,
+	versionPatterns *scan.VersionPatternTable,
+	bannerTargets []*query.BannerTarget) (kec *KafkaEventConsumer, err error) {
 	if config != nil && config.ConsumerGroup == "" {
 		config.ConsumerGroup = DEFAULT_FINGERPRINT_CONSUMER_GROUP
 	}
 
 	newPh := func() (EventProcessHandler, error) {
+		th, err := query.NewDNSTransportHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
 		return &FingerprintProcessEventHandler{
-			SSHQueryHandler: query.NewSSHQueryHandler(queryConfig),
-			DNSQueryHandler: query.NewConventionalDNSQueryHandler(queryConfig),
+			SSHQueryHandler:    query.NewSSHQueryHandler(queryConfig),
+			DNSQueryHandler:    query.NewConventionalDNSQueryHandler(queryConfig),
+			CookieQueryHandler: &query.CookieQueryHandler{TransportHandler: th},
+			BannerQueryHandler: query.NewBannerQueryHandler(queryConfig),
+			TransportHandler:   th,
+			RuleSet:            ruleSet,
+			VersionPatterns:    versionPatterns,
+			BannerTargets:      bannerTargets,
 		}, nil
 	}
 
@@ -6,8 +6,10 @@ import (
 	"testing"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/miekg/dns"
 	"github.com/steffsas/doe-hunter/lib/consumer"
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
 	"github.com/stretchr/testify/assert"
@@ -51,6 +53,34 @@ func (mdqh *mockedDNSQueryHandler) Query(q *query.ConventionalDNSQuery) (respons
 	return args.Get(0).(*query.ConventionalDNSResponse), args.Get(1).(custom_errors.DoEErrors)
 }
 
+type mockedCookieQueryHandler struct {
+	mock.Mock
+}
+
+func (mcqh *mockedCookieQueryHandler) Query(q *query.CookieQuery, transport *query.DNSTransportDescriptor) (*query.CookieResponse, custom_errors.DoEErrors) {
+	args := mcqh.Called(q, transport)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.CookieResponse), nil
+	}
+
+	return args.Get(0).(*query.CookieResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+type mockedBannerQueryHandler struct {
+	mock.Mock
+}
+
+func (mbqh *mockedBannerQueryHandler) Query(q *query.BannerQuery) (*query.BannerResponse, custom_errors.DoEErrors) {
+	args := mbqh.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.BannerResponse), nil
+	}
+
+	return args.Get(0).(*query.BannerResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
 func TestFingerprintProcessEventHandler_Process(t *testing.T) {
 	t.Parallel()
 
@@ -97,6 +127,128 @@ func TestFingerprintProcessEventHandler_Process(t *testing.T) {
 		assert.NotNil(t, fps.SSHResult)
 		assert.NotNil(t, fps.VersionBindResult)
 		assert.NotNil(t, fps.VersionServerResult)
+		require.NotNil(t, fps.Classification)
+		assert.Equal(t, fingerprint.SOFTWARE_UNKNOWN, fps.Classification.Software)
+		assert.Nil(t, fps.VersionBind, "should not normalize without response")
+	})
+
+	t.Run("probes and classification", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		versionMsg := new(dns.Msg)
+		versionMsg.Answer = []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: "version.bind.", Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{"unbound 1.19.2"},
+		}}
+
+		dqh := mockedDNSQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: versionMsg}}, nil)
+
+		sqh := mockedSSHQueryHandler{}
+		sqh.On("Query", mock.Anything).Return(&query.SSHResponse{}, nil)
+
+		cqh := mockedCookieQueryHandler{}
+		cqh.On("Query", mock.Anything, mock.Anything).Return(&query.CookieResponse{}, nil)
+
+		dph := &consumer.FingerprintProcessEventHandler{
+			DNSQueryHandler:    &dqh,
+			SSHQueryHandler:    &sqh,
+			CookieQueryHandler: &cqh,
+		}
+
+		fingerprintScanBytes, _ := json.Marshal(scan.NewFingerprintScan("8.8.8.8", "parent", "root", "run", "vp"))
+
+		err := dph.Process(&kafka.Message{Value: fingerprintScanBytes}, &msh)
+		assert.NoError(t, err)
+
+		fps := msh.Calls[0].Arguments[0].(*scan.FingerprintScan)
+		for _, probe := range fps.Probes {
+			assert.NotNil(t, probe.Result, "probe %s should have been sent", probe.Name)
+		}
+		dqh.AssertNumberOfCalls(t, "Query", len(fps.Probes)+2)
+
+		require.NotNil(t, fps.Classification)
+		assert.Equal(t, fingerprint.SOFTWARE_UNBOUND, fps.Classification.Software)
+		assert.Equal(t, "1.19.2", fps.Classification.Version)
+
+		require.NotNil(t, fps.VersionBind)
+		assert.Equal(t, "Unbound", fps.VersionBind.Product)
+		assert.Equal(t, "1.19.2", fps.VersionBind.Version)
+		assert.Equal(t, scan.DEFAULT_VERSION_PATTERN_TABLE.Revision, fps.VersionBind.Revision)
+	})
+
+	t.Run("custom rule set", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		dqh := mockedDNSQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{}, custom_errors.NewQueryError(custom_errors.ErrNoResponse, true))
+
+		sqh := mockedSSHQueryHandler{}
+		sqh.On("Query", mock.Anything).Return(&query.SSHResponse{}, nil)
+
+		cqh := mockedCookieQueryHandler{}
+		cqh.On("Query", mock.Anything, mock.Anything).Return(&query.CookieResponse{}, nil)
+
+		ruleSet, err := fingerprint.ParseRuleSet([]byte(`{"revision": 2, "rules": [
+			{"name": "silent", "software": "Silent DNS", "probe": "tc_set", "signature": "^no_response$", "weight": 0.5}
+		]}`))
+		require.NoError(t, err)
+
+		dph := &consumer.FingerprintProcessEventHandler{
+			DNSQueryHandler:    &dqh,
+			SSHQueryHandler:    &sqh,
+			CookieQueryHandler: &cqh,
+			RuleSet:            ruleSet,
+		}
+
+		fingerprintScanBytes, _ := json.Marshal(scan.NewFingerprintScan("8.8.8.8", "parent", "root", "run", "vp"))
+
+		err = dph.Process(&kafka.Message{Value: fingerprintScanBytes}, &msh)
+		assert.NoError(t, err)
+
+		fps := msh.Calls[0].Arguments[0].(*scan.FingerprintScan)
+		require.NotNil(t, fps.Classification)
+		assert.Equal(t, "Silent DNS", fps.Classification.Software)
+		assert.Equal(t, 2, fps.Classification.Revision)
+	})
+
+	t.Run("unanswered probes", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		dqh := mockedDNSQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{}, custom_errors.NewQueryError(custom_errors.ErrNoResponse, true))
+
+		sqh := mockedSSHQueryHandler{}
+		sqh.On("Query", mock.Anything).Return(&query.SSHResponse{}, nil)
+
+		cqh := mockedCookieQueryHandler{}
+		cqh.On("Query", mock.Anything, mock.Anything).Return(&query.CookieResponse{}, nil)
+
+		dph := &consumer.FingerprintProcessEventHandler{
+			DNSQueryHandler:    &dqh,
+			SSHQueryHandler:    &sqh,
+			CookieQueryHandler: &cqh,
+		}
+
+		fingerprintScanBytes, _ := json.Marshal(scan.NewFingerprintScan("8.8.8.8", "parent", "root", "run", "vp"))
+
+		err := dph.Process(&kafka.Message{Value: fingerprintScanBytes}, &msh)
+		assert.NoError(t, err)
+
+		fps := msh.Calls[0].Arguments[0].(*scan.FingerprintScan)
+		assert.Len(t, fps.Meta.Errors, 2, "should only add the version.bind and version.server errors")
+		for _, probe := range fps.Probes {
+			assert.Contains(t, probe.Error, custom_errors.ErrNoResponse.Error())
+		}
 	})
 
 	t.Run("invalid message", func(t *testing.T) {
@@ -219,6 +371,130 @@ func TestFingerprintProcessEventHandler_Process(t *testing.T) {
 		assert.Greater(t, len(fps.Meta.Errors), 0)
 	})
 
+	t.Run("cookie query", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		dqh := mockedDNSQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{}, nil)
+
+		sqh := mockedSSHQueryHandler{}
+		sqh.On("Query", mock.Anything).Return(&query.SSHResponse{}, nil)
+
+		cqh := mockedCookieQueryHandler{}
+		cqh.On("Query", mock.Anything, mock.Anything).Return(&query.CookieResponse{CookieSupported: true}, nil)
+
+		dph := &consumer.FingerprintProcessEventHandler{
+			DNSQueryHandler:    &dqh,
+			SSHQueryHandler:    &sqh,
+			CookieQueryHandler: &cqh,
+		}
+
+		fingerprintScan := scan.NewFingerprintScan("8.8.8.8", "parent", "root", "run", "vp")
+		fingerprintScan.Transport = &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DO53, Port: 5353}
+
+		// marshal to bytes
+		fingerprintScanBytes, _ := json.Marshal(fingerprintScan)
+		msg := &kafka.Message{
+			Value: fingerprintScanBytes,
+		}
+
+		err := dph.Process(msg, &msh)
+		assert.NoError(t, err)
+
+		transport := cqh.Calls[0].Arguments[1].(*query.DNSTransportDescriptor)
+		assert.Equal(t, 5353, transport.Port, "should query cookies over the transport of the scan")
+
+		fps := msh.Calls[0].Arguments[0].(*scan.FingerprintScan)
+		require.NotNil(t, fps.CookieResult)
+		assert.True(t, fps.CookieResult.CookieSupported)
+		assert.Empty(t, fps.Meta.Errors)
+	})
+
+	t.Run("cookie query error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		dqh := mockedDNSQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{}, nil)
+
+		sqh := mockedSSHQueryHandler{}
+		sqh.On("Query", mock.Anything).Return(&query.SSHResponse{}, nil)
+
+		cqh := mockedCookieQueryHandler{}
+		cqh.On("Query", mock.Anything, mock.Anything).Return(&query.CookieResponse{}, custom_errors.NewQueryError(custom_errors.ErrNoResponse, true))
+
+		dph := &consumer.FingerprintProcessEventHandler{
+			DNSQueryHandler:    &dqh,
+			SSHQueryHandler:    &sqh,
+			CookieQueryHandler: &cqh,
+		}
+
+		// marshal to bytes
+		fingerprintScanBytes, _ := json.Marshal(scan.NewFingerprintScan("8.8.8.8", "parent", "root", "run", "vp"))
+		msg := &kafka.Message{
+			Value: fingerprintScanBytes,
+		}
+
+		err := dph.Process(msg, &msh)
+		assert.NoError(t, err)
+
+		fps := msh.Calls[0].Arguments[0].(*scan.FingerprintScan)
+		assert.NotNil(t, fps.CookieResult)
+		assert.Len(t, fps.Meta.Errors, 1)
+	})
+
+	t.Run("banners", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		dqh := mockedDNSQueryHandler{}
+		dqh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{}, nil)
+
+		sqh := mockedSSHQueryHandler{}
+		sqh.On("Query", mock.Anything).Return(&query.SSHResponse{}, nil)
+
+		cqh := mockedCookieQueryHandler{}
+		cqh.On("Query", mock.Anything, mock.Anything).Return(&query.CookieResponse{}, nil)
+
+		bqh := mockedBannerQueryHandler{}
+		bqh.On("Query", mock.MatchedBy(func(q *query.BannerQuery) bool {
+			return q.Protocol == query.BANNER_PROTOCOL_HTTP
+		})).Return(&query.BannerResponse{HTTP: &query.HTTPBanner{Title: "Router"}}, nil)
+		bqh.On("Query", mock.Anything).Return(&query.BannerResponse{}, custom_errors.NewQueryError(custom_errors.ErrBannerGrabFailed, false))
+
+		targets, err := query.ParseBannerTargets("http:80,telnet:23")
+		require.NoError(t, err)
+
+		dph := &consumer.FingerprintProcessEventHandler{
+			DNSQueryHandler:    &dqh,
+			SSHQueryHandler:    &sqh,
+			CookieQueryHandler: &cqh,
+			BannerQueryHandler: &bqh,
+			BannerTargets:      targets,
+		}
+
+		fingerprintScanBytes, _ := json.Marshal(scan.NewFingerprintScan("8.8.8.8", "parent", "root", "run", "vp"))
+
+		err = dph.Process(&kafka.Message{Value: fingerprintScanBytes}, &msh)
+		assert.NoError(t, err)
+
+		fps := msh.Calls[0].Arguments[0].(*scan.FingerprintScan)
+		require.Len(t, fps.Banners, 2)
+		assert.Equal(t, "8.8.8.8", fps.Banners[0].Query.Host)
+		require.NotNil(t, fps.Banners[0].Result.HTTP)
+		assert.Equal(t, "Router", fps.Banners[0].Result.HTTP.Title)
+		assert.Empty(t, fps.Banners[0].Error)
+		assert.NotEmpty(t, fps.Banners[1].Error, "closed ports should be recorded at the banner")
+		assert.Empty(t, fps.Meta.Errors, "closed ports should not be scan errors")
+	})
+
 	t.Run("storage error", func(t *testing.T) {
 		t.Parallel()
 
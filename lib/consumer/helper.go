@@ -5,6 +5,7 @@ import (
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
 	k "github.com/steffsas/doe-hunter/lib/kafka"
 	"github.com/steffsas/doe-hunter/lib/producer"
+	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
 )
 
@@ -25,12 +26,30 @@ func RedoDoEScanOnCertError(err custom_errors.DoEErrors, oldScan scan.DoEScan, n
 	}
 }
 
+// QueryOverTransport sends the query over the given transport, Do53 queries are sent with the conventional query handler
+func QueryOverTransport(
+	qh query.ConventionalDNSQueryHandlerI,
+	th *query.DNSTransportHandler,
+	q *query.ConventionalDNSQuery,
+	transport *query.DNSTransportDescriptor,
+) (*query.ConventionalDNSResponse, custom_errors.DoEErrors) {
+	handler := query.DNSTransportHandler{}
+	if th != nil {
+		handler = *th
+	}
+	handler.Do53 = qh
+
+	return handler.Query(q, transport)
+}
+
 func GetKafkaVPTopic(topic string, vantagePoint string) string {
 	return topic + "-" + vantagePoint
 }
 
 func GetKafkaTopicFromScan(s scan.Scan) string {
 	switch s.GetType() {
+	case scan.DDR_SCAN_TYPE:
+		return GetKafkaVPTopic(k.DEFAULT_DDR_TOPIC, s.GetMetaInformation().VantagePoint)
 	case scan.DOH_SCAN_TYPE:
 		return GetKafkaVPTopic(k.DEFAULT_DOH_TOPIC, s.GetMetaInformation().VantagePoint)
 	case scan.DOQ_SCAN_TYPE:
@@ -45,6 +64,18 @@ func GetKafkaTopicFromScan(s scan.Scan) string {
 		return GetKafkaVPTopic(k.DEFAULT_DDR_DNSSEC_TOPIC, s.GetMetaInformation().VantagePoint)
 	case scan.RESINFO_SCAN_TYPE:
 		return GetKafkaVPTopic(k.DEFAULT_RESINFO_TOPIC, s.GetMetaInformation().VantagePoint)
+	case scan.ODOH_SCAN_TYPE:
+		return GetKafkaVPTopic(k.DEFAULT_ODOH_TOPIC, s.GetMetaInformation().VantagePoint)
+	case scan.OHTTP_SCAN_TYPE:
+		return GetKafkaVPTopic(k.DEFAULT_OHTTP_TOPIC, s.GetMetaInformation().VantagePoint)
+	case scan.TLS_ENUM_SCAN_TYPE:
+		return GetKafkaVPTopic(k.DEFAULT_TLS_ENUM_TOPIC, s.GetMetaInformation().VantagePoint)
+	case scan.SESSION_SCAN_TYPE:
+		return GetKafkaVPTopic(k.DEFAULT_SESSION_TOPIC, s.GetMetaInformation().VantagePoint)
+	case scan.RESUMPTION_SCAN_TYPE:
+		return GetKafkaVPTopic(k.DEFAULT_RESUMPTION_TOPIC, s.GetMetaInformation().VantagePoint)
+	case scan.DOH_PATH_SCAN_TYPE:
+		return GetKafkaVPTopic(k.DEFAULT_DOH_PATH_TOPIC, s.GetMetaInformation().VantagePoint)
 	default:
 		return ""
 	}
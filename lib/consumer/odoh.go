@@ -0,0 +1,90 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/producer"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/storage"
+)
+
+const DEFAULT_ODOH_CONSUMER_GROUP = "odoh-scan-group"
+
+type ODoHQueryHandler interface {
+	Query(query *query.ODoHQuery) (response *query.ODoHResponse, err custom_errors.DoEErrors)
+}
+
+type ODoHProcessEventHandler struct {
+	EventProcessHandler
+
+	Producer     producer.ScanProducer
+	QueryHandler ODoHQueryHandler
+
+	// Proxy is the oblivious proxy to use for scans that do not specify one
+	Proxy string
+}
+
+func (ph *ODoHProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
+	// unmarshal message
+	odohScan := &scan.ODoHScan{}
+	err := json.Unmarshal(msg.Value, odohScan)
+	if err != nil {
+		logrus.Errorf("error unmarshaling ODoH scan: %s", err.Error())
+		return err
+	}
+
+	if odohScan.Query != nil && odohScan.Query.Proxy == "" {
+		odohScan.Query.Proxy = ph.Proxy
+	}
+
+	// process
+	var qErr custom_errors.DoEErrors
+	odohScan.Meta.SetStarted()
+	odohScan.Result, qErr = ph.QueryHandler.Query(odohScan.Query)
+	odohScan.Meta.SetFinished()
+	if qErr != nil {
+		odohScan.Meta.AddError(qErr)
+		logrus.Errorf("error processing ODoH scan %s to %s:%d with proxy %s: %s", odohScan.Meta.ScanId, odohScan.Query.Host, odohScan.Query.Port, odohScan.Query.Proxy, qErr.Error())
+	}
+
+	RedoDoEScanOnCertError(
+		qErr,
+		odohScan,
+		scan.NewODoHScan(odohScan.Query, odohScan.Meta.ScanId, odohScan.Meta.RootScanId, odohScan.Meta.RunId, odohScan.Meta.VantagePoint),
+		ph.Producer,
+	)
+
+	// store
+	err = storage.Store(odohScan)
+	if err != nil {
+		logrus.Errorf("failed to store %s: %v", odohScan.Meta.ScanId, err)
+	}
+	return err
+}
+
+func NewKafkaODoHEventConsumer(
+	config *KafkaConsumerConfig,
+	prod producer.ScanProducer,
+	storageHandler storage.StorageHandler,
+	queryConfig *query.QueryConfig,
+	proxy string) (kec *KafkaEventConsumer, err error) {
+	if config != nil && config.ConsumerGroup == "" {
+		config.ConsumerGroup = DEFAULT_ODOH_CONSUMER_GROUP
+	}
+
+	newPh := func() (EventProcessHandler, error) {
+		return &ODoHProcessEventHandler{
+			Producer:     prod,
+			QueryHandler: query.NewODoHQueryHandler(queryConfig),
+			Proxy:        proxy,
+		}, nil
+	}
+
+	kec, err = NewKafkaEventConsumer(config, newPh, storageHandler)
+
+	return
+}
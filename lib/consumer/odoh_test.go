@@ -0,0 +1,200 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/steffsas/doe-hunter/lib/consumer"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockedODoHQueryHandler struct {
+	mock.Mock
+}
+
+func (moqh *mockedODoHQueryHandler) Query(q *query.ODoHQuery) (response *query.ODoHResponse, err custom_errors.DoEErrors) {
+	args := moqh.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.ODoHResponse), nil
+	}
+
+	if args.Get(0) == nil {
+		return nil, args.Get(1).(custom_errors.DoEErrors)
+	}
+
+	return args.Get(0).(*query.ODoHResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+func getODoHScanMessage(q *query.ODoHQuery) *kafka.Message {
+	odohScan := scan.NewODoHScan(q, "", "", "", "")
+	odohScanBytes, _ := json.Marshal(odohScan)
+
+	return &kafka.Message{
+		Value: odohScanBytes,
+	}
+}
+
+func TestODoHProcessEventHandler_Process(t *testing.T) {
+	t.Parallel()
+
+	t.Run("process valid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedODoHQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.ODoHResponse{}, nil)
+
+		ph := &consumer.ODoHProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		// test
+		err := ph.Process(getODoHScanMessage(&query.ODoHQuery{}), &msh)
+
+		assert.NoError(t, err)
+		msh.AssertCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("set default proxy", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedODoHQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.ODoHResponse{}, nil)
+
+		ph := &consumer.ODoHProcessEventHandler{
+			QueryHandler: &oqh,
+			Proxy:        "https://proxy.example.com/proxy",
+		}
+
+		err := ph.Process(getODoHScanMessage(&query.ODoHQuery{}), &msh)
+
+		assert.NoError(t, err)
+		oqh.AssertCalled(t, "Query", mock.MatchedBy(func(q *query.ODoHQuery) bool {
+			return q.Proxy == "https://proxy.example.com/proxy"
+		}))
+	})
+
+	t.Run("keep scan proxy", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedODoHQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.ODoHResponse{}, nil)
+
+		ph := &consumer.ODoHProcessEventHandler{
+			QueryHandler: &oqh,
+			Proxy:        "https://proxy.example.com/proxy",
+		}
+
+		err := ph.Process(getODoHScanMessage(&query.ODoHQuery{Proxy: "https://other.example.com/proxy"}), &msh)
+
+		assert.NoError(t, err)
+		oqh.AssertCalled(t, "Query", mock.MatchedBy(func(q *query.ODoHQuery) bool {
+			return q.Proxy == "https://other.example.com/proxy"
+		}))
+	})
+
+	t.Run("process invalid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedODoHQueryHandler{}
+
+		ph := &consumer.ODoHProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		msg := &kafka.Message{
+			Value: []byte("invalid message"),
+		}
+
+		// test
+		err := ph.Process(msg, &msh)
+
+		assert.Error(t, err)
+		msh.AssertNotCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("process query error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedODoHQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(nil, custom_errors.NewQueryError(errors.New("some error"), true))
+
+		ph := &consumer.ODoHProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		// test
+		err := ph.Process(getODoHScanMessage(&query.ODoHQuery{}), &msh)
+
+		assert.NoError(t, err, "although there is a query error, the process handler does only care about handling errors")
+		msh.AssertCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("reschedule on certificate error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedODoHQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.ODoHResponse{}, custom_errors.NewCertificateError(errors.New("certificate error"), true))
+
+		mpf := &mockedProducerFactory{}
+		mpf.On("Produce", mock.Anything, mock.Anything).Return(nil)
+		mpf.On("Flush", mock.Anything).Return(0)
+
+		ph := &consumer.ODoHProcessEventHandler{
+			QueryHandler: &oqh,
+			Producer:     mpf,
+		}
+
+		err := ph.Process(getODoHScanMessage(&query.ODoHQuery{}), &msh)
+
+		assert.NoError(t, err)
+		mpf.AssertCalled(t, "Produce", mock.MatchedBy(func(s scan.Scan) bool {
+			odohScan, ok := s.(*scan.ODoHScan)
+			return ok && odohScan.Query.SkipCertificateVerify
+		}), mock.Anything)
+	})
+
+	t.Run("process storage error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(errors.New("some error"))
+
+		oqh := mockedODoHQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.ODoHResponse{}, nil)
+
+		ph := &consumer.ODoHProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		// test
+		err := ph.Process(getODoHScanMessage(&query.ODoHQuery{}), &msh)
+
+		assert.Error(t, err)
+		msh.AssertCalled(t, "Store", mock.Anything)
+	})
+}
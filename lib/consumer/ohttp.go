@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/producer"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/storage"
+)
+
+const DEFAULT_OHTTP_CONSUMER_GROUP = "ohttp-scan-group"
+
+type OHTTPQueryHandler interface {
+	Query(query *query.OHTTPQuery) (response *query.OHTTPResponse, err custom_errors.DoEErrors)
+}
+
+type OHTTPProcessEventHandler struct {
+	EventProcessHandler
+
+	Producer     producer.ScanProducer
+	QueryHandler OHTTPQueryHandler
+}
+
+func (ph *OHTTPProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
+	// unmarshal message
+	ohttpScan := &scan.OHTTPScan{}
+	err := json.Unmarshal(msg.Value, ohttpScan)
+	if err != nil {
+		logrus.Errorf("error unmarshaling OHTTP scan: %s", err.Error())
+		return err
+	}
+
+	// process
+	var qErr custom_errors.DoEErrors
+	ohttpScan.Meta.SetStarted()
+	ohttpScan.Result, qErr = ph.QueryHandler.Query(ohttpScan.Query)
+	ohttpScan.Meta.SetFinished()
+	if qErr != nil {
+		ohttpScan.Meta.AddError(qErr)
+		logrus.Errorf("error processing OHTTP scan %s to %s:%d with gateway %s: %s", ohttpScan.Meta.ScanId, ohttpScan.Query.Host, ohttpScan.Query.Port, ohttpScan.Query.GatewayPath, qErr.Error())
+	}
+
+	RedoDoEScanOnCertError(
+		qErr,
+		ohttpScan,
+		scan.NewOHTTPScan(ohttpScan.Query, ohttpScan.Meta.ScanId, ohttpScan.Meta.RootScanId, ohttpScan.Meta.RunId, ohttpScan.Meta.VantagePoint),
+		ph.Producer,
+	)
+
+	// store
+	err = storage.Store(ohttpScan)
+	if err != nil {
+		logrus.Errorf("failed to store %s: %v", ohttpScan.Meta.ScanId, err)
+	}
+	return err
+}
+
+func NewKafkaOHTTPEventConsumer(
+	config *KafkaConsumerConfig,
+	prod producer.ScanProducer,
+	storageHandler storage.StorageHandler,
+	queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+	if config != nil && config.ConsumerGroup == "" {
+		config.ConsumerGroup = DEFAULT_OHTTP_CONSUMER_GROUP
+	}
+
+	newPh := func() (EventProcessHandler, error) {
+		return &OHTTPProcessEventHandler{
+			Producer:     prod,
+			QueryHandler: query.NewOHTTPQueryHandler(queryConfig),
+		}, nil
+	}
+
+	kec, err = NewKafkaEventConsumer(config, newPh, storageHandler)
+
+	return
+}
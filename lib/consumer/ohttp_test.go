@@ -0,0 +1,156 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/steffsas/doe-hunter/lib/consumer"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockedOHTTPQueryHandler struct {
+	mock.Mock
+}
+
+func (mhqh *mockedOHTTPQueryHandler) Query(q *query.OHTTPQuery) (response *query.OHTTPResponse, err custom_errors.DoEErrors) {
+	args := mhqh.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.OHTTPResponse), nil
+	}
+
+	if args.Get(0) == nil {
+		return nil, args.Get(1).(custom_errors.DoEErrors)
+	}
+
+	return args.Get(0).(*query.OHTTPResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+func getOHTTPScanMessage(q *query.OHTTPQuery) *kafka.Message {
+	ohttpScan := scan.NewOHTTPScan(q, "", "", "", "")
+	ohttpScanBytes, _ := json.Marshal(ohttpScan)
+
+	return &kafka.Message{
+		Value: ohttpScanBytes,
+	}
+}
+
+func TestOHTTPProcessEventHandler_Process(t *testing.T) {
+	t.Parallel()
+
+	t.Run("process valid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedOHTTPQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.OHTTPResponse{}, nil)
+
+		ph := &consumer.OHTTPProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		// test
+		err := ph.Process(getOHTTPScanMessage(&query.OHTTPQuery{}), &msh)
+
+		assert.NoError(t, err)
+		msh.AssertCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("process invalid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedOHTTPQueryHandler{}
+
+		ph := &consumer.OHTTPProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		msg := &kafka.Message{
+			Value: []byte("invalid message"),
+		}
+
+		// test
+		err := ph.Process(msg, &msh)
+
+		assert.Error(t, err)
+		msh.AssertNotCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("process query error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedOHTTPQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(nil, custom_errors.NewQueryError(errors.New("some error"), true))
+
+		ph := &consumer.OHTTPProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		// test
+		err := ph.Process(getOHTTPScanMessage(&query.OHTTPQuery{}), &msh)
+
+		assert.NoError(t, err, "although there is a query error, the process handler does only care about handling errors")
+		msh.AssertCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("reschedule on certificate error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		oqh := mockedOHTTPQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.OHTTPResponse{}, custom_errors.NewCertificateError(errors.New("certificate error"), true))
+
+		mpf := &mockedProducerFactory{}
+		mpf.On("Produce", mock.Anything, mock.Anything).Return(nil)
+		mpf.On("Flush", mock.Anything).Return(0)
+
+		ph := &consumer.OHTTPProcessEventHandler{
+			QueryHandler: &oqh,
+			Producer:     mpf,
+		}
+
+		err := ph.Process(getOHTTPScanMessage(&query.OHTTPQuery{}), &msh)
+
+		assert.NoError(t, err)
+		mpf.AssertCalled(t, "Produce", mock.MatchedBy(func(s scan.Scan) bool {
+			ohttpScan, ok := s.(*scan.OHTTPScan)
+			return ok && ohttpScan.Query.SkipCertificateVerify
+		}), mock.Anything)
+	})
+
+	t.Run("process storage error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(errors.New("some error"))
+
+		oqh := mockedOHTTPQueryHandler{}
+		oqh.On("Query", mock.Anything).Return(&query.OHTTPResponse{}, nil)
+
+		ph := &consumer.OHTTPProcessEventHandler{
+			QueryHandler: &oqh,
+		}
+
+		// test
+		err := ph.Process(getOHTTPScanMessage(&query.OHTTPQuery{}), &msh)
+
+		assert.Error(t, err)
+		msh.AssertCalled(t, "Store", mock.Anything)
+	})
+}
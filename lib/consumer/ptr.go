@@ -18,6 +18,8 @@ type PTRProcessEventHandler struct {
 	EventProcessHandler
 
 	QueryHandler query.ConventionalDNSQueryHandlerI
+	// TransportHandler sends queries over DoT, DoH and DoQ if the scan asks for it
+	TransportHandler *query.DNSTransportHandler
 }
 
 func (ph *PTRProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
@@ -31,7 +33,7 @@ func (ph *PTRProcessEventHandler) Process(msg *kafka.Message, storage storage.St
 	// process
 	var qErr custom_errors.DoEErrors
 	ptrScan.Meta.SetStarted()
-	ptrScan.Result, qErr = ph.QueryHandler.Query(ptrScan.Query)
+	ptrScan.Result, qErr = QueryOverTransport(ph.QueryHandler, ph.TransportHandler, ptrScan.Query, ptrScan.Transport)
 	ptrScan.Meta.SetFinished()
 	if qErr != nil {
 		if !strings.Contains(qErr.Error(), custom_errors.ErrNoResponse.Error()) {
@@ -54,8 +56,14 @@ func NewKafkaPTREventConsumer(config *KafkaConsumerConfig, storageHandler storag
 	}
 
 	newPh := func() (EventProcessHandler, error) {
+		th, err := query.NewDNSTransportHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
 		return &PTRProcessEventHandler{
-			QueryHandler: query.NewConventionalDNSQueryHandler(queryConfig),
+			QueryHandler:     query.NewConventionalDNSQueryHandler(queryConfig),
+			TransportHandler: th,
 		}, nil
 	}
 
@@ -19,6 +19,8 @@ type ResInfoProcessConsumer struct {
 	EventProcessHandler
 
 	QueryHandler query.ConventionalDNSQueryHandlerI
+	// TransportHandler sends queries over DoT, DoH and DoQ if the scan asks for it
+	TransportHandler *query.DNSTransportHandler
 }
 
 func (resinfo *ResInfoProcessConsumer) Process(msg *kafka.Message, sh storage.StorageHandler) error {
@@ -89,7 +91,7 @@ func (resinfo *ResInfoProcessConsumer) StartResInfo(s *scan.ResInfoScan) {
 	q.Host = s.Host
 
 	s.Meta.SetStarted()
-	res, err := resinfo.QueryHandler.Query(q)
+	res, err := QueryOverTransport(resinfo.QueryHandler, resinfo.TransportHandler, q, s.Transport)
 	s.Meta.SetFinished()
 	if err != nil {
 		logrus.Errorf("error querying %s: %v", s.Meta.ScanId, err)
@@ -116,8 +118,14 @@ func NewKafkaResInfoEventConsumer(
 	}
 
 	newPh := func() (EventProcessHandler, error) {
+		th, err := query.NewDNSTransportHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
 		return &ResInfoProcessConsumer{
-			QueryHandler: query.NewConventionalDNSQueryHandler(queryConfig),
+			QueryHandler:     query.NewConventionalDNSQueryHandler(queryConfig),
+			TransportHandler: th,
 		}, nil
 	}
 
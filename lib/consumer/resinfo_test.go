@@ -101,6 +101,47 @@ func TestResInfoConsumer_Process(t *testing.T) {
 	})
 }
 
+func TestResInfoConsumer_Transport(t *testing.T) {
+	t.Parallel()
+
+	targetName := "resolver.dns4all.eu."
+
+	doqRes := &query.DoQResponse{}
+	doqRes.ResponseMsg = &dns.Msg{
+		Answer: []dns.RR{
+			&dns.RESINFO{
+				Hdr: dns.RR_Header{Name: targetName, Rrtype: dns.TypeRESINFO},
+				Txt: []string{"qnamemin"},
+			},
+		},
+	}
+
+	qh := new(mockedConventionalDNSQueryHandler)
+	dqh := &mockedDoQQueryHandler{}
+	dqh.On("Query", mock.Anything).Return(doqRes, nil)
+
+	c := &consumer.ResInfoProcessConsumer{
+		QueryHandler:     qh,
+		TransportHandler: &query.DNSTransportHandler{DoQ: dqh},
+	}
+
+	s := scan.NewResInfoScan(targetName, "194.0.5.3", "", "", "", "")
+	s.Transport = &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DOQ, SNI: targetName}
+
+	c.StartResInfo(s)
+
+	assert.Empty(t, s.Meta.Errors)
+	assert.True(t, s.Result.RFC9606Support)
+	require.NotNil(t, s.Response.Transport)
+	assert.Equal(t, query.TRANSPORT_DOQ, s.Response.Transport.Protocol)
+	qh.AssertNotCalled(t, "Query", mock.Anything)
+
+	doqQuery := dqh.Calls[0].Arguments.Get(0).(*query.DoQQuery)
+	assert.Equal(t, "194.0.5.3", doqQuery.Host)
+	assert.Equal(t, targetName, doqQuery.SNI)
+	assert.Equal(t, dns.TypeRESINFO, doqQuery.QueryMsg.Question[0].Qtype)
+}
+
 func TestResInfoConsumer_ParseResponse(t *testing.T) {
 	t.Parallel()
 
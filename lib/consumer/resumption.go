@@ -0,0 +1,75 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/storage"
+)
+
+type ResumptionQueryHandler interface {
+	Query(query *query.ResumptionQuery) (response *query.ResumptionResponse, err custom_errors.DoEErrors)
+}
+
+const DEFAULT_RESUMPTION_CONSUMER_GROUP = "resumption-scan-group"
+
+type ResumptionProcessEventHandler struct {
+	EventProcessHandler
+
+	QueryHandler ResumptionQueryHandler
+}
+
+func (ph *ResumptionProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
+	// unmarshal message
+	resumptionScan := &scan.ResumptionScan{}
+	umErr := json.Unmarshal(msg.Value, resumptionScan)
+	if umErr != nil {
+		logrus.Errorf("error unmarshalling resumption scan: %s", umErr)
+		return umErr
+	}
+
+	// process
+	var qErr custom_errors.DoEErrors
+	resumptionScan.Meta.SetStarted()
+	resumptionScan.Result, qErr = ph.QueryHandler.Query(resumptionScan.Query)
+	resumptionScan.Meta.SetFinished()
+	if qErr != nil {
+		logrus.Errorf("error processing %s resumption scan %s to %s:%d: %s", resumptionScan.Query.Protocol, resumptionScan.Meta.ScanId, resumptionScan.Query.Host, resumptionScan.Query.Port, qErr.Error())
+		resumptionScan.Meta.AddError(qErr)
+	}
+
+	// store
+	err := storage.Store(resumptionScan)
+	if err != nil {
+		logrus.Errorf("failed to store %s: %v", resumptionScan.Meta.ScanId, err)
+	}
+	return err
+}
+
+func NewKafkaResumptionEventConsumer(
+	config *KafkaConsumerConfig,
+	storageHandler storage.StorageHandler,
+	queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+	if config != nil && config.ConsumerGroup == "" {
+		config.ConsumerGroup = DEFAULT_RESUMPTION_CONSUMER_GROUP
+	}
+
+	newPh := func() (EventProcessHandler, error) {
+		qh, err := query.NewResumptionQueryHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ResumptionProcessEventHandler{
+			QueryHandler: qh,
+		}, nil
+	}
+
+	kec, err = NewKafkaEventConsumer(config, newPh, storageHandler)
+
+	return
+}
@@ -0,0 +1,191 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/steffsas/doe-hunter/lib/consumer"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedResumptionQueryHandler struct {
+	mock.Mock
+}
+
+func (mqh *mockedResumptionQueryHandler) Query(q *query.ResumptionQuery) (*query.ResumptionResponse, custom_errors.DoEErrors) {
+	args := mqh.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.ResumptionResponse), nil
+	}
+
+	return args.Get(0).(*query.ResumptionResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+func TestResumption_Process(t *testing.T) {
+	t.Parallel()
+
+	getScanBytes := func() []byte {
+		q := query.NewResumptionQuery()
+		q.Host = "8.8.8.8"
+		q.Port = 853
+
+		b, _ := json.Marshal(scan.NewResumptionScan(q, "parent", "root", "run", "vp"))
+		return b
+	}
+
+	process := func(t *testing.T, res *query.ResumptionResponse, qErr custom_errors.DoEErrors) *scan.ResumptionScan {
+		t.Helper()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		mqh := &mockedResumptionQueryHandler{}
+		if qErr == nil {
+			mqh.On("Query", mock.Anything).Return(res, nil)
+		} else {
+			mqh.On("Query", mock.Anything).Return(res, qErr)
+		}
+
+		ph := &consumer.ResumptionProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		require.Nil(t, err)
+		require.Len(t, msh.Calls, 1)
+		return msh.Calls[0].Arguments.Get(0).(*scan.ResumptionScan)
+	}
+
+	t.Run("no session ticket issued", func(t *testing.T) {
+		t.Parallel()
+
+		res := &query.ResumptionResponse{
+			Initial: &query.DoEResponse{TLSVersion: "TLS 1.3"},
+		}
+
+		stored := process(t, res, nil)
+
+		assert.Equal(t, res, stored.Result)
+		assert.False(t, stored.Result.TicketIssued)
+		assert.Nil(t, stored.Result.Resumed, "should not attempt to resume without ticket")
+		assert.Empty(t, stored.Meta.Errors)
+	})
+
+	t.Run("resumption rejected by the server", func(t *testing.T) {
+		t.Parallel()
+
+		res := &query.ResumptionResponse{
+			Initial:            &query.DoEResponse{TLSVersion: "TLS 1.3"},
+			Resumed:            &query.DoEResponse{TLSVersion: "TLS 1.3", TLSResumed: false},
+			TicketIssued:       true,
+			TicketLifetime:     2 * time.Hour,
+			ResumptionAccepted: false,
+			EarlyDataStatus:    query.EARLY_DATA_UNSUPPORTED,
+		}
+
+		stored := process(t, res, nil)
+
+		assert.Equal(t, res, stored.Result)
+		assert.False(t, stored.Result.ResumptionAccepted)
+		assert.Empty(t, stored.Meta.Errors, "a full handshake on resumption is a result, not an error")
+	})
+
+	t.Run("0-RTT accepted", func(t *testing.T) {
+		t.Parallel()
+
+		res := &query.ResumptionResponse{
+			Resumed:            &query.DoEResponse{TLSResumed: true},
+			EarlyData:          &query.DoEResponse{TLSResumed: true},
+			TicketIssued:       true,
+			TicketEarlyData:    true,
+			ResumptionAccepted: true,
+			EarlyDataStatus:    query.EARLY_DATA_ACCEPTED,
+		}
+
+		stored := process(t, res, nil)
+
+		assert.Equal(t, query.EARLY_DATA_ACCEPTED, stored.Result.EarlyDataStatus)
+		assert.NotNil(t, stored.Result.EarlyData)
+		assert.Empty(t, stored.Meta.Errors)
+	})
+
+	t.Run("0-RTT rejected", func(t *testing.T) {
+		t.Parallel()
+
+		res := &query.ResumptionResponse{
+			Resumed:            &query.DoEResponse{TLSResumed: true},
+			TicketIssued:       true,
+			TicketEarlyData:    true,
+			ResumptionAccepted: true,
+			EarlyDataStatus:    query.EARLY_DATA_REJECTED,
+		}
+
+		stored := process(t, res, nil)
+
+		assert.Equal(t, query.EARLY_DATA_REJECTED, stored.Result.EarlyDataStatus)
+		assert.Empty(t, stored.Result.EarlyDataError)
+		assert.Empty(t, stored.Meta.Errors)
+	})
+
+	t.Run("resumed handshake failed", func(t *testing.T) {
+		t.Parallel()
+
+		res := &query.ResumptionResponse{
+			Initial:         &query.DoEResponse{TLSVersion: "TLS 1.3"},
+			TicketIssued:    true,
+			ResumptionError: "timeout",
+		}
+
+		stored := process(t, res, custom_errors.NewQueryError(custom_errors.ErrResumptionFailed, false).AddInfoString("timeout"))
+
+		assert.Equal(t, "timeout", stored.Result.ResumptionError)
+		assert.NotNil(t, stored.Result.Initial, "should keep the full handshake")
+		require.Len(t, stored.Meta.Errors, 1)
+		assert.Contains(t, stored.Meta.Errors[0].Error(), custom_errors.ErrResumptionFailed.Error())
+		assert.False(t, stored.Meta.Errors[0].IsCritical())
+	})
+
+	t.Run("process invalid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		mqh := &mockedResumptionQueryHandler{}
+
+		ph := &consumer.ResumptionProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: []byte("some invalid bytes")}, msh)
+
+		assert.Error(t, err)
+		msh.AssertNotCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(errors.New("storage error"))
+
+		mqh := &mockedResumptionQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(&query.ResumptionResponse{}, nil)
+
+		ph := &consumer.ResumptionProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,75 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/storage"
+)
+
+type SessionQueryHandler interface {
+	Query(query *query.SessionQuery) (response *query.SessionResponse, err custom_errors.DoEErrors)
+}
+
+const DEFAULT_SESSION_CONSUMER_GROUP = "session-scan-group"
+
+type SessionProcessEventHandler struct {
+	EventProcessHandler
+
+	QueryHandler SessionQueryHandler
+}
+
+func (ph *SessionProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
+	// unmarshal message
+	sessionScan := &scan.SessionScan{}
+	umErr := json.Unmarshal(msg.Value, sessionScan)
+	if umErr != nil {
+		logrus.Errorf("error unmarshalling session scan: %s", umErr)
+		return umErr
+	}
+
+	// process
+	var qErr custom_errors.DoEErrors
+	sessionScan.Meta.SetStarted()
+	sessionScan.Result, qErr = ph.QueryHandler.Query(sessionScan.Query)
+	sessionScan.Meta.SetFinished()
+	if qErr != nil {
+		logrus.Errorf("error processing %s session scan %s to %s:%d: %s", sessionScan.Query.Protocol, sessionScan.Meta.ScanId, sessionScan.Query.Host, sessionScan.Query.Port, qErr.Error())
+		sessionScan.Meta.AddError(qErr)
+	}
+
+	// store
+	err := storage.Store(sessionScan)
+	if err != nil {
+		logrus.Errorf("failed to store %s: %v", sessionScan.Meta.ScanId, err)
+	}
+	return err
+}
+
+func NewKafkaSessionEventConsumer(
+	config *KafkaConsumerConfig,
+	storageHandler storage.StorageHandler,
+	queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+	if config != nil && config.ConsumerGroup == "" {
+		config.ConsumerGroup = DEFAULT_SESSION_CONSUMER_GROUP
+	}
+
+	newPh := func() (EventProcessHandler, error) {
+		qh, err := query.NewSessionQueryHandler(queryConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		return &SessionProcessEventHandler{
+			QueryHandler: qh,
+		}, nil
+	}
+
+	kec, err = NewKafkaEventConsumer(config, newPh, storageHandler)
+
+	return
+}
@@ -0,0 +1,185 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/consumer"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedSessionQueryHandler struct {
+	mock.Mock
+}
+
+func (mqh *mockedSessionQueryHandler) Query(q *query.SessionQuery) (*query.SessionResponse, custom_errors.DoEErrors) {
+	args := mqh.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.SessionResponse), nil
+	}
+
+	return args.Get(0).(*query.SessionResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+func newTestSessionQuery(protocol string) *query.SessionQuery {
+	q := query.NewSessionQuery()
+	q.Host = "dns.example"
+	q.Protocol = protocol
+
+	switch protocol {
+	case query.TRANSPORT_DOH:
+		q.Port = 443
+		q.URI = "/resolve{?dns}"
+		q.HTTPVersion = query.HTTP_VERSION_3
+		q.EarlyData = true
+	case query.TRANSPORT_DOQ:
+		q.Port = 853
+		q.EarlyData = true
+	}
+
+	q.Queries = 4
+	q.IdleProbes = []time.Duration{time.Second, 30 * time.Second}
+
+	return q
+}
+
+func TestSession_Process(t *testing.T) {
+	t.Parallel()
+
+	t.Run("query reaches the handler", func(t *testing.T) {
+		t.Parallel()
+
+		for _, protocol := range []string{query.TRANSPORT_DOT, query.TRANSPORT_DOH, query.TRANSPORT_DOQ} {
+			t.Run(protocol, func(t *testing.T) {
+				t.Parallel()
+
+				q := newTestSessionQuery(protocol)
+				b, err := json.Marshal(scan.NewSessionScan(q, "parent", "root", "run", "vp"))
+				require.NoError(t, err)
+
+				msh := &mockedStorageHandler{}
+				msh.On("Store", mock.Anything).Return(nil)
+
+				mqh := &mockedSessionQueryHandler{}
+				mqh.On("Query", mock.Anything).Return(&query.SessionResponse{}, nil)
+
+				ph := &consumer.SessionProcessEventHandler{
+					QueryHandler: mqh,
+				}
+
+				err = ph.Process(&kafka.Message{Value: b}, msh)
+
+				require.Nil(t, err)
+				require.Len(t, mqh.Calls, 1)
+				received := mqh.Calls[0].Arguments.Get(0).(*query.SessionQuery)
+				assert.Equal(t, protocol, received.Protocol)
+				assert.Equal(t, q.Port, received.Port)
+				assert.Equal(t, q.URI, received.URI)
+				assert.Equal(t, q.HTTPVersion, received.HTTPVersion)
+				assert.Equal(t, q.Queries, received.Queries)
+				assert.Equal(t, q.IdleProbes, received.IdleProbes)
+				assert.Equal(t, q.EarlyData, received.EarlyData)
+				assert.True(t, received.DNSSEC)
+				assert.True(t, received.NSID)
+				require.NotNil(t, received.QueryMsg)
+				assert.Equal(t, q.QueryMsg.Question, received.QueryMsg.Question)
+			})
+		}
+	})
+
+	t.Run("result round-trips through JSON", func(t *testing.T) {
+		t.Parallel()
+
+		b, err := json.Marshal(scan.NewSessionScan(newTestSessionQuery(query.TRANSPORT_DOQ), "parent", "root", "run", "vp"))
+		require.NoError(t, err)
+
+		res := &query.SessionResponse{
+			Sequential: []*query.SessionExchange{
+				{Index: 0, RTT: 20 * time.Millisecond, Rcode: dns.RcodeSuccess},
+				{Index: 1, RTT: 5 * time.Millisecond, Rcode: -1, Error: "stream reset"},
+			},
+			QueriesBeforeClose: 1,
+			Pipelined: []*query.SessionExchange{
+				{Index: 1, RTT: 8 * time.Millisecond, Rcode: dns.RcodeSuccess},
+				{Index: 0, RTT: 9 * time.Millisecond, Rcode: dns.RcodeSuccess},
+			},
+			PipelineAnswered: 2,
+			OutOfOrder:       true,
+			IdleProbes: []*query.SessionIdleProbe{
+				{Idle: time.Second, Alive: true},
+				{Idle: 30 * time.Second, Error: "idle timeout"},
+			},
+			IdleSurvived: time.Second,
+		}
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		mqh := &mockedSessionQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(res, nil)
+
+		ph := &consumer.SessionProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err = ph.Process(&kafka.Message{Value: b}, msh)
+		require.Nil(t, err)
+
+		require.Len(t, msh.Calls, 1)
+		stored, err := msh.Calls[0].Arguments.Get(0).(*scan.SessionScan).Marshal()
+		require.NoError(t, err)
+
+		restored := &scan.SessionScan{}
+		require.NoError(t, json.Unmarshal(stored, restored))
+
+		assert.Equal(t, query.TRANSPORT_DOQ, restored.Query.Protocol)
+		assert.Equal(t, res.Sequential, restored.Result.Sequential)
+		assert.Equal(t, res.Pipelined, restored.Result.Pipelined)
+		assert.Equal(t, res.IdleProbes, restored.Result.IdleProbes)
+		assert.Equal(t, 1, restored.Result.QueriesBeforeClose)
+		assert.True(t, restored.Result.OutOfOrder)
+		assert.Equal(t, time.Second, restored.Result.IdleSurvived)
+	})
+
+	t.Run("keep partial result of failed session", func(t *testing.T) {
+		t.Parallel()
+
+		b, err := json.Marshal(scan.NewSessionScan(newTestSessionQuery(query.TRANSPORT_DOT), "parent", "root", "run", "vp"))
+		require.NoError(t, err)
+
+		// the server closed the connection after the first answer
+		res := &query.SessionResponse{
+			Sequential: []*query.SessionExchange{
+				{Index: 0, Rcode: dns.RcodeSuccess},
+			},
+			QueriesBeforeClose: 1,
+		}
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		mqh := &mockedSessionQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(res, custom_errors.NewQueryError(custom_errors.ErrSessionConnectionClosed, false))
+
+		ph := &consumer.SessionProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err = ph.Process(&kafka.Message{Value: b}, msh)
+
+		assert.Nil(t, err)
+		stored := msh.Calls[0].Arguments.Get(0).(*scan.SessionScan)
+		assert.Equal(t, res, stored.Result, "should store the answers before the connection was closed")
+		require.Len(t, stored.Meta.Errors, 1)
+		assert.Contains(t, stored.Meta.Errors[0].Error(), custom_errors.ErrSessionConnectionClosed.Error())
+	})
+}
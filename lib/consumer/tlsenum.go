@@ -0,0 +1,70 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/sirupsen/logrus"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/storage"
+)
+
+type TLSEnumQueryHandler interface {
+	Query(query *query.TLSEnumQuery) (response *query.TLSEnumResponse, err custom_errors.DoEErrors)
+}
+
+const DEFAULT_TLS_ENUM_CONSUMER_GROUP = "tls-enum-scan-group"
+
+type TLSEnumProcessEventHandler struct {
+	EventProcessHandler
+
+	QueryHandler TLSEnumQueryHandler
+}
+
+func (ph *TLSEnumProcessEventHandler) Process(msg *kafka.Message, storage storage.StorageHandler) error {
+	// unmarshal message
+	tlsEnumScan := &scan.TLSEnumScan{}
+	umErr := json.Unmarshal(msg.Value, tlsEnumScan)
+	if umErr != nil {
+		logrus.Errorf("error unmarshalling TLS enumeration scan: %s", umErr)
+		return umErr
+	}
+
+	// process
+	var qErr custom_errors.DoEErrors
+	tlsEnumScan.Meta.SetStarted()
+	tlsEnumScan.Result, qErr = ph.QueryHandler.Query(tlsEnumScan.Query)
+	tlsEnumScan.Meta.SetFinished()
+	if qErr != nil {
+		logrus.Errorf("error processing TLS enumeration scan %s to %s:%d: %s", tlsEnumScan.Meta.ScanId, tlsEnumScan.Query.Host, tlsEnumScan.Query.Port, qErr.Error())
+		tlsEnumScan.Meta.AddError(qErr)
+	}
+
+	// store
+	err := storage.Store(tlsEnumScan)
+	if err != nil {
+		logrus.Errorf("failed to store %s: %v", tlsEnumScan.Meta.ScanId, err)
+	}
+	return err
+}
+
+func NewKafkaTLSEnumEventConsumer(
+	config *KafkaConsumerConfig,
+	storageHandler storage.StorageHandler,
+	queryConfig *query.QueryConfig) (kec *KafkaEventConsumer, err error) {
+	if config != nil && config.ConsumerGroup == "" {
+		config.ConsumerGroup = DEFAULT_TLS_ENUM_CONSUMER_GROUP
+	}
+
+	newPh := func() (EventProcessHandler, error) {
+		return &TLSEnumProcessEventHandler{
+			QueryHandler: query.NewTLSEnumQueryHandler(queryConfig),
+		}, nil
+	}
+
+	kec, err = NewKafkaEventConsumer(config, newPh, storageHandler)
+
+	return
+}
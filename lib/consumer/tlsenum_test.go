@@ -0,0 +1,122 @@
+package consumer_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/steffsas/doe-hunter/lib/consumer"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedTLSEnumQueryHandler struct {
+	mock.Mock
+}
+
+func (mqh *mockedTLSEnumQueryHandler) Query(q *query.TLSEnumQuery) (*query.TLSEnumResponse, custom_errors.DoEErrors) {
+	args := mqh.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.TLSEnumResponse), nil
+	}
+
+	return args.Get(0).(*query.TLSEnumResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+func TestTLSEnum_Process(t *testing.T) {
+	t.Parallel()
+
+	getScanBytes := func() []byte {
+		q := query.NewTLSEnumQuery()
+		q.Host = "8.8.8.8"
+		q.Port = 853
+
+		b, _ := json.Marshal(scan.NewTLSEnumScan(q, "parent", "root", "run", "vp"))
+		return b
+	}
+
+	t.Run("process valid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		res := &query.TLSEnumResponse{
+			Versions: []*query.TLSVersionSupport{{Version: "TLS 1.3", Supported: true}},
+		}
+		mqh := &mockedTLSEnumQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(res, nil)
+
+		ph := &consumer.TLSEnumProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Nil(t, err)
+		require.Len(t, msh.Calls, 1)
+		stored := msh.Calls[0].Arguments.Get(0).(*scan.TLSEnumScan)
+		assert.Equal(t, res, stored.Result)
+		assert.Empty(t, stored.Meta.Errors)
+	})
+
+	t.Run("process invalid message", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		mqh := &mockedTLSEnumQueryHandler{}
+
+		ph := &consumer.TLSEnumProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: []byte("some invalid bytes")}, msh)
+
+		assert.Error(t, err)
+		msh.AssertNotCalled(t, "Store", mock.Anything)
+	})
+
+	t.Run("process query error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(nil)
+
+		mqh := &mockedTLSEnumQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(&query.TLSEnumResponse{}, custom_errors.NewQueryError(custom_errors.ErrTLSEndpointUnreachable, true))
+
+		ph := &consumer.TLSEnumProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Nil(t, err)
+		stored := msh.Calls[0].Arguments.Get(0).(*scan.TLSEnumScan)
+		assert.Len(t, stored.Meta.Errors, 1)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		t.Parallel()
+
+		msh := &mockedStorageHandler{}
+		msh.On("Store", mock.Anything).Return(errors.New("storage error"))
+
+		mqh := &mockedTLSEnumQueryHandler{}
+		mqh.On("Query", mock.Anything).Return(&query.TLSEnumResponse{}, nil)
+
+		ph := &consumer.TLSEnumProcessEventHandler{
+			QueryHandler: mqh,
+		}
+
+		err := ph.Process(&kafka.Message{Value: getScanBytes()}, msh)
+
+		assert.Error(t, err)
+	})
+}
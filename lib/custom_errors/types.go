@@ -35,12 +35,16 @@ var ErrInvalidHttpMethod = errors.New("invalid HTTP method")
 var ErrInvalidHttpVersion = errors.New("invalid HTTP version")
 var ErrEmptyURIPath = errors.New("URI path is empty")
 var ErrURITooLong = errors.New("URI too long for GET request, POST fallback disabled")
-var ErrUnexpectedURIPath = errors.New("URI does not match the expected format")
+var ErrMalformedURITemplate = errors.New("malformed URI template")
 var ErrDNSPackFailed = errors.New("failed to pack DNS message")
 var ErrDNSUnpackFailed = errors.New("failed to unpack DNS message")
 var ErrDoHRequestError = errors.New("DoH request failed")
 var ErrFailedFailedToCreateHTTPReq = errors.New("failed to create HTTP request")
 var ErrFailedToJoinURLPath = errors.New("failed to join URL path")
+var ErrHTTPSRRLookupFailed = errors.New("failed to look up HTTPS RR of target name")
+var ErrInvalidDoHFormat = errors.New("invalid DoH format")
+var ErrDoHJSONNoQuestion = errors.New("JSON API requests need a question")
+var ErrDoHJSONConversionFailed = errors.New("failed to convert JSON API answer to DNS message")
 
 // specific DoQ query errors
 var ErrSessionEstablishmentFailed = errors.New("quic session establishment failed")
@@ -69,10 +73,30 @@ var ErrParsingSvcbKey = errors.New("failed to parse SVCB key")
 var ErrDoHPathNotProvided = errors.New("DoH path not provided")
 var ErrUnknownALPN = errors.New("unknown ALPN in SVCB record")
 var ErrInvalidSVCBRR = errors.New("invalid DNS RR")
+var ErrUnsupportedMandatorySvcbKey = errors.New("unsupported mandatory SVCB key")
+var ErrMandatorySvcbKeyMissing = errors.New("mandatory SVCB key missing")
 
 // specific certificate errors
 var ErrCertificateInvalid = errors.New("certificate is invalid")
 var ErrUnknownProtocolForTLS = errors.New("unknown protocol for TLS")
+var ErrNoCertificate = errors.New("no certificate presented")
+var ErrInvalidRootBundle = errors.New("invalid root certificate bundle")
+
+// specific TLS enumeration errors
+var ErrTLSEndpointUnreachable = errors.New("TLS endpoint unreachable")
+
+// specific session errors
+var ErrInvalidSessionQueries = errors.New("invalid number of session queries")
+var ErrSessionFailed = errors.New("failed to exchange the first message of the session")
+var ErrSessionConnectionClosed = errors.New("session connection closed by the server")
+var ErrPipeliningUnsupported = errors.New("pipelining is not supported over HTTP/1.1")
+
+// specific resumption errors
+var ErrResumptionFailed = errors.New("failed to exchange a message over the resumed session")
+
+// specific DoH path discovery errors
+var ErrNoDoHPaths = errors.New("no DoH paths to probe")
+var ErrNoValidDoHPath = errors.New("no probed DoH path answered with a valid DNS message")
 
 // generic producer generation
 var ErrProducerCreationFailed = errors.New("failed to create producer")
@@ -81,9 +105,44 @@ var ErrProducerProduceFailed = errors.New("failed to produce message")
 // SSH query errors
 var ErrQueryDial = errors.New("failed to dial SSH server")
 
+// banner query errors
+var ErrBannerGrabFailed = errors.New("failed to grab banner")
+
 // generic consumer errors
 var ErrQueryBlockList = errors.New("query host is on blocklist")
 
+// HPKE errors
+var ErrUnsupportedKEM = errors.New("unsupported HPKE KEM")
+var ErrUnsupportedKDF = errors.New("unsupported HPKE KDF")
+var ErrUnsupportedAEAD = errors.New("unsupported HPKE AEAD")
+var ErrInvalidPublicKey = errors.New("invalid HPKE public key")
+var ErrMessageLimitReached = errors.New("HPKE message limit reached")
+
+// ODoH errors
+var ErrODoHConfigFetchFailed = errors.New("failed to fetch ODoH configs")
+var ErrODoHConfigParsingFailed = errors.New("failed to parse ODoH configs")
+var ErrODoHNoSupportedConfig = errors.New("no supported ODoH config found")
+var ErrODoHEncryptionFailed = errors.New("failed to encrypt ODoH query")
+var ErrODoHDecryptionFailed = errors.New("failed to decrypt ODoH response")
+var ErrODoHInvalidMessage = errors.New("invalid ODoH message")
+var ErrODoHRequestFailed = errors.New("ODoH request failed")
+
+// OHTTP errors
+var ErrOHTTPKeyConfigFetchFailed = errors.New("failed to fetch OHTTP key configs")
+var ErrOHTTPKeyConfigParsingFailed = errors.New("failed to parse OHTTP key configs")
+var ErrOHTTPNoSupportedKeyConfig = errors.New("no supported OHTTP key config found")
+var ErrOHTTPEncapsulationFailed = errors.New("failed to encapsulate OHTTP request")
+var ErrOHTTPDecapsulationFailed = errors.New("failed to decapsulate OHTTP response")
+var ErrOHTTPRequestFailed = errors.New("OHTTP request failed")
+var ErrBHTTPInvalidMessage = errors.New("invalid binary HTTP message")
+
+// DNSSEC validation errors
+var ErrInvalidTrustAnchor = errors.New("invalid DNSSEC trust anchor")
+var ErrDNSSECChainQueryFailed = errors.New("DNSSEC chain query failed")
+var ErrDNSSECSignatureExpired = errors.New("RRSIG is outside of its validity period")
+var ErrDNSSECNoMatchingKey = errors.New("no DNSKEY matches RRSIG")
+var ErrDNSSECInvalidSigner = errors.New("RRSIG signer is not an ancestor of the RRset owner")
+
 // RESINFO errors
 var ErrParsingResInfo = errors.New("failed to parse RESINFO record")
 var ErrMultipleResInfoRecords = errors.New("multiple RESINFO records found")
@@ -0,0 +1,110 @@
+package fingerprint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+const SIGNATURE_NO_RESPONSE = "no_response"
+
+// Observation is what a server answered to a probe
+type Observation struct {
+	// Text holds the trimmed TXT strings of the answer, the NSID of the nsid probe
+	Text string `json:"text"`
+	// Signature describes the response header in the spirit of fpdns,
+	// e.g., "opcode=QUERY rcode=NOTIMP flags=qr,rd an=0 ns=0 ar=1"
+	Signature string `json:"signature"`
+}
+
+// Observations maps probe names to observations
+type Observations map[string]*Observation
+
+// NewObservations observes the responses of the probes, unanswered probes are observed as no_response
+func NewObservations(responses map[string]*query.ConventionalDNSResponse) Observations {
+	observations := Observations{}
+	for probe, res := range responses {
+		observations[probe] = NewObservation(probe, res)
+	}
+
+	return observations
+}
+
+func NewObservation(probe string, res *query.ConventionalDNSResponse) *Observation {
+	if res == nil || res.Response == nil || res.Response.ResponseMsg == nil {
+		return &Observation{Signature: SIGNATURE_NO_RESPONSE}
+	}
+
+	msg := res.Response.ResponseMsg
+	observation := &Observation{Signature: GetSignature(msg)}
+
+	if probe == PROBE_NSID {
+		if info := query.NewEDNSInfo(msg); info != nil {
+			observation.Text = info.NSIDText
+			if observation.Text == "" {
+				observation.Text = info.NSID
+			}
+		}
+
+		return observation
+	}
+
+	txts := []string{}
+	for _, rr := range msg.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			txts = append(txts, strings.Join(txt.Txt, ""))
+		}
+	}
+	observation.Text = strings.TrimSpace(strings.Join(txts, " "))
+
+	return observation
+}
+
+// GetSignature describes opcode, rcode, flags and section counts of the message
+func GetSignature(msg *dns.Msg) string {
+	flags := []string{}
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"qr", msg.Response},
+		{"aa", msg.Authoritative},
+		{"tc", msg.Truncated},
+		{"rd", msg.RecursionDesired},
+		{"ra", msg.RecursionAvailable},
+		{"z", msg.Zero},
+		{"ad", msg.AuthenticatedData},
+		{"cd", msg.CheckingDisabled},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+
+	return fmt.Sprintf("opcode=%s rcode=%s flags=%s an=%d ns=%d ar=%d",
+		getOpcodeString(msg.Opcode),
+		getRcodeString(msg.Rcode),
+		strings.Join(flags, ","),
+		len(msg.Answer),
+		len(msg.Ns),
+		len(msg.Extra),
+	)
+}
+
+func getOpcodeString(opcode int) string {
+	if s, ok := dns.OpcodeToString[opcode]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("OPCODE%d", opcode)
+}
+
+func getRcodeString(rcode int) string {
+	if s, ok := dns.RcodeToString[rcode]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("RCODE%d", rcode)
+}
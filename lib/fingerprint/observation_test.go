@@ -0,0 +1,92 @@
+package fingerprint_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTXTResponse(txts ...string) *query.ConventionalDNSResponse {
+	msg := new(dns.Msg)
+	msg.SetQuestion("version.bind.", dns.TypeTXT)
+	msg.Question[0].Qclass = dns.ClassCHAOS
+	msg.Response = true
+
+	for _, txt := range txts {
+		msg.Answer = append(msg.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: "version.bind.", Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{txt},
+		})
+	}
+
+	return &query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: msg}}
+}
+
+func TestGetSignature(t *testing.T) {
+	t.Parallel()
+
+	t.Run("flags and counts", func(t *testing.T) {
+		t.Parallel()
+
+		msg := new(dns.Msg)
+		msg.SetQuestion("example.com.", dns.TypeA)
+		msg.Response = true
+		msg.RecursionAvailable = true
+		msg.Rcode = dns.RcodeNotImplemented
+		msg.SetEdns0(1232, false)
+
+		assert.Equal(t, "opcode=QUERY rcode=NOTIMP flags=qr,rd,ra an=0 ns=0 ar=1", fingerprint.GetSignature(msg))
+	})
+
+	t.Run("unassigned opcode", func(t *testing.T) {
+		t.Parallel()
+
+		msg := new(dns.Msg)
+		msg.Opcode = fingerprint.UNKNOWN_OPCODE
+
+		assert.Equal(t, "opcode=OPCODE15 rcode=NOERROR flags= an=0 ns=0 ar=0", fingerprint.GetSignature(msg))
+	})
+}
+
+func TestNewObservation(t *testing.T) {
+	t.Parallel()
+
+	t.Run("TXT answer", func(t *testing.T) {
+		t.Parallel()
+
+		observation := fingerprint.NewObservation(fingerprint.PROBE_VERSION_BIND, newTXTResponse("unbound 1.19.2"))
+
+		assert.Equal(t, "unbound 1.19.2", observation.Text)
+		assert.Equal(t, "opcode=QUERY rcode=NOERROR flags=qr,rd an=1 ns=0 ar=0", observation.Signature)
+	})
+
+	t.Run("multiple TXT records", func(t *testing.T) {
+		t.Parallel()
+
+		observation := fingerprint.NewObservation(fingerprint.PROBE_ID_SERVER, newTXTResponse("a", "b"))
+
+		assert.Equal(t, "a b", observation.Text)
+	})
+
+	t.Run("NSID", func(t *testing.T) {
+		t.Parallel()
+
+		res := newTXTResponse()
+		res.Response.ResponseMsg.SetEdns0(1232, false)
+		opt := res.Response.ResponseMsg.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte("fra-1"))})
+
+		assert.Equal(t, "fra-1", fingerprint.NewObservation(fingerprint.PROBE_NSID, res).Text)
+	})
+
+	t.Run("no response", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, fingerprint.SIGNATURE_NO_RESPONSE, fingerprint.NewObservation(fingerprint.PROBE_QR_SET, nil).Signature)
+		assert.Equal(t, fingerprint.SIGNATURE_NO_RESPONSE, fingerprint.NewObservation(fingerprint.PROBE_QR_SET, &query.ConventionalDNSResponse{}).Signature)
+	})
+}
@@ -0,0 +1,152 @@
+package fingerprint
+
+import (
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+// CHAOS probes, see https://www.rfc-editor.org/rfc/rfc4892.html
+const PROBE_VERSION_BIND = "version.bind"
+const PROBE_VERSION_SERVER = "version.server"
+const PROBE_HOSTNAME_BIND = "hostname.bind"
+const PROBE_ID_SERVER = "id.server"
+
+// PowerDNS answers version.pdns, dnsmasq reports its cache size on cachesize.bind
+const PROBE_VERSION_PDNS = "version.pdns"
+const PROBE_CACHESIZE_BIND = "cachesize.bind"
+
+// behavioural probes in the spirit of fpdns
+const PROBE_NSID = "nsid"
+const PROBE_IQUERY = "iquery"
+const PROBE_UNKNOWN_OPCODE = "unknown_opcode"
+const PROBE_UNKNOWN_CLASS = "unknown_class"
+const PROBE_QR_SET = "qr_set"
+const PROBE_ODD_FLAGS = "odd_flags"
+const PROBE_NO_QUESTION = "no_question"
+const PROBE_TC_SET = "tc_set"
+const PROBE_TRUNCATION = "truncation"
+
+// UNKNOWN_OPCODE is unassigned, see https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml#dns-parameters-5
+const UNKNOWN_OPCODE = 15
+
+// UNKNOWN_CLASS is unassigned, see https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml#dns-parameters-2
+const UNKNOWN_CLASS = 42
+
+// TRUNCATION_UDP_SIZE is the advertised UDP payload size of the truncation probe, the root DNSKEY RRset with signatures exceeds it
+const TRUNCATION_UDP_SIZE = 512
+
+// Probe is a single query of the fingerprint scan
+type Probe struct {
+	Name   string                         `json:"name"`
+	Query  *query.ConventionalDNSQuery    `json:"query"`
+	Result *query.ConventionalDNSResponse `json:"result"`
+	// Error is the query error, behavioural probes often stay unanswered on purpose
+	Error string `json:"error"`
+	// UDPSize is the advertised EDNS(0) UDP payload size, 0 keeps the default of the query handler
+	UDPSize uint16 `json:"udp_size"`
+}
+
+// SetUDPSize adds an OPT record advertising the UDP payload size to the query message
+// Do not use this function before marshaling the probe but before sending it as a DNS query
+func (p *Probe) SetUDPSize() {
+	if p.UDPSize == 0 || p.Query == nil || p.Query.QueryMsg == nil {
+		return
+	}
+
+	if opt := p.Query.QueryMsg.IsEdns0(); opt != nil {
+		opt.SetUDPSize(p.UDPSize)
+		return
+	}
+	p.Query.QueryMsg.SetEdns0(p.UDPSize, p.Query.DNSSEC)
+}
+
+// NewProbes returns the probes complementing version.bind and version.server
+func NewProbes(host string) []*Probe {
+	return []*Probe{
+		NewChaosProbe(host, PROBE_HOSTNAME_BIND),
+		NewChaosProbe(host, PROBE_ID_SERVER),
+		NewChaosProbe(host, PROBE_VERSION_PDNS),
+		NewChaosProbe(host, PROBE_CACHESIZE_BIND),
+		newNSIDProbe(host),
+		newOpcodeProbe(host, PROBE_IQUERY, dns.OpcodeIQuery),
+		newOpcodeProbe(host, PROBE_UNKNOWN_OPCODE, UNKNOWN_OPCODE),
+		newUnknownClassProbe(host),
+		newFlagProbe(host, PROBE_QR_SET, func(msg *dns.Msg) { msg.Response = true }),
+		newFlagProbe(host, PROBE_ODD_FLAGS, func(msg *dns.Msg) {
+			msg.Authoritative = true
+			msg.Zero = true
+			msg.AuthenticatedData = true
+			msg.CheckingDisabled = true
+		}),
+		newFlagProbe(host, PROBE_NO_QUESTION, func(msg *dns.Msg) { msg.Question = []dns.Question{} }),
+		newFlagProbe(host, PROBE_TC_SET, func(msg *dns.Msg) { msg.Truncated = true }),
+		newTruncationProbe(host),
+	}
+}
+
+// NewChaosProbe asks for the TXT record of the name in class CHAOS
+func NewChaosProbe(host string, name string) *Probe {
+	q := newProbeQuery(host)
+	q.QueryMsg.Question = []dns.Question{{
+		Name:   dns.Fqdn(name),
+		Qtype:  dns.TypeTXT,
+		Qclass: dns.ClassCHAOS,
+	}}
+
+	return &Probe{Name: name, Query: q}
+}
+
+// newNSIDProbe sends an ordinary query requesting the NSID, the other probes are sent without EDNS
+func newNSIDProbe(host string) *Probe {
+	q := newProbeQuery(host)
+	q.NSID = true
+
+	return &Probe{Name: PROBE_NSID, Query: q}
+}
+
+func newOpcodeProbe(host string, name string, opcode int) *Probe {
+	q := newProbeQuery(host)
+	q.QueryMsg.Opcode = opcode
+
+	return &Probe{Name: name, Query: q}
+}
+
+func newUnknownClassProbe(host string) *Probe {
+	q := newProbeQuery(host)
+	q.QueryMsg.Question[0].Qclass = UNKNOWN_CLASS
+
+	return &Probe{Name: PROBE_UNKNOWN_CLASS, Query: q}
+}
+
+func newFlagProbe(host string, name string, setFlags func(msg *dns.Msg)) *Probe {
+	q := newProbeQuery(host)
+	setFlags(q.QueryMsg)
+
+	return &Probe{Name: name, Query: q}
+}
+
+// newTruncationProbe asks for the signed root DNSKEY RRset over UDP without falling back to TCP
+func newTruncationProbe(host string) *Probe {
+	q := newProbeQuery(host)
+	q.QueryMsg.SetQuestion(".", dns.TypeDNSKEY)
+	q.QueryMsg.Id = 0
+	q.DNSSEC = true
+
+	return &Probe{Name: PROBE_TRUNCATION, Query: q, UDPSize: TRUNCATION_UDP_SIZE}
+}
+
+// newProbeQuery sends the default query once over UDP, unanswered probes are part of the fingerprint
+func newProbeQuery(host string) *query.ConventionalDNSQuery {
+	q := query.NewConventionalQuery()
+	q.Host = host
+	q.DNSSEC = false
+	q.MaxUDPRetries = 1
+	q.AutoFallbackTCP = false
+
+	q.QueryMsg = new(dns.Msg)
+	q.QueryMsg.SetQuestion(dns.Fqdn(query.QUERY_HOST), dns.TypeA)
+	q.QueryMsg.Id = 0
+	q.QueryMsg.RecursionDesired = true
+
+	return q
+}
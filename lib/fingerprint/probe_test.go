@@ -0,0 +1,160 @@
+package fingerprint_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getProbe(t *testing.T, probes []*fingerprint.Probe, name string) *fingerprint.Probe {
+	t.Helper()
+
+	for _, probe := range probes {
+		if probe.Name == name {
+			return probe
+		}
+	}
+
+	require.Failf(t, "probe not found", "probe %s", name)
+	return nil
+}
+
+// startTestChaosServer starts a local Do53 server answering CHAOS TXT queries with the TXT of the name
+func startTestChaosServer(t *testing.T, txts map[string]string) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+
+			if len(r.Question) > 0 && r.Question[0].Qclass == dns.ClassCHAOS {
+				if txt, ok := txts[r.Question[0].Name]; ok {
+					m.Answer = append(m.Answer, &dns.TXT{
+						Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+						Txt: []string{txt},
+					})
+				} else {
+					m.Rcode = dns.RcodeRefused
+				}
+			}
+
+			_ = w.WriteMsg(m)
+		}),
+	}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func TestNewProbes(t *testing.T) {
+	t.Parallel()
+
+	probes := fingerprint.NewProbes("8.8.8.8")
+
+	names := map[string]bool{}
+	for _, probe := range probes {
+		assert.False(t, names[probe.Name], "probe %s should be unique", probe.Name)
+		names[probe.Name] = true
+
+		assert.Equal(t, "8.8.8.8", probe.Query.Host)
+		assert.False(t, probe.Query.AutoFallbackTCP, "probe %s should not fall back to TCP", probe.Name)
+		assert.Nil(t, probe.Result)
+	}
+
+	hostname := getProbe(t, probes, fingerprint.PROBE_HOSTNAME_BIND)
+	assert.Equal(t, dns.Question{Name: "hostname.bind.", Qtype: dns.TypeTXT, Qclass: dns.ClassCHAOS}, hostname.Query.QueryMsg.Question[0])
+
+	assert.Equal(t, fingerprint.UNKNOWN_OPCODE, getProbe(t, probes, fingerprint.PROBE_UNKNOWN_OPCODE).Query.QueryMsg.Opcode)
+	assert.Equal(t, uint16(fingerprint.UNKNOWN_CLASS), getProbe(t, probes, fingerprint.PROBE_UNKNOWN_CLASS).Query.QueryMsg.Question[0].Qclass)
+	assert.True(t, getProbe(t, probes, fingerprint.PROBE_QR_SET).Query.QueryMsg.Response)
+	assert.True(t, getProbe(t, probes, fingerprint.PROBE_TC_SET).Query.QueryMsg.Truncated)
+	assert.Empty(t, getProbe(t, probes, fingerprint.PROBE_NO_QUESTION).Query.QueryMsg.Question)
+
+	truncation := getProbe(t, probes, fingerprint.PROBE_TRUNCATION)
+	assert.Nil(t, truncation.Query.QueryMsg.IsEdns0(), "should not add the OPT record before marshaling")
+	assert.Equal(t, uint16(fingerprint.TRUNCATION_UDP_SIZE), truncation.UDPSize)
+	assert.True(t, truncation.Query.DNSSEC)
+
+	for _, probe := range probes {
+		assert.Equal(t, probe.Name == fingerprint.PROBE_NSID, probe.Query.NSID, "only the nsid probe should request the NSID")
+	}
+}
+
+func TestProbe_SetUDPSize(t *testing.T) {
+	t.Parallel()
+
+	t.Run("add OPT record", func(t *testing.T) {
+		t.Parallel()
+
+		probe := getProbe(t, fingerprint.NewProbes("host"), fingerprint.PROBE_TRUNCATION)
+		probe.SetUDPSize()
+		probe.Query.SetDNSSEC()
+
+		opt := probe.Query.QueryMsg.IsEdns0()
+		require.NotNil(t, opt)
+		assert.Equal(t, uint16(fingerprint.TRUNCATION_UDP_SIZE), opt.UDPSize())
+		assert.True(t, opt.Do())
+		assert.Len(t, probe.Query.QueryMsg.Extra, 1)
+	})
+
+	t.Run("default size", func(t *testing.T) {
+		t.Parallel()
+
+		probe := getProbe(t, fingerprint.NewProbes("host"), fingerprint.PROBE_NSID)
+		probe.SetUDPSize()
+
+		assert.Nil(t, probe.Query.QueryMsg.IsEdns0())
+	})
+}
+
+func TestProbes_Local(t *testing.T) {
+	t.Parallel()
+
+	host, port, err := net.SplitHostPort(startTestChaosServer(t, map[string]string{
+		"hostname.bind.": "resolver-1",
+	}))
+	require.NoError(t, err)
+
+	qh := query.NewConventionalDNSQueryHandler(nil)
+	responses := map[string]*query.ConventionalDNSResponse{}
+
+	for _, probe := range fingerprint.NewProbes(host) {
+		probe.Query.Port, err = net.LookupPort("udp", port)
+		require.NoError(t, err)
+		probe.Query.Timeout = 500 * time.Millisecond
+
+		// every probe must be packable, the server may drop the odd ones
+		probe.SetUDPSize()
+		res, _ := qh.Query(probe.Query)
+		responses[probe.Name] = res
+
+		// the behaviour of servers without EDNS is part of the fingerprint
+		if probe.Name != fingerprint.PROBE_NSID && probe.Name != fingerprint.PROBE_TRUNCATION {
+			assert.Nil(t, probe.Query.QueryMsg.IsEdns0(), "probe %s should be sent without EDNS", probe.Name)
+		}
+	}
+
+	observations := fingerprint.NewObservations(responses)
+
+	assert.Equal(t, "resolver-1", observations[fingerprint.PROBE_HOSTNAME_BIND].Text)
+	assert.Contains(t, observations[fingerprint.PROBE_ID_SERVER].Signature, "rcode=REFUSED")
+	assert.Contains(t, observations[fingerprint.PROBE_NSID].Signature, "opcode=QUERY rcode=NOERROR")
+	assert.Contains(t, observations[fingerprint.PROBE_UNKNOWN_OPCODE].Signature, "rcode=NOTIMP", "the local server rejects unknown opcodes")
+}
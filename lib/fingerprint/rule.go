@@ -0,0 +1,232 @@
+package fingerprint
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+)
+
+const SOFTWARE_UNKNOWN = "unknown"
+const SOFTWARE_BIND = "BIND"
+const SOFTWARE_UNBOUND = "Unbound"
+const SOFTWARE_POWERDNS_RECURSOR = "PowerDNS Recursor"
+const SOFTWARE_POWERDNS_AUTHORITATIVE = "PowerDNS Authoritative"
+const SOFTWARE_DNSMASQ = "dnsmasq"
+const SOFTWARE_KNOT_RESOLVER = "Knot Resolver"
+const SOFTWARE_KNOT_DNS = "Knot DNS"
+const SOFTWARE_WINDOWS = "Microsoft DNS"
+const SOFTWARE_NSD = "NSD"
+
+// RULE_VERSION_GROUP is the named group of a text pattern that extracts the version
+const RULE_VERSION_GROUP = "version"
+
+// Rule attributes an observation of a probe to a software
+type Rule struct {
+	Name     string `json:"name"`
+	Software string `json:"software"`
+	Probe    string `json:"probe"`
+	// Text is matched against the text of the observation, the group version extracts the version (optional)
+	Text string `json:"text"`
+	// Signature is matched against the signature of the observation (optional)
+	Signature string `json:"signature"`
+	// Weight is the probability that a match identifies the software
+	Weight float64 `json:"weight"`
+
+	text      *regexp.Regexp
+	signature *regexp.Regexp
+}
+
+// RuleSet classifies the software of servers, rule sets are JSON files, see rules.json
+type RuleSet struct {
+	// Revision must be increased whenever the rules change to tell stale classifications apart
+	Revision int     `json:"revision"`
+	Rules    []*Rule `json:"rules"`
+}
+
+//go:embed rules.json
+var defaultRuleSet []byte // nolint: gochecknoglobals
+
+// DEFAULT_RULE_SET covers CHAOS names only some software answers and how software answers malformed or
+// unusual queries, version strings are attributed by the version pattern table of the scan package
+//
+// nolint: gochecknoglobals
+var DEFAULT_RULE_SET = mustParseRuleSet(defaultRuleSet)
+
+// NewTextRule creates a rule matching the text of the observation with a compiled pattern
+func NewTextRule(name string, software string, probe string, text *regexp.Regexp, weight float64) *Rule {
+	return &Rule{
+		Name:     name,
+		Software: software,
+		Probe:    probe,
+		Text:     text.String(),
+		Weight:   weight,
+		text:     text,
+	}
+}
+
+// Match returns whether the observation matches all patterns of the rule and the extracted version
+func (r *Rule) Match(observation *Observation) (bool, string) {
+	if observation == nil || (r.text == nil && r.signature == nil) {
+		return false, ""
+	}
+
+	if r.signature != nil && !r.signature.MatchString(observation.Signature) {
+		return false, ""
+	}
+
+	if r.text == nil {
+		return true, ""
+	}
+
+	match := r.text.FindStringSubmatch(observation.Text)
+	if match == nil {
+		return false, ""
+	}
+
+	if i := r.text.SubexpIndex(RULE_VERSION_GROUP); i > 0 {
+		return true, match[i]
+	}
+
+	return true, ""
+}
+
+func (r *Rule) compile() (err error) {
+	if r.Text != "" {
+		if r.text, err = regexp.Compile(r.Text); err != nil {
+			return fmt.Errorf("invalid text pattern of rule %s: %w", r.Name, err)
+		}
+	}
+
+	if r.Signature != "" {
+		if r.signature, err = regexp.Compile(r.Signature); err != nil {
+			return fmt.Errorf("invalid signature pattern of rule %s: %w", r.Name, err)
+		}
+	}
+
+	if r.text == nil && r.signature == nil {
+		return fmt.Errorf("rule %s has neither text nor signature pattern", r.Name)
+	}
+
+	return nil
+}
+
+// ParseRuleSet parses and compiles a JSON rule set
+func ParseRuleSet(data []byte) (*RuleSet, error) {
+	ruleSet := &RuleSet{}
+	if err := json.Unmarshal(data, ruleSet); err != nil {
+		return nil, fmt.Errorf("failed to parse rule set: %w", err)
+	}
+
+	for _, rule := range ruleSet.Rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ruleSet, nil
+}
+
+// LoadRuleSet reads a JSON rule set from a file
+func LoadRuleSet(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRuleSet(data)
+}
+
+func mustParseRuleSet(data []byte) *RuleSet {
+	ruleSet, err := ParseRuleSet(data)
+	if err != nil {
+		panic(err)
+	}
+
+	return ruleSet
+}
+
+// Candidate is a software matched by at least one rule
+type Candidate struct {
+	Software string `json:"software"`
+	Version  string `json:"version"`
+	// Score combines the weights of the matched rules as 1 - Π(1 - weight)
+	Score float64  `json:"score"`
+	Rules []string `json:"rules"`
+}
+
+type Classification struct {
+	Software string `json:"software"`
+	Version  string `json:"version"`
+	// Confidence is the score of the best candidate discounted by the score of the runner-up
+	Confidence float64 `json:"confidence"`
+	// Candidates are sorted by score
+	Candidates []*Candidate `json:"candidates"`
+	// Revision is the revision of the rule set the observations were classified with
+	Revision int `json:"revision"`
+}
+
+// Classify applies the rules to the observations, the software is unknown if no rule matches
+func Classify(observations Observations, ruleSet *RuleSet) *Classification {
+	candidates := map[string]*Candidate{}
+	missProbabilities := map[string]float64{}
+	versionWeights := map[string]float64{}
+
+	for _, rule := range ruleSet.Rules {
+		matched, version := rule.Match(observations[rule.Probe])
+		if !matched {
+			continue
+		}
+
+		candidate, ok := candidates[rule.Software]
+		if !ok {
+			candidate = &Candidate{Software: rule.Software, Rules: []string{}}
+			candidates[rule.Software] = candidate
+			missProbabilities[rule.Software] = 1
+		}
+
+		candidate.Rules = append(candidate.Rules, rule.Name)
+		missProbabilities[rule.Software] *= 1 - rule.Weight
+		candidate.Score = 1 - missProbabilities[rule.Software]
+
+		// the version of the most reliable rule wins
+		if version != "" && rule.Weight > versionWeights[rule.Software] {
+			candidate.Version = version
+			versionWeights[rule.Software] = rule.Weight
+		}
+	}
+
+	classification := &Classification{
+		Software:   SOFTWARE_UNKNOWN,
+		Candidates: []*Candidate{},
+		Revision:   ruleSet.Revision,
+	}
+
+	for _, candidate := range candidates {
+		classification.Candidates = append(classification.Candidates, candidate)
+	}
+
+	if len(classification.Candidates) == 0 {
+		return classification
+	}
+
+	slices.SortFunc(classification.Candidates, func(a, b *Candidate) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Software, b.Software)
+	})
+
+	best := classification.Candidates[0]
+	classification.Software = best.Software
+	classification.Version = best.Version
+	classification.Confidence = best.Score
+	if len(classification.Candidates) > 1 {
+		classification.Confidence *= 1 - classification.Candidates[1].Score
+	}
+
+	return classification
+}
@@ -0,0 +1,245 @@
+package fingerprint_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRuleSet = `{
+	"revision": 7,
+	"rules": [
+		{"name": "qr_set_notimp", "software": "test", "probe": "qr_set", "signature": "rcode=NOTIMP", "weight": 0.3},
+		{"name": "text_and_signature", "software": "test", "probe": "version.bind", "text": "^v(?P<version>\\d+)", "signature": "aa", "weight": 0.5}
+	]
+}`
+
+// testVersionRuleSet attributes version strings like the rules the scan package derives from its pattern table
+const testVersionRuleSet = `{
+	"revision": 1,
+	"rules": [
+		{"name": "bind_version", "software": "BIND", "probe": "version.bind", "text": "^(?P<version>9\\.\\d+\\.\\d+)", "weight": 0.9},
+		{"name": "unbound_version", "software": "Unbound", "probe": "version.bind", "text": "(?i)^unbound (?P<version>\\d\\S*)", "weight": 0.95},
+		{"name": "unbound_version_server", "software": "Unbound", "probe": "version.server", "text": "(?i)^unbound (?P<version>\\d\\S*)", "weight": 0.95},
+		{"name": "dnsmasq_cachesize", "software": "dnsmasq", "probe": "cachesize.bind", "text": "^\\d+$", "weight": 0.8}
+	]
+}`
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	versionRuleSet, err := fingerprint.ParseRuleSet([]byte(testVersionRuleSet))
+	require.NoError(t, err)
+
+	t.Run("BIND version.bind", func(t *testing.T) {
+		t.Parallel()
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_VERSION_BIND: {Text: "9.18.28-0ubuntu0.22.04.1-Ubuntu"},
+		}, versionRuleSet)
+
+		assert.Equal(t, fingerprint.SOFTWARE_BIND, classification.Software)
+		assert.Equal(t, "9.18.28", classification.Version)
+		assert.InDelta(t, 0.9, classification.Confidence, 1e-9)
+		require.Len(t, classification.Candidates, 1)
+		assert.Equal(t, []string{"bind_version"}, classification.Candidates[0].Rules)
+		assert.Equal(t, versionRuleSet.Revision, classification.Revision)
+	})
+
+	t.Run("combine rules", func(t *testing.T) {
+		t.Parallel()
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_VERSION_BIND:   {Text: "unbound 1.19.2"},
+			fingerprint.PROBE_VERSION_SERVER: {Text: "unbound 1.19.2"},
+		}, versionRuleSet)
+
+		assert.Equal(t, fingerprint.SOFTWARE_UNBOUND, classification.Software)
+		assert.Equal(t, "1.19.2", classification.Version)
+		assert.InDelta(t, 1-0.05*0.05, classification.Confidence, 1e-9)
+	})
+
+	t.Run("dnsmasq without version", func(t *testing.T) {
+		t.Parallel()
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_VERSION_BIND:   {Signature: "opcode=QUERY rcode=REFUSED flags=qr,rd an=0 ns=0 ar=0"},
+			fingerprint.PROBE_CACHESIZE_BIND: {Text: "150"},
+		}, fingerprint.DEFAULT_RULE_SET)
+
+		assert.Equal(t, fingerprint.SOFTWARE_DNSMASQ, classification.Software)
+		assert.Empty(t, classification.Version)
+		assert.InDelta(t, 0.8, classification.Confidence, 1e-9)
+	})
+
+	t.Run("conflicting candidates", func(t *testing.T) {
+		t.Parallel()
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_VERSION_BIND:   {Text: "9.18.28"},
+			fingerprint.PROBE_CACHESIZE_BIND: {Text: "150"},
+		}, versionRuleSet)
+
+		assert.Equal(t, fingerprint.SOFTWARE_BIND, classification.Software)
+		assert.InDelta(t, 0.9*0.2, classification.Confidence, 1e-9, "the runner-up should lower the confidence")
+		require.Len(t, classification.Candidates, 2)
+		assert.Equal(t, fingerprint.SOFTWARE_DNSMASQ, classification.Candidates[1].Software)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_VERSION_BIND: {Text: "none of your business"},
+		}, fingerprint.DEFAULT_RULE_SET)
+
+		assert.Equal(t, fingerprint.SOFTWARE_UNKNOWN, classification.Software)
+		assert.Equal(t, 0.0, classification.Confidence)
+		assert.Empty(t, classification.Candidates)
+	})
+
+	t.Run("signature rule", func(t *testing.T) {
+		t.Parallel()
+
+		ruleSet, err := fingerprint.ParseRuleSet([]byte(testRuleSet))
+		require.NoError(t, err)
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_QR_SET: {Signature: "opcode=QUERY rcode=NOTIMP flags=qr an=0 ns=0 ar=0"},
+		}, ruleSet)
+
+		assert.Equal(t, "test", classification.Software)
+		assert.InDelta(t, 0.3, classification.Confidence, 1e-9)
+		assert.Equal(t, 7, classification.Revision)
+	})
+
+	t.Run("hidden version", func(t *testing.T) {
+		t.Parallel()
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_VERSION_BIND:  {Text: "none", Signature: "opcode=QUERY rcode=NOERROR flags=qr,aa,rd an=1 ns=0 ar=0"},
+			fingerprint.PROBE_HOSTNAME_BIND: {Text: "resolver1", Signature: "opcode=QUERY rcode=NOERROR flags=qr,aa,rd an=1 ns=0 ar=0"},
+			fingerprint.PROBE_ID_SERVER:     {Text: "resolver1", Signature: "opcode=QUERY rcode=NOERROR flags=qr,aa,rd an=1 ns=0 ar=0"},
+			fingerprint.PROBE_TC_SET:        {Signature: "opcode=QUERY rcode=FORMERR flags=qr,rd,ra an=0 ns=0 ar=0"},
+		}, fingerprint.DEFAULT_RULE_SET)
+
+		assert.Equal(t, fingerprint.SOFTWARE_UNBOUND, classification.Software, "the behaviour should identify the software")
+		assert.Empty(t, classification.Version)
+		assert.Positive(t, classification.Confidence)
+		assert.Contains(t, classification.Candidates[0].Rules, "unbound_tc_set_formerr")
+	})
+
+	t.Run("unanswered probe", func(t *testing.T) {
+		t.Parallel()
+
+		classification := fingerprint.Classify(fingerprint.Observations{
+			fingerprint.PROBE_UNKNOWN_OPCODE: {Signature: fingerprint.SIGNATURE_NO_RESPONSE},
+			fingerprint.PROBE_UNKNOWN_CLASS:  {Signature: "opcode=QUERY rcode=NOTIMP flags=qr,rd,ra an=0 ns=0 ar=1"},
+		}, fingerprint.DEFAULT_RULE_SET)
+
+		assert.Equal(t, fingerprint.SOFTWARE_POWERDNS_RECURSOR, classification.Software)
+		assert.InDelta(t, 1-0.7*0.6, classification.Confidence, 1e-9)
+	})
+}
+
+func TestRule_Match(t *testing.T) {
+	t.Parallel()
+
+	t.Run("rule without patterns", func(t *testing.T) {
+		t.Parallel()
+
+		matched, _ := (&fingerprint.Rule{Probe: fingerprint.PROBE_VERSION_BIND}).Match(&fingerprint.Observation{Text: "9.18.28"})
+
+		assert.False(t, matched)
+	})
+
+	t.Run("missing observation", func(t *testing.T) {
+		t.Parallel()
+
+		matched, _ := fingerprint.DEFAULT_RULE_SET.Rules[0].Match(nil)
+
+		assert.False(t, matched)
+	})
+
+	t.Run("text and signature", func(t *testing.T) {
+		t.Parallel()
+
+		ruleSet, err := fingerprint.ParseRuleSet([]byte(testRuleSet))
+		require.NoError(t, err)
+		rule := ruleSet.Rules[1]
+
+		matched, version := rule.Match(&fingerprint.Observation{Text: "v2", Signature: "flags=qr,aa"})
+		assert.True(t, matched)
+		assert.Equal(t, "2", version)
+
+		matched, _ = rule.Match(&fingerprint.Observation{Text: "v2", Signature: "flags=qr"})
+		assert.False(t, matched)
+	})
+}
+
+func TestParseRuleSet(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default rule set", func(t *testing.T) {
+		t.Parallel()
+
+		// version.bind and version.server are queried by the scan itself
+		probes := map[string]bool{fingerprint.PROBE_VERSION_BIND: true, fingerprint.PROBE_VERSION_SERVER: true}
+		for _, probe := range fingerprint.NewProbes("192.0.2.1") {
+			probes[probe.Name] = true
+		}
+
+		for _, rule := range fingerprint.DEFAULT_RULE_SET.Rules {
+			assert.True(t, probes[rule.Probe], "rule %s should observe a probe", rule.Name)
+			assert.True(t, rule.Weight > 0 && rule.Weight < 1, "rule %s should weigh in (0, 1)", rule.Name)
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fingerprint.ParseRuleSet([]byte(`{"rules": [{"name": "broken", "probe": "nsid", "signature": "("}]}`))
+		assert.ErrorContains(t, err, "broken")
+	})
+
+	t.Run("rule without patterns", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fingerprint.ParseRuleSet([]byte(`{"rules": [{"name": "empty", "probe": "nsid", "weight": 0.5}]}`))
+		assert.ErrorContains(t, err, "empty")
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fingerprint.ParseRuleSet([]byte(`{`))
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadRuleSet(t *testing.T) {
+	t.Parallel()
+
+	t.Run("load file", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "rules.json")
+		require.NoError(t, os.WriteFile(path, []byte(testRuleSet), 0600))
+
+		ruleSet, err := fingerprint.LoadRuleSet(path)
+		require.NoError(t, err)
+		assert.Equal(t, 7, ruleSet.Revision)
+		assert.Len(t, ruleSet.Rules, 2)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fingerprint.LoadRuleSet(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+}
@@ -12,12 +12,12 @@ import (
 
 // nolint: gochecknoglobals
 var SUPPORTED_PROTOCOL_TYPES = []string{
-	"ddr", "doh", "doq", "dot", "certificate", "ptr", "edsr", "fingerprint", "ddr-dnssec", "canary", "all", "resinfo",
+	"ddr", "doh", "doq", "dot", "certificate", "ptr", "edsr", "fingerprint", "ddr-dnssec", "canary", "all", "resinfo", "odoh", "ohttp", "tls-enum", "session", "resumption", "doh-path",
 }
 
 // nolint: gochecknoglobals
 var SUPPORTED_RUN_TYPES = []string{
-	"consumer", "producer",
+	"consumer", "producer", "normalize",
 }
 
 // nolint: gochecknoglobals
@@ -53,6 +53,16 @@ var LOG_LEVEL_ENV = "LOG_LEVEL"
 // nolint: gochecknoglobals
 var PRODUCER_WATCH_DIRECTORY = "PRODUCER_WATCH_DIRECTORY"
 
+// NORMALIZE ENVIRONMENT VARIABLES
+
+// file with stored fingerprint scans to re-normalize and re-classify, one JSON document per line (e.g., mongoexport)
+// nolint: gochecknoglobals
+var NORMALIZE_INPUT_FILE_ENV = "NORMALIZE_INPUT_FILE"
+
+// file the re-normalized fingerprint scans are written to
+// nolint: gochecknoglobals
+var NORMALIZE_OUTPUT_FILE_ENV = "NORMALIZE_OUTPUT_FILE"
+
 // CONSUMER ENVIRONMENT VARIABLES
 
 // nolint: gochecknoglobals
@@ -89,6 +99,15 @@ var THREADS_PTR_ENV = "THREADS_PTR"
 // nolint: gochecknoglobals
 var THREADS_FINGERPRINT_ENV = "THREADS_FINGERPRINT"
 
+// JSON file with the rules fingerprint scans classify the software with (default: built-in rule set)
+// nolint: gochecknoglobals
+var FINGERPRINT_RULE_SET_FILE_PATH_ENV = "FINGERPRINT_RULE_SET_FILE_PATH"
+
+// comma-separated banner probes of fingerprint scans, protocol:port[:timeout] with protocol http, https, telnet or ssh,
+// e.g., http:80,https:443,http:8080,telnet:23 (default: none)
+// nolint: gochecknoglobals
+var FINGERPRINT_BANNER_TARGETS_ENV = "FINGERPRINT_BANNER_TARGETS"
+
 // nolint: gochecknoglobals
 var THREADS_DDR_DNSSEC_ENV = "THREADS_DDR_DNSSEC"
 
@@ -98,6 +117,56 @@ var THREADS_CANARY_ENV = "THREADS_CANARY"
 // nolint: gochecknoglobals
 var THREADS_RESINFO_ENV = "THREADS_RESINFO"
 
+// nolint: gochecknoglobals
+var THREADS_ODOH_ENV = "THREADS_ODOH"
+
+// nolint: gochecknoglobals
+var THREADS_OHTTP_ENV = "THREADS_OHTTP"
+
+// nolint: gochecknoglobals
+var THREADS_TLS_ENUM_ENV = "THREADS_TLS_ENUM"
+
+// schedule TLS version and cipher suite enumeration scans for endpoints discovered by DDR scans (default: false)
+// nolint: gochecknoglobals
+var SCHEDULE_TLS_ENUM_SCANS_ENV = "SCHEDULE_TLS_ENUM_SCANS"
+
+// nolint: gochecknoglobals
+var THREADS_SESSION_ENV = "THREADS_SESSION"
+
+// schedule connection reuse and pipelining scans for endpoints discovered by DDR scans (default: false)
+// nolint: gochecknoglobals
+var SCHEDULE_SESSION_SCANS_ENV = "SCHEDULE_SESSION_SCANS"
+
+// nolint: gochecknoglobals
+var THREADS_RESUMPTION_ENV = "THREADS_RESUMPTION"
+
+// schedule TLS session resumption and 0-RTT scans for endpoints discovered by DDR scans (default: false)
+// nolint: gochecknoglobals
+var SCHEDULE_RESUMPTION_SCANS_ENV = "SCHEDULE_RESUMPTION_SCANS"
+
+// nolint: gochecknoglobals
+var THREADS_DOH_PATH_ENV = "THREADS_DOH_PATH"
+
+// comma-separated paths probed by DoH path discovery scans (default: /dns-query,/resolve,/query,/)
+// nolint: gochecknoglobals
+var DOH_DISCOVERY_PATHS_ENV = "DOH_DISCOVERY_PATHS"
+
+// oblivious proxy used for ODoH scans
+// nolint: gochecknoglobals
+var ODOH_PROXY_ENV = "ODOH_PROXY"
+
+// file with DS/DNSKEY records used as trust anchor for DNSSEC validation (default: root KSKs)
+// nolint: gochecknoglobals
+var DNSSEC_TRUST_ANCHOR_FILE_PATH_ENV = "DNSSEC_TRUST_ANCHOR_FILE_PATH"
+
+// PEM file with root certificates certificate chains are verified against in addition to the system pool
+// nolint: gochecknoglobals
+var CERTIFICATE_ROOT_BUNDLE_PATH_ENV = "CERTIFICATE_ROOT_BUNDLE_PATH"
+
+// JSON file with the patterns version.bind and version.server strings are normalized with (default: built-in table)
+// nolint: gochecknoglobals
+var VERSION_PATTERN_TABLE_FILE_PATH_ENV = "VERSION_PATTERN_TABLE_FILE_PATH"
+
 // nolint: gochecknoglobals
 var BLOCKLIST_FILE_PATH_ENV = "BLOCKLIST_FILE_PATH"
 
@@ -0,0 +1,367 @@
+package hpke
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// This package implements the base mode of Hybrid Public Key Encryption (HPKE) as required by
+// Oblivious DoH (RFC 9230) and Oblivious HTTP (RFC 9458), see https://www.rfc-editor.org/rfc/rfc9180.html
+
+// see https://www.rfc-editor.org/rfc/rfc9180.html#name-key-encapsulation-mechanism
+const KEM_P256_HKDF_SHA256 uint16 = 0x0010
+const KEM_X25519_HKDF_SHA256 uint16 = 0x0020
+
+// see https://www.rfc-editor.org/rfc/rfc9180.html#name-key-derivation-functions-kd
+const KDF_HKDF_SHA256 uint16 = 0x0001
+const KDF_HKDF_SHA384 uint16 = 0x0002
+const KDF_HKDF_SHA512 uint16 = 0x0003
+
+// see https://www.rfc-editor.org/rfc/rfc9180.html#name-authenticated-encryption-wi
+const AEAD_AES_128_GCM uint16 = 0x0001
+const AEAD_AES_256_GCM uint16 = 0x0002
+const AEAD_CHACHA20_POLY1305 uint16 = 0x0003
+
+const MODE_BASE byte = 0x00
+
+const hpkeVersionLabel = "HPKE-v1"
+
+// Suite is a combination of KEM, KDF and AEAD
+type Suite struct {
+	KEMId  uint16 `json:"kem_id"`
+	KDFId  uint16 `json:"kdf_id"`
+	AEADId uint16 `json:"aead_id"`
+}
+
+// IsSupported returns true if all algorithms of the suite are implemented
+func (s *Suite) IsSupported() bool {
+	return s.check() == nil
+}
+
+func (s *Suite) check() error {
+	if s.curve() == nil {
+		return custom_errors.ErrUnsupportedKEM
+	}
+
+	if s.kdfHash() == nil {
+		return custom_errors.ErrUnsupportedKDF
+	}
+
+	if s.KeySize() == 0 {
+		return custom_errors.ErrUnsupportedAEAD
+	}
+
+	return nil
+}
+
+// KeySize returns Nk, the length in bytes of the AEAD key
+func (s *Suite) KeySize() int {
+	switch s.AEADId {
+	case AEAD_AES_128_GCM:
+		return 16
+	case AEAD_AES_256_GCM, AEAD_CHACHA20_POLY1305:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// EncapsulatedKeySize returns Nenc, the length in bytes of an encapsulated key
+func (s *Suite) EncapsulatedKeySize() int {
+	switch s.KEMId {
+	case KEM_P256_HKDF_SHA256:
+		return 65
+	case KEM_X25519_HKDF_SHA256:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// NonceSize returns Nn, the length in bytes of the AEAD nonce
+func (s *Suite) NonceSize() int {
+	return 12
+}
+
+// HashSize returns Nh, the output size of the KDF
+func (s *Suite) HashSize() int {
+	h := s.kdfHash()
+	if h == nil {
+		return 0
+	}
+	return h().Size()
+}
+
+// Extract is the (unlabeled) HKDF-Extract of the suite's KDF
+func (s *Suite) Extract(salt, ikm []byte) ([]byte, error) {
+	h := s.kdfHash()
+	if h == nil {
+		return nil, custom_errors.ErrUnsupportedKDF
+	}
+	return hkdf.Extract(h, ikm, salt)
+}
+
+// Expand is the (unlabeled) HKDF-Expand of the suite's KDF
+func (s *Suite) Expand(prk, info []byte, length int) ([]byte, error) {
+	h := s.kdfHash()
+	if h == nil {
+		return nil, custom_errors.ErrUnsupportedKDF
+	}
+	return hkdf.Expand(h, prk, string(info), length)
+}
+
+// NewAEAD creates the suite's AEAD with the given key
+func (s *Suite) NewAEAD(key []byte) (cipher.AEAD, error) {
+	switch s.AEADId {
+	case AEAD_AES_128_GCM, AEAD_AES_256_GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AEAD_CHACHA20_POLY1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, custom_errors.ErrUnsupportedAEAD
+	}
+}
+
+// GenerateKeyPair generates a new key pair for the suite's KEM
+func (s *Suite) GenerateKeyPair() (*ecdh.PrivateKey, error) {
+	c := s.curve()
+	if c == nil {
+		return nil, custom_errors.ErrUnsupportedKEM
+	}
+	return c.GenerateKey(rand.Reader)
+}
+
+// SetupBaseS establishes a sender context to the receiver's public key pkRm (serialized)
+func (s *Suite) SetupBaseS(pkRm []byte, info []byte) (enc []byte, ctx *Context, err error) {
+	if err := s.check(); err != nil {
+		return nil, nil, err
+	}
+
+	pkR, err := s.curve().NewPublicKey(pkRm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", custom_errors.ErrInvalidPublicKey, err.Error())
+	}
+
+	skE, err := s.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dh, err := skE.ECDH(pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc = skE.PublicKey().Bytes()
+	kemContext := append(append([]byte{}, enc...), pkRm...)
+
+	sharedSecret, err := s.extractAndExpand(dh, kemContext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, err = s.keySchedule(sharedSecret, info)
+	return enc, ctx, err
+}
+
+// SetupBaseR establishes a receiver context from the encapsulated key enc
+func (s *Suite) SetupBaseR(enc []byte, skR *ecdh.PrivateKey, info []byte) (*Context, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+
+	pkE, err := s.curve().NewPublicKey(enc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", custom_errors.ErrInvalidPublicKey, err.Error())
+	}
+
+	dh, err := skR.ECDH(pkE)
+	if err != nil {
+		return nil, err
+	}
+
+	kemContext := append(append([]byte{}, enc...), skR.PublicKey().Bytes()...)
+
+	sharedSecret, err := s.extractAndExpand(dh, kemContext)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.keySchedule(sharedSecret, info)
+}
+
+func (s *Suite) curve() ecdh.Curve {
+	switch s.KEMId {
+	case KEM_P256_HKDF_SHA256:
+		return ecdh.P256()
+	case KEM_X25519_HKDF_SHA256:
+		return ecdh.X25519()
+	default:
+		return nil
+	}
+}
+
+func (s *Suite) kdfHash() func() hash.Hash {
+	switch s.KDFId {
+	case KDF_HKDF_SHA256:
+		return sha256.New
+	case KDF_HKDF_SHA384:
+		return sha512.New384
+	case KDF_HKDF_SHA512:
+		return sha512.New
+	default:
+		return nil
+	}
+}
+
+func (s *Suite) kemSuiteId() []byte {
+	return binary.BigEndian.AppendUint16([]byte("KEM"), s.KEMId)
+}
+
+func (s *Suite) hpkeSuiteId() []byte {
+	id := []byte("HPKE")
+	id = binary.BigEndian.AppendUint16(id, s.KEMId)
+	id = binary.BigEndian.AppendUint16(id, s.KDFId)
+	return binary.BigEndian.AppendUint16(id, s.AEADId)
+}
+
+// extractAndExpand derives the KEM shared secret, both supported DHKEMs use HKDF-SHA256 with Nsecret = 32
+func (s *Suite) extractAndExpand(dh, kemContext []byte) ([]byte, error) {
+	prk, err := labeledExtract(sha256.New, s.kemSuiteId(), nil, "eae_prk", dh)
+	if err != nil {
+		return nil, err
+	}
+	return labeledExpand(sha256.New, s.kemSuiteId(), prk, "shared_secret", kemContext, 32)
+}
+
+func (s *Suite) keySchedule(sharedSecret, info []byte) (*Context, error) {
+	h := s.kdfHash()
+	suiteId := s.hpkeSuiteId()
+
+	pskIdHash, err := labeledExtract(h, suiteId, nil, "psk_id_hash", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	infoHash, err := labeledExtract(h, suiteId, nil, "info_hash", info)
+	if err != nil {
+		return nil, err
+	}
+
+	ksContext := append([]byte{MODE_BASE}, pskIdHash...)
+	ksContext = append(ksContext, infoHash...)
+
+	secret, err := labeledExtract(h, suiteId, sharedSecret, "secret", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := labeledExpand(h, suiteId, secret, "key", ksContext, s.KeySize())
+	if err != nil {
+		return nil, err
+	}
+
+	baseNonce, err := labeledExpand(h, suiteId, secret, "base_nonce", ksContext, s.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	exporterSecret, err := labeledExpand(h, suiteId, secret, "exp", ksContext, s.HashSize())
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := s.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Context{
+		suite:          s,
+		aead:           aead,
+		baseNonce:      baseNonce,
+		exporterSecret: exporterSecret,
+	}, nil
+}
+
+func labeledExtract(h func() hash.Hash, suiteId, salt []byte, label string, ikm []byte) ([]byte, error) {
+	labeledIkm := append([]byte(hpkeVersionLabel), suiteId...)
+	labeledIkm = append(labeledIkm, label...)
+	labeledIkm = append(labeledIkm, ikm...)
+	return hkdf.Extract(h, labeledIkm, salt)
+}
+
+func labeledExpand(h func() hash.Hash, suiteId, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	labeledInfo := binary.BigEndian.AppendUint16(nil, uint16(length))
+	labeledInfo = append(labeledInfo, hpkeVersionLabel...)
+	labeledInfo = append(labeledInfo, suiteId...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+	return hkdf.Expand(h, prk, string(labeledInfo), length)
+}
+
+// Context is an HPKE encryption context, see https://www.rfc-editor.org/rfc/rfc9180.html#name-encryption-and-decryption
+type Context struct {
+	suite          *Suite
+	aead           cipher.AEAD
+	baseNonce      []byte
+	exporterSecret []byte
+	seq            uint64
+}
+
+// Seal encrypts the plaintext and increments the sequence number
+func (c *Context) Seal(aad, pt []byte) ([]byte, error) {
+	nonce, err := c.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nil, nonce, pt, aad), nil
+}
+
+// Open decrypts the ciphertext and increments the sequence number
+func (c *Context) Open(aad, ct []byte) ([]byte, error) {
+	nonce, err := c.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Open(nil, nonce, ct, aad)
+}
+
+// Export derives a secret from the context, see https://www.rfc-editor.org/rfc/rfc9180.html#name-secret-export
+func (c *Context) Export(exporterContext []byte, length int) ([]byte, error) {
+	return labeledExpand(c.suite.kdfHash(), c.suite.hpkeSuiteId(), c.exporterSecret, "sec", exporterContext, length)
+}
+
+func (c *Context) nextNonce() ([]byte, error) {
+	if c.seq == ^uint64(0) {
+		return nil, custom_errors.ErrMessageLimitReached
+	}
+
+	nonce := make([]byte, len(c.baseNonce))
+	copy(nonce, c.baseNonce)
+
+	// XOR the big-endian sequence number into the last 8 bytes of the base nonce
+	seq := binary.BigEndian.AppendUint64(nil, c.seq)
+	for i := range seq {
+		nonce[len(nonce)-len(seq)+i] ^= seq[i]
+	}
+
+	c.seq++
+
+	return nonce, nil
+}
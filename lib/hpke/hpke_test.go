@@ -0,0 +1,150 @@
+package hpke_test
+
+import (
+	"crypto/ecdh"
+	"encoding/hex"
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/hpke"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	require.Nil(t, err, "test vector should be valid hex")
+
+	return b
+}
+
+func TestSuite_RFC9180TestVector(t *testing.T) {
+	t.Parallel()
+
+	// see https://www.rfc-editor.org/rfc/rfc9180.html#appendix-A.1.1
+	s := &hpke.Suite{
+		KEMId:  hpke.KEM_X25519_HKDF_SHA256,
+		KDFId:  hpke.KDF_HKDF_SHA256,
+		AEADId: hpke.AEAD_AES_128_GCM,
+	}
+
+	skR, err := ecdh.X25519().NewPrivateKey(mustDecodeHex(t, "4612c550263fc8ad58375df3f557aac531d26850903e55a9f23f21d8534e8ac8"))
+	require.Nil(t, err)
+
+	info := mustDecodeHex(t, "4f6465206f6e2061204772656369616e2055726e")
+	enc := mustDecodeHex(t, "37fda3567bdbd628e88668c3c8d7e97d1d1253b6d4ea6d44c150f741f1bf4431")
+
+	ctx, err := s.SetupBaseR(enc, skR, info)
+	require.Nil(t, err, "should have set up receiver context")
+
+	t.Run("open first message", func(t *testing.T) {
+		pt, err := ctx.Open(
+			mustDecodeHex(t, "436f756e742d30"),
+			mustDecodeHex(t, "f938558b5d72f1a23810b4be2ab4f84331acc02fc97babc53a52ae8218a355a96d8770ac83d07bea87e13c512a"),
+		)
+
+		require.Nil(t, err, "should have decrypted ciphertext")
+		assert.Equal(t, "Beauty is truth, truth beauty", string(pt))
+	})
+
+	t.Run("export secret", func(t *testing.T) {
+		exported, err := ctx.Export([]byte{}, 32)
+
+		require.Nil(t, err)
+		assert.Equal(t, "3853fe2b4035195a573ffc53856e77058e15d9ea064de3e59f4961d0095250ee", hex.EncodeToString(exported))
+	})
+}
+
+func TestSuite_SealOpen(t *testing.T) {
+	t.Parallel()
+
+	suites := []*hpke.Suite{
+		{KEMId: hpke.KEM_X25519_HKDF_SHA256, KDFId: hpke.KDF_HKDF_SHA256, AEADId: hpke.AEAD_AES_128_GCM},
+		{KEMId: hpke.KEM_X25519_HKDF_SHA256, KDFId: hpke.KDF_HKDF_SHA512, AEADId: hpke.AEAD_CHACHA20_POLY1305},
+		{KEMId: hpke.KEM_P256_HKDF_SHA256, KDFId: hpke.KDF_HKDF_SHA384, AEADId: hpke.AEAD_AES_256_GCM},
+	}
+
+	for _, s := range suites {
+		t.Run(hex.EncodeToString([]byte{byte(s.KEMId), byte(s.KDFId), byte(s.AEADId)}), func(t *testing.T) {
+			t.Parallel()
+
+			require.True(t, s.IsSupported(), "suite should be supported")
+
+			skR, err := s.GenerateKeyPair()
+			require.Nil(t, err)
+
+			enc, sender, err := s.SetupBaseS(skR.PublicKey().Bytes(), []byte("info"))
+			require.Nil(t, err)
+
+			receiver, err := s.SetupBaseR(enc, skR, []byte("info"))
+			require.Nil(t, err)
+
+			for _, msg := range []string{"first", "second"} {
+				ct, err := sender.Seal([]byte("aad"), []byte(msg))
+				require.Nil(t, err)
+
+				pt, err := receiver.Open([]byte("aad"), ct)
+				require.Nil(t, err)
+				assert.Equal(t, msg, string(pt))
+			}
+
+			senderSecret, err := sender.Export([]byte("context"), s.KeySize())
+			require.Nil(t, err)
+			receiverSecret, err := receiver.Export([]byte("context"), s.KeySize())
+			require.Nil(t, err)
+			assert.Equal(t, senderSecret, receiverSecret, "exported secrets should match")
+		})
+	}
+
+	t.Run("wrong aad", func(t *testing.T) {
+		t.Parallel()
+
+		s := suites[0]
+		skR, err := s.GenerateKeyPair()
+		require.Nil(t, err)
+
+		enc, sender, err := s.SetupBaseS(skR.PublicKey().Bytes(), nil)
+		require.Nil(t, err)
+
+		receiver, err := s.SetupBaseR(enc, skR, nil)
+		require.Nil(t, err)
+
+		ct, err := sender.Seal([]byte("aad"), []byte("msg"))
+		require.Nil(t, err)
+
+		_, err = receiver.Open([]byte("other"), ct)
+		assert.NotNil(t, err, "should not decrypt with wrong aad")
+	})
+}
+
+func TestSuite_Unsupported(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unsupported KEM", func(t *testing.T) {
+		t.Parallel()
+
+		s := &hpke.Suite{KEMId: 0x0042, KDFId: hpke.KDF_HKDF_SHA256, AEADId: hpke.AEAD_AES_128_GCM}
+
+		assert.False(t, s.IsSupported())
+		_, _, err := s.SetupBaseS([]byte{0x01}, nil)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("unsupported AEAD", func(t *testing.T) {
+		t.Parallel()
+
+		s := &hpke.Suite{KEMId: hpke.KEM_X25519_HKDF_SHA256, KDFId: hpke.KDF_HKDF_SHA256, AEADId: 0xFFFF}
+
+		assert.False(t, s.IsSupported())
+	})
+
+	t.Run("invalid public key", func(t *testing.T) {
+		t.Parallel()
+
+		s := &hpke.Suite{KEMId: hpke.KEM_P256_HKDF_SHA256, KDFId: hpke.KDF_HKDF_SHA256, AEADId: hpke.AEAD_AES_128_GCM}
+
+		_, _, err := s.SetupBaseS([]byte{0x01, 0x02}, nil)
+		assert.NotNil(t, err)
+	})
+}
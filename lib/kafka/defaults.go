@@ -18,6 +18,12 @@ const DEFAULT_FINGERPRINT_TOPIC = "fingerprint-scan"
 const DEFAULT_DDR_DNSSEC_TOPIC = "ddr-dnssec-scan"
 const DEFAULT_CANARY_TOPIC = "canary-scan"
 const DEFAULT_RESINFO_TOPIC = "resinfo-scan"
+const DEFAULT_ODOH_TOPIC = "odoh-scan"
+const DEFAULT_OHTTP_TOPIC = "ohttp-scan"
+const DEFAULT_TLS_ENUM_TOPIC = "tls-enum-scan"
+const DEFAULT_SESSION_TOPIC = "session-scan"
+const DEFAULT_RESUMPTION_TOPIC = "resumption-scan"
+const DEFAULT_DOH_PATH_TOPIC = "doh-path-scan"
 
 const DEFAULT_CONCURRENT_CONSUMER = 10
 const DEFAULT_PARTITIONS = 100
@@ -0,0 +1,98 @@
+package query
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ALPN protocol ID of HTTP/3 in Alt-Svc headers, see https://www.rfc-editor.org/rfc/rfc9114.html#section-3.1
+const ALT_SVC_HTTP3 = "h3"
+
+// AltSvc is an alternative service advertised in the Alt-Svc header
+type AltSvc struct {
+	ProtocolID string `json:"protocol_id"`
+	// Host is empty if the alternative is on the same host
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// MaxAge is the ma parameter in seconds, -1 if not set
+	MaxAge int `json:"max_age"`
+}
+
+// ParseAltSvc parses the value of an Alt-Svc header, see https://www.rfc-editor.org/rfc/rfc7838.html#section-3
+// invalid alternatives are skipped, "clear" yields no alternatives
+func ParseAltSvc(header string) []*AltSvc {
+	alternatives := []*AltSvc{}
+
+	for _, value := range splitQuoted(header, ',') {
+		params := splitQuoted(value, ';')
+
+		protocolID, authority, found := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !found {
+			continue
+		}
+
+		protocolID, err := url.PathUnescape(strings.TrimSpace(protocolID))
+		if err != nil {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(strings.Trim(strings.TrimSpace(authority), `"`))
+		if err != nil {
+			continue
+		}
+
+		portNumber, err := strconv.Atoi(port)
+		if err != nil || portNumber <= 0 || portNumber > 65535 {
+			continue
+		}
+
+		altSvc := &AltSvc{
+			ProtocolID: protocolID,
+			Host:       host,
+			Port:       portNumber,
+			MaxAge:     -1,
+		}
+
+		for _, param := range params[1:] {
+			name, paramValue, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(name)) != "ma" {
+				continue
+			}
+
+			if maxAge, err := strconv.Atoi(strings.Trim(strings.TrimSpace(paramValue), `"`)); err == nil {
+				altSvc.MaxAge = maxAge
+			}
+		}
+
+		alternatives = append(alternatives, altSvc)
+	}
+
+	return alternatives
+}
+
+// splitQuoted splits s at sep outside of quoted strings
+func splitQuoted(s string, sep rune) []string {
+	parts := []string{}
+
+	quoted := false
+	escaped := false
+	start := 0
+
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
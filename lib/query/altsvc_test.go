@@ -0,0 +1,58 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	t.Parallel()
+
+	t.Run("multiple alternatives", func(t *testing.T) {
+		t.Parallel()
+
+		alternatives := query.ParseAltSvc(`h3=":443"; ma=86400, h3-29=":8443"; ma=3600; persist=1, h2="alt.example.com:443"`)
+
+		require.Len(t, alternatives, 3)
+		assert.Equal(t, &query.AltSvc{ProtocolID: "h3", Port: 443, MaxAge: 86400}, alternatives[0])
+		assert.Equal(t, &query.AltSvc{ProtocolID: "h3-29", Port: 8443, MaxAge: 3600}, alternatives[1])
+		assert.Equal(t, &query.AltSvc{ProtocolID: "h2", Host: "alt.example.com", Port: 443, MaxAge: -1}, alternatives[2])
+	})
+
+	t.Run("IPv6 alt-authority", func(t *testing.T) {
+		t.Parallel()
+
+		alternatives := query.ParseAltSvc(`h3="[2001:db8::1]:443"`)
+
+		require.Len(t, alternatives, 1)
+		assert.Equal(t, "2001:db8::1", alternatives[0].Host)
+		assert.Equal(t, 443, alternatives[0].Port)
+	})
+
+	t.Run("percent-encoded protocol ID", func(t *testing.T) {
+		t.Parallel()
+
+		alternatives := query.ParseAltSvc(`w%3Dx%3Ay=":443"`)
+
+		require.Len(t, alternatives, 1)
+		assert.Equal(t, "w=x:y", alternatives[0].ProtocolID)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Empty(t, query.ParseAltSvc("clear"))
+	})
+
+	t.Run("invalid alternatives", func(t *testing.T) {
+		t.Parallel()
+
+		alternatives := query.ParseAltSvc(`h3=":0", h3="443", h3, h3=":99999", h3=":8443"`)
+
+		require.Len(t, alternatives, 1)
+		assert.Equal(t, 8443, alternatives[0].Port)
+	})
+}
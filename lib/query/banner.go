@@ -0,0 +1,434 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/helper"
+)
+
+const BANNER_PROTOCOL_HTTP = "http"
+const BANNER_PROTOCOL_HTTPS = "https"
+const BANNER_PROTOCOL_TELNET = "telnet"
+const BANNER_PROTOCOL_SSH = "ssh"
+
+const BANNER_HTTP_TIMEOUT = 5000 * time.Millisecond
+const BANNER_TIMEOUT = 3000 * time.Millisecond
+
+// BANNER_IDLE_TIMEOUT ends reading a Telnet banner once the server stops sending
+const BANNER_IDLE_TIMEOUT = 500 * time.Millisecond
+
+// we do not want to store arbitrary large banners
+const MAX_BANNER_SIZE = 1024
+
+const telnetIAC = 255
+const telnetSB = 250
+const telnetSE = 240
+const telnetWILL = 251
+const telnetWONT = 252
+const telnetDO = 253
+const telnetDONT = 254
+
+var htmlTitleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`) // nolint: gochecknoglobals
+var httpRealmRegexp = regexp.MustCompile(`(?i)realm="([^"]*)"`)            // nolint: gochecknoglobals
+
+// BannerTarget is a port banners are grabbed from and the protocol spoken on it
+type BannerTarget struct {
+	Protocol string        `json:"protocol"`
+	Port     int           `json:"port"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+type BannerQuery struct {
+	Host     string        `json:"host"`
+	Port     int           `json:"port"`
+	Protocol string        `json:"protocol"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+// HTTPBanner identifies the web interface of a device
+type HTTPBanner struct {
+	StatusCode int    `json:"status_code"`
+	Server     string `json:"server"`
+	PoweredBy  string `json:"powered_by"`
+	Title      string `json:"title"`
+	// Realm of HTTP authentication, routers often name their model in it
+	Realm    string `json:"realm"`
+	Location string `json:"location"`
+}
+
+// TelnetBanner is the text a Telnet server sends before the login prompt
+type TelnetBanner struct {
+	Banner string `json:"banner"`
+}
+
+// SSHBanner is the identification string of an SSH server, see RFC 4253 section 4.2
+type SSHBanner struct {
+	// Raw is the identification string, e.g., "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13"
+	Raw             string `json:"raw"`
+	ProtoVersion    string `json:"proto_version"`
+	SoftwareVersion string `json:"software_version"`
+	Comments        string `json:"comments"`
+}
+
+// BannerResponse holds the result of the protocol of the query
+type BannerResponse struct {
+	HTTP   *HTTPBanner   `json:"http"`
+	Telnet *TelnetBanner `json:"telnet"`
+	SSH    *SSHBanner    `json:"ssh"`
+	RTT    time.Duration `json:"rtt"`
+}
+
+type BannerQueryHandler struct {
+	Dialer *net.Dialer
+}
+
+func (qh *BannerQueryHandler) Query(query *BannerQuery) (*BannerResponse, custom_errors.DoEErrors) {
+	res := &BannerResponse{}
+
+	if query == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if query.Host == "" {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrHostEmpty, true)
+	}
+
+	if query.Port <= 0 || query.Port >= 65536 {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrInvalidPort, true)
+	}
+
+	if query.Timeout <= 0 {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrInvalidTimeout, true)
+	}
+
+	// each probe has its own timeout
+	dialer := *qh.Dialer
+	dialer.Timeout = query.Timeout
+
+	begin := time.Now()
+
+	var err error
+	switch query.Protocol {
+	case BANNER_PROTOCOL_HTTP, BANNER_PROTOCOL_HTTPS:
+		res.HTTP, err = grabHTTPBanner(&dialer, query)
+	case BANNER_PROTOCOL_TELNET:
+		res.Telnet, err = grabTelnetBanner(&dialer, query)
+	case BANNER_PROTOCOL_SSH:
+		res.SSH, err = grabSSHBanner(&dialer, query)
+	default:
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrInvalidProtocol, true).AddInfoString(query.Protocol)
+	}
+
+	res.RTT = time.Since(begin)
+
+	if err != nil {
+		qErr := custom_errors.NewQueryError(custom_errors.ErrBannerGrabFailed, false)
+		_ = qErr.AddInfo(err)
+		return res, qErr
+	}
+
+	return res, nil
+}
+
+func grabHTTPBanner(dialer *net.Dialer, query *BannerQuery) (*HTTPBanner, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			// management interfaces mostly present self-signed certificates
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			DialContext:       dialer.DialContext,
+			DisableKeepAlives: true,
+		},
+		Timeout: query.Timeout,
+		// the redirect target is part of the banner
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	url := fmt.Sprintf("%s://%s/", query.Protocol, helper.GetFullHostFromHostPort(query.Host, query.Port))
+	httpReq, err := http.NewRequestWithContext(context.Background(), HTTP_GET, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRes, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+
+	banner := &HTTPBanner{
+		StatusCode: httpRes.StatusCode,
+		Server:     httpRes.Header.Get("Server"),
+		PoweredBy:  httpRes.Header.Get("X-Powered-By"),
+		Location:   httpRes.Header.Get("Location"),
+	}
+
+	if match := httpRealmRegexp.FindStringSubmatch(httpRes.Header.Get("WWW-Authenticate")); match != nil {
+		banner.Realm = match[1]
+	}
+
+	// a cut off body may still carry the title
+	body, _ := io.ReadAll(io.LimitReader(httpRes.Body, MAX_HTTP_BODY_SIZE))
+	if match := htmlTitleRegexp.FindSubmatch(body); match != nil {
+		banner.Title = strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+	}
+
+	return banner, nil
+}
+
+func grabTelnetBanner(dialer *net.Dialer, query *BannerQuery) (*TelnetBanner, error) {
+	conn, err := dialer.Dial("tcp", helper.GetFullHostFromHostPort(query.Host, query.Port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(query.Timeout)
+	banner := []byte{}
+	buf := make([]byte, MAX_BANNER_SIZE)
+	// an option negotiation may be split across reads
+	pending := []byte{}
+
+	for len(banner) < MAX_BANNER_SIZE {
+		// stop once the server waits for the login
+		readDeadline := deadline
+		if len(banner) > 0 && time.Now().Add(BANNER_IDLE_TIMEOUT).Before(deadline) {
+			readDeadline = time.Now().Add(BANNER_IDLE_TIMEOUT)
+		}
+		_ = conn.SetDeadline(readDeadline)
+
+		n, err := conn.Read(buf)
+		if n > 0 {
+			var text, reply []byte
+			text, reply, pending = parseTelnet(append(pending, buf[:n]...))
+			banner = append(banner, text...)
+
+			// do not buffer an endless subnegotiation
+			if len(pending) > MAX_BANNER_SIZE {
+				pending = pending[:0]
+			}
+
+			// refuse all options, some servers only send the banner after the negotiation
+			if len(reply) > 0 {
+				if _, err := conn.Write(reply); err != nil {
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			if len(banner) == 0 && !isTimeout(err) && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	if len(banner) > MAX_BANNER_SIZE {
+		banner = banner[:MAX_BANNER_SIZE]
+	}
+
+	return &TelnetBanner{Banner: sanitizeBanner(string(banner))}, nil
+}
+
+// parseTelnet strips the option negotiation from the data and returns the refusals of the options,
+// rest is an incomplete command at the end of the data that has to be parsed with the next read
+func parseTelnet(data []byte) (text []byte, reply []byte, rest []byte) {
+	for i := 0; i < len(data); i++ {
+		if data[i] != telnetIAC {
+			text = append(text, data[i])
+			continue
+		}
+
+		if i+1 >= len(data) {
+			return text, reply, data[i:]
+		}
+
+		switch cmd := data[i+1]; cmd {
+		case telnetIAC:
+			// escaped 255
+			text = append(text, telnetIAC)
+			i++
+		case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+			if i+2 >= len(data) {
+				return text, reply, data[i:]
+			}
+			switch cmd {
+			case telnetDO:
+				reply = append(reply, telnetIAC, telnetWONT, data[i+2])
+			case telnetWILL:
+				reply = append(reply, telnetIAC, telnetDONT, data[i+2])
+			}
+			i += 2
+		case telnetSB:
+			// skip the subnegotiation up to IAC SE
+			end := bytes.Index(data[i:], []byte{telnetIAC, telnetSE})
+			if end < 0 {
+				return text, reply, data[i:]
+			}
+			i += end + 1
+		default:
+			i++
+		}
+	}
+
+	return text, reply, nil
+}
+
+func grabSSHBanner(dialer *net.Dialer, query *BannerQuery) (*SSHBanner, error) {
+	conn, err := dialer.Dial("tcp", helper.GetFullHostFromHostPort(query.Host, query.Port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(query.Timeout))
+
+	data := []byte{}
+	buf := make([]byte, MAX_BANNER_SIZE)
+
+	// servers may send other lines before the identification string
+	for len(data) < MAX_BANNER_SIZE {
+		n, err := conn.Read(buf)
+		data = append(data, buf[:n]...)
+
+		if banner := NewSSHBanner(data); banner != nil {
+			return banner, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("no SSH identification string in the first %d bytes", MAX_BANNER_SIZE)
+}
+
+// NewSSHBanner parses the first complete identification string of the data, nil if there is none
+func NewSSHBanner(data []byte) *SSHBanner {
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if !strings.HasSuffix(line, "\n") {
+			// incomplete line
+			return nil
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, "SSH-") {
+			continue
+		}
+
+		banner := &SSHBanner{Raw: sanitizeBanner(line)}
+
+		identification, comments, _ := strings.Cut(strings.TrimPrefix(line, "SSH-"), " ")
+		banner.ProtoVersion, banner.SoftwareVersion, _ = strings.Cut(identification, "-")
+		banner.ProtoVersion = sanitizeBanner(banner.ProtoVersion)
+		banner.SoftwareVersion = sanitizeBanner(banner.SoftwareVersion)
+		banner.Comments = sanitizeBanner(comments)
+
+		return banner
+	}
+
+	return nil
+}
+
+// sanitizeBanner keeps printable characters and line breaks of banners
+func sanitizeBanner(banner string) string {
+	banner = strings.ToValidUTF8(banner, "")
+
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '\n' || unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, banner))
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// ParseBannerTargets parses comma-separated targets of the form protocol:port[:timeout],
+// e.g., "http:80,https:443,telnet:23:2s"
+func ParseBannerTargets(targets string) ([]*BannerTarget, error) {
+	result := []*BannerTarget{}
+
+	for _, spec := range strings.Split(targets, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid banner target %s, should be protocol:port[:timeout]", spec)
+		}
+
+		target := &BannerTarget{Protocol: strings.ToLower(parts[0])}
+
+		switch target.Protocol {
+		case BANNER_PROTOCOL_HTTP, BANNER_PROTOCOL_HTTPS:
+			target.Timeout = BANNER_HTTP_TIMEOUT
+		case BANNER_PROTOCOL_TELNET, BANNER_PROTOCOL_SSH:
+			target.Timeout = BANNER_TIMEOUT
+		default:
+			return nil, fmt.Errorf("invalid banner target %s, unsupported protocol %s", spec, parts[0])
+		}
+
+		port, err := strconv.Atoi(parts[1])
+		if err != nil || port <= 0 || port >= 65536 {
+			return nil, fmt.Errorf("invalid banner target %s, invalid port %s", spec, parts[1])
+		}
+		target.Port = port
+
+		if len(parts) == 3 {
+			target.Timeout, err = time.ParseDuration(parts[2])
+			if err != nil || target.Timeout <= 0 {
+				return nil, fmt.Errorf("invalid banner target %s, invalid timeout %s", spec, parts[2])
+			}
+		}
+
+		result = append(result, target)
+	}
+
+	return result, nil
+}
+
+func NewBannerQuery(host string, target *BannerTarget) *BannerQuery {
+	return &BannerQuery{
+		Host:     host,
+		Port:     target.Port,
+		Protocol: target.Protocol,
+		Timeout:  target.Timeout,
+	}
+}
+
+func NewBannerQueryHandler(config *QueryConfig) *BannerQueryHandler {
+	dialer := &net.Dialer{}
+
+	if config != nil && config.LocalAddr != nil {
+		dialer.LocalAddr = &net.TCPAddr{
+			IP:   config.LocalAddr,
+			Port: 0,
+		}
+	}
+
+	return &BannerQueryHandler{
+		Dialer: dialer,
+	}
+}
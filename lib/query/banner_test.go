@@ -0,0 +1,345 @@
+package query_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestTCPServer accepts connections and hands them to the handler
+func startTestTCPServer(t *testing.T, handle func(conn net.Conn)) (string, int) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func newTestBannerQuery(t *testing.T, rawURL string, protocol string) *query.BannerQuery {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	return &query.BannerQuery{
+		Host:     u.Hostname(),
+		Port:     port,
+		Protocol: protocol,
+		Timeout:  time.Second,
+	}
+}
+
+func TestBannerQueryHandler_Query(t *testing.T) {
+	t.Parallel()
+
+	t.Run("http", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Server", "lighttpd/1.4.59")
+			w.Header().Set("WWW-Authenticate", `Basic realm="FRITZ!Box 7590"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("<html><head><TITLE>\n  Router &amp; Modem\n</TITLE></head></html>"))
+		}))
+		t.Cleanup(server.Close)
+
+		res, err := query.NewBannerQueryHandler(nil).Query(newTestBannerQuery(t, server.URL, query.BANNER_PROTOCOL_HTTP))
+
+		require.Nil(t, err)
+		require.NotNil(t, res.HTTP)
+		assert.Equal(t, http.StatusUnauthorized, res.HTTP.StatusCode)
+		assert.Equal(t, "lighttpd/1.4.59", res.HTTP.Server)
+		assert.Equal(t, "Router & Modem", res.HTTP.Title)
+		assert.Equal(t, "FRITZ!Box 7590", res.HTTP.Realm)
+		assert.Nil(t, res.Telnet)
+		assert.Nil(t, res.SSH)
+	})
+
+	t.Run("https with self-signed certificate", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Powered-By", "PHP/7.4")
+			http.Redirect(w, r, "/login.htm", http.StatusFound)
+		}))
+		t.Cleanup(server.Close)
+
+		res, err := query.NewBannerQueryHandler(nil).Query(newTestBannerQuery(t, server.URL, query.BANNER_PROTOCOL_HTTPS))
+
+		require.Nil(t, err)
+		require.NotNil(t, res.HTTP)
+		assert.Equal(t, http.StatusFound, res.HTTP.StatusCode, "should not follow redirects")
+		assert.Equal(t, "/login.htm", res.HTTP.Location)
+		assert.Equal(t, "PHP/7.4", res.HTTP.PoweredBy)
+	})
+
+	t.Run("telnet", func(t *testing.T) {
+		t.Parallel()
+
+		replies := make(chan []byte, 1)
+		host, port := startTestTCPServer(t, func(conn net.Conn) {
+			// IAC DO ECHO, IAC SB TTYPE SEND IAC SE
+			_, _ = conn.Write([]byte{255, 253, 1, 255, 250, 24, 1, 255, 240})
+
+			reply := make([]byte, 3)
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _ := conn.Read(reply)
+			replies <- reply[:n]
+
+			_, _ = conn.Write([]byte("\r\nZyXEL VMG3625\r\nlogin: "))
+			time.Sleep(2 * time.Second)
+		})
+
+		begin := time.Now()
+		res, err := query.NewBannerQueryHandler(nil).Query(&query.BannerQuery{
+			Host:     host,
+			Port:     port,
+			Protocol: query.BANNER_PROTOCOL_TELNET,
+			Timeout:  3 * time.Second,
+		})
+
+		require.Nil(t, err)
+		require.NotNil(t, res.Telnet)
+		assert.Equal(t, "ZyXEL VMG3625\nlogin:", res.Telnet.Banner)
+		assert.Equal(t, []byte{255, 252, 1}, <-replies, "should refuse the option")
+		assert.Less(t, time.Since(begin), 2*time.Second, "should stop reading once the server is idle")
+	})
+
+	t.Run("telnet option split across reads", func(t *testing.T) {
+		t.Parallel()
+
+		replies := make(chan []byte, 1)
+		host, port := startTestTCPServer(t, func(conn net.Conn) {
+			// IAC WILL ECHO in two segments, then the banner
+			_, _ = conn.Write([]byte("Router\r\n\xff"))
+			time.Sleep(50 * time.Millisecond)
+			_, _ = conn.Write([]byte{251, 1})
+
+			reply := make([]byte, 3)
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _ := conn.Read(reply)
+			replies <- reply[:n]
+
+			_, _ = conn.Write([]byte("login: "))
+		})
+
+		res, err := query.NewBannerQueryHandler(nil).Query(&query.BannerQuery{
+			Host:     host,
+			Port:     port,
+			Protocol: query.BANNER_PROTOCOL_TELNET,
+			Timeout:  time.Second,
+		})
+
+		require.Nil(t, err)
+		require.NotNil(t, res.Telnet)
+		assert.Equal(t, "Router\nlogin:", res.Telnet.Banner, "should not leak the split option into the banner")
+		assert.Equal(t, []byte{255, 254, 1}, <-replies, "should refuse the split option")
+	})
+
+	t.Run("ssh", func(t *testing.T) {
+		t.Parallel()
+
+		host, port := startTestTCPServer(t, func(conn net.Conn) {
+			_, _ = conn.Write([]byte("Welcome\r\nSSH-2.0-dropbear_2020.81 "))
+			time.Sleep(50 * time.Millisecond)
+			_, _ = conn.Write([]byte("router\r\n"))
+		})
+
+		res, err := query.NewBannerQueryHandler(nil).Query(&query.BannerQuery{
+			Host:     host,
+			Port:     port,
+			Protocol: query.BANNER_PROTOCOL_SSH,
+			Timeout:  time.Second,
+		})
+
+		require.Nil(t, err)
+		require.NotNil(t, res.SSH)
+		assert.Equal(t, "SSH-2.0-dropbear_2020.81 router", res.SSH.Raw)
+		assert.Equal(t, "dropbear_2020.81", res.SSH.SoftwareVersion)
+	})
+
+	t.Run("ssh without identification string", func(t *testing.T) {
+		t.Parallel()
+
+		host, port := startTestTCPServer(t, func(conn net.Conn) {
+			_, _ = conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n"))
+		})
+
+		_, err := query.NewBannerQueryHandler(nil).Query(&query.BannerQuery{
+			Host:     host,
+			Port:     port,
+			Protocol: query.BANNER_PROTOCOL_SSH,
+			Timeout:  time.Second,
+		})
+
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), custom_errors.ErrBannerGrabFailed.Error())
+		assert.False(t, err.IsCritical())
+	})
+
+	t.Run("closed port", func(t *testing.T) {
+		t.Parallel()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := listener.Addr().(*net.TCPAddr).Port
+		require.NoError(t, listener.Close())
+
+		res, qErr := query.NewBannerQueryHandler(nil).Query(&query.BannerQuery{
+			Host:     "127.0.0.1",
+			Port:     port,
+			Protocol: query.BANNER_PROTOCOL_TELNET,
+			Timeout:  time.Second,
+		})
+
+		require.NotNil(t, res)
+		assert.Nil(t, res.Telnet)
+		require.NotNil(t, qErr)
+		assert.Contains(t, qErr.Error(), custom_errors.ErrBannerGrabFailed.Error())
+	})
+
+	t.Run("invalid queries", func(t *testing.T) {
+		t.Parallel()
+
+		qh := query.NewBannerQueryHandler(nil)
+
+		for _, q := range []*query.BannerQuery{
+			nil,
+			{Port: 80, Protocol: query.BANNER_PROTOCOL_HTTP, Timeout: time.Second},
+			{Host: "127.0.0.1", Protocol: query.BANNER_PROTOCOL_HTTP, Timeout: time.Second},
+			{Host: "127.0.0.1", Port: 80, Protocol: query.BANNER_PROTOCOL_HTTP},
+			{Host: "127.0.0.1", Port: 80, Protocol: "gopher", Timeout: time.Second},
+		} {
+			res, err := qh.Query(q)
+
+			assert.NotNil(t, res)
+			require.NotNil(t, err)
+			assert.True(t, err.IsCritical())
+		}
+	})
+}
+
+func TestNewSSHBanner(t *testing.T) {
+	t.Parallel()
+
+	t.Run("identification string with comments", func(t *testing.T) {
+		t.Parallel()
+
+		banner := query.NewSSHBanner([]byte("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n\x00\x00\x04"))
+
+		require.NotNil(t, banner)
+		assert.Equal(t, "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13", banner.Raw)
+		assert.Equal(t, "2.0", banner.ProtoVersion)
+		assert.Equal(t, "OpenSSH_9.6p1", banner.SoftwareVersion)
+		assert.Equal(t, "Ubuntu-3ubuntu13", banner.Comments)
+	})
+
+	t.Run("incomplete line", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, query.NewSSHBanner([]byte("SSH-2.0-OpenSSH")))
+		assert.Nil(t, query.NewSSHBanner(nil))
+	})
+}
+
+func TestParseBannerTargets(t *testing.T) {
+	t.Parallel()
+
+	t.Run("multiple targets", func(t *testing.T) {
+		t.Parallel()
+
+		targets, err := query.ParseBannerTargets("http:80,https:443,http:8080,telnet:23")
+
+		require.NoError(t, err)
+		require.Len(t, targets, 4)
+		assert.Equal(t, &query.BannerTarget{Protocol: query.BANNER_PROTOCOL_HTTP, Port: 80, Timeout: query.BANNER_HTTP_TIMEOUT}, targets[0])
+		assert.Equal(t, &query.BannerTarget{Protocol: query.BANNER_PROTOCOL_TELNET, Port: 23, Timeout: query.BANNER_TIMEOUT}, targets[3])
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+
+		targets, err := query.ParseBannerTargets(" SSH:2222:1500ms , ")
+
+		require.NoError(t, err)
+		require.Len(t, targets, 1)
+		assert.Equal(t, &query.BannerTarget{Protocol: query.BANNER_PROTOCOL_SSH, Port: 2222, Timeout: 1500 * time.Millisecond}, targets[0])
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+
+		targets, err := query.ParseBannerTargets("")
+
+		require.NoError(t, err)
+		assert.Empty(t, targets)
+	})
+
+	t.Run("invalid targets", func(t *testing.T) {
+		t.Parallel()
+
+		for _, targets := range []string{"http", "ftp:21", "http:0", "http:port", "telnet:23:forever", "telnet:23:1s:2"} {
+			_, err := query.ParseBannerTargets(targets)
+			assert.Error(t, err, targets)
+		}
+	})
+}
+
+func TestNewBannerQuery(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewBannerQuery("192.0.2.1", &query.BannerTarget{Protocol: query.BANNER_PROTOCOL_HTTPS, Port: 443, Timeout: time.Second})
+
+	assert.Equal(t, &query.BannerQuery{Host: "192.0.2.1", Port: 443, Protocol: query.BANNER_PROTOCOL_HTTPS, Timeout: time.Second}, q)
+}
+
+func TestNewBannerQueryHandler(t *testing.T) {
+	t.Parallel()
+
+	t.Run("local address", func(t *testing.T) {
+		t.Parallel()
+
+		qh := query.NewBannerQueryHandler(&query.QueryConfig{LocalAddr: net.IPv4(127, 0, 0, 1)})
+
+		require.NotNil(t, qh.Dialer.LocalAddr)
+		assert.Equal(t, net.IPv4(127, 0, 0, 1), qh.Dialer.LocalAddr.(*net.TCPAddr).IP)
+	})
+
+	t.Run("config without local address", func(t *testing.T) {
+		t.Parallel()
+
+		qh := query.NewBannerQueryHandler(&query.QueryConfig{})
+
+		assert.Nil(t, qh.Dialer.LocalAddr)
+	})
+}
@@ -0,0 +1,211 @@
+package query
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// This file implements the known-length messages of Binary HTTP as used by Oblivious HTTP,
+// see https://www.rfc-editor.org/rfc/rfc9292.html
+
+const BHTTP_MEDIA_TYPE = "message/bhttp"
+
+const BHTTP_FRAMING_KNOWN_LENGTH_REQUEST uint64 = 0
+const BHTTP_FRAMING_KNOWN_LENGTH_RESPONSE uint64 = 1
+
+var errBHTTPUnsupportedFraming = errors.New("unsupported framing indicator")
+
+type BHTTPField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type BHTTPRequest struct {
+	Method    string       `json:"method"`
+	Scheme    string       `json:"scheme"`
+	Authority string       `json:"authority"`
+	Path      string       `json:"path"`
+	Header    []BHTTPField `json:"header"`
+	Content   []byte       `json:"content"`
+}
+
+type BHTTPResponse struct {
+	StatusCode int          `json:"status_code"`
+	Header     []BHTTPField `json:"header"`
+	Content    []byte       `json:"content"`
+}
+
+// GetHeader returns the first value of the header field with the given (lowercase) name
+func (r *BHTTPResponse) GetHeader(name string) string {
+	for _, f := range r.Header {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func (r *BHTTPRequest) Marshal() []byte {
+	b := quicvarint.Append(nil, BHTTP_FRAMING_KNOWN_LENGTH_REQUEST)
+
+	// request control data
+	b = appendBHTTPVector(b, []byte(r.Method))
+	b = appendBHTTPVector(b, []byte(r.Scheme))
+	b = appendBHTTPVector(b, []byte(r.Authority))
+	b = appendBHTTPVector(b, []byte(r.Path))
+
+	b = appendBHTTPVector(b, marshalBHTTPFields(r.Header))
+	b = appendBHTTPVector(b, r.Content)
+
+	// empty trailer section
+	return quicvarint.Append(b, 0)
+}
+
+func UnmarshalBHTTPRequest(b []byte) (*BHTTPRequest, error) {
+	r := bytes.NewReader(b)
+
+	framing, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if framing != BHTTP_FRAMING_KNOWN_LENGTH_REQUEST {
+		return nil, errBHTTPUnsupportedFraming
+	}
+
+	req := &BHTTPRequest{}
+	for _, s := range []*string{&req.Method, &req.Scheme, &req.Authority, &req.Path} {
+		v, err := readBHTTPVector(r)
+		if err != nil {
+			return nil, err
+		}
+		*s = string(v)
+	}
+
+	req.Header, err = readBHTTPFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// content and trailer may be truncated, see https://www.rfc-editor.org/rfc/rfc9292.html#section-3.8
+	req.Content, err = readBHTTPVector(r)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func (r *BHTTPResponse) Marshal() []byte {
+	b := quicvarint.Append(nil, BHTTP_FRAMING_KNOWN_LENGTH_RESPONSE)
+
+	b = quicvarint.Append(b, uint64(r.StatusCode))
+	b = appendBHTTPVector(b, marshalBHTTPFields(r.Header))
+	b = appendBHTTPVector(b, r.Content)
+
+	// empty trailer section
+	return quicvarint.Append(b, 0)
+}
+
+func UnmarshalBHTTPResponse(b []byte) (*BHTTPResponse, error) {
+	r := bytes.NewReader(b)
+
+	framing, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if framing != BHTTP_FRAMING_KNOWN_LENGTH_RESPONSE {
+		return nil, errBHTTPUnsupportedFraming
+	}
+
+	res := &BHTTPResponse{}
+
+	for {
+		status, err := quicvarint.Read(r)
+		if err != nil {
+			return nil, err
+		}
+
+		// skip informational responses including their header section
+		if status >= 100 && status < 200 {
+			if _, err := readBHTTPFields(r); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		res.StatusCode = int(status)
+		break
+	}
+
+	res.Header, err = readBHTTPFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Content, err = readBHTTPVector(r)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func marshalBHTTPFields(fields []BHTTPField) []byte {
+	b := []byte{}
+	for _, f := range fields {
+		b = appendBHTTPVector(b, []byte(f.Name))
+		b = appendBHTTPVector(b, []byte(f.Value))
+	}
+	return b
+}
+
+func readBHTTPFields(r *bytes.Reader) ([]BHTTPField, error) {
+	section, err := readBHTTPVector(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := []BHTTPField{}
+	sr := bytes.NewReader(section)
+	for sr.Len() > 0 {
+		name, err := readBHTTPVector(sr)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readBHTTPVector(sr)
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, BHTTPField{Name: string(name), Value: string(value)})
+	}
+
+	return fields, nil
+}
+
+func appendBHTTPVector(b []byte, v []byte) []byte {
+	b = quicvarint.Append(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func readBHTTPVector(r *bytes.Reader) ([]byte, error) {
+	l, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if l > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	v := make([]byte, l)
+	_, err = io.ReadFull(r, v)
+
+	return v, err
+}
@@ -115,15 +115,37 @@ func (cq *CertificateQuery) Check() (err custom_errors.DoEErrors) {
 
 type CertificateQueryHandler struct {
 	QueryHandler CertQueryHandler
+
+	// RootBundle is verified against in addition to the system pool (optional)
+	RootBundle *x509.CertPool
 }
 
 type CertificateResponse struct {
-	// Certificate is the certificate
-	Certificates []*x509.Certificate `json:"certificates"`
+	// Certificates is the parsed certificate chain presented by the peer,
+	// it is omitted if the certificates are kept in a deduplicated certificate store
+	Certificates []*CertificateInfo `json:"certificates"`
+	// Fingerprints are the SHA-256 fingerprints of the presented certificate chain
+	Fingerprints []string `json:"fingerprints"`
+	// Verification is the verification of the chain and names, nil if no certificate was presented
+	Verification *CertificateVerification `json:"verification"`
 
 	RetryWithoutCertificateVerification bool `json:"retry_without_certificate_verification"`
 }
 
+// X509Certificates parses the presented certificates back into x509 certificates
+func (res *CertificateResponse) X509Certificates() ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for _, info := range res.Certificates {
+		cert, err := info.X509()
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
 func (qh *CertificateQueryHandler) Query(q *CertificateQuery) (*CertificateResponse, custom_errors.DoEErrors) {
 	res := &CertificateResponse{}
 	res.RetryWithoutCertificateVerification = false
@@ -165,7 +187,13 @@ func (qh *CertificateQueryHandler) Query(q *CertificateQuery) (*CertificateRespo
 			return res, custom_errors.NewQueryError(custom_errors.ErrUnknownQuery, true).AddInfo(err)
 		}
 	}
-	res.Certificates = conn.PeerCertificates
+	res.Certificates = NewCertificateInfos(conn.PeerCertificates)
+	for _, cert := range res.Certificates {
+		res.Fingerprints = append(res.Fingerprints, cert.SHA256Fingerprint)
+	}
+	if len(conn.PeerCertificates) > 0 {
+		res.Verification = VerifyCertificates(conn.PeerCertificates, qh.RootBundle, q.SNI, q.Host)
+	}
 
 	return res, nil
 }
@@ -188,6 +216,10 @@ func NewCertificateQueryHandler(config *QueryConfig) (*CertificateQueryHandler,
 	// udp addr for quic
 	udpAddr := &net.UDPAddr{}
 
+	if config != nil {
+		qh.RootBundle = config.RootBundle
+	}
+
 	if config != nil && config.LocalAddr != nil {
 		cqh.dialerTCP.LocalAddr = &net.TCPAddr{
 			IP:   config.LocalAddr,
@@ -0,0 +1,293 @@
+package query
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+)
+
+// CertificateInfo is the parsed representation of a X.509 certificate we store instead of the raw x509 structure
+type CertificateInfo struct {
+	Subject      string `json:"subject"`
+	Issuer       string `json:"issuer"`
+	SerialNumber string `json:"serial_number"`
+	Version      int    `json:"version"`
+
+	DNSNames    []string `json:"dns_names"`
+	IPAddresses []string `json:"ip_addresses"`
+
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+
+	PublicKeyAlgorithm string `json:"public_key_algorithm"`
+	// PublicKeySize is the size in bits (RSA modulus or curve size)
+	PublicKeySize      int    `json:"public_key_size"`
+	SignatureAlgorithm string `json:"signature_algorithm"`
+
+	// SHA256Fingerprint is the hex encoded SHA-256 hash of the DER encoding
+	SHA256Fingerprint string `json:"sha256_fingerprint"`
+
+	IsCA        bool     `json:"is_ca"`
+	KeyUsage    []string `json:"key_usage"`
+	ExtKeyUsage []string `json:"ext_key_usage"`
+
+	// Raw is the base64 encoded DER encoding of the certificate
+	Raw string `json:"raw"`
+}
+
+// ChainVerification is the result of verifying a certificate chain against a root pool
+type ChainVerification struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+	// Chain holds the SHA-256 fingerprints of the first verified chain starting with the leaf
+	Chain []string `json:"chain"`
+}
+
+type CertificateVerification struct {
+	SystemPool *ChainVerification `json:"system_pool"`
+	// RootBundle is nil if no root bundle is configured
+	RootBundle *ChainVerification `json:"root_bundle"`
+
+	// SNI is the server name we sent, SNIMatch is true if the leaf certificate is valid for it
+	SNI      string `json:"sni"`
+	SNIMatch bool   `json:"sni_match"`
+	// IP is the IP address of the host (if any), IPMatch is true if the leaf certificate is valid for it
+	IP      string `json:"ip"`
+	IPMatch bool   `json:"ip_match"`
+}
+
+// nolint: gochecknoglobals
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digital_signature"},
+	{x509.KeyUsageContentCommitment, "content_commitment"},
+	{x509.KeyUsageKeyEncipherment, "key_encipherment"},
+	{x509.KeyUsageDataEncipherment, "data_encipherment"},
+	{x509.KeyUsageKeyAgreement, "key_agreement"},
+	{x509.KeyUsageCertSign, "cert_sign"},
+	{x509.KeyUsageCRLSign, "crl_sign"},
+	{x509.KeyUsageEncipherOnly, "encipher_only"},
+	{x509.KeyUsageDecipherOnly, "decipher_only"},
+}
+
+// nolint: gochecknoglobals
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "any",
+	x509.ExtKeyUsageServerAuth:                     "server_auth",
+	x509.ExtKeyUsageClientAuth:                     "client_auth",
+	x509.ExtKeyUsageCodeSigning:                    "code_signing",
+	x509.ExtKeyUsageEmailProtection:                "email_protection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "ipsec_end_system",
+	x509.ExtKeyUsageIPSECTunnel:                    "ipsec_tunnel",
+	x509.ExtKeyUsageIPSECUser:                      "ipsec_user",
+	x509.ExtKeyUsageTimeStamping:                   "time_stamping",
+	x509.ExtKeyUsageOCSPSigning:                    "ocsp_signing",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "microsoft_server_gated_crypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "netscape_server_gated_crypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "microsoft_commercial_code_signing",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "microsoft_kernel_code_signing",
+}
+
+func NewCertificateInfo(cert *x509.Certificate) *CertificateInfo {
+	if cert == nil {
+		return nil
+	}
+
+	info := &CertificateInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Version:            cert.Version,
+		DNSNames:           append([]string{}, cert.DNSNames...),
+		IPAddresses:        []string{},
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		PublicKeyAlgorithm: cert.PublicKeyAlgorithm.String(),
+		PublicKeySize:      getPublicKeySize(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SHA256Fingerprint:  GetCertificateFingerprint(cert),
+		IsCA:               cert.IsCA,
+		KeyUsage:           []string{},
+		ExtKeyUsage:        []string{},
+		Raw:                base64.StdEncoding.EncodeToString(cert.Raw),
+	}
+
+	if cert.SerialNumber != nil {
+		info.SerialNumber = cert.SerialNumber.Text(16)
+	}
+
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+
+	for _, ku := range keyUsageNames {
+		if cert.KeyUsage&ku.usage != 0 {
+			info.KeyUsage = append(info.KeyUsage, ku.name)
+		}
+	}
+
+	for _, eku := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[eku]; ok {
+			info.ExtKeyUsage = append(info.ExtKeyUsage, name)
+		} else {
+			info.ExtKeyUsage = append(info.ExtKeyUsage, fmt.Sprintf("unknown_%d", eku))
+		}
+	}
+
+	for _, oid := range cert.UnknownExtKeyUsage {
+		info.ExtKeyUsage = append(info.ExtKeyUsage, oid.String())
+	}
+
+	return info
+}
+
+// NewCertificateInfos parses all certificates, returns nil if certs is nil
+func NewCertificateInfos(certs []*x509.Certificate) []*CertificateInfo {
+	if certs == nil {
+		return nil
+	}
+
+	infos := []*CertificateInfo{}
+	for _, cert := range certs {
+		if info := NewCertificateInfo(cert); info != nil {
+			infos = append(infos, info)
+		}
+	}
+
+	return infos
+}
+
+// X509 parses the raw DER encoding back into a x509 certificate
+func (info *CertificateInfo) X509() (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(info.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+func GetCertificateFingerprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+func getPublicKeySize(pub any) int {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return len(k) * 8
+	default:
+		return 0
+	}
+}
+
+// VerifyCertificates verifies the chain of the leaf (first certificate) against the system pool
+// and the root bundle (if not nil) and checks whether the leaf is valid for the SNI and the host IP
+func VerifyCertificates(certs []*x509.Certificate, rootBundle *x509.CertPool, sni string, host string) *CertificateVerification {
+	v := &CertificateVerification{
+		SNI: sni,
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		v.IP = ip.String()
+	}
+
+	if len(certs) == 0 || certs[0] == nil {
+		v.SystemPool = &ChainVerification{Error: custom_errors.ErrNoCertificate.Error()}
+		if rootBundle != nil {
+			v.RootBundle = &ChainVerification{Error: custom_errors.ErrNoCertificate.Error()}
+		}
+		return v
+	}
+
+	leaf := certs[0]
+
+	// chain validity only, names are checked separately
+	v.SystemPool = verifyChain(certs, nil)
+	if rootBundle != nil {
+		v.RootBundle = verifyChain(certs, rootBundle)
+	}
+
+	if v.SNI != "" {
+		v.SNIMatch = leaf.VerifyHostname(v.SNI) == nil
+	}
+
+	if v.IP != "" {
+		v.IPMatch = leaf.VerifyHostname(v.IP) == nil
+	}
+
+	return v
+}
+
+func verifyChain(certs []*x509.Certificate, roots *x509.CertPool) *ChainVerification {
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		if c != nil {
+			intermediates.AddCert(c)
+		}
+	}
+
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return &ChainVerification{Error: err.Error()}
+	}
+
+	cv := &ChainVerification{Valid: true, Chain: []string{}}
+	if len(chains) > 0 {
+		for _, c := range chains[0] {
+			cv.Chain = append(cv.Chain, GetCertificateFingerprint(c))
+		}
+	}
+
+	return cv
+}
+
+// LoadRootBundle reads PEM encoded root certificates from the given file
+func LoadRootBundle(path string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	found := false
+	for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Join(custom_errors.ErrInvalidRootBundle, err)
+		}
+
+		pool.AddCert(cert)
+		found = true
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: no certificates in %s", custom_errors.ErrInvalidRootBundle, path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,268 @@
+package query_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestCertificateChain creates a leaf certificate signed by a fresh CA and returns the chain and the CA pool
+func createTestCertificateChain(t *testing.T, dnsNames []string, ips []net.IP) ([]*x509.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(255),
+		Subject:      pkix.Name{CommonName: "test leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafDER)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	return []*x509.Certificate{leaf, ca}, pool
+}
+
+func TestNewCertificateInfo(t *testing.T) {
+	t.Parallel()
+
+	t.Run("leaf certificate", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, []string{"dns.example.com"}, []net.IP{net.ParseIP("8.8.8.8")})
+
+		info := query.NewCertificateInfo(certs[0])
+
+		require.NotNil(t, info)
+		assert.Equal(t, "CN=test leaf", info.Subject)
+		assert.Equal(t, "CN=test ca", info.Issuer)
+		assert.Equal(t, "ff", info.SerialNumber)
+		assert.Equal(t, []string{"dns.example.com"}, info.DNSNames)
+		assert.Equal(t, []string{"8.8.8.8"}, info.IPAddresses)
+		assert.Equal(t, certs[0].NotBefore, info.NotBefore)
+		assert.Equal(t, certs[0].NotAfter, info.NotAfter)
+		assert.Equal(t, "ECDSA", info.PublicKeyAlgorithm)
+		assert.Equal(t, 256, info.PublicKeySize)
+		assert.Equal(t, "ECDSA-SHA256", info.SignatureAlgorithm)
+		assert.False(t, info.IsCA)
+		assert.Equal(t, []string{"digital_signature"}, info.KeyUsage)
+		assert.Equal(t, []string{"server_auth"}, info.ExtKeyUsage)
+
+		hash := sha256.Sum256(certs[0].Raw)
+		assert.Equal(t, hex.EncodeToString(hash[:]), info.SHA256Fingerprint)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(certs[0].Raw), info.Raw)
+	})
+
+	t.Run("CA certificate", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, nil, nil)
+
+		info := query.NewCertificateInfo(certs[1])
+
+		require.NotNil(t, info)
+		assert.True(t, info.IsCA)
+		assert.Equal(t, []string{"cert_sign"}, info.KeyUsage)
+		assert.Empty(t, info.DNSNames)
+	})
+
+	t.Run("nil certificate", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, query.NewCertificateInfo(nil))
+		assert.Nil(t, query.NewCertificateInfos(nil))
+	})
+
+	t.Run("raw roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, []string{"dns.example.com"}, nil)
+
+		res := &query.CertificateResponse{Certificates: query.NewCertificateInfos(certs)}
+		parsed, err := res.X509Certificates()
+
+		require.NoError(t, err)
+		require.Len(t, parsed, 2)
+		assert.True(t, parsed[0].Equal(certs[0]))
+		assert.True(t, parsed[1].Equal(certs[1]))
+	})
+
+	t.Run("invalid raw", func(t *testing.T) {
+		t.Parallel()
+
+		info := &query.CertificateInfo{Raw: "not base64"}
+		_, err := info.X509()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestVerifyCertificates(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid against root bundle", func(t *testing.T) {
+		t.Parallel()
+
+		certs, roots := createTestCertificateChain(t, []string{"dns.example.com"}, []net.IP{net.ParseIP("8.8.8.8")})
+
+		v := query.VerifyCertificates(certs, roots, "dns.example.com", "8.8.8.8")
+
+		require.NotNil(t, v.SystemPool)
+		assert.False(t, v.SystemPool.Valid)
+		assert.NotEmpty(t, v.SystemPool.Error)
+
+		require.NotNil(t, v.RootBundle)
+		assert.True(t, v.RootBundle.Valid)
+		assert.Empty(t, v.RootBundle.Error)
+		assert.Equal(t, []string{query.GetCertificateFingerprint(certs[0]), query.GetCertificateFingerprint(certs[1])}, v.RootBundle.Chain)
+
+		assert.True(t, v.SNIMatch)
+		assert.Equal(t, "8.8.8.8", v.IP)
+		assert.True(t, v.IPMatch)
+	})
+
+	t.Run("name mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		certs, roots := createTestCertificateChain(t, []string{"dns.example.com"}, nil)
+
+		v := query.VerifyCertificates(certs, roots, "other.example.com", "8.8.8.8")
+
+		assert.True(t, v.RootBundle.Valid)
+		assert.False(t, v.SNIMatch)
+		assert.False(t, v.IPMatch)
+	})
+
+	t.Run("hostname host without SNI", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, []string{"dns.example.com"}, nil)
+
+		v := query.VerifyCertificates(certs, nil, "", "dns.example.com")
+
+		assert.Nil(t, v.RootBundle)
+		assert.Empty(t, v.IP)
+		assert.False(t, v.SNIMatch)
+		assert.False(t, v.IPMatch)
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		t.Parallel()
+
+		_, roots := createTestCertificateChain(t, nil, nil)
+
+		v := query.VerifyCertificates(nil, roots, "dns.example.com", "8.8.8.8")
+
+		assert.Equal(t, custom_errors.ErrNoCertificate.Error(), v.SystemPool.Error)
+		assert.Equal(t, custom_errors.ErrNoCertificate.Error(), v.RootBundle.Error)
+	})
+}
+
+func TestCertificateQuery_Analysis(t *testing.T) {
+	t.Parallel()
+
+	certs, roots := createTestCertificateChain(t, []string{"dns.example.com"}, []net.IP{net.ParseIP("8.8.8.8")})
+	mockedDial := getMockedDialHandlerValidResponse(&tls.ConnectionState{PeerCertificates: certs})
+
+	q := query.NewCertificateQuery()
+	q.Host = "8.8.8.8"
+	q.SNI = "dns.example.com"
+
+	qh, err := query.NewCertificateQueryHandler(&query.QueryConfig{RootBundle: roots})
+	require.NoError(t, err)
+	qh.QueryHandler = mockedDial
+
+	res, qErr := qh.Query(q)
+
+	assert.Nil(t, qErr)
+	require.Len(t, res.Certificates, 2)
+	assert.Equal(t, "CN=test leaf", res.Certificates[0].Subject)
+	require.NotNil(t, res.Verification)
+	assert.True(t, res.Verification.RootBundle.Valid)
+	assert.True(t, res.Verification.SNIMatch)
+	assert.True(t, res.Verification.IPMatch)
+}
+
+func TestLoadRootBundle(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid bundle", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, []string{"dns.example.com"}, nil)
+
+		path := filepath.Join(t.TempDir(), "roots.pem")
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[1].Raw}), 0600))
+
+		pool, err := query.LoadRootBundle(path)
+		require.NoError(t, err)
+
+		v := query.VerifyCertificates(certs, pool, "", "")
+		assert.True(t, v.RootBundle.Valid)
+	})
+
+	t.Run("no certificates", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "roots.pem")
+		require.NoError(t, os.WriteFile(path, []byte("no pem"), 0600))
+
+		_, err := query.LoadRootBundle(path)
+		assert.ErrorIs(t, err, custom_errors.ErrInvalidRootBundle)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := query.LoadRootBundle(filepath.Join(t.TempDir(), "missing.pem"))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,220 @@
+package query
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+)
+
+// DNS_CLIENT_COOKIE_LENGTH is the length of the client cookie in bytes, see RFC 7873
+const DNS_CLIENT_COOKIE_LENGTH = 8
+
+// EDNSCookie is the DNS cookie option, see https://www.rfc-editor.org/rfc/rfc7873.html
+type EDNSCookie struct {
+	// ClientCookie is the hex encoded client cookie
+	ClientCookie string `json:"client_cookie"`
+	// ServerCookie is the hex encoded server cookie, empty if the option carries the client cookie only
+	ServerCookie string `json:"server_cookie"`
+	// ServerCookieLength is the length of the server cookie in bytes
+	ServerCookieLength int `json:"server_cookie_length"`
+}
+
+// NewEDNSCookie splits the hex encoded cookie option into the client and the server cookie
+func NewEDNSCookie(cookie string) *EDNSCookie {
+	cookie = strings.ToLower(cookie)
+	if len(cookie) <= 2*DNS_CLIENT_COOKIE_LENGTH {
+		return &EDNSCookie{ClientCookie: cookie}
+	}
+
+	return &EDNSCookie{
+		ClientCookie:       cookie[:2*DNS_CLIENT_COOKIE_LENGTH],
+		ServerCookie:       cookie[2*DNS_CLIENT_COOKIE_LENGTH:],
+		ServerCookieLength: len(cookie)/2 - DNS_CLIENT_COOKIE_LENGTH,
+	}
+}
+
+// SetCookie adds a random client cookie to the query message if Cookie is set
+// Do not use this function before marshaling the query but before sending it as a DNS query
+func (q *DNSQuery) SetCookie() {
+	if !q.Cookie {
+		return
+	}
+
+	if q.QueryMsg == nil {
+		q.QueryMsg = new(dns.Msg)
+	}
+
+	opt := getOrSetOPT(q.QueryMsg)
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_COOKIE); ok {
+			return
+		}
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: newRandomCookie()})
+}
+
+type CookieQuery struct {
+	ConventionalDNSQuery
+}
+
+type CookieResponse struct {
+	// Initial is the response to the query with the client cookie only
+	Initial *ConventionalDNSResponse `json:"initial"`
+	// Learned is the response to the query with the learned server cookie, nil if the server sent none
+	Learned *ConventionalDNSResponse `json:"learned"`
+	// Invalid is the response to the query with a random server cookie, nil if the server sent none
+	Invalid *ConventionalDNSResponse `json:"invalid"`
+
+	ClientCookie string `json:"client_cookie"`
+	ServerCookie string `json:"server_cookie"`
+
+	// CookieSupported is set if the server echoed the client cookie and sent a server cookie
+	CookieSupported    bool `json:"cookie_supported"`
+	ServerCookieLength int  `json:"server_cookie_length"`
+	// ServerCookieAccepted is set if the server answered the query with the learned server cookie without BADCOOKIE
+	ServerCookieAccepted bool `json:"server_cookie_accepted"`
+
+	// InvalidCookieRcode is the rcode of the response to the query with a random server cookie
+	InvalidCookieRcode string `json:"invalid_cookie_rcode"`
+	// InvalidCookieBadCookie is set if the server answered the random server cookie with BADCOOKIE
+	InvalidCookieBadCookie bool `json:"invalid_cookie_bad_cookie"`
+	// InvalidCookieRenewed is set if the server answered the random server cookie with a fresh server cookie
+	InvalidCookieRenewed bool `json:"invalid_cookie_renewed"`
+}
+
+// CookieQueryHandler detects DNS cookie support, see https://www.rfc-editor.org/rfc/rfc7873.html
+//
+// The first query carries a client cookie only. If the server sends a server cookie,
+// a second query checks that the learned server cookie is accepted and a third query
+// records how the server treats a random server cookie.
+type CookieQueryHandler struct {
+	TransportHandler *DNSTransportHandler
+}
+
+func (h *CookieQueryHandler) Query(q *CookieQuery, transport *DNSTransportDescriptor) (*CookieResponse, custom_errors.DoEErrors) {
+	res := &CookieResponse{}
+
+	if q == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if h.TransportHandler == nil {
+		return res, custom_errors.NewGenericError(custom_errors.ErrQueryHandlerNil, true)
+	}
+
+	if err := q.Check(false); err != nil {
+		return res, err
+	}
+
+	res.ClientCookie = newRandomCookie()
+
+	var err custom_errors.DoEErrors
+	res.Initial, err = h.exchange(q, transport, res.ClientCookie)
+	if err != nil {
+		return res, err
+	}
+
+	cookie := getCookieFromResponse(res.Initial)
+	if cookie == nil || cookie.ClientCookie != res.ClientCookie || cookie.ServerCookie == "" {
+		return res, nil
+	}
+
+	res.CookieSupported = true
+	res.ServerCookie = cookie.ServerCookie
+	res.ServerCookieLength = cookie.ServerCookieLength
+
+	// query with the learned server cookie
+	res.Learned, err = h.exchange(q, transport, res.ClientCookie+res.ServerCookie)
+	if err != nil {
+		return res, err
+	}
+
+	learnedCookie := getCookieFromResponse(res.Learned)
+	res.ServerCookieAccepted = getRcodeFromResponse(res.Learned) != dns.RcodeBadCookie &&
+		learnedCookie != nil && learnedCookie.ClientCookie == res.ClientCookie
+
+	// query with a random server cookie
+	invalidServerCookie := newRandomCookie()
+	res.Invalid, err = h.exchange(q, transport, res.ClientCookie+invalidServerCookie)
+	if err != nil {
+		return res, err
+	}
+
+	rcode := getRcodeFromResponse(res.Invalid)
+	res.InvalidCookieRcode = dns.RcodeToString[rcode]
+	res.InvalidCookieBadCookie = rcode == dns.RcodeBadCookie
+
+	invalidCookie := getCookieFromResponse(res.Invalid)
+	res.InvalidCookieRenewed = invalidCookie != nil && invalidCookie.ServerCookie != "" && invalidCookie.ServerCookie != invalidServerCookie
+
+	return res, nil
+}
+
+// exchange sends a copy of the query carrying the hex encoded cookie
+func (h *CookieQueryHandler) exchange(q *CookieQuery, transport *DNSTransportDescriptor, cookie string) (*ConventionalDNSResponse, custom_errors.DoEErrors) {
+	probe := q.ConventionalDNSQuery
+	probe.Cookie = false
+	probe.QueryMsg = q.QueryMsg.Copy()
+
+	opt := getOrSetOPT(probe.QueryMsg)
+	options := []dns.EDNS0{}
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_COOKIE); !ok {
+			options = append(options, o)
+		}
+	}
+	opt.Option = append(options, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: cookie})
+
+	return h.TransportHandler.Query(&probe, transport)
+}
+
+func NewCookieQuery(host string) *CookieQuery {
+	q := &CookieQuery{
+		ConventionalDNSQuery: *NewConventionalQuery(),
+	}
+	q.Host = host
+
+	return q
+}
+
+func NewCookieQueryHandler(config *QueryConfig) (*CookieQueryHandler, error) {
+	th, err := NewDNSTransportHandler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CookieQueryHandler{
+		TransportHandler: th,
+	}, nil
+}
+
+func newRandomCookie() string {
+	cookie := make([]byte, DNS_CLIENT_COOKIE_LENGTH)
+	_, _ = rand.Read(cookie)
+
+	return hex.EncodeToString(cookie)
+}
+
+func getCookieFromResponse(res *ConventionalDNSResponse) *EDNSCookie {
+	if res == nil || res.Response == nil {
+		return nil
+	}
+
+	if info := NewEDNSInfo(res.Response.ResponseMsg); info != nil {
+		return info.Cookie
+	}
+
+	return nil
+}
+
+func getRcodeFromResponse(res *ConventionalDNSResponse) int {
+	if res == nil || res.Response == nil || res.Response.ResponseMsg == nil {
+		return -1
+	}
+
+	return res.Response.ResponseMsg.Rcode
+}
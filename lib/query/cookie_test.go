@@ -0,0 +1,246 @@
+package query_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testServerCookie = "000102030405060708090a0b0c0d0e0f"
+
+// startTestCookieServer starts a local Do53 server that answers cookies with testServerCookie,
+// an enforcing server answers unknown server cookies with BADCOOKIE
+func startTestCookieServer(t *testing.T, cookies bool, enforcing bool) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.SetEdns0(1232, false)
+
+			var cookie *dns.EDNS0_COOKIE
+			if reqOpt := r.IsEdns0(); reqOpt != nil {
+				for _, o := range reqOpt.Option {
+					if c, ok := o.(*dns.EDNS0_COOKIE); ok {
+						cookie = c
+					}
+				}
+			}
+
+			if cookies && cookie != nil {
+				clientCookie, serverCookie := cookie.Cookie[:16], cookie.Cookie[16:]
+				if enforcing && serverCookie != "" && serverCookie != testServerCookie {
+					m.Rcode = dns.RcodeBadCookie
+				}
+
+				opt := m.IsEdns0()
+				opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: clientCookie + testServerCookie})
+			}
+
+			_ = w.WriteMsg(m)
+		}),
+	}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func newLocalCookieQuery(t *testing.T, addr string) *query.CookieQuery {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	q := query.NewCookieQuery(host)
+	q.Port, err = net.LookupPort("udp", port)
+	require.NoError(t, err)
+	q.Timeout = 2 * time.Second
+
+	return q
+}
+
+func TestDNSQuery_SetCookie(t *testing.T) {
+	t.Parallel()
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewConventionalQuery()
+		q.SetCookie()
+
+		assert.Nil(t, q.QueryMsg.IsEdns0())
+	})
+
+	t.Run("client cookie", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.Cookie = true
+		q.SetDNSSEC()
+		q.SetCookie()
+		q.SetCookie()
+
+		opt := q.QueryMsg.IsEdns0()
+		require.NotNil(t, opt)
+		assert.True(t, opt.Do())
+		require.Len(t, opt.Option, 1, "should send the client cookie once")
+
+		cookie, ok := opt.Option[0].(*dns.EDNS0_COOKIE)
+		require.True(t, ok)
+		assert.Len(t, cookie.Cookie, 2*query.DNS_CLIENT_COOKIE_LENGTH)
+	})
+}
+
+func TestNewEDNSCookie(t *testing.T) {
+	t.Parallel()
+
+	t.Run("client cookie only", func(t *testing.T) {
+		t.Parallel()
+
+		cookie := query.NewEDNSCookie("0011223344556677")
+
+		assert.Equal(t, "0011223344556677", cookie.ClientCookie)
+		assert.Empty(t, cookie.ServerCookie)
+		assert.Equal(t, 0, cookie.ServerCookieLength)
+	})
+
+	t.Run("client and server cookie", func(t *testing.T) {
+		t.Parallel()
+
+		cookie := query.NewEDNSCookie("0011223344556677" + testServerCookie)
+
+		assert.Equal(t, "0011223344556677", cookie.ClientCookie)
+		assert.Equal(t, testServerCookie, cookie.ServerCookie)
+		assert.Equal(t, 16, cookie.ServerCookieLength)
+	})
+
+	t.Run("parse from OPT record", func(t *testing.T) {
+		t.Parallel()
+
+		msg := new(dns.Msg)
+		msg.SetEdns0(1232, false)
+		msg.IsEdns0().Option = append(msg.IsEdns0().Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0011223344556677" + testServerCookie})
+
+		info := query.NewEDNSInfo(msg)
+
+		require.NotNil(t, info.Cookie)
+		assert.Equal(t, testServerCookie, info.Cookie.ServerCookie)
+		assert.Empty(t, info.UnknownOptions, "should not record the cookie as unknown option")
+	})
+}
+
+func TestConventionalDNSQuery_Cookie(t *testing.T) {
+	t.Parallel()
+
+	host, port, err := net.SplitHostPort(startTestCookieServer(t, true, false))
+	require.NoError(t, err)
+
+	q := query.NewConventionalQuery()
+	q.Host = host
+	q.Port, err = net.LookupPort("udp", port)
+	require.NoError(t, err)
+	q.Timeout = 2 * time.Second
+	q.Cookie = true
+
+	res, qErr := query.NewConventionalDNSQueryHandler(nil).Query(q)
+
+	require.Nil(t, qErr)
+	require.NotNil(t, res.Response.EDNS)
+	require.NotNil(t, res.Response.EDNS.Cookie)
+	assert.Equal(t, testServerCookie, res.Response.EDNS.Cookie.ServerCookie)
+}
+
+func TestCookieQueryHandler_Query(t *testing.T) {
+	t.Parallel()
+
+	t.Run("enforcing server", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewCookieQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalCookieQuery(t, startTestCookieServer(t, true, true)), nil)
+
+		require.Nil(t, qErr)
+		assert.True(t, res.CookieSupported)
+		assert.Len(t, res.ClientCookie, 2*query.DNS_CLIENT_COOKIE_LENGTH)
+		assert.Equal(t, testServerCookie, res.ServerCookie)
+		assert.Equal(t, 16, res.ServerCookieLength)
+		assert.True(t, res.ServerCookieAccepted)
+		assert.Equal(t, "BADCOOKIE", res.InvalidCookieRcode)
+		assert.True(t, res.InvalidCookieBadCookie)
+		assert.True(t, res.InvalidCookieRenewed)
+		assert.NotNil(t, res.Initial)
+		assert.NotNil(t, res.Learned)
+		assert.NotNil(t, res.Invalid)
+	})
+
+	t.Run("lenient server", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewCookieQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalCookieQuery(t, startTestCookieServer(t, true, false)), nil)
+
+		require.Nil(t, qErr)
+		assert.True(t, res.CookieSupported)
+		assert.True(t, res.ServerCookieAccepted)
+		assert.Equal(t, "NOERROR", res.InvalidCookieRcode)
+		assert.False(t, res.InvalidCookieBadCookie)
+		assert.True(t, res.InvalidCookieRenewed)
+	})
+
+	t.Run("no cookie support", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewCookieQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalCookieQuery(t, startTestCookieServer(t, false, false)), nil)
+
+		require.Nil(t, qErr)
+		assert.False(t, res.CookieSupported)
+		assert.NotNil(t, res.Initial)
+		assert.Nil(t, res.Learned, "should not send a second query")
+		assert.Nil(t, res.Invalid)
+	})
+
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewCookieQueryHandler(nil)
+		require.NoError(t, err)
+
+		_, qErr := qh.Query(nil, nil)
+
+		require.NotNil(t, qErr)
+		assert.True(t, qErr.IsCritical())
+	})
+
+	t.Run("nil transport handler", func(t *testing.T) {
+		t.Parallel()
+
+		_, qErr := (&query.CookieQueryHandler{}).Query(query.NewCookieQuery("localhost"), nil)
+
+		require.NotNil(t, qErr)
+		assert.Contains(t, qErr.Error(), custom_errors.ErrQueryHandlerNil.Error())
+	})
+}
@@ -28,6 +28,8 @@ type ConventionalDNSResponse struct {
 	UDPAttempts   int          `json:"udp_attempts"`
 	TCPAttempts   int          `json:"tcp_attempts"`
 	AttemptErrors []string     `json:"attempt_errors"`
+	// Transport is set if the query was sent over DoT, DoH or DoQ instead of Do53
+	Transport *DNSTransportMeta `json:"transport"`
 }
 
 type ConventionalDNSQuery struct {
@@ -104,6 +106,8 @@ func (dq *ConventionalDNSQueryHandler) Query(query *ConventionalDNSQuery) (*Conv
 	}
 
 	query.SetDNSSEC()
+	query.SetNSID()
+	query.SetCookie()
 
 	res.WasTruncated = false
 	if query.Protocol == DNS_UDP {
@@ -122,6 +126,7 @@ func (dq *ConventionalDNSQueryHandler) Query(query *ConventionalDNSQuery) (*Conv
 				query.TimeoutUDP,
 				nil,
 			)
+			setEDNSInfoToResponse(res.Response)
 			if queryErr != nil {
 				res.AttemptErrors = append(res.AttemptErrors, queryErr.Error())
 			}
@@ -160,6 +165,7 @@ func (dq *ConventionalDNSQueryHandler) Query(query *ConventionalDNSQuery) (*Conv
 				query.TimeoutTCP,
 				nil,
 			)
+			setEDNSInfoToResponse(res.Response)
 
 			if queryErr != nil {
 				res.AttemptErrors = append(res.AttemptErrors, queryErr.Error())
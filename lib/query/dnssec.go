@@ -0,0 +1,558 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+)
+
+// validation states, see https://www.rfc-editor.org/rfc/rfc4035.html#section-4.3
+const DNSSEC_STATUS_SECURE = "secure"
+const DNSSEC_STATUS_INSECURE = "insecure"
+const DNSSEC_STATUS_BOGUS = "bogus"
+const DNSSEC_STATUS_INDETERMINATE = "indeterminate"
+
+const DNSSEC_REASON_VALID_SIGNATURE = "valid signature chained to trust anchor"
+const DNSSEC_REASON_INSECURE_DELEGATION = "unsigned RRset below a provably insecure delegation"
+const DNSSEC_REASON_MISSING_SIGNATURE = "RRset is not signed although its zone is not provably insecure"
+const DNSSEC_REASON_INVALID_SIGNATURE = "no RRSIG could be verified"
+const DNSSEC_REASON_NO_TRUSTED_KEY = "no DNSKEY of the zone matches the trust anchor or DS RRset"
+const DNSSEC_REASON_MISSING_DS = "zone has no DS RRset and no authenticated denial of it"
+const DNSSEC_REASON_QUERY_FAILED = "failed to fetch DS/DNSKEY records"
+const DNSSEC_REASON_OUTSIDE_TRUST_ANCHOR = "zone is not below the trust anchor"
+const DNSSEC_REASON_CHAIN_LOOP = "loop in chain of trust"
+const DNSSEC_REASON_NO_RRSETS = "response does not contain any RRset to validate"
+
+// DEFAULT_ROOT_TRUST_ANCHOR holds the DS records of the root KSKs (KSK-2017 and KSK-2024),
+// see https://data.iana.org/root-anchors/root-anchors.xml
+const DEFAULT_ROOT_TRUST_ANCHOR = `. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16`
+
+// DNSSECRRsetValidation is the validation state of a single RRset of a response
+type DNSSECRRsetValidation struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+type DNSSECValidation struct {
+	// Status is the worst status of all validated RRsets
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// TrustAnchor is the zone of the trust anchor the chain was validated against
+	TrustAnchor string                   `json:"trust_anchor"`
+	RRsets      []*DNSSECRRsetValidation `json:"rrsets"`
+}
+
+type DNSSECValidatorI interface {
+	Validate(msg *dns.Msg, host string, port int) *DNSSECValidation
+}
+
+// DNSSECValidator validates the answer and authority RRsets of a DNS response by walking the chain of trust
+// from the trust anchor down to the signer of each RRset. DS and DNSKEY records are fetched from the given host.
+type DNSSECValidator struct {
+	DNSSECValidatorI
+
+	QueryHandler ConventionalDNSQueryHandlerI
+	// TrustAnchor holds DS and/or DNSKEY records of a single zone (default: root KSKs)
+	TrustAnchor []dns.RR
+	// Now returns the time signature validity periods are checked against
+	Now func() time.Time
+}
+
+type dnssecRRset struct {
+	name   string
+	rrtype uint16
+	rrs    []dns.RR
+	sigs   []*dns.RRSIG
+}
+
+type dnssecZoneKeys struct {
+	keys   []*dns.DNSKEY
+	status string
+	reason string
+}
+
+// dnssecChain caches the validated keys per zone for the validation of a single response
+type dnssecChain struct {
+	validator *DNSSECValidator
+	anchor    string
+	host      string
+	port      int
+	zones     map[string]*dnssecZoneKeys
+}
+
+func (v *DNSSECValidator) Validate(msg *dns.Msg, host string, port int) *DNSSECValidation {
+	res := &DNSSECValidation{
+		RRsets: []*DNSSECRRsetValidation{},
+	}
+
+	if len(v.TrustAnchor) == 0 {
+		res.Status = DNSSEC_STATUS_INDETERMINATE
+		res.Reason = custom_errors.ErrInvalidTrustAnchor.Error()
+		return res
+	}
+
+	c := &dnssecChain{
+		validator: v,
+		anchor:    dns.CanonicalName(v.TrustAnchor[0].Header().Name),
+		host:      host,
+		port:      port,
+		zones:     map[string]*dnssecZoneKeys{},
+	}
+	res.TrustAnchor = c.anchor
+
+	if msg == nil {
+		res.Status = DNSSEC_STATUS_INDETERMINATE
+		res.Reason = DNSSEC_REASON_NO_RRSETS
+		return res
+	}
+
+	rrsets := groupRRsets(append(append([]dns.RR{}, msg.Answer...), msg.Ns...))
+	if len(rrsets) == 0 {
+		res.Status = DNSSEC_STATUS_INDETERMINATE
+		res.Reason = DNSSEC_REASON_NO_RRSETS
+		return res
+	}
+
+	res.Status = DNSSEC_STATUS_SECURE
+	res.Reason = DNSSEC_REASON_VALID_SIGNATURE
+	for _, set := range rrsets {
+		status, reason := c.validateRRset(set)
+		res.RRsets = append(res.RRsets, &DNSSECRRsetValidation{
+			Name:   set.name,
+			Type:   dns.TypeToString[set.rrtype],
+			Status: status,
+			Reason: reason,
+		})
+
+		if dnssecStatusRank(status) > dnssecStatusRank(res.Status) {
+			res.Status = status
+			res.Reason = fmt.Sprintf("%s %s: %s", set.name, dns.TypeToString[set.rrtype], reason)
+		}
+	}
+
+	return res
+}
+
+func (c *dnssecChain) validateRRset(set *dnssecRRset) (status string, reason string) {
+	if len(set.sigs) == 0 {
+		insecure, err := c.proveInsecure(set.name)
+		if err != nil {
+			return DNSSEC_STATUS_INDETERMINATE, fmt.Sprintf("%s: %s", DNSSEC_REASON_QUERY_FAILED, err.Error())
+		}
+		if insecure != "" {
+			return DNSSEC_STATUS_INSECURE, fmt.Sprintf("%s %s", DNSSEC_REASON_INSECURE_DELEGATION, insecure)
+		}
+		return DNSSEC_STATUS_BOGUS, DNSSEC_REASON_MISSING_SIGNATURE
+	}
+
+	var lastErr error
+	for _, sig := range set.sigs {
+		signer := dns.CanonicalName(sig.SignerName)
+		if !dns.IsSubDomain(signer, set.name) {
+			lastErr = custom_errors.ErrDNSSECInvalidSigner
+			continue
+		}
+
+		zk := c.zoneKeys(signer)
+		if zk.status != DNSSEC_STATUS_SECURE {
+			// a signed RRset of an insecure zone is insecure as well, see https://www.rfc-editor.org/rfc/rfc4035.html#section-4.3
+			return zk.status, fmt.Sprintf("zone %s: %s", signer, zk.reason)
+		}
+
+		if lastErr = c.verify(zk.keys, sig, set.rrs); lastErr == nil {
+			return DNSSEC_STATUS_SECURE, DNSSEC_REASON_VALID_SIGNATURE
+		}
+	}
+
+	return DNSSEC_STATUS_BOGUS, fmt.Sprintf("%s: %s", DNSSEC_REASON_INVALID_SIGNATURE, lastErr.Error())
+}
+
+// zoneKeys returns the validated DNSKEYs of the given zone
+func (c *dnssecChain) zoneKeys(zone string) *dnssecZoneKeys {
+	if zk, ok := c.zones[zone]; ok {
+		return zk
+	}
+
+	// guard against signer names referencing each other
+	c.zones[zone] = &dnssecZoneKeys{status: DNSSEC_STATUS_BOGUS, reason: DNSSEC_REASON_CHAIN_LOOP}
+
+	zk := c.resolveZoneKeys(zone)
+	c.zones[zone] = zk
+
+	return zk
+}
+
+func (c *dnssecChain) resolveZoneKeys(zone string) *dnssecZoneKeys {
+	if !dns.IsSubDomain(c.anchor, zone) {
+		return &dnssecZoneKeys{status: DNSSEC_STATUS_INDETERMINATE, reason: DNSSEC_REASON_OUTSIDE_TRUST_ANCHOR}
+	}
+
+	// either the trust anchor or the authenticated DS RRset of the zone
+	anchors := c.validator.TrustAnchor
+	if zone != c.anchor {
+		dsSet, err := c.fetchRRset(zone, dns.TypeDS)
+		if err != nil {
+			return &dnssecZoneKeys{status: DNSSEC_STATUS_INDETERMINATE, reason: fmt.Sprintf("%s: %s", DNSSEC_REASON_QUERY_FAILED, err.Error())}
+		}
+
+		if dsSet == nil || len(dsSet.rrs) == 0 {
+			insecure, err := c.proveInsecure(zone)
+			if err != nil {
+				return &dnssecZoneKeys{status: DNSSEC_STATUS_INDETERMINATE, reason: fmt.Sprintf("%s: %s", DNSSEC_REASON_QUERY_FAILED, err.Error())}
+			}
+			if insecure != "" {
+				return &dnssecZoneKeys{status: DNSSEC_STATUS_INSECURE, reason: fmt.Sprintf("%s %s", DNSSEC_REASON_INSECURE_DELEGATION, insecure)}
+			}
+			return &dnssecZoneKeys{status: DNSSEC_STATUS_BOGUS, reason: DNSSEC_REASON_MISSING_DS}
+		}
+
+		// the DS RRset lives in the parent zone
+		if status, reason := c.validateParentRRset(dsSet, zone); status != DNSSEC_STATUS_SECURE {
+			return &dnssecZoneKeys{status: status, reason: fmt.Sprintf("DS RRset: %s", reason)}
+		}
+
+		anchors = dsSet.rrs
+	}
+
+	keySet, err := c.fetchRRset(zone, dns.TypeDNSKEY)
+	if err != nil {
+		return &dnssecZoneKeys{status: DNSSEC_STATUS_INDETERMINATE, reason: fmt.Sprintf("%s: %s", DNSSEC_REASON_QUERY_FAILED, err.Error())}
+	}
+
+	trusted := matchTrustAnchor(keySet, anchors)
+	if len(trusted) == 0 {
+		return &dnssecZoneKeys{status: DNSSEC_STATUS_BOGUS, reason: DNSSEC_REASON_NO_TRUSTED_KEY}
+	}
+
+	// the DNSKEY RRset must be self-signed by a trusted key
+	var lastErr error = custom_errors.ErrDNSSECNoMatchingKey
+	for _, sig := range keySet.sigs {
+		if lastErr = c.verify(trusted, sig, keySet.rrs); lastErr == nil {
+			keys := []*dns.DNSKEY{}
+			for _, rr := range keySet.rrs {
+				keys = append(keys, rr.(*dns.DNSKEY))
+			}
+			return &dnssecZoneKeys{keys: keys, status: DNSSEC_STATUS_SECURE, reason: DNSSEC_REASON_VALID_SIGNATURE}
+		}
+	}
+
+	return &dnssecZoneKeys{status: DNSSEC_STATUS_BOGUS, reason: fmt.Sprintf("DNSKEY RRset: %s: %s", DNSSEC_REASON_INVALID_SIGNATURE, lastErr.Error())}
+}
+
+// validateParentRRset validates RRsets that must be signed by a zone above the given child (DS, NSEC, NSEC3)
+func (c *dnssecChain) validateParentRRset(set *dnssecRRset, child string) (status string, reason string) {
+	if len(set.sigs) == 0 {
+		return DNSSEC_STATUS_BOGUS, DNSSEC_REASON_MISSING_SIGNATURE
+	}
+
+	var lastErr error
+	for _, sig := range set.sigs {
+		signer := dns.CanonicalName(sig.SignerName)
+		if signer == child || !dns.IsSubDomain(signer, child) {
+			lastErr = custom_errors.ErrDNSSECInvalidSigner
+			continue
+		}
+
+		zk := c.zoneKeys(signer)
+		if zk.status != DNSSEC_STATUS_SECURE {
+			return zk.status, fmt.Sprintf("zone %s: %s", signer, zk.reason)
+		}
+
+		if lastErr = c.verify(zk.keys, sig, set.rrs); lastErr == nil {
+			return DNSSEC_STATUS_SECURE, DNSSEC_REASON_VALID_SIGNATURE
+		}
+	}
+
+	return DNSSEC_STATUS_BOGUS, fmt.Sprintf("%s: %s", DNSSEC_REASON_INVALID_SIGNATURE, lastErr.Error())
+}
+
+// proveInsecure walks the delegations from the trust anchor down to name and returns the first delegation
+// that is authenticated to have no DS RRset, see https://www.rfc-editor.org/rfc/rfc4035.html#section-5.2
+//
+// an empty string is returned if no such delegation could be proven
+func (c *dnssecChain) proveInsecure(name string) (string, error) {
+	name = dns.CanonicalName(name)
+	if !dns.IsSubDomain(c.anchor, name) {
+		return "", nil
+	}
+
+	labels := dns.SplitDomainName(name)
+	anchorLabels := dns.CountLabel(c.anchor)
+
+	// from the label below the anchor down to name itself
+	for i := len(labels) - anchorLabels - 1; i >= 0; i-- {
+		cut := dns.Fqdn(strings.Join(labels[i:], "."))
+
+		msg, err := c.fetch(cut, dns.TypeDS)
+		if err != nil {
+			return "", err
+		}
+
+		rrsets := groupRRsets(append(append([]dns.RR{}, msg.Answer...), msg.Ns...))
+		if findRRset(rrsets, cut, dns.TypeDS) != nil {
+			// secure delegation, keep walking
+			continue
+		}
+
+		if c.deniesDS(rrsets, cut) {
+			return cut, nil
+		}
+	}
+
+	return "", nil
+}
+
+// deniesDS checks whether the authenticated NSEC or NSEC3 records prove a delegation without DS at cut
+func (c *dnssecChain) deniesDS(rrsets []*dnssecRRset, cut string) bool {
+	for _, set := range rrsets {
+		if set.rrtype != dns.TypeNSEC && set.rrtype != dns.TypeNSEC3 {
+			continue
+		}
+
+		proven := false
+		for _, rr := range set.rrs {
+			switch r := rr.(type) {
+			case *dns.NSEC:
+				proven = proven || (dns.CanonicalName(r.Hdr.Name) == cut && isInsecureDelegation(r.TypeBitMap))
+			case *dns.NSEC3:
+				if r.Match(cut) {
+					proven = proven || isInsecureDelegation(r.TypeBitMap)
+				} else if r.Cover(cut) && r.Flags&0x01 == 0x01 {
+					// opt-out NSEC3 covering the delegation, see https://www.rfc-editor.org/rfc/rfc5155.html#section-8.6
+					proven = true
+				}
+			}
+		}
+
+		if proven {
+			if status, _ := c.validateParentRRset(set, cut); status == DNSSEC_STATUS_SECURE {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isInsecureDelegation(bitmap []uint16) bool {
+	hasNS, hasDS, hasSOA := false, false, false
+	for _, t := range bitmap {
+		switch t {
+		case dns.TypeNS:
+			hasNS = true
+		case dns.TypeDS:
+			hasDS = true
+		case dns.TypeSOA:
+			hasSOA = true
+		}
+	}
+
+	return hasNS && !hasDS && !hasSOA
+}
+
+func (c *dnssecChain) verify(keys []*dns.DNSKEY, sig *dns.RRSIG, rrs []dns.RR) error {
+	now := time.Now()
+	if c.validator.Now != nil {
+		now = c.validator.Now()
+	}
+
+	if !sig.ValidityPeriod(now) {
+		return custom_errors.ErrDNSSECSignatureExpired
+	}
+
+	var lastErr error = custom_errors.ErrDNSSECNoMatchingKey
+	for _, key := range keys {
+		if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm || key.Flags&dns.ZONE == 0 || key.Flags&dns.REVOKE != 0 {
+			continue
+		}
+
+		if lastErr = sig.Verify(key, rrs); lastErr == nil {
+			return nil
+		}
+	}
+
+	return lastErr
+}
+
+func (c *dnssecChain) fetch(name string, qtype uint16) (*dns.Msg, error) {
+	q := NewConventionalQuery()
+	q.Host = c.host
+	q.Port = c.port
+	q.QueryMsg.SetQuestion(name, qtype)
+	// we validate on our own, thus we want to see bogus data instead of SERVFAIL
+	q.QueryMsg.CheckingDisabled = true
+
+	if c.validator.QueryHandler == nil {
+		return nil, custom_errors.ErrQueryHandlerNil
+	}
+
+	res, err := c.validator.QueryHandler.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil || res.Response == nil || res.Response.ResponseMsg == nil {
+		return nil, custom_errors.ErrNoResponse
+	}
+
+	msg := res.Response.ResponseMsg
+	if msg.Rcode != dns.RcodeSuccess && msg.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("%w: %s %s returned %s", custom_errors.ErrDNSSECChainQueryFailed, name, dns.TypeToString[qtype], dns.RcodeToString[msg.Rcode])
+	}
+
+	return msg, nil
+}
+
+// fetchRRset returns the RRset of the given name and type from the answer section, nil if it does not exist
+func (c *dnssecChain) fetchRRset(name string, qtype uint16) (*dnssecRRset, error) {
+	msg, err := c.fetch(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	set := findRRset(groupRRsets(msg.Answer), name, qtype)
+	if set == nil && qtype == dns.TypeDNSKEY {
+		return nil, fmt.Errorf("%w: no DNSKEY RRset for %s", custom_errors.ErrDNSSECChainQueryFailed, name)
+	}
+
+	return set, nil
+}
+
+// groupRRsets groups the records by owner name and type and assigns the covering RRSIGs
+func groupRRsets(rrs []dns.RR) []*dnssecRRset {
+	rrsets := []*dnssecRRset{}
+	sigs := []*dns.RRSIG{}
+
+	for _, rr := range rrs {
+		if rr == nil || rr.Header().Rrtype == dns.TypeOPT {
+			continue
+		}
+
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+			continue
+		}
+
+		name := dns.CanonicalName(rr.Header().Name)
+		set := findRRset(rrsets, name, rr.Header().Rrtype)
+		if set == nil {
+			set = &dnssecRRset{name: name, rrtype: rr.Header().Rrtype}
+			rrsets = append(rrsets, set)
+		}
+		set.rrs = append(set.rrs, rr)
+	}
+
+	for _, sig := range sigs {
+		if set := findRRset(rrsets, dns.CanonicalName(sig.Hdr.Name), sig.TypeCovered); set != nil {
+			set.sigs = append(set.sigs, sig)
+		}
+	}
+
+	return rrsets
+}
+
+func findRRset(rrsets []*dnssecRRset, name string, rrtype uint16) *dnssecRRset {
+	name = dns.CanonicalName(name)
+	for _, set := range rrsets {
+		if set.name == name && set.rrtype == rrtype {
+			return set
+		}
+	}
+	return nil
+}
+
+// matchTrustAnchor returns the DNSKEYs of the RRset that match one of the given DS or DNSKEY records
+func matchTrustAnchor(keySet *dnssecRRset, anchors []dns.RR) []*dns.DNSKEY {
+	matched := []*dns.DNSKEY{}
+	if keySet == nil {
+		return matched
+	}
+
+	for _, rr := range keySet.rrs {
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok {
+			continue
+		}
+
+		for _, anchor := range anchors {
+			switch a := anchor.(type) {
+			case *dns.DS:
+				ds := key.ToDS(a.DigestType)
+				if ds != nil && ds.KeyTag == a.KeyTag && ds.Algorithm == a.Algorithm && strings.EqualFold(ds.Digest, a.Digest) {
+					matched = append(matched, key)
+				}
+			case *dns.DNSKEY:
+				if key.Flags == a.Flags && key.Protocol == a.Protocol && key.Algorithm == a.Algorithm && key.PublicKey == a.PublicKey {
+					matched = append(matched, key)
+				}
+			}
+		}
+	}
+
+	return matched
+}
+
+func dnssecStatusRank(status string) int {
+	switch status {
+	case DNSSEC_STATUS_SECURE:
+		return 0
+	case DNSSEC_STATUS_INSECURE:
+		return 1
+	case DNSSEC_STATUS_INDETERMINATE:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// ParseTrustAnchor parses DS and/or DNSKEY records in zone file format, all records must belong to the same zone
+func ParseTrustAnchor(anchor string) ([]dns.RR, error) {
+	rrs := []dns.RR{}
+
+	zp := dns.NewZoneParser(strings.NewReader(anchor), "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if rr.Header().Rrtype != dns.TypeDS && rr.Header().Rrtype != dns.TypeDNSKEY {
+			return nil, fmt.Errorf("%w: unsupported record type %s", custom_errors.ErrInvalidTrustAnchor, dns.TypeToString[rr.Header().Rrtype])
+		}
+
+		if len(rrs) > 0 && dns.CanonicalName(rr.Header().Name) != dns.CanonicalName(rrs[0].Header().Name) {
+			return nil, fmt.Errorf("%w: records of multiple zones", custom_errors.ErrInvalidTrustAnchor)
+		}
+
+		rrs = append(rrs, rr)
+	}
+
+	if err := zp.Err(); err != nil {
+		return nil, errors.Join(custom_errors.ErrInvalidTrustAnchor, err)
+	}
+
+	if len(rrs) == 0 {
+		return nil, fmt.Errorf("%w: no records", custom_errors.ErrInvalidTrustAnchor)
+	}
+
+	return rrs, nil
+}
+
+// NewDNSSECValidator creates a validator with the given trust anchor, the root KSKs are used if anchor is empty
+func NewDNSSECValidator(queryHandler ConventionalDNSQueryHandlerI, anchor string) (*DNSSECValidator, error) {
+	if anchor == "" {
+		anchor = DEFAULT_ROOT_TRUST_ANCHOR
+	}
+
+	rrs, err := ParseTrustAnchor(anchor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DNSSECValidator{
+		QueryHandler: queryHandler,
+		TrustAnchor:  rrs,
+	}, nil
+}
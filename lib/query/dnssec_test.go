@@ -0,0 +1,325 @@
+package query_test
+
+import (
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dnssecTestTarget = "_dns.resolver.example."
+const dnssecTestInsecureTarget = "_dns.resolver.insecure."
+
+type dnssecTestZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newDNSSECTestZone(t *testing.T, name string) *dnssecTestZone {
+	t.Helper()
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+
+	return &dnssecTestZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+func (z *dnssecTestZone) sign(t *testing.T, rrs ...dns.RR) *dns.RRSIG {
+	t.Helper()
+
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: 3600},
+		Algorithm:  z.key.Algorithm,
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.name,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	require.NoError(t, sig.Sign(z.priv, rrs))
+
+	return sig
+}
+
+// stubbedChainHandler answers DS/DNSKEY queries from a local signed hierarchy
+type stubbedChainHandler struct {
+	responses map[string]*dns.Msg
+	err       custom_errors.DoEErrors
+}
+
+func (h *stubbedChainHandler) Query(q *query.ConventionalDNSQuery) (*query.ConventionalDNSResponse, custom_errors.DoEErrors) {
+	res := &query.ConventionalDNSResponse{Response: &query.DNSResponse{}}
+	if h.err != nil {
+		return res, h.err
+	}
+
+	question := q.QueryMsg.Question[0]
+	msg, ok := h.responses[strings.ToLower(question.Name)+"|"+dns.TypeToString[question.Qtype]]
+	if !ok {
+		msg = new(dns.Msg)
+	}
+	res.Response.ResponseMsg = msg
+
+	return res, nil
+}
+
+type dnssecTestHierarchy struct {
+	root    *dnssecTestZone
+	example *dnssecTestZone
+	handler *stubbedChainHandler
+}
+
+// newDNSSECTestHierarchy creates a signed root with the secure delegation example. and the insecure delegation insecure.
+func newDNSSECTestHierarchy(t *testing.T) *dnssecTestHierarchy {
+	t.Helper()
+
+	root := newDNSSECTestZone(t, ".")
+	example := newDNSSECTestZone(t, "example.")
+
+	ds := example.key.ToDS(dns.SHA256)
+	ds.Hdr.Ttl = 3600
+
+	nsec := &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: "insecure.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600},
+		NextDomain: "zzz.",
+		TypeBitMap: []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC},
+	}
+
+	return &dnssecTestHierarchy{
+		root:    root,
+		example: example,
+		handler: &stubbedChainHandler{
+			responses: map[string]*dns.Msg{
+				".|DNSKEY":        {Answer: []dns.RR{root.key, root.sign(t, root.key)}},
+				"example.|DS":     {Answer: []dns.RR{ds, root.sign(t, ds)}},
+				"example.|DNSKEY": {Answer: []dns.RR{example.key, example.sign(t, example.key)}},
+				"insecure.|DS":    {Ns: []dns.RR{nsec, root.sign(t, nsec)}},
+			},
+		},
+	}
+}
+
+func newDNSSECTestSVCB(name string) *dns.SVCB {
+	return &dns.SVCB{
+		Hdr:      dns.RR_Header{Name: name, Rrtype: dns.TypeSVCB, Class: dns.ClassINET, Ttl: 300},
+		Priority: 1,
+		Target:   "resolver.example.",
+	}
+}
+
+func TestDNSSECValidator_Validate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("secure RRset", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.String())
+		require.NoError(t, err)
+
+		svcb := newDNSSECTestSVCB(dnssecTestTarget)
+		msg := &dns.Msg{Answer: []dns.RR{svcb, h.example.sign(t, svcb)}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		require.NotNil(t, res)
+		assert.Equal(t, query.DNSSEC_STATUS_SECURE, res.Status)
+		assert.Equal(t, ".", res.TrustAnchor)
+		require.Len(t, res.RRsets, 1)
+		assert.Equal(t, dnssecTestTarget, res.RRsets[0].Name)
+		assert.Equal(t, "SVCB", res.RRsets[0].Type)
+		assert.Equal(t, query.DNSSEC_STATUS_SECURE, res.RRsets[0].Status)
+	})
+
+	t.Run("DS trust anchor", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.ToDS(dns.SHA256).String())
+		require.NoError(t, err)
+
+		svcb := newDNSSECTestSVCB(dnssecTestTarget)
+		msg := &dns.Msg{Answer: []dns.RR{svcb, h.example.sign(t, svcb)}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_SECURE, res.Status)
+	})
+
+	t.Run("tampered RRset is bogus", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.String())
+		require.NoError(t, err)
+
+		svcb := newDNSSECTestSVCB(dnssecTestTarget)
+		sig := h.example.sign(t, svcb)
+		svcb.Target = "evil.example."
+		msg := &dns.Msg{Answer: []dns.RR{svcb, sig}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_BOGUS, res.Status)
+		require.Len(t, res.RRsets, 1)
+		assert.Contains(t, res.RRsets[0].Reason, query.DNSSEC_REASON_INVALID_SIGNATURE)
+	})
+
+	t.Run("unsigned RRset below insecure delegation", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.String())
+		require.NoError(t, err)
+
+		msg := &dns.Msg{Answer: []dns.RR{newDNSSECTestSVCB(dnssecTestInsecureTarget)}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_INSECURE, res.Status)
+		require.Len(t, res.RRsets, 1)
+		assert.Contains(t, res.RRsets[0].Reason, "insecure.")
+	})
+
+	t.Run("unsigned RRset in secure zone is bogus", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.String())
+		require.NoError(t, err)
+
+		msg := &dns.Msg{Answer: []dns.RR{newDNSSECTestSVCB(dnssecTestTarget)}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_BOGUS, res.Status)
+		require.Len(t, res.RRsets, 1)
+		assert.Equal(t, query.DNSSEC_REASON_MISSING_SIGNATURE, res.RRsets[0].Reason)
+	})
+
+	t.Run("expired signatures are bogus", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.String())
+		require.NoError(t, err)
+		v.Now = func() time.Time { return time.Now().Add(48 * time.Hour) }
+
+		svcb := newDNSSECTestSVCB(dnssecTestTarget)
+		msg := &dns.Msg{Answer: []dns.RR{svcb, h.example.sign(t, svcb)}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_BOGUS, res.Status)
+		assert.Contains(t, res.Reason, custom_errors.ErrDNSSECSignatureExpired.Error())
+	})
+
+	t.Run("unknown trust anchor is bogus", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		other := newDNSSECTestZone(t, ".")
+		v, err := query.NewDNSSECValidator(h.handler, other.key.String())
+		require.NoError(t, err)
+
+		svcb := newDNSSECTestSVCB(dnssecTestTarget)
+		msg := &dns.Msg{Answer: []dns.RR{svcb, h.example.sign(t, svcb)}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_BOGUS, res.Status)
+		assert.Contains(t, res.Reason, query.DNSSEC_REASON_NO_TRUSTED_KEY)
+	})
+
+	t.Run("failing chain queries are indeterminate", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		h.handler.err = custom_errors.NewQueryError(custom_errors.ErrNoResponse, true)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.String())
+		require.NoError(t, err)
+
+		svcb := newDNSSECTestSVCB(dnssecTestTarget)
+		msg := &dns.Msg{Answer: []dns.RR{svcb, h.example.sign(t, svcb)}}
+
+		res := v.Validate(msg, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_INDETERMINATE, res.Status)
+		assert.Contains(t, res.Reason, query.DNSSEC_REASON_QUERY_FAILED)
+	})
+
+	t.Run("empty response is indeterminate", func(t *testing.T) {
+		t.Parallel()
+
+		h := newDNSSECTestHierarchy(t)
+		v, err := query.NewDNSSECValidator(h.handler, h.root.key.String())
+		require.NoError(t, err)
+
+		res := v.Validate(&dns.Msg{}, "localhost", 53)
+
+		assert.Equal(t, query.DNSSEC_STATUS_INDETERMINATE, res.Status)
+		assert.Equal(t, query.DNSSEC_REASON_NO_RRSETS, res.Reason)
+		assert.Empty(t, res.RRsets)
+	})
+}
+
+func TestParseTrustAnchor(t *testing.T) {
+	t.Parallel()
+
+	t.Run("default root trust anchor", func(t *testing.T) {
+		t.Parallel()
+
+		rrs, err := query.ParseTrustAnchor(query.DEFAULT_ROOT_TRUST_ANCHOR)
+
+		require.NoError(t, err)
+		require.Len(t, rrs, 2)
+		assert.Equal(t, uint16(20326), rrs[0].(*dns.DS).KeyTag)
+		assert.Equal(t, uint16(38696), rrs[1].(*dns.DS).KeyTag)
+	})
+
+	t.Run("unsupported record type", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := query.ParseTrustAnchor(". IN A 127.0.0.1")
+
+		assert.True(t, errors.Is(err, custom_errors.ErrInvalidTrustAnchor))
+	})
+
+	t.Run("records of multiple zones", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := query.ParseTrustAnchor(query.DEFAULT_ROOT_TRUST_ANCHOR + "\nexample. IN DS 1 8 2 AABB")
+
+		assert.True(t, errors.Is(err, custom_errors.ErrInvalidTrustAnchor))
+	})
+
+	t.Run("invalid syntax", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := query.ParseTrustAnchor("no dns record")
+
+		assert.True(t, errors.Is(err, custom_errors.ErrInvalidTrustAnchor))
+	})
+
+	t.Run("empty trust anchor", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := query.ParseTrustAnchor("")
+
+		assert.True(t, errors.Is(err, custom_errors.ErrInvalidTrustAnchor))
+	})
+}
@@ -7,10 +7,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
-	"net/url"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -37,8 +37,31 @@ const DEFAULT_DOH_PATH = "/dns-query{?dns}"
 const DEFAULT_DOH_TIMEOUT = 10000 * time.Millisecond
 const DEFAULT_DOH_PORT = 443
 
+// bodies of responses that are not DNS messages are kept up to this size for diagnosis
+const MAX_DOH_HTTP_BODY_SIZE = 1024
+
 type HttpQueryHandler interface {
-	Query(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*dns.Msg, time.Duration, *tls.ConnectionState, error)
+	// Query returns the answer, its size on the wire and the details of the HTTP response
+	Query(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*dns.Msg, int, *DoHHTTPResponse, time.Duration, *tls.ConnectionState, error)
+	// QueryJSON sends a request to the JSON API, see dohjson.go
+	QueryJSON(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*DoHJSONResponse, *DoHHTTPResponse, time.Duration, *tls.ConnectionState, error)
+}
+
+// DoHHTTPResponse holds the HTTP layer of a DoH response
+type DoHHTTPResponse struct {
+	// Proto is the negotiated HTTP version, e.g., HTTP/2.0
+	Proto        string `json:"proto"`
+	StatusCode   int    `json:"status_code"`
+	ContentType  string `json:"content_type"`
+	CacheControl string `json:"cache_control"`
+	// Age is the value of the Age header in seconds, -1 if not set
+	Age    int    `json:"age"`
+	Server string `json:"server"`
+	AltSvc string `json:"alt_svc"`
+
+	// Body is the (truncated) body of responses that are not application/dns-message
+	Body          string `json:"body"`
+	BodyTruncated bool   `json:"body_truncated"`
 }
 
 type defaultHttpQueryHandler struct {
@@ -46,7 +69,23 @@ type defaultHttpQueryHandler struct {
 	QuicTransport *quic.Transport
 }
 
-func (h *defaultHttpQueryHandler) Query(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*dns.Msg, time.Duration, *tls.ConnectionState, error) {
+func (h *defaultHttpQueryHandler) Query(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*dns.Msg, int, *DoHHTTPResponse, time.Duration, *tls.ConnectionState, error) {
+	content, httpInfo, rtt, connState, err := h.do(httpReq, httpVersion, timeout, transport)
+	if err != nil {
+		return nil, 0, httpInfo, 0, connState, err
+	}
+
+	r := &dns.Msg{}
+	err = r.Unpack(content)
+	if err != nil {
+		return nil, 0, httpInfo, 0, connState, err
+	}
+
+	return r, len(content), httpInfo, rtt, connState, nil
+}
+
+// do executes the HTTP request and returns the body of successful responses
+func (h *defaultHttpQueryHandler) do(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) ([]byte, *DoHHTTPResponse, time.Duration, *tls.ConnectionState, error) {
 	// set dialer for http1/http2/http3
 	switch httpVersion {
 	case HTTP_VERSION_1, HTTP_VERSION_2:
@@ -76,7 +115,7 @@ func (h *defaultHttpQueryHandler) Query(httpReq *http.Request, httpVersion strin
 	}
 
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, nil, 0, nil, err
 	}
 
 	// obviously we have established a connection now
@@ -85,35 +124,52 @@ func (h *defaultHttpQueryHandler) Query(httpReq *http.Request, httpVersion strin
 
 	rtt := time.Since(begin)
 
+	httpInfo := newDoHHTTPResponse(httpRes)
+
 	content, err := io.ReadAll(httpRes.Body)
 	if err != nil {
-		return nil, 0, connState, err
+		return nil, httpInfo, 0, connState, err
 	}
 
+	setBodyToDoHHTTPResponse(content, httpInfo)
+
 	if httpRes.StatusCode != http.StatusOK {
-		return nil, 0, connState, fmt.Errorf("DoH query failed with status code %d: \n %s", httpRes.StatusCode, string(content))
+		return nil, httpInfo, 0, connState, fmt.Errorf("DoH query failed with status code %d: \n %s", httpRes.StatusCode, string(content))
 	}
 
-	r := &dns.Msg{}
-	err = r.Unpack(content)
-	if err != nil {
-		return nil, 0, connState, err
+	return content, httpInfo, rtt, connState, nil
+}
+
+func newDoHHTTPResponse(httpRes *http.Response) *DoHHTTPResponse {
+	info := &DoHHTTPResponse{
+		Proto:        httpRes.Proto,
+		StatusCode:   httpRes.StatusCode,
+		ContentType:  httpRes.Header.Get("content-type"),
+		CacheControl: httpRes.Header.Get("cache-control"),
+		Age:          -1,
+		Server:       httpRes.Header.Get("server"),
+		AltSvc:       httpRes.Header.Get("alt-svc"),
 	}
 
-	return r, rtt, connState, nil
+	if age, err := strconv.Atoi(httpRes.Header.Get("age")); err == nil {
+		info.Age = age
+	}
+
+	return info
 }
 
-func GetPathParamFromDoHPath(uri string) (path string, param string, err *custom_errors.DoEError) {
-	// first we remove the query string by a regex fetching "{?<some-string>}"
-	// see also https://datatracker.ietf.org/doc/html/rfc8484#section-4.1.1
-	paramRegex := regexp.MustCompile(`^([^\{]+)\{\?(.*)\}$`)
-	match := paramRegex.FindStringSubmatch(uri)
+// setBodyToDoHHTTPResponse keeps the body of responses that are not DNS messages, e.g., error pages
+func setBodyToDoHHTTPResponse(content []byte, info *DoHHTTPResponse) {
+	if mediaType, _, err := mime.ParseMediaType(info.ContentType); err == nil && (mediaType == DOH_MEDIA_TYPE || mediaType == DOH_JSON_MEDIA_TYPE) {
+		return
+	}
 
-	if len(match) == 3 {
-		return match[1], match[2], nil
-	} else {
-		return "", "", custom_errors.NewQueryConfigError(custom_errors.ErrUnexpectedURIPath, true)
+	if len(content) > MAX_DOH_HTTP_BODY_SIZE {
+		content = content[:MAX_DOH_HTTP_BODY_SIZE]
+		info.BodyTruncated = true
 	}
+
+	info.Body = string(content)
 }
 
 type DoHQuery struct {
@@ -130,10 +186,30 @@ type DoHQuery struct {
 
 	// HTTP1, HTTP2 or HTTP3 support (default:HTTP2)
 	HTTPVersion string `json:"http_version"`
+
+	// Format is wire (RFC 8484), json (JSON API) or both (default: wire)
+	Format string `json:"format"`
 }
 
 type DoHResponse struct {
 	DoEResponse
+
+	// HTTP holds the HTTP layer of the response, nil if no HTTP response was received
+	HTTP *DoHHTTPResponse `json:"http"`
+
+	// URITemplate is the raw URI template of the query
+	URITemplate string `json:"uri_template"`
+	// URIExpansion is the expanded URI template of the request, the dns variable is undefined for POST and JSON API requests
+	URIExpansion string `json:"uri_expansion"`
+	// URITemplateError is set if the URI template is malformed, the request is sent with the partial expansion anyway
+	URITemplateError string `json:"uri_template_error"`
+
+	// JSON holds the JSON API request of the json and both formats
+	JSON *DoHJSONResult `json:"json"`
+	// WireFormatSupported is set if the endpoint answered the wire format request with a DNS message
+	WireFormatSupported bool `json:"wire_format_supported"`
+	// JSONFormatSupported is set if the endpoint answered the JSON API request
+	JSONFormatSupported bool `json:"json_format_supported"`
 }
 
 type DoHQueryHandler struct {
@@ -171,6 +247,10 @@ func (qh *DoHQueryHandler) Query(query *DoHQuery) (*DoHResponse, custom_errors.D
 		return res, custom_errors.NewQueryConfigError(custom_errors.ErrEmptyURIPath, true)
 	}
 
+	if query.Format != "" && query.Format != DOH_FORMAT_WIRE && query.Format != DOH_FORMAT_JSON && query.Format != DOH_FORMAT_BOTH {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrInvalidDoHFormat, true).AddInfoString(query.Format)
+	}
+
 	// set the TLS config
 	tlsConfig := &tls.Config{
 		InsecureSkipVerify: query.SkipCertificateVerify,
@@ -186,17 +266,25 @@ func (qh *DoHQueryHandler) Query(query *DoHQuery) (*DoHResponse, custom_errors.D
 		tlsConfig.ServerName = query.SNI
 	}
 
-	// let's calculate params first
-	path, param, paramErr := GetPathParamFromDoHPath(query.URI)
-	if paramErr != nil {
-		return res, paramErr
+	setECHConfigToTLSConfig(query.ECHConfigList, query.SkipCertificateVerify, tlsConfig)
+
+	// the expansion without the dns variable is the path of POST and JSON API requests
+	path, templateErr := ExpandDoHURITemplate(query.URI, "")
+	if templateErr != nil {
+		logrus.Warnf("DoH URI template %s is malformed, continue with partial expansion %s: %s", query.URI, path, templateErr.Error())
 	}
 
-	if strings.ToLower(param) != "dns" {
-		logrus.Warnf("DoH query param %s is not 'dns', this is not a standard DoH query", param)
+	if !hasDoHURITemplateVariable(query.URI) {
+		logrus.Warnf("DoH URI template %s has no dns variable, this is not a standard DoH query", query.URI)
 	}
 
+	// keep the query message as is for a retry without ECH
+	retryMsg := query.QueryMsg.Copy()
+
 	query.SetDNSSEC()
+	query.SetNSID()
+	query.SetCookie()
+	query.SetPadding()
 
 	// set the transport based on the HTTP version
 	var transport http.RoundTripper
@@ -231,16 +319,18 @@ func (qh *DoHQueryHandler) Query(query *DoHQuery) (*DoHResponse, custom_errors.D
 		}
 	}
 
+	if query.Format == DOH_FORMAT_JSON {
+		jsonRes, jsonErr := qh.queryJSONFormat(query, path, transport, retryMsg)
+		setURITemplateToResponse(query.URI, path, templateErr, jsonRes)
+		return jsonRes, jsonErr
+	}
+
 	// see RFC for DoH: https://datatracker.ietf.org/doc/html/rfc8484
 	// see https://gist.github.com/cherrot/384eb7d9d537ead18462b5c462a07690
 	var (
 		buf, b64 []byte
 	)
 
-	if strings.ToLower(param) != "dns" {
-		logrus.Warnf("DoH query param %s is not 'dns', this is not a standard DoH query", param)
-	}
-
 	// Set DNS ID as zero according to RFC8484 (cache friendly)
 	query.QueryMsg.Id = 0
 
@@ -255,15 +345,12 @@ func (qh *DoHQueryHandler) Query(query *DoHQuery) (*DoHResponse, custom_errors.D
 
 	endpoint := fmt.Sprintf("https://%s", helper.GetFullHostFromHostPort(query.Host, query.Port))
 
-	baseUri, err := url.JoinPath(endpoint, path)
-	if err != nil {
-		return res, custom_errors.NewQueryError(custom_errors.ErrFailedToJoinURLPath, true).AddInfo(err)
-	}
-
-	fullGetURI := fmt.Sprintf("%s?%s=%s", baseUri, param, string(b64))
+	getPath, _ := ExpandDoHURITemplate(query.URI, string(b64))
+	fullGetURI := joinDoHURI(endpoint, getPath)
 
 	var queryErr error
 	var tlsConnState *tls.ConnectionState
+	var responseSize int
 	//nolint:gocritic
 	if query.Method == HTTP_GET && len(fullGetURI) <= MAX_URI_LENGTH {
 		// ready to try GET request
@@ -273,10 +360,11 @@ func (qh *DoHQueryHandler) Query(query *DoHQuery) (*DoHResponse, custom_errors.D
 		}
 		httpReq.Header.Add("accept", DOH_MEDIA_TYPE)
 
-		res.ResponseMsg, res.RTT, tlsConnState, queryErr = qh.QueryHandler.Query(httpReq, query.HTTPVersion, query.Timeout, transport)
+		setURITemplateToResponse(query.URI, getPath, templateErr, res)
+		res.ResponseMsg, responseSize, res.HTTP, res.RTT, tlsConnState, queryErr = qh.QueryHandler.Query(httpReq, query.HTTPVersion, query.Timeout, transport)
 	} else if query.POSTFallback || query.Method == HTTP_POST {
 		// let's try POST instead
-		fullPostURI := fmt.Sprintf("%s%s", endpoint, path)
+		fullPostURI := joinDoHURI(endpoint, path)
 		body := bytes.NewReader(buf)
 		httpReq, err := http.NewRequestWithContext(context.Background(), HTTP_POST, fullPostURI, body)
 		if err != nil {
@@ -286,17 +374,37 @@ func (qh *DoHQueryHandler) Query(query *DoHQuery) (*DoHResponse, custom_errors.D
 		// content-type is required on POST requests, see RFC8484
 		httpReq.Header.Add("content-type", DOH_MEDIA_TYPE)
 
-		res.ResponseMsg, res.RTT, tlsConnState, queryErr = qh.QueryHandler.Query(httpReq, query.HTTPVersion, query.Timeout, transport)
+		setURITemplateToResponse(query.URI, path, templateErr, res)
+		res.ResponseMsg, responseSize, res.HTTP, res.RTT, tlsConnState, queryErr = qh.QueryHandler.Query(httpReq, query.HTTPVersion, query.Timeout, transport)
 	} else {
 		return res, custom_errors.NewQueryConfigError(custom_errors.ErrURITooLong, true).AddInfo(fmt.Errorf("URI length is %d characters", len(fullGetURI)))
 	}
 
-	// let's retrieve ciphersuite and TLS version from the connection state
-	if tlsConnState != nil && tlsConnState.HandshakeComplete {
-		res.TLSVersion = tls.VersionName(tlsConnState.Version)
-		res.TLSCipherSuite = tls.CipherSuiteName(tlsConnState.CipherSuite)
+	// let's retrieve the handshake details from the connection state
+	setTLSDetailsToResponse(tlsConnState, &res.DoEResponse)
+	setPaddingToResponse(&res.DoEResponse, responseSize)
+	setEDNSInfoToResponse(&res.DNSResponse)
+	res.WireFormatSupported = res.ResponseMsg != nil
+
+	if query.Format == DOH_FORMAT_BOTH && getECHRejection(queryErr) == nil {
+		// the outcome of the JSON API request is recorded only
+		res.JSON, _, _ = qh.queryJSON(query, path, transport)
+		res.JSONFormatSupported = res.JSON.Answer != nil
 	}
 
+	// the server rejected ECH, let's retry without ECH to measure the resolver anyway
+	if getECHRejection(queryErr) != nil {
+		retryQuery := *query
+		retryQuery.ECHConfigList = nil
+		retryQuery.QueryMsg = retryMsg
+
+		retryRes, retryErr := qh.Query(&retryQuery)
+		setECHStatusToResponse(query.ECHConfigList, nil, queryErr, &retryRes.DoEResponse)
+
+		return retryRes, retryErr
+	}
+	setECHStatusToResponse(query.ECHConfigList, tlsConnState, queryErr, &res.DoEResponse)
+
 	return res, validateCertificateError(
 		queryErr,
 		custom_errors.NewQueryError(custom_errors.ErrUnknownQuery, true),
@@ -305,19 +413,41 @@ func (qh *DoHQueryHandler) Query(query *DoHQuery) (*DoHResponse, custom_errors.D
 	)
 }
 
+// joinDoHURI appends the expanded URI template to the endpoint
+func joinDoHURI(endpoint string, expansion string) string {
+	if !strings.HasPrefix(expansion, "/") {
+		expansion = "/" + expansion
+	}
+
+	return endpoint + expansion
+}
+
+func setURITemplateToResponse(template string, expansion string, templateErr error, res *DoHResponse) {
+	res.URITemplate = template
+	res.URIExpansion = expansion
+	if templateErr != nil {
+		res.URITemplateError = templateErr.Error()
+	}
+}
+
 func NewDoHQuery() (q *DoHQuery) {
 	q = &DoHQuery{
 		Method:       HTTP_GET,
 		POSTFallback: true,
 		HTTPVersion:  HTTP_VERSION_2,
 		URI:          DEFAULT_DOH_PATH,
+		Format:       DOH_FORMAT_WIRE,
 	}
 
 	q.Timeout = DEFAULT_DOH_TIMEOUT
 	q.Port = DEFAULT_DOH_PORT
+	q.PaddingBlockLength = DEFAULT_PADDING_BLOCK_LENGTH
 
 	q.QueryMsg = GetDefaultQueryMsg()
 
+	// request the name server identifier by default
+	q.NSID = true
+
 	return
 }
 
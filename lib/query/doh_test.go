@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
 	"github.com/steffsas/doe-hunter/lib/query"
 
 	"github.com/miekg/dns"
@@ -23,10 +26,11 @@ type mockedHttpQueryHandler struct {
 	mock.Mock
 }
 
-func (m *mockedHttpQueryHandler) Query(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*dns.Msg, time.Duration, *tls.ConnectionState, error) {
+func (m *mockedHttpQueryHandler) Query(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*dns.Msg, int, *query.DoHHTTPResponse, time.Duration, *tls.ConnectionState, error) {
 	args := m.Called(httpReq, httpVersion, timeout, transport)
 
 	var res *dns.Msg
+	var httpRes *query.DoHHTTPResponse
 	var tlsConnState *tls.ConnectionState
 	var err error
 
@@ -35,14 +39,35 @@ func (m *mockedHttpQueryHandler) Query(httpReq *http.Request, httpVersion string
 	}
 
 	if args.Get(2) != nil {
-		tlsConnState = args.Get(2).(*tls.ConnectionState)
+		httpRes = args.Get(2).(*query.DoHHTTPResponse)
 	}
 
-	if args.Get(3) != nil {
-		err = args.Get(3).(error)
+	if args.Get(4) != nil {
+		tlsConnState = args.Get(4).(*tls.ConnectionState)
 	}
 
-	return res, args.Get(1).(time.Duration), tlsConnState, err
+	if args.Get(5) != nil {
+		err = args.Get(5).(error)
+	}
+
+	return res, args.Int(1), httpRes, args.Get(3).(time.Duration), tlsConnState, err
+}
+
+func (m *mockedHttpQueryHandler) QueryJSON(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*query.DoHJSONResponse, *query.DoHHTTPResponse, time.Duration, *tls.ConnectionState, error) {
+	args := m.Called(httpReq, httpVersion, timeout, transport)
+
+	var res *query.DoHJSONResponse
+	var err error
+
+	if args.Get(0) != nil {
+		res = args.Get(0).(*query.DoHJSONResponse)
+	}
+
+	if args.Get(4) != nil {
+		err = args.Get(4).(error)
+	}
+
+	return res, nil, args.Get(2).(time.Duration), nil, err
 }
 
 func getMockedHttpHandler() *mockedHttpQueryHandler {
@@ -50,37 +75,60 @@ func getMockedHttpHandler() *mockedHttpQueryHandler {
 	return handler
 }
 
-func TestGetPathParamFromDoHPath_EmptyPath(t *testing.T) {
+func TestDoHQuery_URITemplate(t *testing.T) {
 	t.Parallel()
 
-	t.Run("single param", func(t *testing.T) {
+	t.Run("extra query parameters", func(t *testing.T) {
 		t.Parallel()
 
-		path, param, err := query.GetPathParamFromDoHPath(exampleUri)
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
 
-		assert.Nil(t, err, "error should be nil")
-		assert.Equal(t, "/dns-query", path)
-		assert.Equal(t, "dns", param)
+		q := newLocalDoHQuery(t, startTestDoHServer(t))
+		q.URI = "/dns-query{?dns}&foo=bar"
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		assert.NotNil(t, res.ResponseMsg)
+		assert.Equal(t, q.URI, res.URITemplate)
+		assert.True(t, strings.HasPrefix(res.URIExpansion, "/dns-query?dns="))
+		assert.True(t, strings.HasSuffix(res.URIExpansion, "&foo=bar"))
+		assert.Empty(t, res.URITemplateError)
 	})
 
-	t.Run("malformed param", func(t *testing.T) {
+	t.Run("POST without dns variable", func(t *testing.T) {
 		t.Parallel()
 
-		path, param, err := query.GetPathParamFromDoHPath("/dns-query?dns")
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
 
-		assert.NotNil(t, err, "error should not be nil")
-		assert.Empty(t, path, "path should be empty")
-		assert.Empty(t, param, "param should be empty")
+		q := newLocalDoHQuery(t, startTestDoHServer(t))
+		q.URI = "/resolver{/version}{?dns}"
+		q.Method = query.HTTP_POST
+
+		res, _ := qh.Query(q)
+
+		assert.Equal(t, "/resolver", res.URIExpansion)
 	})
 
-	t.Run("non standard param", func(t *testing.T) {
+	t.Run("malformed template", func(t *testing.T) {
 		t.Parallel()
 
-		path, param, err := query.GetPathParamFromDoHPath("/dns-query{?dns,other}")
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
 
-		assert.Nil(t, err, "error should be nil")
-		assert.Equal(t, "/dns-query", path)
-		assert.Equal(t, "dns,other", param)
+		addr, requestURIs := startRecordingTestDoHServer(t)
+		q := newLocalDoHQuery(t, addr)
+		q.URI = "/dns-query{?dns"
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr, "malformed template should still be scanned")
+		assert.NotNil(t, res.ResponseMsg)
+		assert.Contains(t, res.URITemplateError, custom_errors.ErrMalformedURITemplate.Error())
+		assert.True(t, strings.HasPrefix(res.URIExpansion, "/dns-query?dns="), "should drop the unclosed expression")
+		assert.Equal(t, res.URIExpansion, <-requestURIs, "should request the recorded expansion")
 	})
 }
 
@@ -559,7 +607,7 @@ func TestDoHQuery_HTTPMethod(t *testing.T) {
 			mock.Anything,
 			mock.Anything,
 			mock.Anything,
-			mock.Anything).Return(&dns.Msg{}, 1*time.Millisecond, nil, nil)
+			mock.Anything).Return(&dns.Msg{}, 0, nil, 1*time.Millisecond, nil, nil)
 
 		qh, err := query.NewDoHQueryHandler(nil)
 		require.Nil(t, err, "error should be nil")
@@ -634,7 +682,7 @@ func TestDoHQuery_Port(t *testing.T) {
 			mock.Anything,
 			mock.Anything,
 			mock.Anything,
-			mock.Anything).Return(&dns.Msg{}, 1*time.Millisecond, nil, nil)
+			mock.Anything).Return(&dns.Msg{}, 0, nil, 1*time.Millisecond, nil, nil)
 
 		qh, err := query.NewDoHQueryHandler(nil)
 		require.Nil(t, err, "error should be nil")
@@ -707,7 +755,7 @@ func TestDoHQuery_DefaultTimeoutFallback(t *testing.T) {
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
-		mock.Anything).Return(&dns.Msg{}, 1*time.Millisecond, nil, nil)
+		mock.Anything).Return(&dns.Msg{}, 0, nil, 1*time.Millisecond, nil, nil)
 
 	qh, err := query.NewDoHQueryHandler(nil)
 	require.Nil(t, err, "error should be nil")
@@ -811,6 +859,8 @@ func TestDoHQuery_WronglyFormattedURI(t *testing.T) {
 	queryMsg := new(dns.Msg)
 	queryMsg.SetQuestion(dohNameQuery, dns.TypeA)
 
+	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(new(dns.Msg), 0, nil, time.Duration(0), nil, nil)
+
 	q := query.NewDoHQuery()
 	q.Host = dohNameQuery
 	// should be /dns-query{?dns}
@@ -819,9 +869,13 @@ func TestDoHQuery_WronglyFormattedURI(t *testing.T) {
 
 	res, err := qh.Query(q)
 
-	assert.NotNil(t, err, "error should not be nil")
+	assert.Nil(t, err, "error should be nil")
 	require.NotNil(t, res, "result should not be nil")
-	assert.Nil(t, res.ResponseMsg, "response should be nil")
+	assert.NotNil(t, res.ResponseMsg, "should still query the resolver")
+
+	httpReq := handler.Calls[0].Arguments.Get(0).(*http.Request)
+	assert.Equal(t, "/dns-query", httpReq.URL.Path)
+	assert.NotEmpty(t, httpReq.URL.Query().Get("dns"), "should set the dns parameter")
 }
 
 func TestDoHQuery_NilHttpHandler(t *testing.T) {
@@ -867,7 +921,7 @@ func TestDoHQuery_SNI(t *testing.T) {
 		mock.Anything,
 		mock.Anything,
 		mock.Anything,
-		mock.Anything).Return(&dns.Msg{}, 1*time.Millisecond, nil, nil)
+		mock.Anything).Return(&dns.Msg{}, 0, nil, 1*time.Millisecond, nil, nil)
 
 	qh, err := query.NewDoHQueryHandler(nil)
 	require.Nil(t, err, "error should be nil")
@@ -901,7 +955,7 @@ func TestDoHQueryHandler_HttpRequest(t *testing.T) {
 			mock.Anything,
 			mock.Anything,
 			mock.Anything,
-			mock.Anything).Return(&dns.Msg{}, 1*time.Millisecond, nil, nil)
+			mock.Anything).Return(&dns.Msg{}, 0, nil, 1*time.Millisecond, nil, nil)
 
 		qh, err := query.NewDoHQueryHandler(nil)
 		require.Nil(t, err, "error should be nil")
@@ -931,7 +985,7 @@ func TestDoHQueryHandler_HttpRequest(t *testing.T) {
 			mock.Anything,
 			mock.Anything,
 			mock.Anything,
-			mock.Anything).Return(nil, 1*time.Millisecond, nil, fmt.Errorf("error"))
+			mock.Anything).Return(nil, 0, nil, 1*time.Millisecond, nil, fmt.Errorf("error"))
 
 		qh, err := query.NewDoHQueryHandler(nil)
 		require.Nil(t, err, "error should be nil")
@@ -977,3 +1031,86 @@ func TestDohQueryHandler_Config(t *testing.T) {
 		require.NotNil(t, qh, "query handler should not be nil")
 	})
 }
+
+func newLocalDoHQuery(t *testing.T, addr string) *query.DoHQuery {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	q := query.NewDoHQuery()
+	q.Host = host
+	q.Port, err = net.LookupPort("tcp", port)
+	require.NoError(t, err)
+	q.SkipCertificateVerify = true
+	q.Timeout = 2 * time.Second
+
+	return q
+}
+
+func TestDoHQuery_HTTPResponse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("DNS message", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalDoHQuery(t, startTestDoHServer(t)))
+
+		require.Nil(t, qErr)
+		require.NotNil(t, res.HTTP)
+		assert.Equal(t, "HTTP/2.0", res.HTTP.Proto)
+		assert.Equal(t, http.StatusOK, res.HTTP.StatusCode)
+		assert.Equal(t, query.DOH_MEDIA_TYPE, res.HTTP.ContentType)
+		assert.Equal(t, -1, res.HTTP.Age)
+		assert.Empty(t, res.HTTP.Body, "should not keep DNS messages")
+	})
+
+	t.Run("error page", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "text/html; charset=utf-8")
+			w.Header().Set("cache-control", "max-age=60")
+			w.Header().Set("age", "42")
+			w.Header().Set("server", "nginx")
+			w.Header().Set("alt-svc", `h3=":443"; ma=86400`)
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(strings.Repeat("a", 2*query.MAX_DOH_HTTP_BODY_SIZE)))
+		}))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalDoHQuery(t, server.Listener.Addr().String()))
+
+		require.NotNil(t, qErr)
+		assert.Nil(t, res.ResponseMsg)
+		require.NotNil(t, res.HTTP)
+		assert.Equal(t, http.StatusNotFound, res.HTTP.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", res.HTTP.ContentType)
+		assert.Equal(t, "max-age=60", res.HTTP.CacheControl)
+		assert.Equal(t, 42, res.HTTP.Age)
+		assert.Equal(t, "nginx", res.HTTP.Server)
+		assert.Equal(t, `h3=":443"; ma=86400`, res.HTTP.AltSvc)
+		assert.Len(t, res.HTTP.Body, query.MAX_DOH_HTTP_BODY_SIZE)
+		assert.True(t, res.HTTP.BodyTruncated)
+	})
+
+	t.Run("connection refused", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalDoHQuery(t, "127.0.0.1:1"))
+
+		require.NotNil(t, qErr)
+		assert.Nil(t, res.HTTP)
+	})
+}
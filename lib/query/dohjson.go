@@ -0,0 +1,207 @@
+package query
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/helper"
+)
+
+// the JSON API of Google and Cloudflare, see https://developers.google.com/speed/public-dns/docs/doh/json
+const DOH_JSON_MEDIA_TYPE = "application/dns-json"
+
+// DoH message formats, both sends a JSON API request after the wire format request
+const DOH_FORMAT_WIRE = "wire"
+const DOH_FORMAT_JSON = "json"
+const DOH_FORMAT_BOTH = "both"
+
+type DoHJSONQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+type DoHJSONRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// DoHJSONResponse is the answer of the JSON API, the field names follow the API
+type DoHJSONResponse struct {
+	Status     int               `json:"Status"`
+	TC         bool              `json:"TC"`
+	RD         bool              `json:"RD"`
+	RA         bool              `json:"RA"`
+	AD         bool              `json:"AD"`
+	CD         bool              `json:"CD"`
+	Question   []DoHJSONQuestion `json:"Question"`
+	Answer     []DoHJSONRecord   `json:"Answer"`
+	Authority  []DoHJSONRecord   `json:"Authority"`
+	Additional []DoHJSONRecord   `json:"Additional"`
+}
+
+// ToMsg converts the JSON answer into a DNS message
+func (r *DoHJSONResponse) ToMsg() (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.Response = true
+	msg.Rcode = r.Status
+	msg.Truncated = r.TC
+	msg.RecursionDesired = r.RD
+	msg.RecursionAvailable = r.RA
+	msg.AuthenticatedData = r.AD
+	msg.CheckingDisabled = r.CD
+
+	for _, q := range r.Question {
+		msg.Question = append(msg.Question, dns.Question{Name: dns.Fqdn(q.Name), Qtype: q.Type, Qclass: dns.ClassINET})
+	}
+
+	var err error
+	if msg.Answer, err = newRRsFromDoHJSONRecords(r.Answer); err != nil {
+		return nil, err
+	}
+	if msg.Ns, err = newRRsFromDoHJSONRecords(r.Authority); err != nil {
+		return nil, err
+	}
+	if msg.Extra, err = newRRsFromDoHJSONRecords(r.Additional); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+func newRRsFromDoHJSONRecords(records []DoHJSONRecord) ([]dns.RR, error) {
+	rrs := []dns.RR{}
+
+	for _, record := range records {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(record.Name), record.TTL, dns.Type(record.Type).String(), record.Data))
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("empty record %s", record.Name)
+		}
+
+		rrs = append(rrs, rr)
+	}
+
+	return rrs, nil
+}
+
+// DoHJSONResult holds the JSON API request of a DoH query
+type DoHJSONResult struct {
+	HTTP   *DoHHTTPResponse `json:"http"`
+	Answer *DoHJSONResponse `json:"answer"`
+	RTT    time.Duration    `json:"rtt"`
+	Error  string           `json:"error"`
+}
+
+func (h *defaultHttpQueryHandler) QueryJSON(httpReq *http.Request, httpVersion string, timeout time.Duration, transport http.RoundTripper) (*DoHJSONResponse, *DoHHTTPResponse, time.Duration, *tls.ConnectionState, error) {
+	content, httpInfo, rtt, connState, err := h.do(httpReq, httpVersion, timeout, transport)
+	if err != nil {
+		return nil, httpInfo, 0, connState, err
+	}
+
+	r := &DoHJSONResponse{}
+	err = json.Unmarshal(content, r)
+	if err != nil {
+		return nil, httpInfo, 0, connState, err
+	}
+
+	return r, httpInfo, rtt, connState, nil
+}
+
+// queryJSON sends the question of the query to the JSON API at the expanded URI template without the dns variable
+func (qh *DoHQueryHandler) queryJSON(query *DoHQuery, path string, transport http.RoundTripper) (*DoHJSONResult, *tls.ConnectionState, error) {
+	result := &DoHJSONResult{}
+
+	if len(query.QueryMsg.Question) == 0 {
+		result.Error = custom_errors.ErrDoHJSONNoQuestion.Error()
+		return result, nil, custom_errors.ErrDoHJSONNoQuestion
+	}
+
+	endpoint := fmt.Sprintf("https://%s", helper.GetFullHostFromHostPort(query.Host, query.Port))
+
+	uri, err := url.Parse(joinDoHURI(endpoint, path))
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil, err
+	}
+
+	// keep the query parameters of the template
+	params := uri.Query()
+	params.Set("name", query.QueryMsg.Question[0].Name)
+	params.Set("type", dns.Type(query.QueryMsg.Question[0].Qtype).String())
+	if query.DNSSEC {
+		params.Set("do", "1")
+	}
+	uri.RawQuery = params.Encode()
+
+	httpReq, err := http.NewRequestWithContext(context.Background(), HTTP_GET, uri.String(), nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil, err
+	}
+	httpReq.Header.Add("accept", DOH_JSON_MEDIA_TYPE)
+
+	var connState *tls.ConnectionState
+	result.Answer, result.HTTP, result.RTT, connState, err = qh.QueryHandler.QueryJSON(httpReq, query.HTTPVersion, query.Timeout, transport)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result, connState, err
+}
+
+// queryJSONFormat exchanges the query with the JSON API only
+func (qh *DoHQueryHandler) queryJSONFormat(query *DoHQuery, path string, transport http.RoundTripper, retryMsg *dns.Msg) (*DoHResponse, custom_errors.DoEErrors) {
+	res := &DoHResponse{}
+
+	var tlsConnState *tls.ConnectionState
+	var queryErr error
+	res.JSON, tlsConnState, queryErr = qh.queryJSON(query, path, transport)
+	res.HTTP = res.JSON.HTTP
+	res.RTT = res.JSON.RTT
+	res.JSONFormatSupported = res.JSON.Answer != nil
+
+	setTLSDetailsToResponse(tlsConnState, &res.DoEResponse)
+
+	// the server rejected ECH, let's retry without ECH to measure the resolver anyway
+	if getECHRejection(queryErr) != nil {
+		retryQuery := *query
+		retryQuery.ECHConfigList = nil
+		retryQuery.QueryMsg = retryMsg
+
+		retryRes, retryErr := qh.Query(&retryQuery)
+		setECHStatusToResponse(query.ECHConfigList, nil, queryErr, &retryRes.DoEResponse)
+
+		return retryRes, retryErr
+	}
+	setECHStatusToResponse(query.ECHConfigList, tlsConnState, queryErr, &res.DoEResponse)
+
+	cErr := validateCertificateError(
+		queryErr,
+		custom_errors.NewQueryError(custom_errors.ErrUnknownQuery, true),
+		&res.DoEResponse,
+		query.SkipCertificateVerify,
+	)
+	if cErr != nil {
+		return res, cErr
+	}
+
+	msg, err := res.JSON.Answer.ToMsg()
+	if err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrDoHJSONConversionFailed, false).AddInfo(err)
+	}
+	res.ResponseMsg = msg
+	setEDNSInfoToResponse(&res.DNSResponse)
+
+	return res, nil
+}
@@ -0,0 +1,242 @@
+package query_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestDoHJSONServer starts a local DoH server answering JSON API requests at /resolve only
+func startTestDoHJSONServer(t *testing.T) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") != "A" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("content-type", query.DOH_JSON_MEDIA_TYPE)
+		_ = json.NewEncoder(w).Encode(&query.DoHJSONResponse{
+			RD:       true,
+			RA:       true,
+			AD:       r.URL.Query().Get("do") == "1",
+			Question: []query.DoHJSONQuestion{{Name: r.URL.Query().Get("name"), Type: dns.TypeA}},
+			Answer:   []query.DoHJSONRecord{{Name: r.URL.Query().Get("name"), Type: dns.TypeA, TTL: 300, Data: "192.0.2.1"}},
+		})
+	})
+
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server.Listener.Addr().String()
+}
+
+func TestDoHJSONResponse_ToMsg(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid answer", func(t *testing.T) {
+		t.Parallel()
+
+		r := &query.DoHJSONResponse{
+			Status:   dns.RcodeSuccess,
+			RD:       true,
+			RA:       true,
+			AD:       true,
+			Question: []query.DoHJSONQuestion{{Name: "example.com", Type: dns.TypeTXT}},
+			Answer: []query.DoHJSONRecord{
+				{Name: "example.com.", Type: dns.TypeTXT, TTL: 60, Data: `"v=spf1 -all"`},
+				{Name: "example.com.", Type: dns.TypeRRSIG, TTL: 60, Data: "TXT 13 2 60 20260101000000 20250101000000 12345 example.com. dGVzdA=="},
+			},
+			Authority: []query.DoHJSONRecord{{Name: "example.com.", Type: dns.TypeNS, TTL: 60, Data: "a.iana-servers.net."}},
+		}
+
+		msg, err := r.ToMsg()
+
+		require.NoError(t, err)
+		assert.True(t, msg.Response)
+		assert.True(t, msg.AuthenticatedData)
+		assert.Equal(t, "example.com.", msg.Question[0].Name)
+		require.Len(t, msg.Answer, 2)
+		assert.Equal(t, []string{"v=spf1 -all"}, msg.Answer[0].(*dns.TXT).Txt)
+		assert.Equal(t, uint32(60), msg.Answer[0].Header().Ttl)
+		require.Len(t, msg.Ns, 1)
+		assert.Equal(t, "a.iana-servers.net.", msg.Ns[0].(*dns.NS).Ns)
+	})
+
+	t.Run("NXDOMAIN", func(t *testing.T) {
+		t.Parallel()
+
+		msg, err := (&query.DoHJSONResponse{Status: dns.RcodeNameError}).ToMsg()
+
+		require.NoError(t, err)
+		assert.Equal(t, dns.RcodeNameError, msg.Rcode)
+		assert.Empty(t, msg.Answer)
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := (&query.DoHJSONResponse{
+			Answer: []query.DoHJSONRecord{{Name: "example.com.", Type: dns.TypeA, Data: "not an address"}},
+		}).ToMsg()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestDoHQuery_Format(t *testing.T) {
+	t.Parallel()
+
+	newJSONQuery := func(t *testing.T, addr string, format string) *query.DoHQuery {
+		t.Helper()
+
+		q := newLocalDoHQuery(t, addr)
+		q.URI = "/resolve{?name,type}"
+		q.Format = format
+		q.QueryMsg = new(dns.Msg)
+		q.QueryMsg.SetQuestion("example.com.", dns.TypeA)
+
+		return q
+	}
+
+	t.Run("JSON API", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := newJSONQuery(t, startTestDoHJSONServer(t), query.DOH_FORMAT_JSON)
+		q.DNSSEC = true
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		require.NotNil(t, res.ResponseMsg)
+		require.Len(t, res.ResponseMsg.Answer, 1)
+		assert.Equal(t, "192.0.2.1", res.ResponseMsg.Answer[0].(*dns.A).A.String())
+		assert.True(t, res.ResponseMsg.AuthenticatedData, "should have requested DNSSEC")
+		assert.True(t, res.JSONFormatSupported)
+		assert.False(t, res.WireFormatSupported)
+		require.NotNil(t, res.HTTP)
+		assert.Equal(t, query.DOH_JSON_MEDIA_TYPE, res.HTTP.ContentType)
+		assert.Empty(t, res.HTTP.Body)
+		assert.Equal(t, "TLS 1.3", res.TLSVersion)
+	})
+
+	t.Run("both formats on wire format endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := newLocalDoHQuery(t, startTestDoHServer(t))
+		q.Format = query.DOH_FORMAT_BOTH
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		assert.NotNil(t, res.ResponseMsg)
+		assert.True(t, res.WireFormatSupported)
+		assert.False(t, res.JSONFormatSupported)
+		require.NotNil(t, res.JSON)
+		assert.NotEmpty(t, res.JSON.Error)
+		assert.Equal(t, http.StatusBadRequest, res.JSON.HTTP.StatusCode)
+	})
+
+	t.Run("both formats on JSON endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newJSONQuery(t, startTestDoHJSONServer(t), query.DOH_FORMAT_BOTH))
+
+		require.NotNil(t, qErr, "wire format is not supported")
+		assert.False(t, res.WireFormatSupported)
+		assert.True(t, res.JSONFormatSupported)
+		assert.NotNil(t, res.JSON.Answer)
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := query.NewDoHQuery()
+		q.Host = "localhost"
+		q.Format = "xml"
+
+		_, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.Contains(t, qErr.Error(), custom_errors.ErrInvalidDoHFormat.Error())
+	})
+
+	t.Run("no question", func(t *testing.T) {
+		t.Parallel()
+
+		qh := &query.DoHQueryHandler{QueryHandler: getMockedHttpHandler()}
+
+		q := query.NewDoHQuery()
+		q.Host = "localhost"
+		q.Format = query.DOH_FORMAT_JSON
+		q.QueryMsg = new(dns.Msg)
+
+		res, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.Equal(t, custom_errors.ErrDoHJSONNoQuestion.Error(), res.JSON.Error)
+	})
+
+	t.Run("conversion error", func(t *testing.T) {
+		t.Parallel()
+
+		handler := getMockedHttpHandler()
+		handler.On("QueryJSON", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&query.DoHJSONResponse{
+			Answer: []query.DoHJSONRecord{{Name: "example.com.", Type: dns.TypeA, Data: "invalid"}},
+		}, nil, time.Millisecond, nil, nil)
+
+		qh := &query.DoHQueryHandler{QueryHandler: handler}
+
+		q := newJSONQuery(t, "127.0.0.1:443", query.DOH_FORMAT_JSON)
+
+		res, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.False(t, qErr.IsCritical())
+		assert.Contains(t, qErr.Error(), custom_errors.ErrDoHJSONConversionFailed.Error())
+		assert.True(t, res.JSONFormatSupported)
+		assert.Nil(t, res.ResponseMsg)
+	})
+
+	t.Run("JSON API error", func(t *testing.T) {
+		t.Parallel()
+
+		handler := getMockedHttpHandler()
+		handler.On("QueryJSON", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, nil, time.Duration(0), nil, errors.New("connection refused"))
+
+		qh := &query.DoHQueryHandler{QueryHandler: handler}
+
+		res, qErr := qh.Query(newJSONQuery(t, "127.0.0.1:443", query.DOH_FORMAT_JSON))
+
+		require.NotNil(t, qErr)
+		assert.True(t, qErr.IsCritical())
+		assert.False(t, res.JSONFormatSupported)
+		assert.Equal(t, "connection refused", res.JSON.Error)
+	})
+}
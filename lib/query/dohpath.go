@@ -0,0 +1,163 @@
+package query
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+)
+
+// the path DDR falls back to if the SVCB record lacks the dohpath key
+const DEFAULT_DOH_DISCOVERY_PATH = "/dns-query"
+
+// common paths of DoH resolvers
+// nolint: gochecknoglobals
+var DEFAULT_DOH_DISCOVERY_PATHS = []string{DEFAULT_DOH_DISCOVERY_PATH, "/resolve", "/query", "/"}
+
+type DoHPathQuery struct {
+	DoEQuery
+
+	// HTTPVersion for the probes (default: HTTP2)
+	HTTPVersion string `json:"http_version"`
+	// Paths are probed with GET and POST, the dns variable is added to each path (default: /dns-query, /resolve, /query and /)
+	Paths []string `json:"paths"`
+}
+
+type DoHPathProbe struct {
+	Path     string       `json:"path"`
+	Method   string       `json:"method"`
+	Response *DoHResponse `json:"response"`
+	// ValidDNSMessage is set if the path answered with a DNS response to the question of the query
+	ValidDNSMessage bool   `json:"valid_dns_message"`
+	Error           string `json:"error"`
+}
+
+type DoHPathResponse struct {
+	Probes []*DoHPathProbe `json:"probes"`
+
+	// ValidPaths are the paths answering GET or POST with a valid DNS message
+	ValidPaths []string `json:"valid_paths"`
+	// DefaultPathValid is set if the fallback path of DDR is among the valid paths
+	DefaultPathValid bool `json:"default_path_valid"`
+}
+
+type DoHPathQueryHandler struct {
+	QueryHandler DoHQueryHandlerI
+}
+
+func (qh *DoHPathQueryHandler) Query(q *DoHPathQuery) (*DoHPathResponse, custom_errors.DoEErrors) {
+	res := &DoHPathResponse{
+		Probes:     []*DoHPathProbe{},
+		ValidPaths: []string{},
+	}
+
+	if q == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if err := q.Check(true); err != nil {
+		return res, err
+	}
+
+	if qh.QueryHandler == nil {
+		return res, custom_errors.NewGenericError(custom_errors.ErrQueryHandlerNil, true)
+	}
+
+	if len(q.Paths) == 0 {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrNoDoHPaths, true)
+	}
+
+	for _, path := range q.Paths {
+		for _, method := range []string{HTTP_GET, HTTP_POST} {
+			probe := &DoHPathProbe{
+				Path:   path,
+				Method: method,
+			}
+
+			var err custom_errors.DoEErrors
+			probe.Response, err = qh.QueryHandler.Query(newDoHQueryFromDoHPathQuery(q, path, method))
+			if err != nil {
+				probe.Error = err.Error()
+			}
+			probe.ValidDNSMessage = probe.Response != nil && isValidDoHPathAnswer(q.QueryMsg, probe.Response.ResponseMsg)
+
+			if probe.ValidDNSMessage && !slices.Contains(res.ValidPaths, path) {
+				res.ValidPaths = append(res.ValidPaths, path)
+			}
+
+			res.Probes = append(res.Probes, probe)
+		}
+	}
+
+	res.DefaultPathValid = slices.Contains(res.ValidPaths, DEFAULT_DOH_DISCOVERY_PATH)
+
+	if len(res.ValidPaths) == 0 {
+		return res, custom_errors.NewQueryError(custom_errors.ErrNoValidDoHPath, false)
+	}
+
+	return res, nil
+}
+
+// newDoHQueryFromDoHPathQuery creates the DoH query of a single probe, the DoH query handler modifies the query message
+func newDoHQueryFromDoHPathQuery(q *DoHPathQuery, path string, method string) *DoHQuery {
+	dq := &DoHQuery{
+		DoEQuery:    q.DoEQuery,
+		URI:         path + "{?dns}",
+		Method:      method,
+		HTTPVersion: q.HTTPVersion,
+		Format:      DOH_FORMAT_WIRE,
+	}
+
+	if q.QueryMsg != nil {
+		dq.QueryMsg = q.QueryMsg.Copy()
+	}
+
+	return dq
+}
+
+// isValidDoHPathAnswer checks that the answer is a DNS response to the question of the query
+func isValidDoHPathAnswer(queryMsg *dns.Msg, answer *dns.Msg) bool {
+	if answer == nil || !answer.Response {
+		return false
+	}
+
+	if queryMsg == nil || len(queryMsg.Question) == 0 {
+		return true
+	}
+
+	if len(answer.Question) != 1 {
+		return false
+	}
+
+	return strings.EqualFold(answer.Question[0].Name, queryMsg.Question[0].Name) && answer.Question[0].Qtype == queryMsg.Question[0].Qtype
+}
+
+func NewDoHPathQuery() (q *DoHPathQuery) {
+	q = &DoHPathQuery{
+		HTTPVersion: HTTP_VERSION_2,
+		Paths:       slices.Clone(DEFAULT_DOH_DISCOVERY_PATHS),
+	}
+
+	q.Port = DEFAULT_DOH_PORT
+	q.Timeout = DEFAULT_DOH_TIMEOUT
+	q.PaddingBlockLength = DEFAULT_PADDING_BLOCK_LENGTH
+
+	q.QueryMsg = GetDefaultQueryMsg()
+
+	// request the name server identifier by default
+	q.NSID = true
+
+	return
+}
+
+func NewDoHPathQueryHandler(config *QueryConfig) (*DoHPathQueryHandler, error) {
+	qh, err := NewDoHQueryHandler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DoHPathQueryHandler{
+		QueryHandler: qh,
+	}, nil
+}
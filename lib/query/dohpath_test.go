@@ -0,0 +1,184 @@
+package query_test
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestDoHPathServer starts a local DoH server answering GET and POST requests at /resolve only,
+// / serves an HTML page
+func startTestDoHPathServer(t *testing.T) string {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		var buf []byte
+		var err error
+		if r.Method == http.MethodPost {
+			buf, err = io.ReadAll(r.Body)
+		} else {
+			buf, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(buf); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		answer := new(dns.Msg)
+		answer.SetReply(msg)
+		packed, _ := answer.Pack()
+
+		w.Header().Set("content-type", query.DOH_MEDIA_TYPE)
+		_, _ = w.Write(packed)
+	})
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/html")
+		_, _ = w.Write([]byte("<html></html>"))
+	})
+
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server.Listener.Addr().String()
+}
+
+func newLocalDoHPathQuery(t *testing.T, addr string) *query.DoHPathQuery {
+	t.Helper()
+
+	dohQuery := newLocalDoHQuery(t, addr)
+
+	q := query.NewDoHPathQuery()
+	q.Host = dohQuery.Host
+	q.Port = dohQuery.Port
+	q.SkipCertificateVerify = true
+	q.Timeout = dohQuery.Timeout
+
+	return q
+}
+
+func TestDoHPathQuery(t *testing.T) {
+	t.Parallel()
+
+	t.Run("discover paths", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHPathQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalDoHPathQuery(t, startTestDoHPathServer(t)))
+
+		require.Nil(t, qErr)
+		assert.Equal(t, []string{"/resolve"}, res.ValidPaths)
+		assert.False(t, res.DefaultPathValid, "the default path is not served")
+		require.Len(t, res.Probes, 8, "should probe each path with GET and POST")
+
+		for _, probe := range res.Probes {
+			if probe.Path == "/resolve" {
+				assert.True(t, probe.ValidDNSMessage, "%s %s should be valid", probe.Method, probe.Path)
+				assert.Empty(t, probe.Error)
+				continue
+			}
+
+			assert.False(t, probe.ValidDNSMessage, "%s %s should not be valid", probe.Method, probe.Path)
+			assert.NotEmpty(t, probe.Error)
+			require.NotNil(t, probe.Response.HTTP)
+		}
+
+		assert.Equal(t, query.HTTP_GET, res.Probes[0].Method)
+		assert.Equal(t, query.HTTP_POST, res.Probes[1].Method)
+		assert.Equal(t, http.StatusNotFound, res.Probes[0].Response.HTTP.StatusCode)
+		assert.Equal(t, "<html></html>", res.Probes[7].Response.HTTP.Body, "should keep the body of /")
+	})
+
+	t.Run("default path", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHPathQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := newLocalDoHPathQuery(t, startTestDoHServer(t))
+		q.Paths = []string{"/dns-query"}
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		assert.True(t, res.DefaultPathValid)
+		assert.Equal(t, []string{"/dns-query"}, res.ValidPaths)
+	})
+
+	t.Run("no valid path", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHPathQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := newLocalDoHPathQuery(t, startTestDoHPathServer(t))
+		q.Paths = []string{"/dns-query", "/query"}
+
+		res, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.False(t, qErr.IsCritical())
+		assert.Contains(t, qErr.Error(), custom_errors.ErrNoValidDoHPath.Error())
+		assert.Empty(t, res.ValidPaths)
+		assert.Len(t, res.Probes, 4)
+	})
+
+	t.Run("no paths", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHPathQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := query.NewDoHPathQuery()
+		q.Host = "localhost"
+		q.Paths = []string{}
+
+		_, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.True(t, qErr.IsCritical())
+		assert.Contains(t, qErr.Error(), custom_errors.ErrNoDoHPaths.Error())
+	})
+
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewDoHPathQueryHandler(nil)
+		require.NoError(t, err)
+
+		_, qErr := qh.Query(nil)
+
+		require.NotNil(t, qErr)
+		assert.True(t, qErr.IsCritical())
+	})
+
+	t.Run("nil query handler", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoHPathQuery()
+		q.Host = "localhost"
+
+		_, qErr := (&query.DoHPathQueryHandler{}).Query(q)
+
+		require.NotNil(t, qErr)
+		assert.Contains(t, qErr.Error(), custom_errors.ErrQueryHandlerNil.Error())
+	})
+}
@@ -33,12 +33,23 @@ type QuicQueryHandler interface {
 	Query(ctx context.Context, addr net.Addr, tlsConf *tls.Config, conf *quic.Config) (QuicConn, error)
 }
 
+// EarlyQuicQueryHandler dials connections that can send 0-RTT data before the handshake completes
+type EarlyQuicQueryHandler interface {
+	QueryEarly(ctx context.Context, addr net.Addr, tlsConf *tls.Config, conf *quic.Config) (QuicConn, error)
+}
+
 type DefaultQuicQueryHandler struct {
-	Conn net.PacketConn
+	// Transport demultiplexes the connections of all queries sharing its UDP socket,
+	// dialing single-use transports on a shared socket loses packets of consecutive connections
+	Transport *quic.Transport
 }
 
 func (d *DefaultQuicQueryHandler) Query(ctx context.Context, addr net.Addr, tlsConf *tls.Config, conf *quic.Config) (QuicConn, error) {
-	return quic.Dial(ctx, d.Conn, addr, tlsConf, conf)
+	return d.Transport.Dial(ctx, addr, tlsConf, conf)
+}
+
+func (d *DefaultQuicQueryHandler) QueryEarly(ctx context.Context, addr net.Addr, tlsConf *tls.Config, conf *quic.Config) (QuicConn, error) {
+	return d.Transport.DialEarly(ctx, addr, tlsConf, conf)
 }
 
 type DoQResponse struct {
@@ -90,6 +101,9 @@ func (qh *DoQQueryHandler) Query(query *DoQQuery) (*DoQResponse, custom_errors.D
 	}
 
 	query.SetDNSSEC()
+	query.SetNSID()
+	query.SetCookie()
+	query.SetPadding()
 
 	// measure some RTT
 	start := time.Now()
@@ -146,10 +160,7 @@ func (qh *DoQQueryHandler) Query(query *DoQQuery) (*DoQResponse, custom_errors.D
 	// tls connection state
 	connState := session.ConnectionState()
 
-	if connState.TLS.HandshakeComplete {
-		res.TLSVersion = tls.VersionName(connState.TLS.Version)
-		res.TLSCipherSuite = tls.CipherSuiteName(connState.TLS.CipherSuite)
-	}
+	setTLSDetailsToResponse(&connState.TLS, &res.DoEResponse)
 
 	// prepare message according to RFC9250
 	// https://datatracker.ietf.org/doc/html/rfc9250#section-4.2.1
@@ -201,6 +212,8 @@ func (qh *DoQQueryHandler) Query(query *DoQQuery) (*DoQResponse, custom_errors.D
 	}
 
 	res.ResponseMsg = responseMsg
+	setPaddingToResponse(&res.DoEResponse, len(response)-2)
+	setEDNSInfoToResponse(&res.DNSResponse)
 
 	if query.SkipCertificateVerify {
 		// we cannot say anything about the certificate validity
@@ -230,12 +243,16 @@ func NewDoQQuery() (q *DoQQuery) {
 
 	q.Port = DEFAULT_DOQ_PORT
 	q.Timeout = DEFAULT_DOQ_TIMEOUT
+	q.PaddingBlockLength = DEFAULT_PADDING_BLOCK_LENGTH
 
 	q.QueryMsg = GetDefaultQueryMsg()
 
 	// set DNSSEC flag by default
 	q.DNSSEC = true
 
+	// request the name server identifier by default
+	q.NSID = true
+
 	return
 }
 
@@ -256,7 +273,7 @@ func NewDoQQueryHandler(config *QueryConfig) (*DoQQueryHandler, error) {
 	}
 
 	qh.QueryHandler = &DefaultQuicQueryHandler{
-		Conn: conn,
+		Transport: &quic.Transport{Conn: conn},
 	}
 
 	return qh, nil
@@ -59,27 +59,51 @@ func (qh *DefaultDoTQueryHandler) Query(query *DoTQuery) (*DoTResponse, custom_e
 		tlsConfig.ServerName = query.SNI
 	}
 
+	setECHConfigToTLSConfig(query.ECHConfigList, query.SkipCertificateVerify, tlsConfig)
+
+	// keep the query message as is for a retry without ECH
+	retryMsg := query.QueryMsg.Copy()
+
 	query.SetDNSSEC()
+	query.SetNSID()
+	query.SetCookie()
+	query.SetPadding()
 
 	var queryErr error
 
 	var tlsConnState *tls.ConnectionState
 
-	res.ResponseMsg, res.RTT, tlsConnState, queryErr = qh.QueryHandler.Query(
+	var responseSize int
+	res.ResponseMsg, responseSize, res.RTT, tlsConnState, queryErr = qh.QueryHandler.Query(
 		helper.GetFullHostFromHostPort(query.Host, query.Port),
 		query.QueryMsg,
 		query.Timeout,
 		tlsConfig,
 	)
 
+	setPaddingToResponse(&res.DoEResponse, responseSize)
+	setEDNSInfoToResponse(&res.DNSResponse)
+
 	// check whether connection was ok
 	if tlsConnState != nil {
 		res.CertificateValid = true
 		res.CertificateVerified = tlsConnState.VerifiedChains != nil
-		res.TLSVersion = tls.VersionName(tlsConnState.Version)
-		res.TLSCipherSuite = tls.CipherSuiteName(tlsConnState.CipherSuite)
+		setTLSDetailsToResponse(tlsConnState, &res.DoEResponse)
 	}
 
+	// the server rejected ECH, let's retry without ECH to measure the resolver anyway
+	if getECHRejection(queryErr) != nil {
+		retryQuery := *query
+		retryQuery.ECHConfigList = nil
+		retryQuery.QueryMsg = retryMsg
+
+		retryRes, retryErr := qh.Query(&retryQuery)
+		setECHStatusToResponse(query.ECHConfigList, nil, queryErr, &retryRes.DoEResponse)
+
+		return retryRes, retryErr
+	}
+	setECHStatusToResponse(query.ECHConfigList, tlsConnState, queryErr, &res.DoEResponse)
+
 	return res, validateCertificateError(
 		queryErr,
 		custom_errors.NewQueryError(custom_errors.ErrUnknownQuery, true),
@@ -93,28 +117,29 @@ func NewDoTQuery() (q *DoTQuery) {
 
 	q.Port = DEFAULT_DOT_PORT
 	q.Timeout = DEFAULT_DOT_TIMEOUT
+	q.PaddingBlockLength = DEFAULT_PADDING_BLOCK_LENGTH
 
 	q.QueryMsg = GetDefaultQueryMsg()
 
 	// set DNSSEC flag by default
 	q.DNSSEC = true
 
+	// request the name server identifier by default
+	q.NSID = true
+
 	return
 }
 
 type DoTQueryHandler interface {
-	Query(host string, query *dns.Msg, timeout time.Duration, tlsConfig *tls.Config) (answer *dns.Msg, rtt time.Duration, tlsConnState *tls.ConnectionState, err error)
+	// Query returns the answer and its size on the wire
+	Query(host string, query *dns.Msg, timeout time.Duration, tlsConfig *tls.Config) (answer *dns.Msg, size int, rtt time.Duration, tlsConnState *tls.ConnectionState, err error)
 }
 
 type defaultQueryHandlerDoT struct {
 	DialerTCP *net.Dialer
 }
 
-func (df *defaultQueryHandlerDoT) Query(host string, query *dns.Msg, timeout time.Duration, tlsConfig *tls.Config) (*dns.Msg, time.Duration, *tls.ConnectionState, error) {
-	c := &dns.Client{
-		Timeout: timeout,
-	}
-
+func (df *defaultQueryHandlerDoT) Query(host string, query *dns.Msg, timeout time.Duration, tlsConfig *tls.Config) (*dns.Msg, int, time.Duration, *tls.ConnectionState, error) {
 	tlsDialer := &tls.Dialer{
 		NetDialer: df.DialerTCP,
 		Config:    tlsConfig,
@@ -123,8 +148,9 @@ func (df *defaultQueryHandlerDoT) Query(host string, query *dns.Msg, timeout tim
 	// create connection
 	conn, err := tlsDialer.Dial("tcp", host)
 	if err != nil {
-		return nil, 0, nil, err
+		return nil, 0, 0, nil, err
 	}
+	defer conn.Close()
 
 	// retrieve the tls version and cipher suite
 	// parse connection state to tls connection
@@ -133,15 +159,45 @@ func (df *defaultQueryHandlerDoT) Query(host string, query *dns.Msg, timeout tim
 
 	// handshake
 	if err := tlsConn.HandshakeContext(context.Background()); err != nil {
-		return nil, 0, nil, err
+		return nil, 0, 0, nil, err
 	}
 
 	// get the negotiated tls version and cipher suite
 	tlsConnState := tlsConn.ConnectionState()
 
-	msg, rtt, err := c.ExchangeWithConn(query, &dns.Conn{Conn: conn})
+	msg, size, rtt, err := exchangeWithConn(&dns.Conn{Conn: conn}, query, timeout)
+
+	return msg, size, rtt, &tlsConnState, err
+}
+
+// exchangeWithConn is dns.Client.ExchangeWithConn that also returns the size of the answer on the wire,
+// unpacked messages may be packed differently, e.g., without compression
+func exchangeWithConn(co *dns.Conn, query *dns.Msg, timeout time.Duration) (*dns.Msg, int, time.Duration, error) {
+	begin := time.Now()
+	if timeout > 0 {
+		_ = co.SetDeadline(begin.Add(timeout))
+	}
 
-	return msg, rtt, &tlsConnState, err
+	if err := co.WriteMsg(query); err != nil {
+		return nil, 0, 0, err
+	}
+
+	for {
+		raw, err := co.ReadMsgHeader(nil)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(raw); err != nil {
+			return nil, 0, 0, err
+		}
+
+		// skip answers to other queries like dns.Client does
+		if msg.Id == query.Id {
+			return msg, len(raw), time.Since(begin), nil
+		}
+	}
 }
 
 func NewDefaultDoTHandler(config *QueryConfig) *DefaultDoTQueryHandler {
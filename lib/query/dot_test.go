@@ -151,7 +151,7 @@ func TestDoTQuery_QueryMsg(t *testing.T) {
 	qm.SetQuestion(dotQueryName, dns.TypeA)
 
 	handler := &mockedDoTQueryHandler{}
-	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, time.Duration(0), nil, nil)
+	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, 0, time.Duration(0), nil, nil)
 
 	qh := query.NewDefaultDoTHandler(nil)
 	qh.QueryHandler = handler
@@ -191,7 +191,7 @@ func TestDoTQuery_Response(t *testing.T) {
 	response := new(dns.Msg)
 
 	handler := &mockedDoTQueryHandler{}
-	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, time.Duration(0), nil, nil)
+	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, 0, time.Duration(0), nil, nil)
 
 	qh := query.NewDefaultDoTHandler(nil)
 	qh.QueryHandler = handler
@@ -233,7 +233,7 @@ func TestDoTQuery_Handler(t *testing.T) {
 	response := new(dns.Msg)
 
 	handler := &mockedDoTQueryHandler{}
-	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, time.Duration(0), nil, nil)
+	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, 0, time.Duration(0), nil, nil)
 
 	t.Run("valid query handler", func(t *testing.T) {
 		t.Parallel()
@@ -282,7 +282,7 @@ func TestDoTQuery_Port(t *testing.T) {
 	response := new(dns.Msg)
 
 	handler := &mockedDoTQueryHandler{}
-	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, time.Duration(0), nil, nil)
+	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, 0, time.Duration(0), nil, nil)
 
 	qh := query.NewDefaultDoTHandler(nil)
 	qh.QueryHandler = handler
@@ -346,7 +346,7 @@ func TestDoTQuery_Host(t *testing.T) {
 	response := new(dns.Msg)
 
 	handler := &mockedDoTQueryHandler{}
-	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, time.Duration(0), nil, nil)
+	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, 0, time.Duration(0), nil, nil)
 
 	qh := query.NewDefaultDoTHandler(nil)
 	qh.QueryHandler = handler
@@ -403,7 +403,7 @@ func TestDoTQuery_SNI(t *testing.T) {
 	response := new(dns.Msg)
 
 	handler := &mockedDoTQueryHandler{}
-	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, time.Duration(0), nil, nil)
+	handler.On("Query", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(response, 0, time.Duration(0), nil, nil)
 
 	qh := query.NewDefaultDoTHandler(nil)
 	qh.QueryHandler = handler
@@ -449,16 +449,16 @@ type mockedDoTQueryHandler struct {
 	mock.Mock
 }
 
-func (df *mockedDoTQueryHandler) Query(host string, query *dns.Msg, timeout time.Duration, tlsConfig *tls.Config) (*dns.Msg, time.Duration, *tls.ConnectionState, error) {
+func (df *mockedDoTQueryHandler) Query(host string, query *dns.Msg, timeout time.Duration, tlsConfig *tls.Config) (*dns.Msg, int, time.Duration, *tls.ConnectionState, error) {
 	args := df.Called(host, query, timeout, tlsConfig)
 
 	if args.Get(0) == nil {
-		return nil, args.Get(1).(time.Duration), args.Get(2).(*tls.ConnectionState), args.Error(3)
+		return nil, args.Int(1), args.Get(2).(time.Duration), args.Get(3).(*tls.ConnectionState), args.Error(4)
 	}
 
-	if args.Get(2) == nil {
-		return args.Get(0).(*dns.Msg), args.Get(1).(time.Duration), nil, args.Error(3)
+	if args.Get(3) == nil {
+		return args.Get(0).(*dns.Msg), args.Int(1), args.Get(2).(time.Duration), nil, args.Error(4)
 	}
 
-	return args.Get(0).(*dns.Msg), args.Get(1).(time.Duration), args.Get(2).(*tls.ConnectionState), args.Error(3)
+	return args.Get(0).(*dns.Msg), args.Int(1), args.Get(2).(time.Duration), args.Get(3).(*tls.ConnectionState), args.Error(4)
 }
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// see https://datatracker.ietf.org/doc/draft-ietf-tls-esni/
+const ECH_STATUS_ACCEPTED = "accepted"
+const ECH_STATUS_REJECTED = "rejected"
+const ECH_STATUS_RETRY_CONFIGS = "retry_configs"
+const ECH_STATUS_FAILED = "failed"
+
+// setECHConfigToTLSConfig enables ECH for the handshake, ECH requires TLS 1.3
+func setECHConfigToTLSConfig(echConfigList []byte, skipCertificateVerify bool, tlsConfig *tls.Config) {
+	if len(echConfigList) == 0 {
+		return
+	}
+
+	tlsConfig.EncryptedClientHelloConfigList = echConfigList
+	tlsConfig.MinVersion = tls.VersionTLS13
+
+	if skipCertificateVerify {
+		// on rejection the certificate is verified against the public name of the ECHConfig by default
+		// codeql [go/disabled-certificate-check]: This is intentional
+		tlsConfig.EncryptedClientHelloRejectionVerify = func(tls.ConnectionState) error {
+			return nil
+		}
+	}
+}
+
+// getECHRejection returns the rejection of the server if it did not accept ECH, nil otherwise
+func getECHRejection(err error) *tls.ECHRejectionError {
+	var echErr *tls.ECHRejectionError
+	if errors.As(err, &echErr) {
+		return echErr
+	}
+	return nil
+}
+
+// setECHStatusToResponse sets the outcome of an ECH handshake, it does nothing if ECH was not attempted
+func setECHStatusToResponse(echConfigList []byte, connState *tls.ConnectionState, err error, res *DoEResponse) {
+	if len(echConfigList) == 0 {
+		return
+	}
+
+	if echErr := getECHRejection(err); echErr != nil {
+		// the server may send retry configs if it supports ECH but could not decrypt the inner hello
+		if len(echErr.RetryConfigList) > 0 {
+			res.ECHStatus = ECH_STATUS_RETRY_CONFIGS
+			res.ECHRetryConfigList = echErr.RetryConfigList
+		} else {
+			res.ECHStatus = ECH_STATUS_REJECTED
+		}
+		return
+	}
+
+	if connState != nil && connState.ECHAccepted {
+		res.ECHStatus = ECH_STATUS_ACCEPTED
+		return
+	}
+
+	res.ECHStatus = ECH_STATUS_FAILED
+}
+
+// LookupECHConfigList retrieves the ECHConfigList of the HTTPS RR of the given name, nil if there is none
+// see https://www.rfc-editor.org/rfc/rfc9460.html#section-9
+func LookupECHConfigList(name string, resolver net.IP, qh ConventionalDNSQueryHandlerI) ([]byte, error) {
+	q := NewConventionalQuery()
+	q.DNSSEC = false
+	q.QueryMsg.SetQuestion(dns.Fqdn(name), dns.TypeHTTPS)
+	q.Host = resolver.String()
+
+	res, err := qh.Query(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Response == nil || res.Response.ResponseMsg == nil {
+		return nil, nil
+	}
+
+	for _, rr := range res.Response.ResponseMsg.Answer {
+		https, ok := rr.(*dns.HTTPS)
+		if !ok {
+			continue
+		}
+
+		for _, value := range https.Value {
+			if ech, ok := value.(*dns.SVCBECHConfig); ok && len(ech.ECH) > 0 {
+				return ech.ECH, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,227 @@
+package query_test
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedConventionalQueryHandler struct {
+	mock.Mock
+}
+
+func (m *mockedConventionalQueryHandler) Query(q *query.ConventionalDNSQuery) (*query.ConventionalDNSResponse, custom_errors.DoEErrors) {
+	args := m.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.ConventionalDNSResponse), nil
+	}
+
+	return args.Get(0).(*query.ConventionalDNSResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+// createTestECHKey creates an ECHConfig (X25519, HKDF-SHA256, AES-128-GCM) and returns the server key and the ECHConfigList
+func createTestECHKey(t *testing.T, configId uint8, publicName string) (tls.EncryptedClientHelloKey, []byte) {
+	t.Helper()
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	// see https://datatracker.ietf.org/doc/html/draft-ietf-tls-esni#section-4
+	contents := []byte{configId}
+	contents = binary.BigEndian.AppendUint16(contents, 0x0020) // DHKEM(X25519, HKDF-SHA256)
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(key.PublicKey().Bytes())))
+	contents = append(contents, key.PublicKey().Bytes()...)
+	contents = binary.BigEndian.AppendUint16(contents, 4)
+	contents = binary.BigEndian.AppendUint16(contents, 0x0001) // HKDF-SHA256
+	contents = binary.BigEndian.AppendUint16(contents, 0x0001) // AES-128-GCM
+	contents = append(contents, 0)                             // maximum name length
+	contents = append(contents, uint8(len(publicName)))
+	contents = append(contents, publicName...)
+	contents = binary.BigEndian.AppendUint16(contents, 0) // extensions
+
+	config := binary.BigEndian.AppendUint16(nil, 0xfe0d)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+
+	list := binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	list = append(list, config...)
+
+	return tls.EncryptedClientHelloKey{
+		Config:      config,
+		PrivateKey:  key.Bytes(),
+		SendAsRetry: true,
+	}, list
+}
+
+func TestDoTQuery_ECH(t *testing.T) {
+	t.Parallel()
+
+	t.Run("accepted", func(t *testing.T) {
+		t.Parallel()
+
+		echKey, echConfigList := createTestECHKey(t, 1, "public.example.com")
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates:             []tls.Certificate{createTestTLSCertificate(t)},
+			EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{echKey},
+		})
+
+		q := newLocalDoTQuery(t, addr)
+		q.SNI = "dot.example.com"
+		q.ECHConfigList = echConfigList
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(q)
+
+		require.Nil(t, err)
+		assert.Equal(t, query.ECH_STATUS_ACCEPTED, res.ECHStatus)
+		assert.Empty(t, res.ECHRetryConfigList)
+		assert.Equal(t, "TLS 1.3", res.TLSVersion)
+		assert.NotNil(t, res.ResponseMsg)
+	})
+
+	t.Run("rejected with retry configs", func(t *testing.T) {
+		t.Parallel()
+
+		echKey, _ := createTestECHKey(t, 1, "public.example.com")
+		_, staleConfigList := createTestECHKey(t, 2, "public.example.com")
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates:             []tls.Certificate{createTestTLSCertificate(t)},
+			EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{echKey},
+		})
+
+		q := newLocalDoTQuery(t, addr)
+		q.SNI = "dot.example.com"
+		q.ECHConfigList = staleConfigList
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(q)
+
+		require.Nil(t, err, "should have retried without ECH")
+		assert.Equal(t, query.ECH_STATUS_RETRY_CONFIGS, res.ECHStatus)
+		assert.NotEmpty(t, res.ECHRetryConfigList)
+		assert.NotNil(t, res.ResponseMsg)
+		assert.Equal(t, staleConfigList, q.ECHConfigList, "should have kept the ECHConfigList of the query")
+	})
+
+	t.Run("rejected by server without ECH", func(t *testing.T) {
+		t.Parallel()
+
+		_, echConfigList := createTestECHKey(t, 1, "public.example.com")
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+		})
+
+		q := newLocalDoTQuery(t, addr)
+		q.ECHConfigList = echConfigList
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(q)
+
+		require.Nil(t, err, "should have retried without ECH")
+		assert.Equal(t, query.ECH_STATUS_REJECTED, res.ECHStatus)
+		assert.Empty(t, res.ECHRetryConfigList)
+
+		// the retry must not carry a second OPT RR
+		opts := 0
+		for _, rr := range q.QueryMsg.Extra {
+			if _, ok := rr.(*dns.OPT); ok {
+				opts++
+			}
+		}
+		assert.Equal(t, 1, opts)
+	})
+
+	t.Run("invalid ECHConfigList", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+		})
+
+		q := newLocalDoTQuery(t, addr)
+		q.ECHConfigList = []byte{0x00, 0x01, 0x02}
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(q)
+
+		assert.NotNil(t, err)
+		assert.Equal(t, query.ECH_STATUS_FAILED, res.ECHStatus)
+	})
+
+	t.Run("no ECH", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+		})
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(newLocalDoTQuery(t, addr))
+
+		require.Nil(t, err)
+		assert.Empty(t, res.ECHStatus)
+	})
+}
+
+func TestLookupECHConfigList(t *testing.T) {
+	t.Parallel()
+
+	echConfig := []byte{0x00, 0x02, 0xfe, 0x0d}
+
+	t.Run("HTTPS RR with ech", func(t *testing.T) {
+		t.Parallel()
+
+		qh := &mockedConventionalQueryHandler{}
+		qh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{
+			Response: &query.DNSResponse{
+				ResponseMsg: &dns.Msg{
+					Answer: []dns.RR{
+						&dns.HTTPS{SVCB: dns.SVCB{
+							Priority: 1,
+							Target:   ".",
+							Value: []dns.SVCBKeyValue{
+								&dns.SVCBAlpn{Alpn: []string{"h2"}},
+								&dns.SVCBECHConfig{ECH: echConfig},
+							},
+						}},
+					},
+				},
+			},
+		}, nil)
+
+		list, err := query.LookupECHConfigList("dns.example.com", []byte{8, 8, 8, 8}, qh)
+
+		require.NoError(t, err)
+		assert.Equal(t, echConfig, list)
+
+		q := qh.Calls[0].Arguments.Get(0).(*query.ConventionalDNSQuery)
+		assert.Equal(t, "dns.example.com.", q.QueryMsg.Question[0].Name)
+		assert.Equal(t, dns.TypeHTTPS, q.QueryMsg.Question[0].Qtype)
+		assert.Equal(t, "8.8.8.8", q.Host)
+	})
+
+	t.Run("HTTPS RR without ech", func(t *testing.T) {
+		t.Parallel()
+
+		qh := &mockedConventionalQueryHandler{}
+		qh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{
+			Response: &query.DNSResponse{
+				ResponseMsg: &dns.Msg{
+					Answer: []dns.RR{
+						&dns.HTTPS{SVCB: dns.SVCB{Priority: 1, Target: "."}},
+					},
+				},
+			},
+		}, nil)
+
+		list, err := query.LookupECHConfigList("dns.example.com", []byte{8, 8, 8, 8}, qh)
+
+		require.NoError(t, err)
+		assert.Nil(t, list)
+	})
+}
@@ -0,0 +1,142 @@
+package query
+
+import (
+	"encoding/hex"
+
+	"github.com/miekg/dns"
+)
+
+// EDNSError is an Extended DNS Error, see https://www.rfc-editor.org/rfc/rfc8914.html
+type EDNSError struct {
+	InfoCode uint16 `json:"info_code"`
+	// Name is the name of the info code in the IANA registry, e.g., Blocked or DNSSEC Bogus, empty if unassigned
+	Name      string `json:"name"`
+	ExtraText string `json:"extra_text"`
+}
+
+// EDNSOption is an option of the OPT record that is not parsed into EDNSInfo
+type EDNSOption struct {
+	Code uint16 `json:"code"`
+	// Data is the presentation format of the option
+	Data string `json:"data"`
+}
+
+// EDNSInfo holds the OPT record of a response, see https://www.rfc-editor.org/rfc/rfc6891.html
+type EDNSInfo struct {
+	Version uint8  `json:"version"`
+	UDPSize uint16 `json:"udp_size"`
+	DO      bool   `json:"do"`
+
+	// NSID is the hex encoded name server identifier, see https://www.rfc-editor.org/rfc/rfc5001.html
+	NSID string `json:"nsid"`
+	// NSIDText is the name server identifier if it is printable ASCII
+	NSIDText string `json:"nsid_text"`
+
+	ExtendedErrors []*EDNSError `json:"extended_errors"`
+
+	// Cookie is the DNS cookie of the response, nil if the response has none
+	Cookie *EDNSCookie `json:"cookie"`
+
+	// UnknownOptions are all options except NSID, Extended DNS Errors, cookies and padding
+	UnknownOptions []*EDNSOption `json:"unknown_options"`
+}
+
+// SetNSID requests the name server identifier with an empty NSID option if enabled, see RFC 5001
+// Do not use this function before marshaling the query but before sending it as a DNS query
+func (q *DNSQuery) SetNSID() {
+	if !q.NSID {
+		return
+	}
+
+	if q.QueryMsg == nil {
+		q.QueryMsg = new(dns.Msg)
+	}
+
+	opt := getOrSetOPT(q.QueryMsg)
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_NSID); ok {
+			return
+		}
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+}
+
+// NewEDNSInfo parses the OPT record of the message, nil if the message has none
+func NewEDNSInfo(msg *dns.Msg) *EDNSInfo {
+	if msg == nil {
+		return nil
+	}
+
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+
+	info := &EDNSInfo{
+		Version:        opt.Version(),
+		UDPSize:        opt.UDPSize(),
+		DO:             opt.Do(),
+		ExtendedErrors: []*EDNSError{},
+		UnknownOptions: []*EDNSOption{},
+	}
+
+	for _, o := range opt.Option {
+		switch option := o.(type) {
+		case *dns.EDNS0_NSID:
+			info.NSID = option.Nsid
+			info.NSIDText = getPrintableNSID(option.Nsid)
+		case *dns.EDNS0_EDE:
+			info.ExtendedErrors = append(info.ExtendedErrors, &EDNSError{
+				InfoCode:  option.InfoCode,
+				Name:      dns.ExtendedErrorCodeToString[option.InfoCode],
+				ExtraText: option.ExtraText,
+			})
+		case *dns.EDNS0_COOKIE:
+			info.Cookie = NewEDNSCookie(option.Cookie)
+		case *dns.EDNS0_PADDING:
+			// the padding is recorded by the DoE handlers
+		default:
+			info.UnknownOptions = append(info.UnknownOptions, &EDNSOption{
+				Code: o.Option(),
+				Data: o.String(),
+			})
+		}
+	}
+
+	return info
+}
+
+// getOrSetOPT returns the OPT record of the message, adds one without the DO bit if missing
+func getOrSetOPT(msg *dns.Msg) *dns.OPT {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(1232, false)
+		opt = msg.IsEdns0()
+	}
+
+	return opt
+}
+
+func getPrintableNSID(nsid string) string {
+	raw, err := hex.DecodeString(nsid)
+	if err != nil {
+		return ""
+	}
+
+	for _, c := range raw {
+		if c < 0x20 || c > 0x7e {
+			return ""
+		}
+	}
+
+	return string(raw)
+}
+
+func setEDNSInfoToResponse(res *DNSResponse) {
+	if res == nil {
+		return
+	}
+
+	res.EDNS = NewEDNSInfo(res.ResponseMsg)
+}
@@ -0,0 +1,181 @@
+package query_test
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestEDNSServer starts a local Do53 server answering with SERVFAIL, the Extended DNS Error Blocked and the NSID if requested
+func startTestEDNSServer(t *testing.T, nsid string) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeServerFailure)
+			m.SetEdns0(1232, false)
+
+			opt := m.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeBlocked, ExtraText: "blocked by policy"})
+
+			if reqOpt := r.IsEdns0(); reqOpt != nil {
+				for _, o := range reqOpt.Option {
+					if _, ok := o.(*dns.EDNS0_NSID); ok {
+						opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte(nsid))})
+					}
+				}
+			}
+
+			_ = w.WriteMsg(m)
+		}),
+	}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func TestDNSQuery_SetNSID(t *testing.T) {
+	t.Parallel()
+
+	t.Run("add OPT record", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewConventionalQuery()
+		q.NSID = true
+		q.SetNSID()
+
+		require.NotNil(t, q.QueryMsg.IsEdns0())
+		require.Len(t, q.QueryMsg.IsEdns0().Option, 1)
+		assert.Equal(t, uint16(dns.EDNS0NSID), q.QueryMsg.IsEdns0().Option[0].Option())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewConventionalQuery()
+		q.SetNSID()
+
+		assert.Nil(t, q.QueryMsg.IsEdns0(), "Do53 queries should not request the NSID by default")
+	})
+
+	t.Run("keep DNSSEC flag", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.SetDNSSEC()
+		q.SetNSID()
+		q.SetNSID()
+
+		assert.True(t, q.QueryMsg.IsEdns0().Do())
+		assert.Len(t, q.QueryMsg.IsEdns0().Option, 1, "should request the NSID once")
+	})
+
+	t.Run("before padding", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.SetNSID()
+		q.SetPadding()
+
+		assert.Len(t, q.QueryMsg.IsEdns0().Option, 2)
+		assert.Equal(t, query.DEFAULT_PADDING_BLOCK_LENGTH, q.QueryMsg.Len())
+	})
+}
+
+func TestNewEDNSInfo(t *testing.T) {
+	t.Parallel()
+
+	t.Run("parse options", func(t *testing.T) {
+		t.Parallel()
+
+		msg := new(dns.Msg)
+		msg.SetEdns0(4096, true)
+		opt := msg.IsEdns0()
+		opt.Option = append(opt.Option,
+			&dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: hex.EncodeToString([]byte("fra-1"))},
+			&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeDNSBogus, ExtraText: "signature expired"},
+			&dns.EDNS0_EDE{InfoCode: 60000},
+			&dns.EDNS0_PADDING{Padding: make([]byte, 8)},
+			&dns.EDNS0_LOCAL{Code: 65001, Data: []byte{0xab, 0xcd}},
+		)
+
+		info := query.NewEDNSInfo(msg)
+
+		require.NotNil(t, info)
+		assert.Equal(t, uint8(0), info.Version)
+		assert.Equal(t, uint16(4096), info.UDPSize)
+		assert.True(t, info.DO)
+		assert.Equal(t, "6672612d31", info.NSID)
+		assert.Equal(t, "fra-1", info.NSIDText)
+
+		require.Len(t, info.ExtendedErrors, 2)
+		assert.Equal(t, &query.EDNSError{InfoCode: dns.ExtendedErrorCodeDNSBogus, Name: "DNSSEC Bogus", ExtraText: "signature expired"}, info.ExtendedErrors[0])
+		assert.Empty(t, info.ExtendedErrors[1].Name, "unassigned info code has no name")
+
+		require.Len(t, info.UnknownOptions, 1, "should not record the padding")
+		assert.Equal(t, uint16(65001), info.UnknownOptions[0].Code)
+		assert.Equal(t, "65001:0xabcd", info.UnknownOptions[0].Data)
+	})
+
+	t.Run("binary NSID", func(t *testing.T) {
+		t.Parallel()
+
+		msg := new(dns.Msg)
+		msg.SetEdns0(1232, false)
+		msg.IsEdns0().Option = append(msg.IsEdns0().Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: "00ff"})
+
+		info := query.NewEDNSInfo(msg)
+
+		assert.Equal(t, "00ff", info.NSID)
+		assert.Empty(t, info.NSIDText)
+	})
+
+	t.Run("no OPT record", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, query.NewEDNSInfo(new(dns.Msg)))
+		assert.Nil(t, query.NewEDNSInfo(nil))
+	})
+}
+
+func TestConventionalDNSQuery_EDNSInfo(t *testing.T) {
+	t.Parallel()
+
+	host, port, err := net.SplitHostPort(startTestEDNSServer(t, "resolver-1"))
+	require.NoError(t, err)
+
+	q := query.NewConventionalQuery()
+	q.Host = host
+	q.Port, err = net.LookupPort("udp", port)
+	require.NoError(t, err)
+	q.Timeout = 2 * time.Second
+	q.NSID = true
+	q.QueryMsg = new(dns.Msg)
+	q.QueryMsg.SetQuestion("example.com.", dns.TypeA)
+
+	res, qErr := query.NewConventionalDNSQueryHandler(nil).Query(q)
+
+	require.Nil(t, qErr)
+	require.NotNil(t, res.Response.EDNS)
+	assert.Equal(t, "resolver-1", res.Response.EDNS.NSIDText)
+	require.Len(t, res.Response.EDNS.ExtendedErrors, 1)
+	assert.Equal(t, "Blocked", res.Response.EDNS.ExtendedErrors[0].Name)
+	assert.Equal(t, "blocked by policy", res.Response.EDNS.ExtendedErrors[0].ExtraText)
+}
@@ -20,6 +20,7 @@ const QUERY_HOST = "measurement.raiun.de."
 
 func validateCertificateError(queryErr error, noCertificateErr custom_errors.DoEErrors, res *DoEResponse, skipCertificateVerification bool) custom_errors.DoEErrors {
 	setCertificateValidationToResponse(queryErr, res, skipCertificateVerification)
+	setTLSAlertToResponse(queryErr, res)
 	if queryErr != nil {
 		if helper.IsCertificateError(queryErr) {
 			cErr := custom_errors.NewCertificateError(queryErr, true).AddInfo(queryErr)
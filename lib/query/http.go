@@ -0,0 +1,90 @@
+package query
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// we do not want to read arbitrary large bodies into memory
+const MAX_HTTP_BODY_SIZE = 65535
+
+type HttpRawResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// HttpRawQueryHandler executes HTTP requests and returns the raw response body, e.g., for oblivious DNS messages
+type HttpRawQueryHandler interface {
+	Query(httpReq *http.Request, timeout time.Duration, tlsConfig *tls.Config) (*HttpRawResponse, time.Duration, *tls.ConnectionState, error)
+}
+
+type defaultHttpRawQueryHandler struct {
+	Dialer *net.Dialer
+}
+
+func (h *defaultHttpRawQueryHandler) Query(httpReq *http.Request, timeout time.Duration, tlsConfig *tls.Config) (*HttpRawResponse, time.Duration, *tls.ConnectionState, error) {
+	transport := &http.Transport{
+		TLSClientConfig:   tlsConfig,
+		DialContext:       h.Dialer.DialContext,
+		DisableKeepAlives: true,
+		ForceAttemptHTTP2: true,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+
+	begin := time.Now()
+
+	httpRes, err := client.Do(httpReq)
+
+	if httpRes != nil && httpRes.Body != nil {
+		defer httpRes.Body.Close()
+	}
+
+	if err != nil {
+		// unwrap the URL error so that certificate errors can be detected by the caller
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, 0, nil, urlErr.Err
+		}
+		return nil, 0, nil, err
+	}
+
+	connState := httpRes.TLS
+
+	content, err := io.ReadAll(io.LimitReader(httpRes.Body, MAX_HTTP_BODY_SIZE))
+	if err != nil {
+		return nil, 0, connState, err
+	}
+
+	rtt := time.Since(begin)
+
+	return &HttpRawResponse{
+		StatusCode:  httpRes.StatusCode,
+		ContentType: httpRes.Header.Get("content-type"),
+		Body:        content,
+	}, rtt, connState, nil
+}
+
+func newDefaultHttpRawQueryHandler(config *QueryConfig) *defaultHttpRawQueryHandler {
+	dialer := &net.Dialer{}
+
+	if config != nil {
+		dialer.LocalAddr = &net.TCPAddr{
+			IP:   config.LocalAddr,
+			Port: 0,
+		}
+	}
+
+	return &defaultHttpRawQueryHandler{
+		Dialer: dialer,
+	}
+}
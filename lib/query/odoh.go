@@ -1,3 +1,576 @@
 package query
 
-// TBD
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/helper"
+	"github.com/steffsas/doe-hunter/lib/hpke"
+)
+
+// see https://www.rfc-editor.org/rfc/rfc9230.html
+const ODOH_MEDIA_TYPE = "application/oblivious-dns-message"
+const ODOH_CONFIG_PATH = "/.well-known/odohconfigs"
+const ODOH_VERSION uint16 = 0x0001
+
+const ODOH_MESSAGE_TYPE_QUERY uint8 = 0x01
+const ODOH_MESSAGE_TYPE_RESPONSE uint8 = 0x02
+
+const DEFAULT_ODOH_TARGET_PATH = "/dns-query"
+const DEFAULT_ODOH_PORT = 443
+const DEFAULT_ODOH_TIMEOUT = 10000 * time.Millisecond
+
+// see https://www.rfc-editor.org/rfc/rfc9230.html#section-4.1
+const ODOH_PROXY_TARGET_HOST_PARAM = "targethost"
+const ODOH_PROXY_TARGET_PATH_PARAM = "targetpath"
+
+var errODoHTruncated = errors.New("message is truncated")
+
+// ODoHConfig is a single ObliviousDoHConfig, see https://www.rfc-editor.org/rfc/rfc9230.html#section-6.1
+type ODoHConfig struct {
+	Version   uint16 `json:"version"`
+	KEMId     uint16 `json:"kem_id"`
+	KDFId     uint16 `json:"kdf_id"`
+	AEADId    uint16 `json:"aead_id"`
+	PublicKey []byte `json:"public_key"`
+	// KeyId is derived from the config contents, see https://www.rfc-editor.org/rfc/rfc9230.html#section-6.2
+	KeyId []byte `json:"key_id"`
+	// Supported is true if we are able to use this config (known version and HPKE suite)
+	Supported bool `json:"supported"`
+}
+
+func (c *ODoHConfig) Suite() *hpke.Suite {
+	return &hpke.Suite{
+		KEMId:  c.KEMId,
+		KDFId:  c.KDFId,
+		AEADId: c.AEADId,
+	}
+}
+
+func (c *ODoHConfig) marshalContents() []byte {
+	b := binary.BigEndian.AppendUint16(nil, c.KEMId)
+	b = binary.BigEndian.AppendUint16(b, c.KDFId)
+	b = binary.BigEndian.AppendUint16(b, c.AEADId)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(c.PublicKey)))
+	return append(b, c.PublicKey...)
+}
+
+func (c *ODoHConfig) deriveKeyId() ([]byte, error) {
+	s := c.Suite()
+
+	prk, err := s.Extract(nil, c.marshalContents())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Expand(prk, []byte("odoh key id"), s.HashSize())
+}
+
+// NewODoHConfig creates a version 1 ODoH config for the given suite and public key
+func NewODoHConfig(suite *hpke.Suite, publicKey []byte) (*ODoHConfig, error) {
+	c := &ODoHConfig{
+		Version:   ODOH_VERSION,
+		KEMId:     suite.KEMId,
+		KDFId:     suite.KDFId,
+		AEADId:    suite.AEADId,
+		PublicKey: publicKey,
+		Supported: suite.IsSupported(),
+	}
+
+	var err error
+	c.KeyId, err = c.deriveKeyId()
+
+	return c, err
+}
+
+// MarshalODoHConfigs serializes ObliviousDoHConfigs
+func MarshalODoHConfigs(configs []*ODoHConfig) []byte {
+	list := []byte{}
+	for _, c := range configs {
+		contents := c.marshalContents()
+		list = binary.BigEndian.AppendUint16(list, c.Version)
+		list = binary.BigEndian.AppendUint16(list, uint16(len(contents)))
+		list = append(list, contents...)
+	}
+
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(list))), list...)
+}
+
+// ParseODoHConfigs parses ObliviousDoHConfigs, configs of unknown versions are skipped
+func ParseODoHConfigs(b []byte) ([]*ODoHConfig, error) {
+	list, _, err := readODoHVector(b)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []*ODoHConfig{}
+	for len(list) > 0 {
+		if len(list) < 2 {
+			return configs, errODoHTruncated
+		}
+
+		version := binary.BigEndian.Uint16(list)
+
+		var contents []byte
+		contents, list, err = readODoHVector(list[2:])
+		if err != nil {
+			return configs, err
+		}
+
+		if version != ODOH_VERSION {
+			// see https://www.rfc-editor.org/rfc/rfc9230.html#section-6.1, clients must ignore unknown versions
+			configs = append(configs, &ODoHConfig{Version: version, Supported: false})
+			continue
+		}
+
+		if len(contents) < 6 {
+			return configs, errODoHTruncated
+		}
+
+		c := &ODoHConfig{
+			Version: version,
+			KEMId:   binary.BigEndian.Uint16(contents[0:]),
+			KDFId:   binary.BigEndian.Uint16(contents[2:]),
+			AEADId:  binary.BigEndian.Uint16(contents[4:]),
+		}
+
+		c.PublicKey, _, err = readODoHVector(contents[6:])
+		if err != nil {
+			return configs, err
+		}
+
+		c.Supported = c.Suite().IsSupported()
+		if c.Supported {
+			c.KeyId, err = c.deriveKeyId()
+			if err != nil {
+				return configs, err
+			}
+		}
+
+		configs = append(configs, c)
+	}
+
+	return configs, nil
+}
+
+// ODoHMessage is an ObliviousDoHMessage, see https://www.rfc-editor.org/rfc/rfc9230.html#section-6.3
+type ODoHMessage struct {
+	MessageType      uint8
+	KeyId            []byte
+	EncryptedMessage []byte
+}
+
+func (m *ODoHMessage) Marshal() []byte {
+	b := []byte{m.MessageType}
+	b = appendODoHVector(b, m.KeyId)
+	return appendODoHVector(b, m.EncryptedMessage)
+}
+
+func UnmarshalODoHMessage(b []byte) (*ODoHMessage, error) {
+	if len(b) < 1 {
+		return nil, errODoHTruncated
+	}
+
+	m := &ODoHMessage{
+		MessageType: b[0],
+	}
+
+	var err error
+	var rest []byte
+	m.KeyId, rest, err = readODoHVector(b[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	m.EncryptedMessage, _, err = readODoHVector(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// MarshalODoHPlaintext serializes an ObliviousDoHMessagePlaintext
+func MarshalODoHPlaintext(dnsMsg []byte, padding []byte) []byte {
+	return appendODoHVector(appendODoHVector(nil, dnsMsg), padding)
+}
+
+// UnmarshalODoHPlaintext returns the DNS message of an ObliviousDoHMessagePlaintext
+func UnmarshalODoHPlaintext(b []byte) ([]byte, error) {
+	dnsMsg, _, err := readODoHVector(b)
+	return dnsMsg, err
+}
+
+// EncryptODoHQuery encrypts the plaintext query to the config's public key, see https://www.rfc-editor.org/rfc/rfc9230.html#section-6.4
+func EncryptODoHQuery(config *ODoHConfig, qPlain []byte) (*ODoHMessage, *hpke.Context, error) {
+	enc, ctx, err := config.Suite().SetupBaseS(config.PublicKey, []byte("odoh query"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aad := appendODoHVector([]byte{ODOH_MESSAGE_TYPE_QUERY}, config.KeyId)
+
+	ct, err := ctx.Seal(aad, qPlain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ODoHMessage{
+		MessageType:      ODOH_MESSAGE_TYPE_QUERY,
+		KeyId:            config.KeyId,
+		EncryptedMessage: append(enc, ct...),
+	}, ctx, nil
+}
+
+// DeriveODoHResponseSecrets derives the AEAD key and nonce of the response, see https://www.rfc-editor.org/rfc/rfc9230.html#section-6.4
+func DeriveODoHResponseSecrets(suite *hpke.Suite, ctx *hpke.Context, qPlain []byte, responseNonce []byte) (key []byte, nonce []byte, err error) {
+	secret, err := ctx.Export([]byte("odoh response"), suite.KeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	salt := appendODoHVector(append([]byte{}, qPlain...), responseNonce)
+
+	prk, err := suite.Extract(salt, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err = suite.Expand(prk, []byte("odoh key"), suite.KeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err = suite.Expand(prk, []byte("odoh nonce"), suite.NonceSize())
+
+	return key, nonce, err
+}
+
+// EncryptODoHResponse encrypts the plaintext response, this is the target's part of the protocol
+func EncryptODoHResponse(suite *hpke.Suite, ctx *hpke.Context, qPlain []byte, rPlain []byte) (*ODoHMessage, error) {
+	responseNonce := make([]byte, max(suite.KeySize(), suite.NonceSize()))
+	if _, err := rand.Read(responseNonce); err != nil {
+		return nil, err
+	}
+
+	key, nonce, err := DeriveODoHResponseSecrets(suite, ctx, qPlain, responseNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := suite.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aad := appendODoHVector([]byte{ODOH_MESSAGE_TYPE_RESPONSE}, responseNonce)
+
+	return &ODoHMessage{
+		MessageType:      ODOH_MESSAGE_TYPE_RESPONSE,
+		KeyId:            responseNonce,
+		EncryptedMessage: aead.Seal(nil, nonce, rPlain, aad),
+	}, nil
+}
+
+// DecryptODoHResponse decrypts the response message and returns the plaintext response
+func DecryptODoHResponse(suite *hpke.Suite, ctx *hpke.Context, qPlain []byte, msg *ODoHMessage) ([]byte, error) {
+	if msg.MessageType != ODOH_MESSAGE_TYPE_RESPONSE {
+		return nil, fmt.Errorf("unexpected message type %d", msg.MessageType)
+	}
+
+	// the key_id field of a response carries the response nonce
+	key, nonce, err := DeriveODoHResponseSecrets(suite, ctx, qPlain, msg.KeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := suite.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aad := appendODoHVector([]byte{ODOH_MESSAGE_TYPE_RESPONSE}, msg.KeyId)
+
+	return aead.Open(nil, nonce, msg.EncryptedMessage, aad)
+}
+
+func appendODoHVector(b []byte, v []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+	return append(b, v...)
+}
+
+// readODoHVector reads an opaque vector with 2-byte length prefix and returns the vector and the remaining bytes
+func readODoHVector(b []byte) (v []byte, rest []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, errODoHTruncated
+	}
+
+	l := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+l {
+		return nil, nil, errODoHTruncated
+	}
+
+	return b[2 : 2+l], b[2+l:], nil
+}
+
+type ODoHQuery struct {
+	DoEQuery
+
+	// TargetPath is the DoH path of the ODoH target (default: /dns-query)
+	TargetPath string `json:"target_path"`
+
+	// ConfigPath is the well-known path to fetch the ODoH configs from (default: /.well-known/odohconfigs)
+	ConfigPath string `json:"config_path"`
+
+	// Proxy is the URL of the oblivious proxy, e.g., https://proxy.example/proxy
+	// if empty, the oblivious query is sent to the target directly
+	Proxy string `json:"proxy"`
+}
+
+type ODoHResponse struct {
+	DoEResponse
+
+	// RawConfigs are the ObliviousDoHConfigs as served by the target
+	RawConfigs []byte `json:"raw_configs"`
+	// Configs are the parsed ODoH configs including their key IDs
+	Configs []*ODoHConfig `json:"configs"`
+	// UsedKeyId is the key ID of the config we used to encrypt the query
+	UsedKeyId []byte `json:"used_key_id"`
+	// ViaProxy is true if the query was sent through the oblivious proxy
+	ViaProxy bool `json:"via_proxy"`
+}
+
+type ODoHQueryHandler struct {
+	// QueryHandler is an interface to execute HTTP requests
+	QueryHandler HttpRawQueryHandler
+}
+
+func (qh *ODoHQueryHandler) Query(query *ODoHQuery) (*ODoHResponse, custom_errors.DoEErrors) {
+	res := &ODoHResponse{}
+
+	res.CertificateValid = false
+	res.CertificateVerified = false
+
+	if query == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if err := query.Check(true); err != nil {
+		return res, err
+	}
+
+	if qh.QueryHandler == nil {
+		return res, custom_errors.NewGenericError(custom_errors.ErrQueryHandlerNil, true)
+	}
+
+	if query.TargetPath == "" || query.ConfigPath == "" {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrEmptyURIPath, true)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: query.SkipCertificateVerify,
+		// let's support all TLS versions, including TLS 1.0 and TLS 1.1
+		// codeql [go/insecure-tls]: This is intentional
+		MinVersion: tls.VersionTLS10,
+		MaxVersion: tls.VersionTLS13,
+		// let's support all ciphers
+		CipherSuites: getAllTLSCipherSuites(),
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if query.SNI != "" {
+		tlsConfig.ServerName = query.SNI
+	}
+
+	target := fmt.Sprintf("https://%s", helper.GetFullHostFromHostPort(query.Host, query.Port))
+
+	// fetch the target's ODoH configs first
+	configURI, err := url.JoinPath(target, query.ConfigPath)
+	if err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrFailedToJoinURLPath, true).AddInfo(err)
+	}
+
+	configReq, err := http.NewRequestWithContext(context.Background(), HTTP_GET, configURI, nil)
+	if err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrFailedFailedToCreateHTTPReq, true).AddInfo(err)
+	}
+
+	configRes, _, tlsConnState, queryErr := qh.QueryHandler.Query(configReq, query.Timeout, tlsConfig)
+
+	// the TLS connection state of the target, not of the proxy
+	setTLSDetailsToResponse(tlsConnState, &res.DoEResponse)
+
+	if cErr := validateCertificateError(
+		queryErr,
+		custom_errors.NewQueryError(custom_errors.ErrODoHConfigFetchFailed, true),
+		&res.DoEResponse,
+		query.SkipCertificateVerify,
+	); cErr != nil {
+		return res, cErr
+	}
+
+	if configRes.StatusCode != http.StatusOK {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHConfigFetchFailed, true).
+			AddInfoString(fmt.Sprintf("status code %d", configRes.StatusCode))
+	}
+
+	res.RawConfigs = configRes.Body
+
+	var parseErr error
+	res.Configs, parseErr = ParseODoHConfigs(configRes.Body)
+	if parseErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHConfigParsingFailed, true).AddInfo(parseErr)
+	}
+
+	var config *ODoHConfig
+	for _, c := range res.Configs {
+		if c.Supported {
+			config = c
+			break
+		}
+	}
+
+	if config == nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHNoSupportedConfig, true).
+			AddInfoString(fmt.Sprintf("got %d configs", len(res.Configs)))
+	}
+
+	res.UsedKeyId = config.KeyId
+
+	query.SetDNSSEC()
+	query.SetNSID()
+	query.SetCookie()
+
+	// Set DNS ID as zero according to RFC9230 (see section 4.1)
+	query.QueryMsg.Id = 0
+
+	buf, packErr := query.QueryMsg.Pack()
+	if packErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrDNSPackFailed, true).AddInfo(packErr)
+	}
+
+	qPlain := MarshalODoHPlaintext(buf, nil)
+
+	odohQuery, hpkeCtx, encErr := EncryptODoHQuery(config, qPlain)
+	if encErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHEncryptionFailed, true).AddInfo(encErr)
+	}
+
+	queryURI, proxyTlsConfig, uriErr := getODoHQueryURI(query, target, tlsConfig)
+	if uriErr != nil {
+		return res, uriErr
+	}
+	res.ViaProxy = query.Proxy != ""
+
+	httpReq, err := http.NewRequestWithContext(context.Background(), HTTP_POST, queryURI, bytes.NewReader(odohQuery.Marshal()))
+	if err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrFailedFailedToCreateHTTPReq, true).AddInfo(err)
+	}
+	httpReq.Header.Add("accept", ODOH_MEDIA_TYPE)
+	httpReq.Header.Add("content-type", ODOH_MEDIA_TYPE)
+
+	odohRes, rtt, _, queryErr := qh.QueryHandler.Query(httpReq, query.Timeout, proxyTlsConfig)
+	if queryErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHRequestFailed, true).AddInfo(queryErr)
+	}
+
+	if odohRes.StatusCode != http.StatusOK {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHRequestFailed, true).
+			AddInfoString(fmt.Sprintf("status code %d: %s", odohRes.StatusCode, string(odohRes.Body)))
+	}
+
+	res.RTT = rtt
+
+	odohResponse, msgErr := UnmarshalODoHMessage(odohRes.Body)
+	if msgErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHInvalidMessage, true).AddInfo(msgErr)
+	}
+
+	rPlain, decErr := DecryptODoHResponse(config.Suite(), hpkeCtx, qPlain, odohResponse)
+	if decErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHDecryptionFailed, true).AddInfo(decErr)
+	}
+
+	dnsMsg, msgErr := UnmarshalODoHPlaintext(rPlain)
+	if msgErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrODoHInvalidMessage, true).AddInfo(msgErr)
+	}
+
+	r := &dns.Msg{}
+	if err := r.Unpack(dnsMsg); err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrDNSUnpackFailed, true).AddInfo(err)
+	}
+
+	res.ResponseMsg = r
+	setEDNSInfoToResponse(&res.DNSResponse)
+
+	return res, nil
+}
+
+// getODoHQueryURI returns the URI to send the oblivious query to and the TLS config for that connection
+func getODoHQueryURI(query *ODoHQuery, target string, targetTlsConfig *tls.Config) (string, *tls.Config, custom_errors.DoEErrors) {
+	if query.Proxy == "" {
+		uri, err := url.JoinPath(target, query.TargetPath)
+		if err != nil {
+			return "", nil, custom_errors.NewQueryError(custom_errors.ErrFailedToJoinURLPath, true).AddInfo(err)
+		}
+
+		return uri, targetTlsConfig, nil
+	}
+
+	proxyURI, err := url.Parse(query.Proxy)
+	if err != nil {
+		return "", nil, custom_errors.NewQueryConfigError(custom_errors.ErrODoHRequestFailed, true).AddInfo(err)
+	}
+
+	targetHost := query.Host
+	if query.Port != DEFAULT_ODOH_PORT {
+		targetHost = helper.GetFullHostFromHostPort(query.Host, query.Port)
+	}
+
+	params := proxyURI.Query()
+	params.Set(ODOH_PROXY_TARGET_HOST_PARAM, targetHost)
+	params.Set(ODOH_PROXY_TARGET_PATH_PARAM, query.TargetPath)
+	proxyURI.RawQuery = params.Encode()
+
+	// the proxy is a different server than the target, so we must not use the target's SNI
+	proxyTlsConfig := &tls.Config{
+		InsecureSkipVerify: query.SkipCertificateVerify,
+		NextProtos:         []string{"h2", "http/1.1"},
+	}
+
+	return proxyURI.String(), proxyTlsConfig, nil
+}
+
+func NewODoHQuery() (q *ODoHQuery) {
+	q = &ODoHQuery{
+		TargetPath: DEFAULT_ODOH_TARGET_PATH,
+		ConfigPath: ODOH_CONFIG_PATH,
+	}
+
+	q.Timeout = DEFAULT_ODOH_TIMEOUT
+	q.Port = DEFAULT_ODOH_PORT
+
+	q.QueryMsg = GetDefaultQueryMsg()
+
+	// request the name server identifier by default
+	q.NSID = true
+
+	return
+}
+
+func NewODoHQueryHandler(config *QueryConfig) *ODoHQueryHandler {
+	return &ODoHQueryHandler{
+		QueryHandler: newDefaultHttpRawQueryHandler(config),
+	}
+}
@@ -0,0 +1,419 @@
+package query_test
+
+import (
+	"crypto/ecdh"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/hpke"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const odohTestProxyPath = "/proxy"
+
+// odohTestTarget is a minimal ODoH target stand-in (see https://www.rfc-editor.org/rfc/rfc9230.html#section-4.2)
+type odohTestTarget struct {
+	suite   *hpke.Suite
+	sk      *ecdh.PrivateKey
+	config  *query.ODoHConfig
+	configs []byte
+	// queried is true if the target received an oblivious query
+	queried bool
+}
+
+func newODoHTestTarget(t *testing.T) *odohTestTarget {
+	t.Helper()
+
+	suite := &hpke.Suite{
+		KEMId:  hpke.KEM_X25519_HKDF_SHA256,
+		KDFId:  hpke.KDF_HKDF_SHA256,
+		AEADId: hpke.AEAD_AES_128_GCM,
+	}
+
+	sk, err := suite.GenerateKeyPair()
+	require.Nil(t, err)
+
+	config, err := query.NewODoHConfig(suite, sk.PublicKey().Bytes())
+	require.Nil(t, err)
+
+	return &odohTestTarget{
+		suite:   suite,
+		sk:      sk,
+		config:  config,
+		configs: query.MarshalODoHConfigs([]*query.ODoHConfig{config}),
+	}
+}
+
+func (o *odohTestTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case query.ODOH_CONFIG_PATH:
+		w.Header().Set("content-type", "application/octet-stream")
+		_, _ = w.Write(o.configs)
+	case query.DEFAULT_ODOH_TARGET_PATH:
+		o.queried = true
+
+		rMsg, err := o.answer(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("content-type", query.ODOH_MEDIA_TYPE)
+		_, _ = w.Write(rMsg)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (o *odohTestTarget) answer(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := query.UnmarshalODoHMessage(body)
+	if err != nil {
+		return nil, err
+	}
+
+	nEnc := o.suite.EncapsulatedKeySize()
+	ctx, err := o.suite.SetupBaseR(msg.EncryptedMessage[:nEnc], o.sk, []byte("odoh query"))
+	if err != nil {
+		return nil, err
+	}
+
+	aad := append([]byte{query.ODOH_MESSAGE_TYPE_QUERY, 0x00, byte(len(msg.KeyId))}, msg.KeyId...)
+	qPlain, err := ctx.Open(aad, msg.EncryptedMessage[nEnc:])
+	if err != nil {
+		return nil, err
+	}
+
+	dnsQuery, err := query.UnmarshalODoHPlaintext(qPlain)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &dns.Msg{}
+	if err := q.Unpack(dnsQuery); err != nil {
+		return nil, err
+	}
+
+	a := &dns.Msg{}
+	a.SetReply(q)
+	a.Answer = append(a.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.0.2.1"),
+	})
+
+	dnsAnswer, err := a.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	rMsg, err := query.EncryptODoHResponse(o.suite, ctx, qPlain, query.MarshalODoHPlaintext(dnsAnswer, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return rMsg.Marshal(), nil
+}
+
+// newODoHTestProxy forwards oblivious messages to the target given by the targethost and targetpath params
+func newODoHTestProxy(t *testing.T) (*httptest.Server, *bool) {
+	t.Helper()
+
+	forwarded := false
+
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != odohTestProxyPath || r.Header.Get("content-type") != query.ODOH_MEDIA_TYPE {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		targetURI := url.URL{
+			Scheme: "https",
+			Host:   r.URL.Query().Get(query.ODOH_PROXY_TARGET_HOST_PARAM),
+			Path:   r.URL.Query().Get(query.ODOH_PROXY_TARGET_PATH_PARAM),
+		}
+
+		client := &http.Client{
+			Transport: &http.Transport{
+				// codeql [go/disabled-certificate-check]: test server uses a self-signed certificate
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint: gosec
+			},
+		}
+
+		fwdReq, err := http.NewRequestWithContext(r.Context(), http.MethodPost, targetURI.String(), r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		fwdReq.Header.Set("content-type", query.ODOH_MEDIA_TYPE)
+
+		fwdRes, err := client.Do(fwdReq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer fwdRes.Body.Close()
+
+		forwarded = true
+
+		w.Header().Set("content-type", fwdRes.Header.Get("content-type"))
+		w.WriteHeader(fwdRes.StatusCode)
+		_, _ = io.Copy(w, fwdRes.Body)
+	}))
+
+	return proxy, &forwarded
+}
+
+func newODoHTestQuery(t *testing.T, target *httptest.Server) *query.ODoHQuery {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(target.Listener.Addr().String())
+	require.Nil(t, err)
+
+	p, err := strconv.Atoi(port)
+	require.Nil(t, err)
+
+	q := query.NewODoHQuery()
+	q.Host = host
+	q.Port = p
+	q.SkipCertificateVerify = true
+	q.QueryMsg.SetQuestion("example.org.", dns.TypeA)
+
+	return q
+}
+
+func TestODoHConfigs_MarshalParse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		target := newODoHTestTarget(t)
+
+		configs, err := query.ParseODoHConfigs(target.configs)
+
+		require.Nil(t, err, "should have parsed configs")
+		require.Len(t, configs, 1)
+		assert.True(t, configs[0].Supported)
+		assert.Equal(t, target.config.PublicKey, configs[0].PublicKey)
+		assert.Equal(t, target.config.KeyId, configs[0].KeyId)
+		assert.Len(t, configs[0].KeyId, 32, "key id should have Nh bytes")
+	})
+
+	t.Run("unknown version is skipped", func(t *testing.T) {
+		t.Parallel()
+
+		target := newODoHTestTarget(t)
+		unknown := &query.ODoHConfig{Version: 0xff01, KEMId: hpke.KEM_X25519_HKDF_SHA256, PublicKey: []byte{0x01}}
+
+		configs, err := query.ParseODoHConfigs(query.MarshalODoHConfigs([]*query.ODoHConfig{unknown, target.config}))
+
+		require.Nil(t, err, "should have parsed configs")
+		require.Len(t, configs, 2)
+		assert.False(t, configs[0].Supported)
+		assert.True(t, configs[1].Supported)
+	})
+
+	t.Run("unsupported suite", func(t *testing.T) {
+		t.Parallel()
+
+		unsupported := &query.ODoHConfig{Version: query.ODOH_VERSION, KEMId: 0x0042, KDFId: 0x0001, AEADId: 0x0001, PublicKey: []byte{0x01}}
+
+		configs, err := query.ParseODoHConfigs(query.MarshalODoHConfigs([]*query.ODoHConfig{unsupported}))
+
+		require.Nil(t, err, "should have parsed configs")
+		require.Len(t, configs, 1)
+		assert.False(t, configs[0].Supported)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		t.Parallel()
+
+		target := newODoHTestTarget(t)
+
+		_, err := query.ParseODoHConfigs(target.configs[:len(target.configs)-5])
+
+		assert.NotNil(t, err, "should fail on truncated configs")
+	})
+}
+
+func TestODoHMessage_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	msg := &query.ODoHMessage{
+		MessageType:      query.ODOH_MESSAGE_TYPE_QUERY,
+		KeyId:            []byte{0x01, 0x02},
+		EncryptedMessage: []byte{0x03, 0x04, 0x05},
+	}
+
+	parsed, err := query.UnmarshalODoHMessage(msg.Marshal())
+
+	require.Nil(t, err)
+	assert.Equal(t, msg, parsed)
+
+	_, err = query.UnmarshalODoHMessage([]byte{0x01, 0x00})
+	assert.NotNil(t, err, "should fail on truncated message")
+}
+
+func TestODoHQuery_LocalTarget(t *testing.T) {
+	t.Parallel()
+
+	t.Run("direct", func(t *testing.T) {
+		t.Parallel()
+
+		target := newODoHTestTarget(t)
+		server := httptest.NewTLSServer(target)
+		defer server.Close()
+
+		q := newODoHTestQuery(t, server)
+
+		res, err := query.NewODoHQueryHandler(nil).Query(q)
+
+		require.Nil(t, err, "should not have returned an error")
+		require.NotNil(t, res.ResponseMsg, "should have returned a response")
+		require.Len(t, res.ResponseMsg.Answer, 1)
+		assert.Equal(t, "192.0.2.1", res.ResponseMsg.Answer[0].(*dns.A).A.String())
+		assert.Equal(t, target.config.KeyId, res.UsedKeyId)
+		assert.Len(t, res.Configs, 1)
+		assert.NotEmpty(t, res.RawConfigs)
+		assert.NotEmpty(t, res.TLSVersion)
+		assert.False(t, res.ViaProxy)
+		assert.True(t, target.queried)
+	})
+
+	t.Run("via proxy", func(t *testing.T) {
+		t.Parallel()
+
+		target := newODoHTestTarget(t)
+		server := httptest.NewTLSServer(target)
+		defer server.Close()
+
+		proxy, forwarded := newODoHTestProxy(t)
+		defer proxy.Close()
+
+		q := newODoHTestQuery(t, server)
+		q.Proxy = proxy.URL + odohTestProxyPath
+
+		res, err := query.NewODoHQueryHandler(nil).Query(q)
+
+		require.Nil(t, err, "should not have returned an error")
+		require.NotNil(t, res.ResponseMsg, "should have returned a response")
+		assert.Len(t, res.ResponseMsg.Answer, 1)
+		assert.True(t, res.ViaProxy)
+		assert.True(t, *forwarded, "proxy should have forwarded the query")
+		assert.True(t, target.queried)
+	})
+
+	t.Run("no configs", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+
+		q := newODoHTestQuery(t, server)
+
+		res, err := query.NewODoHQueryHandler(nil).Query(q)
+
+		assert.NotNil(t, err, "should have returned an error")
+		assert.NotNil(t, res, "response should not be nil")
+		assert.Nil(t, res.ResponseMsg)
+	})
+
+	t.Run("no supported config", func(t *testing.T) {
+		t.Parallel()
+
+		target := newODoHTestTarget(t)
+		target.configs = query.MarshalODoHConfigs([]*query.ODoHConfig{
+			{Version: query.ODOH_VERSION, KEMId: 0x0042, KDFId: 0x0001, AEADId: 0x0001, PublicKey: []byte{0x01}},
+		})
+		server := httptest.NewTLSServer(target)
+		defer server.Close()
+
+		q := newODoHTestQuery(t, server)
+
+		res, err := query.NewODoHQueryHandler(nil).Query(q)
+
+		assert.NotNil(t, err, "should have returned an error")
+		assert.Len(t, res.Configs, 1)
+		assert.False(t, target.queried, "should not have sent a query")
+	})
+
+	t.Run("certificate error", func(t *testing.T) {
+		t.Parallel()
+
+		target := newODoHTestTarget(t)
+		server := httptest.NewTLSServer(target)
+		defer server.Close()
+
+		q := newODoHTestQuery(t, server)
+		q.SkipCertificateVerify = false
+
+		res, err := query.NewODoHQueryHandler(nil).Query(q)
+
+		require.NotNil(t, err, "should have returned an error")
+		assert.True(t, err.IsCertificateError(), "should be a certificate error")
+		assert.True(t, res.CertificateVerified)
+		assert.False(t, res.CertificateValid)
+	})
+}
+
+func TestODoHQuery_Config(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+
+		res, err := query.NewODoHQueryHandler(nil).Query(nil)
+
+		assert.NotNil(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("nil handler", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewODoHQuery()
+		q.Host = "localhost"
+
+		res, err := (&query.ODoHQueryHandler{}).Query(q)
+
+		assert.NotNil(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("empty target path", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewODoHQuery()
+		q.Host = "localhost"
+		q.TargetPath = ""
+
+		_, err := query.NewODoHQueryHandler(nil).Query(q)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewODoHQuery()
+
+		assert.Equal(t, query.DEFAULT_ODOH_PORT, q.Port)
+		assert.Equal(t, query.DEFAULT_ODOH_TARGET_PATH, q.TargetPath)
+		assert.Equal(t, query.ODOH_CONFIG_PATH, q.ConfigPath)
+		assert.Equal(t, query.DEFAULT_ODOH_TIMEOUT, q.Timeout)
+		assert.NotNil(t, q.QueryMsg)
+	})
+}
@@ -0,0 +1,551 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/helper"
+	"github.com/steffsas/doe-hunter/lib/hpke"
+)
+
+// see https://www.rfc-editor.org/rfc/rfc9458.html and https://www.rfc-editor.org/rfc/rfc9540.html
+const OHTTP_KEYS_MEDIA_TYPE = "application/ohttp-keys"
+const OHTTP_REQUEST_MEDIA_TYPE = "message/ohttp-req"
+const OHTTP_RESPONSE_MEDIA_TYPE = "message/ohttp-res"
+const OHTTP_GATEWAY_PATH = "/.well-known/ohttp-gateway"
+
+const DEFAULT_OHTTP_TARGET_PATH = "/dns-query"
+const DEFAULT_OHTTP_PORT = 443
+const DEFAULT_OHTTP_TIMEOUT = 10000 * time.Millisecond
+
+var errOHTTPTruncated = errors.New("message is truncated")
+
+type OHTTPSymmetricAlgorithm struct {
+	KDFId  uint16 `json:"kdf_id"`
+	AEADId uint16 `json:"aead_id"`
+}
+
+// OHTTPKeyConfig is a single key configuration of an OHTTP gateway, see https://www.rfc-editor.org/rfc/rfc9458.html#section-3
+type OHTTPKeyConfig struct {
+	KeyId               uint8                     `json:"key_id"`
+	KEMId               uint16                    `json:"kem_id"`
+	PublicKey           []byte                    `json:"public_key"`
+	SymmetricAlgorithms []OHTTPSymmetricAlgorithm `json:"symmetric_algorithms"`
+	// Supported is true if we are able to use the KEM and at least one of the symmetric algorithms
+	Supported bool `json:"supported"`
+}
+
+// GetSupportedSuite returns the first HPKE suite of the key config we are able to use
+func (c *OHTTPKeyConfig) GetSupportedSuite() *hpke.Suite {
+	for _, alg := range c.SymmetricAlgorithms {
+		s := &hpke.Suite{
+			KEMId:  c.KEMId,
+			KDFId:  alg.KDFId,
+			AEADId: alg.AEADId,
+		}
+		if s.IsSupported() {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func (c *OHTTPKeyConfig) Marshal() []byte {
+	b := []byte{c.KeyId}
+	b = binary.BigEndian.AppendUint16(b, c.KEMId)
+	b = append(b, c.PublicKey...)
+	b = binary.BigEndian.AppendUint16(b, uint16(4*len(c.SymmetricAlgorithms)))
+	for _, alg := range c.SymmetricAlgorithms {
+		b = binary.BigEndian.AppendUint16(b, alg.KDFId)
+		b = binary.BigEndian.AppendUint16(b, alg.AEADId)
+	}
+
+	return b
+}
+
+// MarshalOHTTPKeyConfigs serializes the key configs as application/ohttp-keys
+func MarshalOHTTPKeyConfigs(configs []*OHTTPKeyConfig) []byte {
+	b := []byte{}
+	for _, c := range configs {
+		config := c.Marshal()
+		b = binary.BigEndian.AppendUint16(b, uint16(len(config)))
+		b = append(b, config...)
+	}
+
+	return b
+}
+
+// ParseOHTTPKeyConfigs parses application/ohttp-keys, see https://www.rfc-editor.org/rfc/rfc9458.html#section-3.2
+// some gateways still serve a single key config without length prefix, so we fall back to that format
+func ParseOHTTPKeyConfigs(b []byte) ([]*OHTTPKeyConfig, error) {
+	configs, err := parseOHTTPKeyConfigList(b)
+	if err == nil {
+		return configs, nil
+	}
+
+	config, rest, singleErr := parseOHTTPKeyConfig(b)
+	if singleErr == nil && len(rest) == 0 {
+		return []*OHTTPKeyConfig{config}, nil
+	}
+
+	return configs, err
+}
+
+func parseOHTTPKeyConfigList(b []byte) ([]*OHTTPKeyConfig, error) {
+	configs := []*OHTTPKeyConfig{}
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return configs, errOHTTPTruncated
+		}
+
+		l := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+l {
+			return configs, errOHTTPTruncated
+		}
+
+		config, rest, err := parseOHTTPKeyConfig(b[2 : 2+l])
+		if err != nil {
+			return configs, err
+		}
+
+		if len(rest) != 0 {
+			return configs, fmt.Errorf("got %d unexpected bytes after key config", len(rest))
+		}
+
+		configs = append(configs, config)
+		b = b[2+l:]
+	}
+
+	return configs, nil
+}
+
+func parseOHTTPKeyConfig(b []byte) (*OHTTPKeyConfig, []byte, error) {
+	if len(b) < 3 {
+		return nil, nil, errOHTTPTruncated
+	}
+
+	c := &OHTTPKeyConfig{
+		KeyId: b[0],
+		KEMId: binary.BigEndian.Uint16(b[1:]),
+	}
+
+	// the public key length depends on the KEM, i.e., we cannot parse configs with unknown KEMs
+	npk := (&hpke.Suite{KEMId: c.KEMId}).EncapsulatedKeySize()
+	if npk == 0 {
+		return nil, nil, fmt.Errorf("%w: %d", custom_errors.ErrUnsupportedKEM, c.KEMId)
+	}
+
+	b = b[3:]
+	if len(b) < npk+2 {
+		return nil, nil, errOHTTPTruncated
+	}
+
+	c.PublicKey = b[:npk]
+	b = b[npk:]
+
+	l := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < l || l%4 != 0 {
+		return nil, nil, errOHTTPTruncated
+	}
+
+	for i := 0; i < l; i += 4 {
+		c.SymmetricAlgorithms = append(c.SymmetricAlgorithms, OHTTPSymmetricAlgorithm{
+			KDFId:  binary.BigEndian.Uint16(b[i:]),
+			AEADId: binary.BigEndian.Uint16(b[i+2:]),
+		})
+	}
+
+	c.Supported = c.GetSupportedSuite() != nil
+
+	return c, b[l:], nil
+}
+
+// OHTTPContext holds the HPKE state of a single encapsulated request and its response
+type OHTTPContext struct {
+	suite   *hpke.Suite
+	enc     []byte
+	hpkeCtx *hpke.Context
+}
+
+func ohttpHeader(keyId uint8, suite *hpke.Suite) []byte {
+	hdr := []byte{keyId}
+	hdr = binary.BigEndian.AppendUint16(hdr, suite.KEMId)
+	hdr = binary.BigEndian.AppendUint16(hdr, suite.KDFId)
+	return binary.BigEndian.AppendUint16(hdr, suite.AEADId)
+}
+
+func ohttpRequestInfo(hdr []byte) []byte {
+	info := append([]byte("message/bhttp request"), 0x00)
+	return append(info, hdr...)
+}
+
+// EncapsulateOHTTPRequest encapsulates the binary HTTP request, see https://www.rfc-editor.org/rfc/rfc9458.html#section-4.3
+func EncapsulateOHTTPRequest(config *OHTTPKeyConfig, suite *hpke.Suite, request []byte) ([]byte, *OHTTPContext, error) {
+	hdr := ohttpHeader(config.KeyId, suite)
+
+	enc, ctx, err := suite.SetupBaseS(config.PublicKey, ohttpRequestInfo(hdr))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ct, err := ctx.Seal(nil, request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encRequest := append(hdr, enc...)
+	encRequest = append(encRequest, ct...)
+
+	return encRequest, &OHTTPContext{suite: suite, enc: enc, hpkeCtx: ctx}, nil
+}
+
+// DecapsulateOHTTPRequest decapsulates an encapsulated request, this is the gateway's part of the protocol
+func DecapsulateOHTTPRequest(config *OHTTPKeyConfig, sk *ecdh.PrivateKey, encRequest []byte) ([]byte, *OHTTPContext, error) {
+	if len(encRequest) < 7 {
+		return nil, nil, errOHTTPTruncated
+	}
+
+	if encRequest[0] != config.KeyId {
+		return nil, nil, fmt.Errorf("unknown key id %d", encRequest[0])
+	}
+
+	suite := &hpke.Suite{
+		KEMId:  binary.BigEndian.Uint16(encRequest[1:]),
+		KDFId:  binary.BigEndian.Uint16(encRequest[3:]),
+		AEADId: binary.BigEndian.Uint16(encRequest[5:]),
+	}
+
+	nenc := suite.EncapsulatedKeySize()
+	if len(encRequest) < 7+nenc {
+		return nil, nil, errOHTTPTruncated
+	}
+
+	enc := encRequest[7 : 7+nenc]
+
+	ctx, err := suite.SetupBaseR(enc, sk, ohttpRequestInfo(encRequest[:7]))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, err := ctx.Open(nil, encRequest[7+nenc:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return request, &OHTTPContext{suite: suite, enc: enc, hpkeCtx: ctx}, nil
+}
+
+func (c *OHTTPContext) responseAEAD(responseNonce []byte) (key []byte, nonce []byte, err error) {
+	secret, err := c.hpkeCtx.Export([]byte("message/bhttp response"), c.suite.KeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	salt := append(append([]byte{}, c.enc...), responseNonce...)
+
+	prk, err := c.suite.Extract(salt, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err = c.suite.Expand(prk, []byte("key"), c.suite.KeySize())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err = c.suite.Expand(prk, []byte("nonce"), c.suite.NonceSize())
+
+	return key, nonce, err
+}
+
+// EncapsulateResponse encapsulates the binary HTTP response, this is the gateway's part of the protocol
+func (c *OHTTPContext) EncapsulateResponse(response []byte) ([]byte, error) {
+	responseNonce := make([]byte, max(c.suite.KeySize(), c.suite.NonceSize()))
+	if _, err := rand.Read(responseNonce); err != nil {
+		return nil, err
+	}
+
+	key, nonce, err := c.responseAEAD(responseNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.suite.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(responseNonce, aead.Seal(nil, nonce, response, nil)...), nil
+}
+
+// DecapsulateResponse decapsulates the encapsulated response, see https://www.rfc-editor.org/rfc/rfc9458.html#section-4.4
+func (c *OHTTPContext) DecapsulateResponse(encResponse []byte) ([]byte, error) {
+	nonceSize := max(c.suite.KeySize(), c.suite.NonceSize())
+	if len(encResponse) < nonceSize {
+		return nil, errOHTTPTruncated
+	}
+
+	key, nonce, err := c.responseAEAD(encResponse[:nonceSize])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := c.suite.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, nonce, encResponse[nonceSize:], nil)
+}
+
+type OHTTPQuery struct {
+	DoEQuery
+
+	// GatewayPath is the path of the OHTTP gateway serving the key configs (default: /.well-known/ohttp-gateway)
+	GatewayPath string `json:"gateway_path"`
+
+	// TargetPath is the DoH path of the target resource within the encapsulated request (default: /dns-query)
+	TargetPath string `json:"target_path"`
+}
+
+type OHTTPResponse struct {
+	DoEResponse
+
+	// RawKeyConfigs are the key configs as served by the gateway
+	RawKeyConfigs []byte `json:"raw_key_configs"`
+	// KeyConfigContentType is the content type of the key config response, should be application/ohttp-keys
+	KeyConfigContentType string `json:"key_config_content_type"`
+	// KeyConfigs are the parsed key configs
+	KeyConfigs []*OHTTPKeyConfig `json:"key_configs"`
+	// UsedKeyId is the key ID of the config we used to encapsulate the request
+	UsedKeyId *uint8 `json:"used_key_id"`
+	// UsedSuite is the HPKE suite we used to encapsulate the request
+	UsedSuite *hpke.Suite `json:"used_suite"`
+	// GatewayStatusCode is the HTTP status code of the gateway on the encapsulated request
+	GatewayStatusCode int `json:"gateway_status_code"`
+	// GatewayContentType is the content type of the gateway's response, should be message/ohttp-res
+	GatewayContentType string `json:"gateway_content_type"`
+	// TargetStatusCode is the HTTP status code of the target resource within the encapsulated response
+	TargetStatusCode int `json:"target_status_code"`
+}
+
+type OHTTPQueryHandler struct {
+	// QueryHandler is an interface to execute HTTP requests
+	QueryHandler HttpRawQueryHandler
+}
+
+func (qh *OHTTPQueryHandler) Query(query *OHTTPQuery) (*OHTTPResponse, custom_errors.DoEErrors) {
+	res := &OHTTPResponse{}
+
+	res.CertificateValid = false
+	res.CertificateVerified = false
+
+	if query == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if err := query.Check(true); err != nil {
+		return res, err
+	}
+
+	if qh.QueryHandler == nil {
+		return res, custom_errors.NewGenericError(custom_errors.ErrQueryHandlerNil, true)
+	}
+
+	if query.GatewayPath == "" || query.TargetPath == "" {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrEmptyURIPath, true)
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: query.SkipCertificateVerify,
+		// let's support all TLS versions, including TLS 1.0 and TLS 1.1
+		// codeql [go/insecure-tls]: This is intentional
+		MinVersion: tls.VersionTLS10,
+		MaxVersion: tls.VersionTLS13,
+		// let's support all ciphers
+		CipherSuites: getAllTLSCipherSuites(),
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if query.SNI != "" {
+		tlsConfig.ServerName = query.SNI
+	}
+
+	gatewayURI, err := url.JoinPath(fmt.Sprintf("https://%s", helper.GetFullHostFromHostPort(query.Host, query.Port)), query.GatewayPath)
+	if err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrFailedToJoinURLPath, true).AddInfo(err)
+	}
+
+	// fetch the gateway's key configs first, see https://www.rfc-editor.org/rfc/rfc9540.html#section-3
+	configReq, err := http.NewRequestWithContext(context.Background(), HTTP_GET, gatewayURI, nil)
+	if err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrFailedFailedToCreateHTTPReq, true).AddInfo(err)
+	}
+	configReq.Header.Add("accept", OHTTP_KEYS_MEDIA_TYPE)
+
+	configRes, _, tlsConnState, queryErr := qh.QueryHandler.Query(configReq, query.Timeout, tlsConfig)
+
+	setTLSDetailsToResponse(tlsConnState, &res.DoEResponse)
+
+	if cErr := validateCertificateError(
+		queryErr,
+		custom_errors.NewQueryError(custom_errors.ErrOHTTPKeyConfigFetchFailed, true),
+		&res.DoEResponse,
+		query.SkipCertificateVerify,
+	); cErr != nil {
+		return res, cErr
+	}
+
+	if configRes.StatusCode != http.StatusOK {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPKeyConfigFetchFailed, true).
+			AddInfoString(fmt.Sprintf("status code %d", configRes.StatusCode))
+	}
+
+	res.RawKeyConfigs = configRes.Body
+	res.KeyConfigContentType = configRes.ContentType
+
+	var parseErr error
+	res.KeyConfigs, parseErr = ParseOHTTPKeyConfigs(configRes.Body)
+	if parseErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPKeyConfigParsingFailed, true).AddInfo(parseErr)
+	}
+
+	var config *OHTTPKeyConfig
+	var suite *hpke.Suite
+	for _, c := range res.KeyConfigs {
+		if suite = c.GetSupportedSuite(); suite != nil {
+			config = c
+			break
+		}
+	}
+
+	if config == nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPNoSupportedKeyConfig, true).
+			AddInfoString(fmt.Sprintf("got %d key configs", len(res.KeyConfigs)))
+	}
+
+	res.UsedKeyId = &config.KeyId
+	res.UsedSuite = suite
+
+	query.SetDNSSEC()
+	query.SetNSID()
+	query.SetCookie()
+
+	// Set DNS ID as zero according to RFC8484 (cache friendly)
+	query.QueryMsg.Id = 0
+
+	buf, packErr := query.QueryMsg.Pack()
+	if packErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrDNSPackFailed, true).AddInfo(packErr)
+	}
+
+	// the target resource is the DoH endpoint of the resolver, see https://www.rfc-editor.org/rfc/rfc9540.html#section-4
+	authority := query.SNI
+	if authority == "" {
+		authority = query.Host
+	}
+	if query.Port != DEFAULT_OHTTP_PORT {
+		authority = helper.GetFullHostFromHostPort(authority, query.Port)
+	}
+
+	innerReq := &BHTTPRequest{
+		Method:    HTTP_POST,
+		Scheme:    "https",
+		Authority: authority,
+		Path:      query.TargetPath,
+		Header: []BHTTPField{
+			{Name: "accept", Value: DOH_MEDIA_TYPE},
+			{Name: "content-type", Value: DOH_MEDIA_TYPE},
+		},
+		Content: buf,
+	}
+
+	encRequest, ohttpCtx, encErr := EncapsulateOHTTPRequest(config, suite, innerReq.Marshal())
+	if encErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPEncapsulationFailed, true).AddInfo(encErr)
+	}
+
+	httpReq, err := http.NewRequestWithContext(context.Background(), HTTP_POST, gatewayURI, bytes.NewReader(encRequest))
+	if err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrFailedFailedToCreateHTTPReq, true).AddInfo(err)
+	}
+	httpReq.Header.Add("content-type", OHTTP_REQUEST_MEDIA_TYPE)
+
+	ohttpRes, rtt, _, queryErr := qh.QueryHandler.Query(httpReq, query.Timeout, tlsConfig)
+	if queryErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPRequestFailed, true).AddInfo(queryErr)
+	}
+
+	res.GatewayStatusCode = ohttpRes.StatusCode
+	res.GatewayContentType = ohttpRes.ContentType
+
+	if ohttpRes.StatusCode != http.StatusOK {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPRequestFailed, true).
+			AddInfoString(fmt.Sprintf("status code %d: %s", ohttpRes.StatusCode, string(ohttpRes.Body)))
+	}
+
+	res.RTT = rtt
+
+	innerRes, decErr := ohttpCtx.DecapsulateResponse(ohttpRes.Body)
+	if decErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPDecapsulationFailed, true).AddInfo(decErr)
+	}
+
+	bhttpRes, bErr := UnmarshalBHTTPResponse(innerRes)
+	if bErr != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrBHTTPInvalidMessage, true).AddInfo(bErr)
+	}
+
+	res.TargetStatusCode = bhttpRes.StatusCode
+
+	if bhttpRes.StatusCode != http.StatusOK {
+		return res, custom_errors.NewQueryError(custom_errors.ErrOHTTPRequestFailed, true).
+			AddInfoString(fmt.Sprintf("target status code %d", bhttpRes.StatusCode))
+	}
+
+	r := &dns.Msg{}
+	if err := r.Unpack(bhttpRes.Content); err != nil {
+		return res, custom_errors.NewQueryError(custom_errors.ErrDNSUnpackFailed, true).AddInfo(err)
+	}
+
+	res.ResponseMsg = r
+	setEDNSInfoToResponse(&res.DNSResponse)
+
+	return res, nil
+}
+
+func NewOHTTPQuery() (q *OHTTPQuery) {
+	q = &OHTTPQuery{
+		GatewayPath: OHTTP_GATEWAY_PATH,
+		TargetPath:  DEFAULT_OHTTP_TARGET_PATH,
+	}
+
+	q.Timeout = DEFAULT_OHTTP_TIMEOUT
+	q.Port = DEFAULT_OHTTP_PORT
+
+	q.QueryMsg = GetDefaultQueryMsg()
+
+	// request the name server identifier by default
+	q.NSID = true
+
+	return
+}
+
+func NewOHTTPQueryHandler(config *QueryConfig) *OHTTPQueryHandler {
+	return &OHTTPQueryHandler{
+		QueryHandler: newDefaultHttpRawQueryHandler(config),
+	}
+}
@@ -0,0 +1,350 @@
+package query_test
+
+import (
+	"crypto/ecdh"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/hpke"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ohttpTestGateway is a minimal OHTTP gateway stand-in forwarding to a DoH target resource
+type ohttpTestGateway struct {
+	sk      *ecdh.PrivateKey
+	config  *query.OHTTPKeyConfig
+	configs []byte
+	// targetStatus is the status code of the inner response
+	targetStatus int
+	// request is the last decapsulated request
+	request *query.BHTTPRequest
+}
+
+func newOHTTPTestGateway(t *testing.T) *ohttpTestGateway {
+	t.Helper()
+
+	suite := &hpke.Suite{KEMId: hpke.KEM_X25519_HKDF_SHA256}
+
+	sk, err := suite.GenerateKeyPair()
+	require.Nil(t, err)
+
+	config := &query.OHTTPKeyConfig{
+		KeyId:     0x01,
+		KEMId:     hpke.KEM_X25519_HKDF_SHA256,
+		PublicKey: sk.PublicKey().Bytes(),
+		SymmetricAlgorithms: []query.OHTTPSymmetricAlgorithm{
+			// unknown AEAD should be skipped
+			{KDFId: hpke.KDF_HKDF_SHA256, AEADId: 0xffff},
+			{KDFId: hpke.KDF_HKDF_SHA256, AEADId: hpke.AEAD_AES_128_GCM},
+		},
+	}
+
+	return &ohttpTestGateway{
+		sk:           sk,
+		config:       config,
+		configs:      query.MarshalOHTTPKeyConfigs([]*query.OHTTPKeyConfig{config}),
+		targetStatus: http.StatusOK,
+	}
+}
+
+func (g *ohttpTestGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != query.OHTTP_GATEWAY_PATH {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("content-type", query.OHTTP_KEYS_MEDIA_TYPE)
+		_, _ = w.Write(g.configs)
+		return
+	}
+
+	encResponse, err := g.answer(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("content-type", query.OHTTP_RESPONSE_MEDIA_TYPE)
+	_, _ = w.Write(encResponse)
+}
+
+func (g *ohttpTestGateway) answer(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	request, ctx, err := query.DecapsulateOHTTPRequest(g.config, g.sk, body)
+	if err != nil {
+		return nil, err
+	}
+
+	g.request, err = query.UnmarshalBHTTPRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &dns.Msg{}
+	if err := q.Unpack(g.request.Content); err != nil {
+		return nil, err
+	}
+
+	a := &dns.Msg{}
+	a.SetReply(q)
+	a.Answer = append(a.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: q.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.0.2.1"),
+	})
+
+	dnsAnswer, err := a.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &query.BHTTPResponse{
+		StatusCode: g.targetStatus,
+		Header:     []query.BHTTPField{{Name: "content-type", Value: query.DOH_MEDIA_TYPE}},
+		Content:    dnsAnswer,
+	}
+
+	return ctx.EncapsulateResponse(response.Marshal())
+}
+
+func newOHTTPTestQuery(t *testing.T, gateway *httptest.Server) *query.OHTTPQuery {
+	t.Helper()
+
+	odohQuery := newODoHTestQuery(t, gateway)
+
+	q := query.NewOHTTPQuery()
+	q.Host = odohQuery.Host
+	q.Port = odohQuery.Port
+	q.SkipCertificateVerify = true
+	q.QueryMsg.SetQuestion("example.org.", dns.TypeA)
+
+	return q
+}
+
+func TestOHTTPKeyConfigs_MarshalParse(t *testing.T) {
+	t.Parallel()
+
+	t.Run("roundtrip", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := newOHTTPTestGateway(t)
+
+		configs, err := query.ParseOHTTPKeyConfigs(gateway.configs)
+
+		require.Nil(t, err, "should have parsed key configs")
+		require.Len(t, configs, 1)
+		assert.True(t, configs[0].Supported)
+		assert.Equal(t, uint8(0x01), configs[0].KeyId)
+		assert.Equal(t, gateway.config.PublicKey, configs[0].PublicKey)
+		assert.Len(t, configs[0].SymmetricAlgorithms, 2)
+		assert.Equal(t, hpke.AEAD_AES_128_GCM, configs[0].GetSupportedSuite().AEADId, "should have skipped unknown AEAD")
+	})
+
+	t.Run("single key config without length prefix", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := newOHTTPTestGateway(t)
+
+		configs, err := query.ParseOHTTPKeyConfigs(gateway.config.Marshal())
+
+		require.Nil(t, err, "should have parsed key config")
+		require.Len(t, configs, 1)
+		assert.True(t, configs[0].Supported)
+	})
+
+	t.Run("unsupported KEM", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := query.ParseOHTTPKeyConfigs([]byte{0x00, 0x03, 0x01, 0x00, 0x42})
+
+		assert.NotNil(t, err, "should not parse unknown KEM")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := newOHTTPTestGateway(t)
+
+		_, err := query.ParseOHTTPKeyConfigs(gateway.configs[:10])
+
+		assert.NotNil(t, err, "should fail on truncated key configs")
+	})
+}
+
+func TestBHTTP_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	t.Run("request", func(t *testing.T) {
+		t.Parallel()
+
+		req := &query.BHTTPRequest{
+			Method:    "POST",
+			Scheme:    "https",
+			Authority: "example.com",
+			Path:      "/dns-query",
+			Header:    []query.BHTTPField{{Name: "accept", Value: query.DOH_MEDIA_TYPE}},
+			Content:   []byte{0x01, 0x02},
+		}
+
+		parsed, err := query.UnmarshalBHTTPRequest(req.Marshal())
+
+		require.Nil(t, err)
+		assert.Equal(t, req, parsed)
+	})
+
+	t.Run("response with informational response", func(t *testing.T) {
+		t.Parallel()
+
+		// framing 1, status 103 with empty fields, status 200, one header field, content, empty trailer
+		raw := []byte{0x01, 0x40, 0x67, 0x00, 0x40, 0xc8, 0x04, 0x01, 0x61, 0x01, 0x62, 0x01, 0xff, 0x00}
+
+		res, err := query.UnmarshalBHTTPResponse(raw)
+
+		require.Nil(t, err)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "b", res.GetHeader("a"))
+		assert.Equal(t, []byte{0xff}, res.Content)
+	})
+
+	t.Run("wrong framing", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := query.UnmarshalBHTTPResponse([]byte{0x00})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestOHTTPQuery_LocalGateway(t *testing.T) {
+	t.Parallel()
+
+	t.Run("encapsulated DNS request", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := newOHTTPTestGateway(t)
+		server := httptest.NewTLSServer(gateway)
+		defer server.Close()
+
+		q := newOHTTPTestQuery(t, server)
+		q.SNI = "dns.example.com"
+
+		res, err := query.NewOHTTPQueryHandler(nil).Query(q)
+
+		require.Nil(t, err, "should not have returned an error")
+		require.NotNil(t, res.ResponseMsg, "should have returned a response")
+		require.Len(t, res.ResponseMsg.Answer, 1)
+		assert.Equal(t, "192.0.2.1", res.ResponseMsg.Answer[0].(*dns.A).A.String())
+		assert.Equal(t, query.OHTTP_KEYS_MEDIA_TYPE, res.KeyConfigContentType)
+		assert.Equal(t, query.OHTTP_RESPONSE_MEDIA_TYPE, res.GatewayContentType)
+		assert.Equal(t, http.StatusOK, res.GatewayStatusCode)
+		assert.Equal(t, http.StatusOK, res.TargetStatusCode)
+		require.NotNil(t, res.UsedKeyId)
+		assert.Equal(t, uint8(0x01), *res.UsedKeyId)
+		assert.Equal(t, hpke.AEAD_AES_128_GCM, res.UsedSuite.AEADId)
+
+		require.NotNil(t, gateway.request, "gateway should have received a request")
+		assert.Equal(t, "/dns-query", gateway.request.Path)
+		assert.Contains(t, gateway.request.Authority, "dns.example.com")
+	})
+
+	t.Run("target error", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := newOHTTPTestGateway(t)
+		gateway.targetStatus = http.StatusBadGateway
+		server := httptest.NewTLSServer(gateway)
+		defer server.Close()
+
+		res, err := query.NewOHTTPQueryHandler(nil).Query(newOHTTPTestQuery(t, server))
+
+		assert.NotNil(t, err, "should have returned an error")
+		assert.Equal(t, http.StatusOK, res.GatewayStatusCode)
+		assert.Equal(t, http.StatusBadGateway, res.TargetStatusCode)
+		assert.Nil(t, res.ResponseMsg)
+	})
+
+	t.Run("no gateway", func(t *testing.T) {
+		t.Parallel()
+
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+
+		res, err := query.NewOHTTPQueryHandler(nil).Query(newOHTTPTestQuery(t, server))
+
+		assert.NotNil(t, err, "should have returned an error")
+		assert.Nil(t, res.KeyConfigs)
+	})
+
+	t.Run("no supported key config", func(t *testing.T) {
+		t.Parallel()
+
+		gateway := newOHTTPTestGateway(t)
+		gateway.config.SymmetricAlgorithms = []query.OHTTPSymmetricAlgorithm{{KDFId: 0xffff, AEADId: 0xffff}}
+		gateway.configs = query.MarshalOHTTPKeyConfigs([]*query.OHTTPKeyConfig{gateway.config})
+		server := httptest.NewTLSServer(gateway)
+		defer server.Close()
+
+		res, err := query.NewOHTTPQueryHandler(nil).Query(newOHTTPTestQuery(t, server))
+
+		assert.NotNil(t, err, "should have returned an error")
+		assert.Len(t, res.KeyConfigs, 1)
+		assert.Nil(t, gateway.request, "should not have sent a request")
+	})
+}
+
+func TestOHTTPQuery_Config(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+
+		res, err := query.NewOHTTPQueryHandler(nil).Query(nil)
+
+		assert.NotNil(t, err)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("nil handler", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewOHTTPQuery()
+		q.Host = "localhost"
+
+		_, err := (&query.OHTTPQueryHandler{}).Query(q)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("empty gateway path", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewOHTTPQuery()
+		q.Host = "localhost"
+		q.GatewayPath = ""
+
+		_, err := query.NewOHTTPQueryHandler(nil).Query(q)
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewOHTTPQuery()
+
+		assert.Equal(t, query.DEFAULT_OHTTP_PORT, q.Port)
+		assert.Equal(t, query.OHTTP_GATEWAY_PATH, q.GatewayPath)
+		assert.Equal(t, query.DEFAULT_OHTTP_TARGET_PATH, q.TargetPath)
+		assert.NotNil(t, q.QueryMsg)
+	})
+}
@@ -0,0 +1,69 @@
+package query
+
+import (
+	"github.com/miekg/dns"
+)
+
+// block length queries are padded to by default, see https://www.rfc-editor.org/rfc/rfc8467.html#section-4.1
+const DEFAULT_PADDING_BLOCK_LENGTH = 128
+
+// block length resolvers should pad their responses to, see https://www.rfc-editor.org/rfc/rfc8467.html#section-4.1
+const RESPONSE_PADDING_BLOCK_LENGTH = 468
+
+// SetPadding pads the query message to a multiple of the block length using the EDNS(0) padding option, see RFC 7830
+// Do not use this function before marshaling the query but before sending it as a DNS query
+func (q *DoEQuery) SetPadding() {
+	if q.PaddingBlockLength <= 0 {
+		return
+	}
+
+	if q.QueryMsg == nil {
+		q.QueryMsg = new(dns.Msg)
+	}
+
+	opt := q.QueryMsg.IsEdns0()
+	if opt == nil {
+		q.QueryMsg.SetEdns0(1232, false)
+		opt = q.QueryMsg.IsEdns0()
+	}
+
+	// drop the padding of a previous attempt
+	options := []dns.EDNS0{}
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_PADDING); !ok {
+			options = append(options, o)
+		}
+	}
+
+	// the empty option already accounts for the option header
+	padding := &dns.EDNS0_PADDING{}
+	opt.Option = append(options, padding)
+
+	if remainder := q.QueryMsg.Len() % q.PaddingBlockLength; remainder != 0 {
+		padding.Padding = make([]byte, q.PaddingBlockLength-remainder)
+	}
+}
+
+// setPaddingToResponse records the EDNS(0) padding of the response
+// size is the length of the message as received, re-packing the unpacked message may change its size
+func setPaddingToResponse(res *DoEResponse, size int) {
+	if res.ResponseMsg == nil {
+		return
+	}
+
+	res.ResponseSize = size
+
+	opt := res.ResponseMsg.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	for _, o := range opt.Option {
+		if padding, ok := o.(*dns.EDNS0_PADDING); ok {
+			res.ResponsePadded = true
+			res.ResponsePaddingLength = len(padding.Padding)
+		}
+	}
+
+	res.ResponseBlockPadded = res.ResponsePadded && res.ResponseSize%RESPONSE_PADDING_BLOCK_LENGTH == 0
+}
@@ -0,0 +1,211 @@
+package query_test
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPaddedResponse packs the answer to the query padded to the block length, 0 disables padding
+func newTestPaddedResponse(t *testing.T, r *dns.Msg, blockLength int, compress bool) []byte {
+	t.Helper()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Compress = compress
+	// repeat the name, so the answer shrinks if compressed
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP(ip),
+		})
+	}
+	m.SetEdns0(1232, false)
+	if blockLength > 0 {
+		padding := &dns.EDNS0_PADDING{}
+		m.IsEdns0().Option = append(m.IsEdns0().Option, padding)
+		padding.Padding = make([]byte, blockLength-m.Len()%blockLength)
+	}
+
+	packed, err := m.Pack()
+	require.NoError(t, err)
+
+	return packed
+}
+
+// startTestPaddingDoTServer starts a local DoT server padding its responses to the block length, 0 disables padding
+func startTestPaddingDoTServer(t *testing.T, blockLength int, compress bool) (addr string, querySizes chan int) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+	})
+	require.NoError(t, err)
+
+	querySizes = make(chan int, 1)
+
+	server := &dns.Server{
+		Listener: listener,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			querySizes <- r.Len()
+			_, _ = w.Write(newTestPaddedResponse(t, r, blockLength, compress))
+		}),
+	}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return listener.Addr().String(), querySizes
+}
+
+func TestDoEQuery_SetPadding(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pad to block length", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.SetDNSSEC()
+		q.SetPadding()
+
+		packed, err := q.QueryMsg.Pack()
+		require.NoError(t, err)
+		assert.Equal(t, query.DEFAULT_PADDING_BLOCK_LENGTH, len(packed))
+		assert.True(t, q.QueryMsg.IsEdns0().Do(), "should keep the DNSSEC flag")
+	})
+
+	t.Run("add OPT record", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.PaddingBlockLength = 64
+		q.SetPadding()
+
+		require.NotNil(t, q.QueryMsg.IsEdns0())
+		assert.Equal(t, 0, q.QueryMsg.Len()%64)
+	})
+
+	t.Run("replace previous padding", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.SetPadding()
+		q.SetPadding()
+
+		assert.Len(t, q.QueryMsg.IsEdns0().Option, 1)
+		assert.Equal(t, query.DEFAULT_PADDING_BLOCK_LENGTH, q.QueryMsg.Len())
+	})
+
+	t.Run("padding disabled", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.PaddingBlockLength = 0
+		q.SetPadding()
+
+		assert.Nil(t, q.QueryMsg.IsEdns0())
+	})
+}
+
+func TestDoTQuery_Padding(t *testing.T) {
+	t.Parallel()
+
+	t.Run("block padded response", func(t *testing.T) {
+		t.Parallel()
+
+		addr, querySizes := startTestPaddingDoTServer(t, query.RESPONSE_PADDING_BLOCK_LENGTH, true)
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(newLocalDoTQuery(t, addr))
+
+		require.Nil(t, err)
+		assert.Equal(t, query.DEFAULT_PADDING_BLOCK_LENGTH, <-querySizes)
+		assert.Equal(t, query.RESPONSE_PADDING_BLOCK_LENGTH, res.ResponseSize)
+		assert.True(t, res.ResponsePadded)
+		assert.Positive(t, res.ResponsePaddingLength)
+		assert.True(t, res.ResponseBlockPadded)
+		require.NotNil(t, res.EDNS)
+		assert.Empty(t, res.EDNS.UnknownOptions, "should not record the padding as unknown option")
+	})
+
+	t.Run("uncompressed block padded response", func(t *testing.T) {
+		t.Parallel()
+
+		addr, _ := startTestPaddingDoTServer(t, query.RESPONSE_PADDING_BLOCK_LENGTH, false)
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(newLocalDoTQuery(t, addr))
+
+		require.Nil(t, err)
+		assert.Equal(t, query.RESPONSE_PADDING_BLOCK_LENGTH, res.ResponseSize, "should record the size on the wire")
+		assert.True(t, res.ResponseBlockPadded)
+	})
+
+	t.Run("other block length", func(t *testing.T) {
+		t.Parallel()
+
+		addr, _ := startTestPaddingDoTServer(t, 128, true)
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(newLocalDoTQuery(t, addr))
+
+		require.Nil(t, err)
+		assert.Equal(t, 128, res.ResponseSize)
+		assert.True(t, res.ResponsePadded)
+		assert.False(t, res.ResponseBlockPadded)
+	})
+
+	t.Run("unpadded response", func(t *testing.T) {
+		t.Parallel()
+
+		addr, querySizes := startTestPaddingDoTServer(t, 0, true)
+
+		q := newLocalDoTQuery(t, addr)
+		q.PaddingBlockLength = 0
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(q)
+
+		require.Nil(t, err)
+		assert.NotEqual(t, query.DEFAULT_PADDING_BLOCK_LENGTH, <-querySizes)
+		assert.Positive(t, res.ResponseSize)
+		assert.False(t, res.ResponsePadded)
+		assert.False(t, res.ResponseBlockPadded)
+	})
+}
+
+func TestDoHQuery_Padding(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		require.NoError(t, err)
+
+		msg := new(dns.Msg)
+		require.NoError(t, msg.Unpack(b))
+
+		w.Header().Set("content-type", query.DOH_MEDIA_TYPE)
+		_, _ = w.Write(newTestPaddedResponse(t, msg, query.RESPONSE_PADDING_BLOCK_LENGTH, false))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	qh, err := query.NewDoHQueryHandler(nil)
+	require.NoError(t, err)
+
+	res, qErr := qh.Query(newLocalDoHQuery(t, server.Listener.Addr().String()))
+
+	require.Nil(t, qErr)
+	assert.Equal(t, query.RESPONSE_PADDING_BLOCK_LENGTH, res.ResponseSize, "should record the size on the wire")
+	assert.True(t, res.ResponsePadded)
+	assert.True(t, res.ResponseBlockPadded)
+}
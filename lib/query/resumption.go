@@ -0,0 +1,310 @@
+package query
+
+import (
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const DEFAULT_RESUMPTION_TIMEOUT time.Duration = 5000 * time.Millisecond
+
+// outcome of the 0-RTT attempt with the resumed session
+const EARLY_DATA_ACCEPTED = "accepted"
+const EARLY_DATA_REJECTED = "rejected"
+const EARLY_DATA_FAILED = "failed"
+
+// the session ticket does not permit 0-RTT
+const EARLY_DATA_NOT_OFFERED = "not_offered"
+
+// crypto/tls does not send early data over TCP
+const EARLY_DATA_UNSUPPORTED = "unsupported"
+
+type ResumptionQuery struct {
+	DoEQuery
+
+	// Protocol is one of dot, doh or doq
+	Protocol string `json:"protocol"`
+	// URI is the URI template for DoH (default: /dns-query{?dns})
+	URI string `json:"uri"`
+	// HTTPVersion for DoH (default: HTTP2)
+	HTTPVersion string `json:"http_version"`
+	// EarlyData attempts 0-RTT with the resumed session over QUIC, i.e. DoQ and DoH over HTTP/3 (default: true)
+	EarlyData bool `json:"early_data"`
+}
+
+type ResumptionResponse struct {
+	// Initial holds the TLS details and the answer of the full handshake
+	Initial *DoEResponse `json:"initial"`
+	// Resumed holds the TLS details and the answer of the handshake offering the session ticket
+	Resumed *DoEResponse `json:"resumed"`
+	// EarlyData holds the TLS details and the answer of the query sent as 0-RTT data
+	EarlyData *DoEResponse `json:"early_data"`
+
+	// TicketIssued is set if the server issued a session ticket on the full handshake
+	TicketIssued bool `json:"ticket_issued"`
+	// TicketLifetime is the lifetime the server assigned to the ticket, TLS 1.3 only
+	TicketLifetime time.Duration `json:"ticket_lifetime"`
+	// TicketEarlyData is set if the ticket permits 0-RTT, QUIC only
+	TicketEarlyData bool `json:"ticket_early_data"`
+
+	// ResumptionAccepted is set if the server resumed the session instead of a full handshake
+	ResumptionAccepted bool   `json:"resumption_accepted"`
+	ResumptionError    string `json:"resumption_error"`
+
+	// EarlyDataStatus is the outcome of the 0-RTT attempt (accepted, rejected, failed, not_offered or unsupported), empty if not attempted
+	EarlyDataStatus string `json:"early_data_status"`
+	EarlyDataError  string `json:"early_data_error"`
+}
+
+type ResumptionQueryHandler struct {
+	DoT SessionDialer
+	DoH SessionDialer
+	DoQ SessionDialer
+}
+
+func (qh *ResumptionQueryHandler) Query(q *ResumptionQuery) (*ResumptionResponse, custom_errors.DoEErrors) {
+	res := &ResumptionResponse{}
+
+	if q == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	sq := newSessionQueryFromResumptionQuery(q)
+	if err := sq.Check(); err != nil {
+		return res, err
+	}
+
+	dialer := qh.getDialer(q.Protocol)
+	if dialer == nil {
+		return res, custom_errors.NewGenericError(custom_errors.ErrQueryHandlerNil, true).AddInfoString(q.Protocol)
+	}
+
+	sq.SetDNSSEC()
+	sq.SetNSID()
+	sq.SetCookie()
+
+	cache := newSessionTicketRecorder()
+
+	// full handshake, the server issues its session tickets
+	var err error
+	res.Initial, _, err = resumptionHandshake(dialer, sq, cache)
+	if err != nil {
+		return res, validateCertificateError(err, custom_errors.NewQueryError(custom_errors.ErrSessionFailed, true), res.Initial, q.SkipCertificateVerify)
+	}
+
+	res.TicketIssued, res.TicketLifetime, res.TicketEarlyData = cache.get()
+	if !res.TicketIssued {
+		return res, nil
+	}
+
+	// the session cache offers the ticket on the next handshake
+	res.Resumed, _, err = resumptionHandshake(dialer, sq, cache)
+	if err != nil {
+		res.ResumptionError = err.Error()
+		return res, custom_errors.NewQueryError(custom_errors.ErrResumptionFailed, false).AddInfo(err)
+	}
+	res.ResumptionAccepted = res.Resumed.TLSResumed
+
+	if !q.EarlyData {
+		return res, nil
+	}
+
+	if q.Protocol != TRANSPORT_DOQ && (q.Protocol != TRANSPORT_DOH || q.HTTPVersion != HTTP_VERSION_3) {
+		res.EarlyDataStatus = EARLY_DATA_UNSUPPORTED
+		return res, nil
+	}
+
+	// the resumed handshake issued a fresh ticket
+	if _, _, ticketEarlyData := cache.get(); !ticketEarlyData {
+		res.EarlyDataStatus = EARLY_DATA_NOT_OFFERED
+		return res, nil
+	}
+
+	earlyQuery := *sq
+	earlyQuery.EarlyData = true
+
+	var used0RTT bool
+	res.EarlyData, used0RTT, err = resumptionHandshake(dialer, &earlyQuery, cache)
+	switch {
+	case errors.Is(err, quic.Err0RTTRejected):
+		res.EarlyDataStatus = EARLY_DATA_REJECTED
+	case err != nil:
+		res.EarlyDataStatus = EARLY_DATA_FAILED
+		res.EarlyDataError = err.Error()
+	case used0RTT:
+		res.EarlyDataStatus = EARLY_DATA_ACCEPTED
+	default:
+		res.EarlyDataStatus = EARLY_DATA_REJECTED
+	}
+
+	return res, nil
+}
+
+func (qh *ResumptionQueryHandler) getDialer(protocol string) SessionDialer {
+	switch protocol {
+	case TRANSPORT_DOT:
+		return qh.DoT
+	case TRANSPORT_DOH:
+		return qh.DoH
+	case TRANSPORT_DOQ:
+		return qh.DoQ
+	default:
+		return nil
+	}
+}
+
+// resumptionHandshake exchanges a single message over a fresh connection using the session cache
+func resumptionHandshake(dialer SessionDialer, q *SessionQuery, cache tls.ClientSessionCache) (*DoEResponse, bool, error) {
+	res := &DoEResponse{}
+
+	tlsConfig := newSessionTLSConfig(q)
+	tlsConfig.ClientSessionCache = cache
+
+	conn, err := dialer.Dial(q, tlsConfig)
+	if err != nil {
+		return res, false, err
+	}
+	defer conn.Close()
+
+	// reading the answer also processes the tickets sent after the TLS 1.3 handshake
+	res.ResponseMsg, res.RTT, err = conn.Exchange(q.QueryMsg.Copy())
+	setEDNSInfoToResponse(&res.DNSResponse)
+	setTLSDetailsToResponse(conn.ConnectionState(), res)
+	setCertificateValidationToResponse(err, res, q.SkipCertificateVerify)
+
+	used0RTT := false
+	if earlyConn, ok := conn.(EarlyDataConn); ok && q.EarlyData && err == nil {
+		used0RTT = earlyConn.Used0RTT()
+	}
+
+	return res, used0RTT, err
+}
+
+func newSessionQueryFromResumptionQuery(q *ResumptionQuery) *SessionQuery {
+	sq := &SessionQuery{
+		DoEQuery:    q.DoEQuery,
+		Protocol:    q.Protocol,
+		URI:         q.URI,
+		HTTPVersion: q.HTTPVersion,
+		Queries:     1,
+	}
+
+	if q.QueryMsg != nil {
+		sq.QueryMsg = q.QueryMsg.Copy()
+	}
+
+	return sq
+}
+
+// sessionTicketRecorder is a session cache that records the last ticket issued by the server
+type sessionTicketRecorder struct {
+	tls.ClientSessionCache
+
+	mu        sync.Mutex
+	issued    bool
+	lifetime  time.Duration
+	earlyData bool
+}
+
+func (r *sessionTicketRecorder) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs != nil {
+		r.mu.Lock()
+		r.issued = true
+		r.lifetime = 0
+		r.earlyData = false
+		if _, state, err := cs.ResumptionState(); err == nil && state != nil {
+			r.lifetime = getTicketLifetime(state)
+			r.earlyData = state.EarlyData
+		}
+		r.mu.Unlock()
+	}
+
+	r.ClientSessionCache.Put(sessionKey, cs)
+}
+
+func (r *sessionTicketRecorder) get() (issued bool, lifetime time.Duration, earlyData bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.issued, r.lifetime, r.earlyData
+}
+
+func newSessionTicketRecorder() *sessionTicketRecorder {
+	return &sessionTicketRecorder{
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+}
+
+// getTicketLifetime returns the lifetime of a TLS 1.3 ticket, crypto/tls only exposes it in the encoded session state
+// see the SessionState encoding in crypto/tls/ticket.go
+func getTicketLifetime(state *tls.SessionState) time.Duration {
+	b, err := state.Bytes()
+	if err != nil {
+		return 0
+	}
+
+	s := cryptobyte.String(b)
+
+	var version, cipherSuite uint16
+	var sessionType, extMasterSecret, earlyData uint8
+	var createdAt, useBy uint64
+	var secret, extra, certificates, verifiedChains, alpn cryptobyte.String
+
+	if !s.ReadUint16(&version) || !s.ReadUint8(&sessionType) || !s.ReadUint16(&cipherSuite) ||
+		!s.ReadUint64(&createdAt) || !s.ReadUint8LengthPrefixed(&secret) || !s.ReadUint24LengthPrefixed(&extra) ||
+		!s.ReadUint8(&extMasterSecret) || !s.ReadUint8(&earlyData) ||
+		!s.ReadUint24LengthPrefixed(&certificates) || !s.ReadUint24LengthPrefixed(&verifiedChains) {
+		return 0
+	}
+
+	if earlyData == 1 && !s.ReadUint8LengthPrefixed(&alpn) {
+		return 0
+	}
+
+	// client sessions only
+	if version != tls.VersionTLS13 || sessionType != 2 || !s.ReadUint64(&useBy) || useBy < createdAt {
+		return 0
+	}
+
+	return time.Duration(useBy-createdAt) * time.Second
+}
+
+func NewResumptionQuery() (q *ResumptionQuery) {
+	q = &ResumptionQuery{
+		Protocol:    TRANSPORT_DOT,
+		URI:         DEFAULT_DOH_PATH,
+		HTTPVersion: HTTP_VERSION_2,
+		EarlyData:   true,
+	}
+
+	q.Port = DEFAULT_DOT_PORT
+	q.Timeout = DEFAULT_RESUMPTION_TIMEOUT
+
+	q.QueryMsg = GetDefaultQueryMsg()
+
+	// set DNSSEC flag by default
+	q.DNSSEC = true
+
+	// request the name server identifier by default
+	q.NSID = true
+
+	return
+}
+
+func NewResumptionQueryHandler(config *QueryConfig) (*ResumptionQueryHandler, error) {
+	sqh, err := NewSessionQueryHandler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResumptionQueryHandler{
+		DoT: sqh.DoT,
+		DoH: sqh.DoH,
+		DoQ: sqh.DoQ,
+	}, nil
+}
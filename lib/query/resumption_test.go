@@ -0,0 +1,200 @@
+package query_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newLocalResumptionQuery(t *testing.T, protocol string, addr string) *query.ResumptionQuery {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	q := query.NewResumptionQuery()
+	q.Protocol = protocol
+	q.Host = host
+	q.Port, err = net.LookupPort("tcp", port)
+	require.NoError(t, err)
+	q.SkipCertificateVerify = true
+	q.Timeout = 2 * time.Second
+
+	return q
+}
+
+func TestResumptionQueryHandler_Query(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewResumptionQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(nil)
+
+		require.NotNil(t, qErr)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("invalid protocol", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewResumptionQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := query.NewResumptionQuery()
+		q.Host = "localhost"
+		q.Protocol = "do53"
+
+		_, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.Contains(t, qErr.Error(), custom_errors.ErrInvalidProtocol.Error())
+	})
+
+	t.Run("nil dialer", func(t *testing.T) {
+		t.Parallel()
+
+		qh := &query.ResumptionQueryHandler{}
+		q := query.NewResumptionQuery()
+		q.Host = "localhost"
+
+		_, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.Contains(t, qErr.Error(), custom_errors.ErrQueryHandlerNil.Error())
+	})
+
+	t.Run("dial error", func(t *testing.T) {
+		t.Parallel()
+
+		dialer := &mockedSessionDialer{}
+		dialer.On("Dial", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused"))
+
+		qh := &query.ResumptionQueryHandler{DoT: dialer}
+		q := query.NewResumptionQuery()
+		q.Host = "localhost"
+
+		res, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.True(t, qErr.IsCritical())
+		assert.Contains(t, qErr.Error(), custom_errors.ErrSessionFailed.Error())
+		assert.False(t, res.TicketIssued)
+		assert.Nil(t, res.Resumed)
+	})
+
+	t.Run("no session ticket", func(t *testing.T) {
+		t.Parallel()
+
+		dialer := &mockedSessionDialer{}
+		dialer.On("Dial", mock.Anything, mock.Anything).Return(&reversingSessionConn{}, nil)
+
+		qh := &query.ResumptionQueryHandler{DoT: dialer}
+		q := query.NewResumptionQuery()
+		q.Host = "localhost"
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		assert.NotNil(t, res.Initial.ResponseMsg)
+		assert.False(t, res.TicketIssued)
+		assert.Nil(t, res.Resumed)
+		assert.Empty(t, res.EarlyDataStatus)
+		dialer.AssertNumberOfCalls(t, "Dial", 1)
+	})
+}
+
+func TestResumptionQueryHandler_DoT(t *testing.T) {
+	t.Parallel()
+
+	addr := startTestSessionDoTServer(t, 0, 0)
+
+	qh, err := query.NewResumptionQueryHandler(nil)
+	require.NoError(t, err)
+
+	res, qErr := qh.Query(newLocalResumptionQuery(t, query.TRANSPORT_DOT, addr))
+
+	require.Nil(t, qErr)
+	assert.False(t, res.Initial.TLSResumed)
+	assert.True(t, res.TicketIssued)
+	// crypto/tls issues tickets valid for 7 days
+	assert.Equal(t, 7*24*time.Hour, res.TicketLifetime)
+	assert.False(t, res.TicketEarlyData)
+	require.NotNil(t, res.Resumed)
+	assert.NotNil(t, res.Resumed.ResponseMsg)
+	assert.True(t, res.ResumptionAccepted)
+	assert.Equal(t, query.EARLY_DATA_UNSUPPORTED, res.EarlyDataStatus)
+	assert.Nil(t, res.EarlyData)
+}
+
+func TestResumptionQueryHandler_DoQ(t *testing.T) {
+	t.Parallel()
+
+	t.Run("0-RTT accepted", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoQServer(t, &quic.Config{Allow0RTT: true})
+
+		qh, err := query.NewResumptionQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalResumptionQuery(t, query.TRANSPORT_DOQ, addr))
+
+		require.Nil(t, qErr)
+		assert.True(t, res.TicketIssued)
+		assert.True(t, res.TicketEarlyData)
+		assert.True(t, res.ResumptionAccepted)
+		assert.Equal(t, query.EARLY_DATA_ACCEPTED, res.EarlyDataStatus)
+		require.NotNil(t, res.EarlyData)
+		assert.NotNil(t, res.EarlyData.ResponseMsg)
+		assert.True(t, res.EarlyData.TLSResumed)
+	})
+
+	t.Run("0-RTT not offered", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoQServer(t, nil)
+
+		qh, err := query.NewResumptionQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalResumptionQuery(t, query.TRANSPORT_DOQ, addr))
+
+		require.Nil(t, qErr)
+		assert.True(t, res.TicketIssued)
+		assert.False(t, res.TicketEarlyData)
+		assert.True(t, res.ResumptionAccepted)
+		assert.Equal(t, query.EARLY_DATA_NOT_OFFERED, res.EarlyDataStatus)
+		assert.Nil(t, res.EarlyData)
+	})
+
+	t.Run("early data disabled", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoQServer(t, &quic.Config{Allow0RTT: true})
+
+		qh, err := query.NewResumptionQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := newLocalResumptionQuery(t, query.TRANSPORT_DOQ, addr)
+		q.EarlyData = false
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		assert.True(t, res.ResumptionAccepted)
+		assert.Empty(t, res.EarlyDataStatus)
+		assert.Nil(t, res.EarlyData)
+	})
+}
@@ -0,0 +1,923 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/helper"
+)
+
+const DEFAULT_SESSION_QUERIES = 10
+
+// MAX_SESSION_QUERIES limits the load a single session scan puts on a resolver
+const MAX_SESSION_QUERIES = 100
+
+const DEFAULT_SESSION_TIMEOUT time.Duration = 5000 * time.Millisecond
+
+// nolint: gochecknoglobals
+var DEFAULT_SESSION_IDLE_PROBES = []time.Duration{
+	1 * time.Second,
+	5 * time.Second,
+	15 * time.Second,
+}
+
+type SessionQuery struct {
+	DoEQuery
+
+	// Protocol is one of dot, doh or doq
+	Protocol string `json:"protocol"`
+	// URI is the URI template for DoH (default: /dns-query{?dns})
+	URI string `json:"uri"`
+	// HTTPVersion for DoH (default: HTTP2)
+	HTTPVersion string `json:"http_version"`
+	// Queries is the number of queries sent one after another and pipelined over a single connection (default: 10)
+	Queries int `json:"queries"`
+	// IdleProbes are the idle times after which the connection is used again, in ascending order
+	IdleProbes []time.Duration `json:"idle_probes"`
+	// EarlyData sends the first query of a resumed QUIC connection as 0-RTT data (DoQ and DoH over HTTP/3)
+	EarlyData bool `json:"early_data"`
+}
+
+func (q *SessionQuery) Check() (err custom_errors.DoEErrors) {
+	if err = q.DNSQuery.Check(true); err != nil {
+		return err
+	}
+
+	switch q.Protocol {
+	case TRANSPORT_DOT, TRANSPORT_DOQ:
+	case TRANSPORT_DOH:
+		if q.URI == "" {
+			return custom_errors.NewQueryConfigError(custom_errors.ErrEmptyURIPath, true)
+		}
+
+		if q.HTTPVersion != HTTP_VERSION_1 && q.HTTPVersion != HTTP_VERSION_2 && q.HTTPVersion != HTTP_VERSION_3 {
+			return custom_errors.NewQueryConfigError(custom_errors.ErrInvalidHttpVersion, true)
+		}
+	default:
+		return custom_errors.NewQueryConfigError(custom_errors.ErrInvalidProtocol, true).AddInfoString(q.Protocol)
+	}
+
+	if q.Queries <= 0 || q.Queries > MAX_SESSION_QUERIES {
+		return custom_errors.NewQueryConfigError(custom_errors.ErrInvalidSessionQueries, true).AddInfoString(fmt.Sprintf("queries: %d", q.Queries))
+	}
+
+	for _, idle := range q.IdleProbes {
+		if idle < 0 {
+			return custom_errors.NewQueryConfigError(custom_errors.ErrInvalidTimeout, true).AddInfoString("negative idle probe")
+		}
+	}
+
+	return nil
+}
+
+type SessionExchange struct {
+	// Index is the position in which the query was sent
+	Index int           `json:"index"`
+	RTT   time.Duration `json:"rtt"`
+	// Rcode of the answer, -1 if there was none
+	Rcode int    `json:"rcode"`
+	Error string `json:"error"`
+}
+
+type SessionIdleProbe struct {
+	Idle  time.Duration `json:"idle"`
+	Alive bool          `json:"alive"`
+	Error string        `json:"error"`
+}
+
+type SessionResponse struct {
+	// DoEResponse holds the TLS details and the first answer of the connection used for sequential queries
+	DoEResponse
+
+	// Sequential holds the queries sent one after another over a single connection
+	Sequential []*SessionExchange `json:"sequential"`
+	// QueriesBeforeClose is the number of queries answered before the connection failed, -1 if all were answered
+	QueriesBeforeClose int `json:"queries_before_close"`
+
+	// Pipelined holds the queries sent back-to-back (DoT) or on concurrent streams (DoH and DoQ) in order of arrival
+	Pipelined []*SessionExchange `json:"pipelined"`
+	// PipelineAnswered is the number of pipelined queries answered over the connection
+	PipelineAnswered int `json:"pipeline_answered"`
+	// OutOfOrder is set if the answers arrived in a different order than the queries were sent
+	OutOfOrder bool `json:"out_of_order"`
+	// PipelineError is set if pipelining failed as a whole, e.g. over HTTP/1.1
+	PipelineError string `json:"pipeline_error"`
+
+	IdleProbes []*SessionIdleProbe `json:"idle_probes"`
+	// IdleSurvived is the longest probed idle time after which the connection was still usable
+	IdleSurvived time.Duration `json:"idle_survived"`
+	// EDNSKeepalive is the idle timeout signalled by the edns-tcp-keepalive option of DoT answers, 0 if none
+	// see https://www.rfc-editor.org/rfc/rfc7828.html
+	EDNSKeepalive time.Duration `json:"edns_keepalive"`
+}
+
+// SessionAnswer is the answer to a message sent over a SessionConn
+type SessionAnswer struct {
+	// Index is the position of the message the answer belongs to
+	Index int
+	Msg   *dns.Msg
+	RTT   time.Duration
+	Err   error
+}
+
+// SessionConn is a single connection to a DoE server that carries multiple DNS messages
+type SessionConn interface {
+	// Exchange sends a single message and waits for its answer
+	Exchange(msg *dns.Msg) (*dns.Msg, time.Duration, error)
+	// Pipeline sends all messages without waiting for the answers, the answers are returned in order of arrival
+	Pipeline(msgs []*dns.Msg) ([]*SessionAnswer, error)
+	// ConnectionState returns the TLS details of the connection, nil if not established yet
+	ConnectionState() *tls.ConnectionState
+	Close() error
+}
+
+// EarlyDataConn is implemented by session connections over QUIC
+type EarlyDataConn interface {
+	// Used0RTT returns whether the server accepted 0-RTT data on the connection
+	Used0RTT() bool
+}
+
+type SessionDialer interface {
+	Dial(q *SessionQuery, tlsConfig *tls.Config) (SessionConn, error)
+}
+
+type SessionQueryHandler struct {
+	DoT SessionDialer
+	DoH SessionDialer
+	DoQ SessionDialer
+
+	Sleeper sleeper
+}
+
+func (qh *SessionQueryHandler) Query(q *SessionQuery) (*SessionResponse, custom_errors.DoEErrors) {
+	res := &SessionResponse{
+		Sequential:         []*SessionExchange{},
+		QueriesBeforeClose: -1,
+		Pipelined:          []*SessionExchange{},
+		IdleProbes:         []*SessionIdleProbe{},
+	}
+
+	if q == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if err := q.Check(); err != nil {
+		return res, err
+	}
+
+	dialer := qh.getDialer(q.Protocol)
+	if dialer == nil {
+		return res, custom_errors.NewGenericError(custom_errors.ErrQueryHandlerNil, true).AddInfoString(q.Protocol)
+	}
+
+	q.SetDNSSEC()
+	q.SetNSID()
+	q.SetCookie()
+	msgs := newSessionMsgs(q)
+
+	if err := qh.sequential(dialer, q, msgs, res); err != nil {
+		return res, err
+	}
+
+	qh.pipeline(dialer, q, msgs, res)
+	qh.idle(dialer, q, msgs[0], res)
+
+	return res, nil
+}
+
+// sequential sends the messages one after another over a single connection until the connection fails
+func (qh *SessionQueryHandler) sequential(dialer SessionDialer, q *SessionQuery, msgs []*dns.Msg, res *SessionResponse) custom_errors.DoEErrors {
+	conn, err := dialer.Dial(q, newSessionTLSConfig(q))
+	if err != nil {
+		return validateCertificateError(err, custom_errors.NewQueryError(custom_errors.ErrSessionFailed, true), &res.DoEResponse, q.SkipCertificateVerify)
+	}
+	defer conn.Close()
+
+	for i, msg := range msgs {
+		answer, rtt, err := conn.Exchange(msg)
+		res.Sequential = append(res.Sequential, newSessionExchange(i, answer, rtt, err))
+
+		if i == 0 {
+			setTLSDetailsToResponse(conn.ConnectionState(), &res.DoEResponse)
+			if cErr := validateCertificateError(err, custom_errors.NewQueryError(custom_errors.ErrSessionFailed, true), &res.DoEResponse, q.SkipCertificateVerify); cErr != nil {
+				return cErr
+			}
+
+			res.ResponseMsg = answer
+			res.RTT = rtt
+			setEDNSInfoToResponse(&res.DNSResponse)
+		}
+
+		if err != nil {
+			res.QueriesBeforeClose = i
+			break
+		}
+
+		setEDNSKeepaliveToResponse(answer, res)
+	}
+
+	return nil
+}
+
+// pipeline sends all messages at once over a fresh connection that was used once before
+func (qh *SessionQueryHandler) pipeline(dialer SessionDialer, q *SessionQuery, msgs []*dns.Msg, res *SessionResponse) {
+	conn, err := dialer.Dial(q, newSessionTLSConfig(q))
+	if err != nil {
+		res.PipelineError = err.Error()
+		return
+	}
+	defer conn.Close()
+
+	// establish the connection (and the HTTP/2 or HTTP/3 session) before pipelining
+	if _, _, err := conn.Exchange(msgs[0]); err != nil {
+		res.PipelineError = err.Error()
+		return
+	}
+
+	answers, err := conn.Pipeline(msgs)
+	if err != nil {
+		res.PipelineError = err.Error()
+	}
+
+	lastIndex := -1
+	for _, answer := range answers {
+		res.Pipelined = append(res.Pipelined, newSessionExchange(answer.Index, answer.Msg, answer.RTT, answer.Err))
+
+		if answer.Err != nil {
+			continue
+		}
+
+		res.PipelineAnswered++
+		if answer.Index < lastIndex {
+			res.OutOfOrder = true
+		}
+		lastIndex = answer.Index
+	}
+}
+
+// idle uses a fresh connection again after each idle probe until the connection fails
+func (qh *SessionQueryHandler) idle(dialer SessionDialer, q *SessionQuery, msg *dns.Msg, res *SessionResponse) {
+	if len(q.IdleProbes) == 0 {
+		return
+	}
+
+	conn, err := dialer.Dial(q, newSessionTLSConfig(q))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, _, err := conn.Exchange(msg); err != nil {
+		return
+	}
+
+	for _, idle := range q.IdleProbes {
+		if qh.Sleeper != nil {
+			qh.Sleeper.Sleep(idle)
+		}
+
+		probe := &SessionIdleProbe{Idle: idle}
+		res.IdleProbes = append(res.IdleProbes, probe)
+
+		if _, _, err := conn.Exchange(msg); err != nil {
+			probe.Error = err.Error()
+			break
+		}
+
+		probe.Alive = true
+		res.IdleSurvived = idle
+	}
+}
+
+func (qh *SessionQueryHandler) getDialer(protocol string) SessionDialer {
+	switch protocol {
+	case TRANSPORT_DOT:
+		return qh.DoT
+	case TRANSPORT_DOH:
+		return qh.DoH
+	case TRANSPORT_DOQ:
+		return qh.DoQ
+	default:
+		return nil
+	}
+}
+
+func newSessionMsgs(q *SessionQuery) []*dns.Msg {
+	msgs := make([]*dns.Msg, q.Queries)
+	for i := range msgs {
+		msg := q.QueryMsg.Copy()
+		// pipelined answers are matched by their ID, see https://www.rfc-editor.org/rfc/rfc7766.html#section-7
+		msg.Id = uint16(i + 1)
+
+		if q.Protocol == TRANSPORT_DOT {
+			// ask for the idle timeout, see https://www.rfc-editor.org/rfc/rfc7828.html#section-3.2.1
+			if msg.IsEdns0() == nil {
+				msg.SetEdns0(1232, false)
+			}
+			opt := msg.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE})
+		}
+
+		msgs[i] = msg
+	}
+
+	return msgs
+}
+
+func newSessionExchange(index int, answer *dns.Msg, rtt time.Duration, err error) *SessionExchange {
+	exchange := &SessionExchange{
+		Index: index,
+		RTT:   rtt,
+		Rcode: -1,
+	}
+
+	if answer != nil {
+		exchange.Rcode = answer.Rcode
+	}
+
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+
+	return exchange
+}
+
+func setEDNSKeepaliveToResponse(answer *dns.Msg, res *SessionResponse) {
+	if answer == nil || answer.IsEdns0() == nil {
+		return
+	}
+
+	for _, option := range answer.IsEdns0().Option {
+		if keepalive, ok := option.(*dns.EDNS0_TCP_KEEPALIVE); ok && keepalive.Timeout > 0 {
+			// the timeout is encoded in units of 100 milliseconds
+			res.EDNSKeepalive = time.Duration(keepalive.Timeout) * 100 * time.Millisecond
+		}
+	}
+}
+
+func newSessionTLSConfig(q *SessionQuery) *tls.Config {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: q.SkipCertificateVerify,
+		// let's support all TLS versions, including TLS 1.0 and TLS 1.1
+		// codeql [go/insecure-tls]: This is intentional
+		MinVersion: tls.VersionTLS10,
+		MaxVersion: tls.VersionTLS13,
+		// let's support all ciphers
+		CipherSuites: getAllTLSCipherSuites(),
+	}
+
+	if q.SNI != "" {
+		tlsConfig.ServerName = q.SNI
+	}
+
+	return tlsConfig
+}
+
+// getSessionDeadline returns the deadline of an exchange, no deadline if the timeout is 0
+func getSessionDeadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(timeout)
+}
+
+// waitForHandshake waits until the handshake of a connection dialed for 0-RTT completed
+func waitForHandshake(conn quic.EarlyConnection, timeout time.Duration) bool {
+	if timeout <= 0 {
+		<-conn.HandshakeComplete()
+		return true
+	}
+
+	select {
+	case <-conn.HandshakeComplete():
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// exchangeConcurrently sends each message on its own stream, the answers are returned in order of arrival
+func exchangeConcurrently(msgs []*dns.Msg, exchange func(msg *dns.Msg) (*dns.Msg, time.Duration, error)) []*SessionAnswer {
+	answers := make([]*SessionAnswer, 0, len(msgs))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			answer, rtt, err := exchange(msg)
+
+			mu.Lock()
+			answers = append(answers, &SessionAnswer{Index: i, Msg: answer, RTT: rtt, Err: err})
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return answers
+}
+
+type dotSessionDialer struct {
+	DialerTCP *net.Dialer
+}
+
+func (d *dotSessionDialer) Dial(q *SessionQuery, tlsConfig *tls.Config) (SessionConn, error) {
+	dialer := &tls.Dialer{
+		NetDialer: d.DialerTCP,
+		Config:    tlsConfig,
+	}
+
+	ctx := context.Background()
+	if q.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.Timeout)
+		defer cancel()
+	}
+
+	// the handshake is part of the dial
+	conn, err := dialer.DialContext(ctx, "tcp", helper.GetFullHostFromHostPort(q.Host, q.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	return &dotSessionConn{
+		conn:    &dns.Conn{Conn: conn},
+		tlsConn: conn.(*tls.Conn),
+		timeout: q.Timeout,
+	}, nil
+}
+
+type dotSessionConn struct {
+	conn    *dns.Conn
+	tlsConn *tls.Conn
+	timeout time.Duration
+}
+
+func (c *dotSessionConn) Exchange(msg *dns.Msg) (*dns.Msg, time.Duration, error) {
+	_ = c.conn.SetDeadline(getSessionDeadline(c.timeout))
+
+	start := time.Now()
+	if err := c.conn.WriteMsg(msg); err != nil {
+		return nil, 0, err
+	}
+
+	for {
+		answer, err := c.conn.ReadMsg()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if answer.Id == msg.Id {
+			return answer, time.Since(start), nil
+		}
+	}
+}
+
+func (c *dotSessionConn) Pipeline(msgs []*dns.Msg) ([]*SessionAnswer, error) {
+	answers := []*SessionAnswer{}
+
+	_ = c.conn.SetDeadline(getSessionDeadline(c.timeout))
+
+	pending := map[uint16]int{}
+	start := time.Now()
+	for i, msg := range msgs {
+		if err := c.conn.WriteMsg(msg); err != nil {
+			return answers, err
+		}
+		pending[msg.Id] = i
+	}
+
+	for len(pending) > 0 {
+		answer, err := c.conn.ReadMsg()
+		if err != nil {
+			return answers, err
+		}
+
+		index, ok := pending[answer.Id]
+		if !ok {
+			continue
+		}
+		delete(pending, answer.Id)
+
+		answers = append(answers, &SessionAnswer{Index: index, Msg: answer, RTT: time.Since(start)})
+	}
+
+	return answers, nil
+}
+
+func (c *dotSessionConn) ConnectionState() *tls.ConnectionState {
+	connState := c.tlsConn.ConnectionState()
+	return &connState
+}
+
+func (c *dotSessionConn) Close() error {
+	return c.conn.Close()
+}
+
+type dohSessionDialer struct {
+	Dialer        *net.Dialer
+	QuicTransport *quic.Transport
+}
+
+func (d *dohSessionDialer) Dial(q *SessionQuery, tlsConfig *tls.Config) (SessionConn, error) {
+	conn := &dohSessionConn{
+		endpoint:    fmt.Sprintf("https://%s", helper.GetFullHostFromHostPort(q.Host, q.Port)),
+		template:    q.URI,
+		httpVersion: q.HTTPVersion,
+		earlyData:   q.EarlyData && q.HTTPVersion == HTTP_VERSION_3,
+		timeout:     q.Timeout,
+	}
+
+	switch q.HTTPVersion {
+	case HTTP_VERSION_1, HTTP_VERSION_2:
+		if q.HTTPVersion == HTTP_VERSION_1 {
+			tlsConfig.NextProtos = []string{"http/1.1"}
+		} else {
+			tlsConfig.NextProtos = []string{"h2"}
+		}
+
+		conn.transport = &http.Transport{
+			TLSClientConfig:   tlsConfig,
+			ForceAttemptHTTP2: q.HTTPVersion == HTTP_VERSION_2,
+			MaxConnsPerHost:   1,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if err := conn.dialOnce(); err != nil {
+					return nil, err
+				}
+				return d.Dialer.DialContext(ctx, network, addr)
+			},
+		}
+	case HTTP_VERSION_3:
+		tlsConfig.NextProtos = []string{"h3"}
+		conn.transport = &http3.Transport{
+			TLSClientConfig: tlsConfig,
+			QUICConfig: &quic.Config{
+				Allow0RTT: conn.earlyData,
+			},
+			Dial: func(ctx context.Context, addr string, tlsConf *tls.Config, quicConf *quic.Config) (quic.EarlyConnection, error) {
+				if err := conn.dialOnce(); err != nil {
+					return nil, err
+				}
+
+				a, err := net.ResolveUDPAddr("udp", addr)
+				if err != nil {
+					return nil, err
+				}
+
+				quicConn, err := d.QuicTransport.DialEarly(ctx, a, tlsConf, quicConf)
+				if err == nil {
+					conn.mu.Lock()
+					conn.quicConn = quicConn
+					conn.mu.Unlock()
+				}
+				return quicConn, err
+			},
+		}
+	default:
+		return nil, custom_errors.ErrInvalidHttpVersion
+	}
+
+	conn.client = &http.Client{
+		Transport: conn.transport,
+		Timeout:   q.Timeout,
+	}
+
+	return conn, nil
+}
+
+type dohSessionConn struct {
+	endpoint    string
+	template    string
+	httpVersion string
+	earlyData   bool
+	timeout     time.Duration
+
+	client    *http.Client
+	transport http.RoundTripper
+
+	// the transport must not replace a connection closed by the server
+	dialed atomic.Bool
+
+	mu        sync.Mutex
+	connState *tls.ConnectionState
+	quicConn  quic.EarlyConnection
+}
+
+func (c *dohSessionConn) dialOnce() error {
+	if !c.dialed.CompareAndSwap(false, true) {
+		return custom_errors.ErrSessionConnectionClosed
+	}
+
+	return nil
+}
+
+func (c *dohSessionConn) Exchange(msg *dns.Msg) (*dns.Msg, time.Duration, error) {
+	httpReq, err := c.newRequest(msg)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+	httpRes, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer httpRes.Body.Close()
+
+	if httpRes.TLS != nil {
+		c.mu.Lock()
+		c.connState = httpRes.TLS
+		c.mu.Unlock()
+	}
+
+	content, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	rtt := time.Since(start)
+
+	if httpRes.StatusCode != http.StatusOK {
+		return nil, rtt, fmt.Errorf("DoH query failed with status code %d", httpRes.StatusCode)
+	}
+
+	answer := &dns.Msg{}
+	if err := answer.Unpack(content); err != nil {
+		return nil, rtt, err
+	}
+
+	return answer, rtt, nil
+}
+
+func (c *dohSessionConn) Pipeline(msgs []*dns.Msg) ([]*SessionAnswer, error) {
+	// net/http does not pipeline HTTP/1.1 requests
+	if c.httpVersion == HTTP_VERSION_1 {
+		return []*SessionAnswer{}, custom_errors.ErrPipeliningUnsupported
+	}
+
+	return exchangeConcurrently(msgs, c.Exchange), nil
+}
+
+func (c *dohSessionConn) newRequest(msg *dns.Msg) (*http.Request, error) {
+	m := msg.Copy()
+	// Set DNS ID as zero according to RFC8484 (cache friendly)
+	m.Id = 0
+
+	buf, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	getPath, _ := ExpandDoHURITemplate(c.template, base64.RawURLEncoding.EncodeToString(buf))
+	fullGetURI := joinDoHURI(c.endpoint, getPath)
+
+	method := HTTP_GET
+	if c.earlyData {
+		// only GET requests are sent before the handshake completes
+		method = http3.MethodGet0RTT
+	}
+
+	var httpReq *http.Request
+	if len(fullGetURI) <= MAX_URI_LENGTH {
+		httpReq, err = http.NewRequestWithContext(context.Background(), method, fullGetURI, nil)
+	} else {
+		postPath, _ := ExpandDoHURITemplate(c.template, "")
+		httpReq, err = http.NewRequestWithContext(context.Background(), HTTP_POST, joinDoHURI(c.endpoint, postPath), bytes.NewReader(buf))
+		if err == nil {
+			httpReq.Header.Add("content-type", DOH_MEDIA_TYPE)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Add("accept", DOH_MEDIA_TYPE)
+
+	return httpReq, nil
+}
+
+func (c *dohSessionConn) ConnectionState() *tls.ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.connState
+}
+
+func (c *dohSessionConn) Used0RTT() bool {
+	c.mu.Lock()
+	quicConn := c.quicConn
+	c.mu.Unlock()
+
+	return quicConn != nil && waitForHandshake(quicConn, c.timeout) && quicConn.ConnectionState().Used0RTT
+}
+
+func (c *dohSessionConn) Close() error {
+	switch t := c.transport.(type) {
+	case *http.Transport:
+		t.CloseIdleConnections()
+	case *http3.Transport:
+		return t.Close()
+	}
+
+	return nil
+}
+
+type doqSessionDialer struct {
+	QueryHandler QuicQueryHandler
+}
+
+func (d *doqSessionDialer) Dial(q *SessionQuery, tlsConfig *tls.Config) (SessionConn, error) {
+	tlsConfig.NextProtos = DOQ_TLS_PROTOCOLS
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = q.Host
+	}
+
+	// the client must not close the connection before the server does
+	idleTimeout := q.Timeout
+	if len(q.IdleProbes) > 0 {
+		idleTimeout += slices.Max(q.IdleProbes)
+	}
+
+	quicConfig := &quic.Config{
+		HandshakeIdleTimeout: q.Timeout,
+		MaxIdleTimeout:       idleTimeout,
+		Allow0RTT:            q.EarlyData,
+	}
+
+	var udpAddr *net.UDPAddr
+	ipAddr := net.ParseIP(q.Host)
+	if ipAddr == nil {
+		resolvedAddress, err := net.ResolveUDPAddr("udp", helper.GetFullHostFromHostPort(q.Host, q.Port))
+		if err != nil {
+			return nil, err
+		}
+		udpAddr = resolvedAddress
+	} else {
+		udpAddr = &net.UDPAddr{
+			IP:   ipAddr,
+			Port: q.Port,
+		}
+	}
+
+	var conn QuicConn
+	var err error
+	if earlyHandler, ok := d.QueryHandler.(EarlyQuicQueryHandler); ok && q.EarlyData {
+		conn, err = earlyHandler.QueryEarly(context.Background(), udpAddr, tlsConfig, quicConfig)
+	} else {
+		conn, err = d.QueryHandler.Query(context.Background(), udpAddr, tlsConfig, quicConfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &doqSessionConn{
+		conn:    conn,
+		timeout: q.Timeout,
+	}, nil
+}
+
+type doqSessionConn struct {
+	conn    QuicConn
+	timeout time.Duration
+}
+
+func (c *doqSessionConn) Exchange(msg *dns.Msg) (*dns.Msg, time.Duration, error) {
+	// see https://datatracker.ietf.org/doc/html/rfc9250#section-4.2.1
+	m := msg.Copy()
+	m.Id = 0
+
+	packedMessage, err := m.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := time.Now()
+
+	// each query is sent on its own stream, see https://datatracker.ietf.org/doc/html/rfc9250#section-4.2
+	stream, err := c.conn.OpenStream()
+	if err != nil {
+		return nil, 0, err
+	}
+	_ = stream.SetDeadline(getSessionDeadline(c.timeout))
+
+	if _, err = stream.Write(AddQuicPrefix(packedMessage)); err != nil {
+		_ = stream.Close()
+		return nil, 0, err
+	}
+	_ = stream.Close()
+
+	response, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, 0, err
+	}
+	rtt := time.Since(start)
+
+	if len(response) <= 2 {
+		return nil, rtt, custom_errors.ErrEmptyStreamResponse
+	}
+
+	answer := &dns.Msg{}
+	if err := answer.Unpack(response[2:]); err != nil {
+		return nil, rtt, err
+	}
+
+	return answer, rtt, nil
+}
+
+func (c *doqSessionConn) Pipeline(msgs []*dns.Msg) ([]*SessionAnswer, error) {
+	return exchangeConcurrently(msgs, c.Exchange), nil
+}
+
+func (c *doqSessionConn) ConnectionState() *tls.ConnectionState {
+	connState := c.conn.ConnectionState().TLS
+	return &connState
+}
+
+func (c *doqSessionConn) Used0RTT() bool {
+	earlyConn, ok := c.conn.(quic.EarlyConnection)
+	if !ok {
+		return false
+	}
+
+	return waitForHandshake(earlyConn, c.timeout) && earlyConn.ConnectionState().Used0RTT
+}
+
+func (c *doqSessionConn) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+func NewSessionQuery() (q *SessionQuery) {
+	q = &SessionQuery{
+		Protocol:    TRANSPORT_DOT,
+		URI:         DEFAULT_DOH_PATH,
+		HTTPVersion: HTTP_VERSION_2,
+		Queries:     DEFAULT_SESSION_QUERIES,
+		IdleProbes:  slices.Clone(DEFAULT_SESSION_IDLE_PROBES),
+	}
+
+	q.Port = DEFAULT_DOT_PORT
+	q.Timeout = DEFAULT_SESSION_TIMEOUT
+
+	q.QueryMsg = GetDefaultQueryMsg()
+
+	// set DNSSEC flag by default
+	q.DNSSEC = true
+
+	// request the name server identifier by default
+	q.NSID = true
+
+	return
+}
+
+func NewSessionQueryHandler(config *QueryConfig) (*SessionQueryHandler, error) {
+	dialerTCP := &net.Dialer{}
+
+	localUDPAddr := &net.UDPAddr{}
+	if config != nil && config.LocalAddr != nil {
+		dialerTCP.LocalAddr = &net.TCPAddr{
+			IP:   config.LocalAddr,
+			Port: 0,
+		}
+		localUDPAddr.IP = config.LocalAddr
+	}
+
+	// HTTP3 and DoQ are based on UDP
+	dohConn, err := net.ListenUDP("udp", localUDPAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	doqConn, err := net.ListenUDP("udp", localUDPAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SessionQueryHandler{
+		DoT: &dotSessionDialer{
+			DialerTCP: dialerTCP,
+		},
+		DoH: &dohSessionDialer{
+			Dialer:        dialerTCP,
+			QuicTransport: &quic.Transport{Conn: dohConn},
+		},
+		DoQ: &doqSessionDialer{
+			QueryHandler: &DefaultQuicQueryHandler{Transport: &quic.Transport{Conn: doqConn}},
+		},
+		Sleeper: newDefaultSleeper(),
+	}, nil
+}
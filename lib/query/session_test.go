@@ -0,0 +1,452 @@
+package query_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedSessionDialer struct {
+	mock.Mock
+}
+
+func (m *mockedSessionDialer) Dial(q *query.SessionQuery, tlsConfig *tls.Config) (query.SessionConn, error) {
+	args := m.Called(q, tlsConfig)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(query.SessionConn), args.Error(1)
+}
+
+// reversingSessionConn answers pipelined messages in reverse order
+type reversingSessionConn struct{}
+
+func (c *reversingSessionConn) Exchange(msg *dns.Msg) (*dns.Msg, time.Duration, error) {
+	answer := new(dns.Msg)
+	answer.SetReply(msg)
+	return answer, time.Millisecond, nil
+}
+
+func (c *reversingSessionConn) Pipeline(msgs []*dns.Msg) ([]*query.SessionAnswer, error) {
+	answers := []*query.SessionAnswer{}
+	for i := len(msgs) - 1; i >= 0; i-- {
+		answer, rtt, _ := c.Exchange(msgs[i])
+		answers = append(answers, &query.SessionAnswer{Index: i, Msg: answer, RTT: rtt})
+	}
+	return answers, nil
+}
+
+func (c *reversingSessionConn) ConnectionState() *tls.ConnectionState {
+	return nil
+}
+
+func (c *reversingSessionConn) Close() error {
+	return nil
+}
+
+// startTestSessionDoTServer starts a local DoT server that signals an edns-tcp-keepalive timeout of 5s
+func startTestSessionDoTServer(t *testing.T, maxQueries int, idleTimeout time.Duration) string {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+	})
+	require.NoError(t, err)
+
+	server := &dns.Server{
+		Listener:      listener,
+		MaxTCPQueries: maxQueries,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.SetEdns0(1232, false)
+			opt := m.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE, Timeout: 50})
+			_ = w.WriteMsg(m)
+		}),
+	}
+	if idleTimeout > 0 {
+		server.IdleTimeout = func() time.Duration {
+			return idleTimeout
+		}
+	}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return listener.Addr().String()
+}
+
+// startTestDoHServer starts a local DoH server supporting HTTP/1.1 and HTTP/2
+func startTestDoHServer(t *testing.T) string {
+	t.Helper()
+
+	addr, _ := startRecordingTestDoHServer(t)
+	return addr
+}
+
+// startRecordingTestDoHServer starts a local DoH server like startTestDoHServer and records the request URIs
+func startRecordingTestDoHServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	requestURIs := make(chan string, 16)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requestURIs <- r.URL.RequestURI():
+		default:
+		}
+
+		buf, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(buf); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		answer := new(dns.Msg)
+		answer.SetReply(msg)
+		packed, _ := answer.Pack()
+
+		w.Header().Set("content-type", query.DOH_MEDIA_TYPE)
+		_, _ = w.Write(packed)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server.Listener.Addr().String(), requestURIs
+}
+
+// startTestDoQServer starts a local DoQ server answering each stream with an empty response
+func startTestDoQServer(t *testing.T, quicConfig *quic.Config) string {
+	t.Helper()
+
+	listener, err := quic.ListenAddrEarly("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+		NextProtos:   query.DOQ_TLS_PROTOCOLS,
+	}, quicConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+
+					go func() {
+						defer stream.Close()
+
+						buf, err := io.ReadAll(stream)
+						if err != nil || len(buf) <= 2 {
+							return
+						}
+
+						msg := new(dns.Msg)
+						if err := msg.Unpack(buf[2:]); err != nil {
+							return
+						}
+
+						answer := new(dns.Msg)
+						answer.SetReply(msg)
+						packed, _ := answer.Pack()
+						_, _ = stream.Write(query.AddQuicPrefix(packed))
+					}()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func newLocalSessionQuery(t *testing.T, protocol string, addr string) *query.SessionQuery {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	q := query.NewSessionQuery()
+	q.Protocol = protocol
+	q.Host = host
+	q.Port, err = net.LookupPort("tcp", port)
+	require.NoError(t, err)
+	q.SkipCertificateVerify = true
+	q.Timeout = 2 * time.Second
+	q.Queries = 5
+	q.IdleProbes = []time.Duration{}
+
+	return q
+}
+
+func TestSessionQuery_Check(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		modify func(q *query.SessionQuery)
+		err    error
+	}{
+		{"invalid protocol", func(q *query.SessionQuery) { q.Protocol = "do53" }, custom_errors.ErrInvalidProtocol},
+		{"empty DoH URI", func(q *query.SessionQuery) { q.Protocol = query.TRANSPORT_DOH; q.URI = "" }, custom_errors.ErrEmptyURIPath},
+		{"invalid HTTP version", func(q *query.SessionQuery) { q.Protocol = query.TRANSPORT_DOH; q.HTTPVersion = "HTTP4" }, custom_errors.ErrInvalidHttpVersion},
+		{"no queries", func(q *query.SessionQuery) { q.Queries = 0 }, custom_errors.ErrInvalidSessionQueries},
+		{"too many queries", func(q *query.SessionQuery) { q.Queries = query.MAX_SESSION_QUERIES + 1 }, custom_errors.ErrInvalidSessionQueries},
+		{"negative idle probe", func(q *query.SessionQuery) { q.IdleProbes = []time.Duration{-time.Second} }, custom_errors.ErrInvalidTimeout},
+		{"nil query message", func(q *query.SessionQuery) { q.QueryMsg = nil }, custom_errors.ErrEmptyQueryMessage},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			q := query.NewSessionQuery()
+			q.Host = "localhost"
+			tc.modify(q)
+
+			err := q.Check()
+
+			require.NotNil(t, err)
+			assert.Contains(t, err.Error(), tc.err.Error())
+		})
+	}
+
+	t.Run("valid query", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewSessionQuery()
+		q.Host = "localhost"
+
+		assert.Nil(t, q.Check())
+	})
+}
+
+func TestSessionQueryHandler_Query(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewSessionQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(nil)
+
+		require.NotNil(t, qErr)
+		assert.NotNil(t, res)
+	})
+
+	t.Run("nil dialer", func(t *testing.T) {
+		t.Parallel()
+
+		qh := &query.SessionQueryHandler{}
+		q := query.NewSessionQuery()
+		q.Host = "localhost"
+
+		_, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.Contains(t, qErr.Error(), custom_errors.ErrQueryHandlerNil.Error())
+	})
+
+	t.Run("dial error", func(t *testing.T) {
+		t.Parallel()
+
+		dialer := &mockedSessionDialer{}
+		dialer.On("Dial", mock.Anything, mock.Anything).Return(nil, errors.New("connection refused"))
+
+		qh := &query.SessionQueryHandler{DoT: dialer}
+		q := query.NewSessionQuery()
+		q.Host = "localhost"
+
+		res, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.True(t, qErr.IsCritical())
+		assert.Contains(t, qErr.Error(), custom_errors.ErrSessionFailed.Error())
+		assert.Empty(t, res.Sequential)
+	})
+
+	t.Run("out of order answers", func(t *testing.T) {
+		t.Parallel()
+
+		dialer := &mockedSessionDialer{}
+		dialer.On("Dial", mock.Anything, mock.Anything).Return(&reversingSessionConn{}, nil)
+
+		sleeper := &mockedSleeper{}
+		sleeper.On("Sleep", mock.Anything).Return()
+
+		qh := &query.SessionQueryHandler{DoT: dialer, Sleeper: sleeper}
+		q := query.NewSessionQuery()
+		q.Host = "localhost"
+		q.Queries = 3
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		assert.Len(t, res.Sequential, 3)
+		assert.Equal(t, -1, res.QueriesBeforeClose)
+		assert.True(t, res.OutOfOrder)
+		assert.Equal(t, 3, res.PipelineAnswered)
+		assert.Equal(t, 2, res.Pipelined[0].Index)
+		assert.Len(t, res.IdleProbes, len(query.DEFAULT_SESSION_IDLE_PROBES))
+		assert.Equal(t, slices.Max(query.DEFAULT_SESSION_IDLE_PROBES), res.IdleSurvived)
+		sleeper.AssertNumberOfCalls(t, "Sleep", len(query.DEFAULT_SESSION_IDLE_PROBES))
+	})
+}
+
+func TestSessionQueryHandler_DoT(t *testing.T) {
+	t.Parallel()
+
+	t.Run("pipelining", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestSessionDoTServer(t, 0, 0)
+
+		qh, err := query.NewSessionQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalSessionQuery(t, query.TRANSPORT_DOT, addr))
+
+		require.Nil(t, qErr)
+		assert.NotNil(t, res.ResponseMsg)
+		assert.Equal(t, "TLS 1.3", res.TLSVersion)
+		assert.Len(t, res.Sequential, 5)
+		assert.Equal(t, -1, res.QueriesBeforeClose)
+		assert.Equal(t, 5, res.PipelineAnswered)
+		assert.Empty(t, res.PipelineError)
+		assert.Equal(t, 5*time.Second, res.EDNSKeepalive)
+	})
+
+	t.Run("server closes connection", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestSessionDoTServer(t, 3, 0)
+
+		qh, err := query.NewSessionQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalSessionQuery(t, query.TRANSPORT_DOT, addr))
+
+		require.Nil(t, qErr)
+		assert.Equal(t, 3, res.QueriesBeforeClose)
+		assert.Len(t, res.Sequential, 4)
+		assert.NotEmpty(t, res.Sequential[3].Error)
+		assert.Equal(t, -1, res.Sequential[3].Rcode)
+		// one query is used to establish the connection before pipelining
+		assert.Equal(t, 2, res.PipelineAnswered)
+		assert.NotEmpty(t, res.PipelineError)
+	})
+
+	t.Run("idle timeout", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestSessionDoTServer(t, 0, 200*time.Millisecond)
+
+		qh, err := query.NewSessionQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := newLocalSessionQuery(t, query.TRANSPORT_DOT, addr)
+		q.IdleProbes = []time.Duration{10 * time.Millisecond, 500 * time.Millisecond, time.Second}
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		require.Len(t, res.IdleProbes, 2)
+		assert.True(t, res.IdleProbes[0].Alive)
+		assert.False(t, res.IdleProbes[1].Alive)
+		assert.Equal(t, 10*time.Millisecond, res.IdleSurvived)
+	})
+}
+
+func TestSessionQueryHandler_DoH(t *testing.T) {
+	t.Parallel()
+
+	addr := startTestDoHServer(t)
+
+	t.Run("concurrent HTTP/2 streams", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewSessionQueryHandler(nil)
+		require.NoError(t, err)
+
+		res, qErr := qh.Query(newLocalSessionQuery(t, query.TRANSPORT_DOH, addr))
+
+		require.Nil(t, qErr)
+		assert.Equal(t, "h2", res.TLSALPN)
+		assert.Equal(t, -1, res.QueriesBeforeClose)
+		assert.Equal(t, 5, res.PipelineAnswered)
+		assert.Empty(t, res.PipelineError)
+	})
+
+	t.Run("no pipelining over HTTP/1.1", func(t *testing.T) {
+		t.Parallel()
+
+		qh, err := query.NewSessionQueryHandler(nil)
+		require.NoError(t, err)
+
+		q := newLocalSessionQuery(t, query.TRANSPORT_DOH, addr)
+		q.HTTPVersion = query.HTTP_VERSION_1
+
+		res, qErr := qh.Query(q)
+
+		require.Nil(t, qErr)
+		assert.Equal(t, -1, res.QueriesBeforeClose)
+		assert.Equal(t, 0, res.PipelineAnswered)
+		assert.Equal(t, custom_errors.ErrPipeliningUnsupported.Error(), res.PipelineError)
+	})
+}
+
+func TestSessionQueryHandler_DoQ(t *testing.T) {
+	t.Parallel()
+
+	addr := startTestDoQServer(t, nil)
+
+	qh, err := query.NewSessionQueryHandler(nil)
+	require.NoError(t, err)
+
+	res, qErr := qh.Query(newLocalSessionQuery(t, query.TRANSPORT_DOQ, addr))
+
+	require.Nil(t, qErr)
+	assert.Equal(t, "doq", res.TLSALPN)
+	assert.Len(t, res.Sequential, 5)
+	assert.Equal(t, -1, res.QueriesBeforeClose)
+	assert.Equal(t, 5, res.PipelineAnswered)
+}
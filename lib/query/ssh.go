@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/steffsas/doe-hunter/lib/custom_errors"
@@ -27,6 +28,37 @@ type SSHResponse struct {
 	PubKeyFingerprint string                    `json:"pub_key_fingerprint"`
 	OpenSSHServer     bool                      `json:"openssh_server"`
 	Errors            []custom_errors.DoEErrors `json:"errors"`
+
+	// Banner is the identification string of the server, nil if it sent none
+	Banner *SSHBanner `json:"banner"`
+}
+
+// recordingConn records the first bytes read from the connection, i.e., the identification string
+type recordingConn struct {
+	net.Conn
+
+	mutex    sync.Mutex
+	recorded []byte
+}
+
+func (rc *recordingConn) Read(b []byte) (int, error) {
+	n, err := rc.Conn.Read(b)
+
+	// the SSH client keeps reading in the background once the handshake started
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	if free := MAX_BANNER_SIZE - len(rc.recorded); free > 0 {
+		rc.recorded = append(rc.recorded, b[:min(n, free)]...)
+	}
+
+	return n, err
+}
+
+func (rc *recordingConn) getBanner() *SSHBanner {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return NewSSHBanner(rc.recorded)
 }
 
 type SSHDialWrapper struct{}
@@ -81,7 +113,10 @@ func (qh *SSHQueryHandler) Query(query *SSHQuery) (*SSHResponse, custom_errors.D
 		Timeout: query.Timeout,
 	}
 
-	sshCon, _, _, err := qh.SSHDialer.NewClientConn(con, fmt.Sprintf("%s:%d", query.Host, query.Port), config)
+	// the identification strings are exchanged even if the authentication fails
+	rc := &recordingConn{Conn: con}
+	sshCon, _, _, err := qh.SSHDialer.NewClientConn(rc, fmt.Sprintf("%s:%d", query.Host, query.Port), config)
+	res.Banner = rc.getBanner()
 
 	if err != nil {
 		dialErr := custom_errors.NewQueryError(custom_errors.ErrQueryDial, false)
@@ -2,6 +2,7 @@ package query_test
 
 import (
 	"errors"
+	"io"
 	"net"
 	"testing"
 
@@ -131,6 +132,34 @@ func TestSSHQueryHandler_Query(t *testing.T) {
 	})
 }
 
+func TestSSHQueryHandler_Banner(t *testing.T) {
+	t.Parallel()
+
+	client, server := net.Pipe()
+	// the pipe is synchronous, hence the client identification string must be read
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+	go func() {
+		defer server.Close()
+		_, _ = server.Write([]byte("SSH-2.0-dropbear_2022.83\r\n"))
+	}()
+
+	mtd := &mockedTCPDialer{}
+	mtd.On("Dial", mock.Anything, mock.Anything).Return(client, nil)
+
+	qh := query.NewSSHQueryHandler(nil)
+	qh.TCPDialer = mtd
+
+	res, qErr := qh.Query(query.NewSSHQuery("192.0.2.1"))
+
+	assert.Nil(t, qErr, "should not fail if the handshake fails")
+	require.NotNil(t, res)
+	assert.False(t, res.OpenSSHServer)
+	require.NotNil(t, res.Banner, "should record the identification string before the handshake fails")
+	assert.Equal(t, "dropbear_2022.83", res.Banner.SoftwareVersion)
+}
+
 func TestNewSSHQueryHandler(t *testing.T) {
 	t.Parallel()
 
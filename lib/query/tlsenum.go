@@ -0,0 +1,250 @@
+package query
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+)
+
+const DEFAULT_TLS_ENUM_TIMEOUT time.Duration = 2500 * time.Millisecond
+
+// DEFAULT_TLS_ENUM_HANDSHAKE_DELAY rate limits the handshakes sent to a single endpoint
+const DEFAULT_TLS_ENUM_HANDSHAKE_DELAY time.Duration = 250 * time.Millisecond
+
+// nolint: gochecknoglobals
+var TLS_ENUM_VERSIONS = []uint16{
+	tls.VersionTLS10,
+	tls.VersionTLS11,
+	tls.VersionTLS12,
+	tls.VersionTLS13,
+}
+
+type TLSEnumQuery struct {
+	// Host is the host for the dialer (required)
+	Host string `json:"host"`
+	// Port is the port for the dialer (default: 443)
+	Port int `json:"port"`
+	// Timeout is the timeout of each handshake in ms (default: 2500)
+	Timeout time.Duration `json:"timeout"`
+	// HandshakeDelay is the delay between two handshakes to the endpoint (default: 250ms)
+	HandshakeDelay time.Duration `json:"handshake_delay"`
+	// SNI
+	SNI string `json:"sni"`
+	// ALPN protocol
+	ALPN []string `json:"alpn"`
+}
+
+func (q *TLSEnumQuery) Check() (err custom_errors.DoEErrors) {
+	if err = checkForQueryParams(q.Host, q.Port, q.Timeout, true); err != nil {
+		return err
+	}
+
+	if q.HandshakeDelay < 0 {
+		return custom_errors.NewQueryConfigError(custom_errors.ErrInvalidTimeout, true).AddInfoString("negative handshake delay")
+	}
+
+	return nil
+}
+
+type TLSCipherSuiteSupport struct {
+	CipherSuite string `json:"cipher_suite"`
+	Accepted    bool   `json:"accepted"`
+
+	// alert sent by the server on rejection, 0 if none
+	TLSAlert            int    `json:"tls_alert"`
+	TLSAlertDescription string `json:"tls_alert_description"`
+	// Error is set if the handshake failed without an alert, e.g. on timeouts
+	Error string `json:"error"`
+}
+
+type TLSVersionSupport struct {
+	Version   string `json:"version"`
+	Supported bool   `json:"supported"`
+
+	// NegotiatedCipherSuite is the cipher suite selected if all cipher suites are offered
+	NegotiatedCipherSuite string `json:"negotiated_cipher_suite"`
+
+	// alert sent by the server on rejection, 0 if none
+	TLSAlert            int    `json:"tls_alert"`
+	TLSAlertDescription string `json:"tls_alert_description"`
+	// Error is set if the handshake failed without an alert, e.g. on timeouts
+	Error string `json:"error"`
+
+	// CipherSuites is the accepted matrix of this version, one handshake per cipher suite.
+	// TLS 1.3 cipher suites cannot be offered individually, hence it is not enumerated.
+	CipherSuites []*TLSCipherSuiteSupport `json:"cipher_suites"`
+	// PreferenceOrder is the order in which the server selects the accepted cipher suites
+	PreferenceOrder []string `json:"preference_order"`
+}
+
+type TLSEnumResponse struct {
+	Versions []*TLSVersionSupport `json:"versions"`
+	// Handshakes is the number of handshakes sent to the endpoint
+	Handshakes int `json:"handshakes"`
+}
+
+type TLSEnumQueryHandler struct {
+	QueryHandler CertQueryHandler
+	Sleeper      sleeper
+}
+
+func (qh *TLSEnumQueryHandler) Query(q *TLSEnumQuery) (*TLSEnumResponse, custom_errors.DoEErrors) {
+	res := &TLSEnumResponse{
+		Versions: []*TLSVersionSupport{},
+	}
+
+	if q == nil {
+		return res, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if err := q.Check(); err != nil {
+		return res, err
+	}
+
+	if qh.QueryHandler == nil {
+		return res, custom_errors.NewGenericError(custom_errors.ErrQueryHandlerNil, true)
+	}
+
+	for _, version := range TLS_ENUM_VERSIONS {
+		vs := &TLSVersionSupport{
+			Version:         tls.VersionName(version),
+			CipherSuites:    []*TLSCipherSuiteSupport{},
+			PreferenceOrder: []string{},
+		}
+		res.Versions = append(res.Versions, vs)
+
+		suites := getTLSEnumCipherSuites(version)
+		connState, err := qh.handshake(q, res, version, suites)
+		if err != nil {
+			if isDialError(err) {
+				// there is no point in enumerating an endpoint we cannot connect to
+				return res, custom_errors.NewQueryError(custom_errors.ErrTLSEndpointUnreachable, true).AddInfo(err)
+			}
+			vs.TLSAlert, vs.TLSAlertDescription, vs.Error = getHandshakeFailure(err)
+			continue
+		}
+
+		vs.Supported = true
+		vs.NegotiatedCipherSuite = tls.CipherSuiteName(connState.CipherSuite)
+
+		if version == tls.VersionTLS13 {
+			// crypto/tls does not allow to configure TLS 1.3 cipher suites
+			vs.PreferenceOrder = append(vs.PreferenceOrder, vs.NegotiatedCipherSuite)
+			continue
+		}
+
+		// accepted matrix
+		accepted := []uint16{}
+		for _, suite := range suites {
+			cs := &TLSCipherSuiteSupport{
+				CipherSuite: tls.CipherSuiteName(suite),
+			}
+			vs.CipherSuites = append(vs.CipherSuites, cs)
+
+			if _, err := qh.handshake(q, res, version, []uint16{suite}); err != nil {
+				cs.TLSAlert, cs.TLSAlertDescription, cs.Error = getHandshakeFailure(err)
+				continue
+			}
+
+			cs.Accepted = true
+			accepted = append(accepted, suite)
+		}
+
+		// preference order, offer the remaining accepted cipher suites until the server selected each of them
+		for len(accepted) > 0 {
+			connState, err := qh.handshake(q, res, version, accepted)
+			if err != nil || !slices.Contains(accepted, connState.CipherSuite) {
+				break
+			}
+
+			vs.PreferenceOrder = append(vs.PreferenceOrder, tls.CipherSuiteName(connState.CipherSuite))
+			accepted = slices.DeleteFunc(accepted, func(suite uint16) bool {
+				return suite == connState.CipherSuite
+			})
+		}
+	}
+
+	return res, nil
+}
+
+// handshake runs a single handshake offering only the given version and cipher suites
+func (qh *TLSEnumQueryHandler) handshake(q *TLSEnumQuery, res *TLSEnumResponse, version uint16, suites []uint16) (*tls.ConnectionState, error) {
+	if res.Handshakes > 0 && q.HandshakeDelay > 0 && qh.Sleeper != nil {
+		qh.Sleeper.Sleep(q.HandshakeDelay)
+	}
+	res.Handshakes++
+
+	tlsConfig := &tls.Config{
+		// we are interested in the supported parameters, not in the certificate
+		// codeql [go/disabled-certificate-check]: This is intentional
+		InsecureSkipVerify: true,
+		MinVersion:         version,
+		MaxVersion:         version,
+		CipherSuites:       suites,
+	}
+
+	if q.SNI != "" {
+		tlsConfig.ServerName = q.SNI
+	}
+
+	if len(q.ALPN) > 0 {
+		tlsConfig.NextProtos = q.ALPN
+	}
+
+	return qh.QueryHandler.Query(q.Host, q.Port, TLS_PROTOCOL_TCP, q.Timeout, tlsConfig)
+}
+
+// getTLSEnumCipherSuites returns all cipher suites implemented by crypto/tls, including the insecure ones, for a version
+func getTLSEnumCipherSuites(version uint16) []uint16 {
+	suites := []uint16{}
+	for _, cs := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if slices.Contains(cs.SupportedVersions, version) {
+			suites = append(suites, cs.ID)
+		}
+	}
+
+	return suites
+}
+
+func getHandshakeFailure(err error) (alert int, description string, errMsg string) {
+	if a := GetTLSAlert(err); a != 0 {
+		return int(a), tls.AlertError(a).Error(), ""
+	}
+
+	return 0, "", err.Error()
+}
+
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func NewTLSEnumQuery() (q *TLSEnumQuery) {
+	return &TLSEnumQuery{
+		Port:           DEFAULT_TLS_PORT,
+		Timeout:        DEFAULT_TLS_ENUM_TIMEOUT,
+		HandshakeDelay: DEFAULT_TLS_ENUM_HANDSHAKE_DELAY,
+	}
+}
+
+func NewTLSEnumQueryHandler(config *QueryConfig) *TLSEnumQueryHandler {
+	cqh := &DefaultCertQueryHandler{
+		dialerTCP: &net.Dialer{},
+	}
+
+	if config != nil && config.LocalAddr != nil {
+		cqh.dialerTCP.LocalAddr = &net.TCPAddr{
+			IP:   config.LocalAddr,
+			Port: 0,
+		}
+	}
+
+	return &TLSEnumQueryHandler{
+		QueryHandler: cqh,
+		Sleeper:      newDefaultSleeper(),
+	}
+}
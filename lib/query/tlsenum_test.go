@@ -0,0 +1,186 @@
+package query_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestTLSServer starts a local TLS server that completes handshakes and closes the connection
+func startTestTLSServer(t *testing.T, tlsConfig *tls.Config) (string, int) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func getTLSEnumQueryHandler() (*query.TLSEnumQueryHandler, *mockedSleeper) {
+	sleeper := &mockedSleeper{}
+	sleeper.On("Sleep", mock.Anything).Return()
+
+	qh := query.NewTLSEnumQueryHandler(nil)
+	qh.Sleeper = sleeper
+
+	return qh, sleeper
+}
+
+func TestTLSEnumQueryHandler_Query(t *testing.T) {
+	t.Parallel()
+
+	t.Run("enumerate TLS 1.2 only endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		accepted := []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		}
+
+		host, port := startTestTLSServer(t, &tls.Config{
+			Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: accepted,
+		})
+
+		q := query.NewTLSEnumQuery()
+		q.Host = host
+		q.Port = port
+
+		qh, sleeper := getTLSEnumQueryHandler()
+		res, err := qh.Query(q)
+
+		require.Nil(t, err)
+		require.Len(t, res.Versions, 4)
+
+		versions := map[string]*query.TLSVersionSupport{}
+		for _, v := range res.Versions {
+			versions[v.Version] = v
+		}
+
+		for _, name := range []string{"TLS 1.0", "TLS 1.1", "TLS 1.3"} {
+			assert.False(t, versions[name].Supported, name)
+			assert.Equal(t, 70, versions[name].TLSAlert, "should have received protocol_version for %s", name)
+			assert.Empty(t, versions[name].CipherSuites)
+		}
+
+		tls12 := versions["TLS 1.2"]
+		require.True(t, tls12.Supported)
+		assert.Contains(t, []string{tls.CipherSuiteName(accepted[0]), tls.CipherSuiteName(accepted[1])}, tls12.NegotiatedCipherSuite)
+
+		acceptedNames := []string{}
+		for _, cs := range tls12.CipherSuites {
+			if cs.Accepted {
+				acceptedNames = append(acceptedNames, cs.CipherSuite)
+			} else {
+				assert.NotZero(t, cs.TLSAlert, "should have received an alert for %s", cs.CipherSuite)
+			}
+		}
+		assert.ElementsMatch(t, []string{tls.CipherSuiteName(accepted[0]), tls.CipherSuiteName(accepted[1])}, acceptedNames)
+		assert.ElementsMatch(t, acceptedNames, tls12.PreferenceOrder)
+		assert.Equal(t, tls12.NegotiatedCipherSuite, tls12.PreferenceOrder[0], "most preferred cipher suite should have been negotiated")
+
+		// one handshake per version, one per TLS 1.2 cipher suite and one per accepted cipher suite
+		assert.Equal(t, 4+len(tls12.CipherSuites)+2, res.Handshakes)
+		sleeper.AssertNumberOfCalls(t, "Sleep", res.Handshakes-1)
+		sleeper.AssertCalled(t, "Sleep", query.DEFAULT_TLS_ENUM_HANDSHAKE_DELAY)
+	})
+
+	t.Run("TLS 1.3 is not enumerated per cipher suite", func(t *testing.T) {
+		t.Parallel()
+
+		host, port := startTestTLSServer(t, &tls.Config{
+			Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+			MinVersion:   tls.VersionTLS13,
+		})
+
+		q := query.NewTLSEnumQuery()
+		q.Host = host
+		q.Port = port
+
+		qh, _ := getTLSEnumQueryHandler()
+		res, err := qh.Query(q)
+
+		require.Nil(t, err)
+		tls13 := res.Versions[3]
+		assert.Equal(t, "TLS 1.3", tls13.Version)
+		assert.True(t, tls13.Supported)
+		assert.Empty(t, tls13.CipherSuites)
+		assert.Equal(t, []string{tls13.NegotiatedCipherSuite}, tls13.PreferenceOrder)
+		assert.Equal(t, 4, res.Handshakes)
+	})
+
+	t.Run("unreachable endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		// grab a free port and close it again
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		port := listener.Addr().(*net.TCPAddr).Port
+		require.NoError(t, listener.Close())
+
+		q := query.NewTLSEnumQuery()
+		q.Host = "127.0.0.1"
+		q.Port = port
+
+		qh, _ := getTLSEnumQueryHandler()
+		res, qErr := qh.Query(q)
+
+		require.NotNil(t, qErr)
+		assert.True(t, qErr.IsCritical())
+		assert.Contains(t, qErr.Error(), custom_errors.ErrTLSEndpointUnreachable.Error())
+		assert.Equal(t, 1, res.Handshakes, "should have stopped after the first handshake")
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		t.Parallel()
+
+		qh, _ := getTLSEnumQueryHandler()
+
+		_, err := qh.Query(nil)
+		assert.NotNil(t, err)
+
+		q := query.NewTLSEnumQuery()
+		_, err = qh.Query(q)
+		assert.NotNil(t, err, "empty host")
+
+		q.Host = "127.0.0.1"
+		q.HandshakeDelay = -1
+		_, err = qh.Query(q)
+		assert.NotNil(t, err, "negative delay")
+	})
+
+	t.Run("nil query handler", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewTLSEnumQuery()
+		q.Host = "127.0.0.1"
+
+		qh := &query.TLSEnumQueryHandler{}
+		_, err := qh.Query(q)
+
+		assert.NotNil(t, err)
+	})
+}
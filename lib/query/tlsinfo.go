@@ -0,0 +1,152 @@
+package query
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/quic-go/quic-go"
+	"golang.org/x/crypto/ocsp"
+)
+
+const OCSP_STATUS_NONE = "none"
+const OCSP_STATUS_GOOD = "good"
+const OCSP_STATUS_REVOKED = "revoked"
+const OCSP_STATUS_UNKNOWN = "unknown"
+const OCSP_STATUS_INVALID = "invalid"
+
+// see https://www.rfc-editor.org/rfc/rfc6962.html#section-3.3
+// nolint: gochecknoglobals
+var oidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// tlsAlertsByDescription maps the descriptions crypto/tls prints for alerts, e.g., "tls: internal error",
+// to their codes, unknown alerts are printed as "tls: alert(N)"
+// nolint: gochecknoglobals
+var tlsAlertsByDescription = newTLSAlertsByDescription()
+
+func newTLSAlertsByDescription() map[string]uint8 {
+	alerts := make(map[string]uint8, 256)
+	for i := 1; i < 256; i++ {
+		alerts[tls.AlertError(i).Error()] = uint8(i)
+	}
+
+	return alerts
+}
+
+// setTLSDetailsToResponse sets the details of a completed TLS handshake
+func setTLSDetailsToResponse(connState *tls.ConnectionState, res *DoEResponse) {
+	if connState == nil || !connState.HandshakeComplete {
+		return
+	}
+
+	res.TLSVersion = tls.VersionName(connState.Version)
+	res.TLSCipherSuite = tls.CipherSuiteName(connState.CipherSuite)
+	res.TLSALPN = connState.NegotiatedProtocol
+	if connState.CurveID != 0 {
+		res.TLSKeyExchangeGroup = connState.CurveID.String()
+	}
+	res.TLSResumed = connState.DidResume
+
+	res.PeerCertificateFingerprints = []string{}
+	for _, cert := range connState.PeerCertificates {
+		res.PeerCertificateFingerprints = append(res.PeerCertificateFingerprints, GetCertificateFingerprint(cert))
+	}
+
+	res.TLSOCSPStatus = getOCSPStatus(connState)
+	res.TLSSCTCount = getSCTCount(connState)
+}
+
+func getOCSPStatus(connState *tls.ConnectionState) string {
+	if len(connState.OCSPResponse) == 0 {
+		return OCSP_STATUS_NONE
+	}
+
+	// verify the signature against the issuer if the server sent it along
+	var issuer *x509.Certificate
+	if len(connState.PeerCertificates) > 1 {
+		issuer = connState.PeerCertificates[1]
+	}
+
+	ocspRes, err := ocsp.ParseResponse(connState.OCSPResponse, issuer)
+	if err != nil {
+		return OCSP_STATUS_INVALID
+	}
+
+	switch ocspRes.Status {
+	case ocsp.Good:
+		return OCSP_STATUS_GOOD
+	case ocsp.Revoked:
+		return OCSP_STATUS_REVOKED
+	default:
+		return OCSP_STATUS_UNKNOWN
+	}
+}
+
+// getSCTCount counts the SCTs sent in the TLS extension and embedded in the leaf certificate
+func getSCTCount(connState *tls.ConnectionState) int {
+	count := len(connState.SignedCertificateTimestamps)
+
+	if len(connState.PeerCertificates) == 0 {
+		return count
+	}
+
+	for _, ext := range connState.PeerCertificates[0].Extensions {
+		if !ext.Id.Equal(oidExtensionSCTList) {
+			continue
+		}
+
+		var list []byte
+		if _, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(list) < 2 {
+			continue
+		}
+
+		// opaque SerializedSCT<1..2^16-1> prefixed by the length of the whole list
+		list = list[2:]
+		for len(list) >= 2 {
+			l := int(binary.BigEndian.Uint16(list))
+			if len(list) < 2+l {
+				break
+			}
+			list = list[2+l:]
+			count++
+		}
+	}
+
+	return count
+}
+
+// GetTLSAlert returns the TLS alert the server sent on a failed handshake, 0 if none
+func GetTLSAlert(err error) uint8 {
+	if err == nil {
+		return 0
+	}
+
+	// QUIC carries the alert as crypto error, see https://www.rfc-editor.org/rfc/rfc9001.html#section-4.8
+	var transportErr *quic.TransportError
+	if errors.As(err, &transportErr) {
+		if transportErr.Remote && transportErr.ErrorCode.IsCryptoError() {
+			return uint8(transportErr.ErrorCode - 0x100)
+		}
+		return 0
+	}
+
+	// crypto/tls wraps received alerts of TCP connections into a net.OpError with an unexported alert type
+	// that cannot be unwrapped into a tls.AlertError, i.e., "remote error: tls: internal error"
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" && opErr.Err != nil {
+		return tlsAlertsByDescription[opErr.Err.Error()]
+	}
+
+	return 0
+}
+
+// setTLSAlertToResponse sets the TLS alert of a failed handshake
+func setTLSAlertToResponse(err error, res *DoEResponse) {
+	if alert := GetTLSAlert(err); alert != 0 {
+		res.TLSAlert = int(alert)
+		res.TLSAlertDescription = tls.AlertError(alert).Error()
+	}
+}
@@ -0,0 +1,202 @@
+package query_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestTLSCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "dot.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"dot.example.com"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// startTestDoTServer starts a local DoT server answering every query with an empty response
+func startTestDoTServer(t *testing.T, tlsConfig *tls.Config) string {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+
+	server := &dns.Server{
+		Listener: listener,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			_ = w.WriteMsg(m)
+		}),
+	}
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	t.Cleanup(func() {
+		_ = server.Shutdown()
+	})
+
+	return listener.Addr().String()
+}
+
+func newLocalDoTQuery(t *testing.T, addr string) *query.DoTQuery {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(addr)
+	require.NoError(t, err)
+
+	q := query.NewDoTQuery()
+	q.Host = host
+	q.Port, err = net.LookupPort("tcp", port)
+	require.NoError(t, err)
+	q.SkipCertificateVerify = true
+	q.Timeout = 2 * time.Second
+
+	return q
+}
+
+func TestDoTQuery_TLSHandshakeDetails(t *testing.T) {
+	t.Parallel()
+
+	t.Run("completed handshake", func(t *testing.T) {
+		t.Parallel()
+
+		cert := createTestTLSCertificate(t)
+		cert.OCSPStaple = []byte("not an OCSP response")
+		cert.SignedCertificateTimestamps = [][]byte{{0x00, 0x01}, {0x00, 0x02}}
+
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS13,
+		})
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(newLocalDoTQuery(t, addr))
+
+		require.Nil(t, err)
+		assert.Equal(t, "TLS 1.3", res.TLSVersion)
+		assert.NotEmpty(t, res.TLSKeyExchangeGroup)
+		assert.Empty(t, res.TLSALPN)
+		assert.False(t, res.TLSResumed)
+		assert.Equal(t, query.OCSP_STATUS_INVALID, res.TLSOCSPStatus)
+		assert.Equal(t, 2, res.TLSSCTCount)
+		assert.Equal(t, []string{query.GetCertificateFingerprint(cert.Leaf)}, res.PeerCertificateFingerprints)
+		assert.Zero(t, res.TLSAlert)
+	})
+
+	t.Run("no stapled OCSP response", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+		})
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(newLocalDoTQuery(t, addr))
+
+		require.Nil(t, err)
+		assert.Equal(t, query.OCSP_STATUS_NONE, res.TLSOCSPStatus)
+		assert.Zero(t, res.TLSSCTCount)
+	})
+
+	t.Run("alert on failed handshake", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoTServer(t, &tls.Config{
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return nil, errors.New("rejected")
+			},
+		})
+
+		res, err := query.NewDefaultDoTHandler(nil).Query(newLocalDoTQuery(t, addr))
+
+		require.NotNil(t, err)
+		assert.Equal(t, 80, res.TLSAlert)
+		assert.Equal(t, "tls: internal error", res.TLSAlertDescription)
+		assert.Empty(t, res.TLSVersion)
+	})
+}
+
+func TestGetTLSAlert(t *testing.T) {
+	t.Parallel()
+
+	t.Run("alert received by crypto/tls", func(t *testing.T) {
+		t.Parallel()
+
+		client, server := net.Pipe()
+		t.Cleanup(func() {
+			_ = client.Close()
+			_ = server.Close()
+		})
+
+		go func() {
+			_ = tls.Server(server, &tls.Config{
+				Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+				MinVersion:   tls.VersionTLS13,
+			}).Handshake()
+			_ = server.Close()
+		}()
+
+		// nolint: gosec
+		err := tls.Client(client, &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS12,
+		}).Handshake()
+
+		require.ErrorContains(t, err, "remote error: tls: protocol version not supported")
+		assert.Equal(t, uint8(70), query.GetTLSAlert(err))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name  string
+			err   error
+			alert uint8
+		}{
+			{"no error", nil, 0},
+			{"remote alert", &net.OpError{Op: "remote error", Err: errors.New("tls: handshake failure")}, 40},
+			{"unknown remote alert", &net.OpError{Op: "remote error", Err: errors.New("tls: alert(200)")}, 200},
+			{"local alert", &net.OpError{Op: "local error", Err: errors.New("tls: handshake failure")}, 0},
+			{"no alert", &net.OpError{Op: "remote error", Err: errors.New("connection reset")}, 0},
+			{"local alert error", fmt.Errorf("handshake: %w", tls.AlertError(112)), 0},
+			{"QUIC crypto error", &quic.TransportError{Remote: true, ErrorCode: 0x100 + 120}, 120},
+			{"local QUIC crypto error", &quic.TransportError{ErrorCode: 0x100 + 120}, 0},
+		}
+
+		for _, test := range tests {
+			assert.Equal(t, test.alert, query.GetTLSAlert(test.err), test.name)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package query
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+)
+
+const TRANSPORT_DO53 = "do53"
+const TRANSPORT_DOT = "dot"
+const TRANSPORT_DOH = "doh"
+const TRANSPORT_DOQ = "doq"
+
+type DoTQueryHandlerI interface {
+	Query(query *DoTQuery) (*DoTResponse, custom_errors.DoEErrors)
+}
+
+type DoHQueryHandlerI interface {
+	Query(query *DoHQuery) (*DoHResponse, custom_errors.DoEErrors)
+}
+
+type DoQQueryHandlerI interface {
+	Query(query *DoQQuery) (*DoQResponse, custom_errors.DoEErrors)
+}
+
+// DNSTransportDescriptor describes the protocol a scan exchanges its DNS messages over, nil means Do53
+type DNSTransportDescriptor struct {
+	// Protocol is one of do53, dot, doh or doq
+	Protocol string `json:"protocol"`
+	// Port overwrites the default port of the protocol (optional)
+	Port int `json:"port"`
+	// SNI for DoT, DoH and DoQ (optional)
+	SNI string `json:"sni"`
+	// DoHPath is the URI template for DoH (default: /dns-query{?dns})
+	DoHPath string `json:"doh_path"`
+	// HTTPVersion for DoH (default: HTTP2)
+	HTTPVersion           string `json:"http_version"`
+	SkipCertificateVerify bool   `json:"skip_certificate_verify"`
+}
+
+func (d *DNSTransportDescriptor) String() string {
+	if d == nil {
+		return TRANSPORT_DO53
+	}
+
+	return fmt.Sprintf("%s|%d|%s|%s|%s|skip_tls_verify_%t", d.Protocol, d.Port, d.SNI, d.DoHPath, d.HTTPVersion, d.SkipCertificateVerify)
+}
+
+// DNSTransportMeta holds the details of a single exchange
+type DNSTransportMeta struct {
+	Protocol string        `json:"protocol"`
+	Host     string        `json:"host"`
+	Port     int           `json:"port"`
+	RTT      time.Duration `json:"rtt"`
+
+	// Conventional is the response of Do53 exchanges including the UDP/TCP attempts
+	Conventional *ConventionalDNSResponse `json:"conventional"`
+	// DoE holds the TLS details of DoT, DoH and DoQ exchanges (without the DNS response)
+	DoE *DoEResponse `json:"doe"`
+}
+
+// DNSTransport exchanges DNS messages with a single host over a specific protocol
+type DNSTransport interface {
+	Exchange(msg *dns.Msg) (*dns.Msg, *DNSTransportMeta, custom_errors.DoEErrors)
+}
+
+type Do53Transport struct {
+	Query        *ConventionalDNSQuery
+	QueryHandler ConventionalDNSQueryHandlerI
+}
+
+func (t *Do53Transport) Exchange(msg *dns.Msg) (*dns.Msg, *DNSTransportMeta, custom_errors.DoEErrors) {
+	q := *t.Query
+	q.QueryMsg = msg.Copy()
+
+	meta := &DNSTransportMeta{Protocol: TRANSPORT_DO53, Host: q.Host, Port: q.Port}
+
+	res, err := t.QueryHandler.Query(&q)
+	meta.Conventional = res
+
+	return getResponseMsgFromConventional(res, meta), meta, err
+}
+
+type DoTTransport struct {
+	Query        *DoTQuery
+	QueryHandler DoTQueryHandlerI
+}
+
+func (t *DoTTransport) Exchange(msg *dns.Msg) (*dns.Msg, *DNSTransportMeta, custom_errors.DoEErrors) {
+	q := *t.Query
+	q.QueryMsg = msg.Copy()
+
+	res, err := t.QueryHandler.Query(&q)
+	if res == nil {
+		return nil, newDoETransportMeta(TRANSPORT_DOT, &q.DoEQuery, nil), err
+	}
+
+	return res.ResponseMsg, newDoETransportMeta(TRANSPORT_DOT, &q.DoEQuery, &res.DoEResponse), err
+}
+
+type DoHTransport struct {
+	Query        *DoHQuery
+	QueryHandler DoHQueryHandlerI
+}
+
+func (t *DoHTransport) Exchange(msg *dns.Msg) (*dns.Msg, *DNSTransportMeta, custom_errors.DoEErrors) {
+	q := *t.Query
+	q.QueryMsg = msg.Copy()
+
+	res, err := t.QueryHandler.Query(&q)
+	if res == nil {
+		return nil, newDoETransportMeta(TRANSPORT_DOH, &q.DoEQuery, nil), err
+	}
+
+	return res.ResponseMsg, newDoETransportMeta(TRANSPORT_DOH, &q.DoEQuery, &res.DoEResponse), err
+}
+
+type DoQTransport struct {
+	Query        *DoQQuery
+	QueryHandler DoQQueryHandlerI
+}
+
+func (t *DoQTransport) Exchange(msg *dns.Msg) (*dns.Msg, *DNSTransportMeta, custom_errors.DoEErrors) {
+	q := *t.Query
+	q.QueryMsg = msg.Copy()
+
+	res, err := t.QueryHandler.Query(&q)
+	if res == nil {
+		return nil, newDoETransportMeta(TRANSPORT_DOQ, &q.DoEQuery, nil), err
+	}
+
+	return res.ResponseMsg, newDoETransportMeta(TRANSPORT_DOQ, &q.DoEQuery, &res.DoEResponse), err
+}
+
+// DNSTransportHandler creates transports for descriptors and sends conventional DNS queries over them
+type DNSTransportHandler struct {
+	Do53 ConventionalDNSQueryHandlerI
+	DoT  DoTQueryHandlerI
+	DoH  DoHQueryHandlerI
+	DoQ  DoQQueryHandlerI
+}
+
+// NewTransport returns the transport of the descriptor, the conventional query provides the host, timeout and DNSSEC flag
+func (h *DNSTransportHandler) NewTransport(q *ConventionalDNSQuery, d *DNSTransportDescriptor) (DNSTransport, custom_errors.DoEErrors) {
+	if q == nil {
+		return nil, custom_errors.NewQueryConfigError(custom_errors.ErrQueryNil, true)
+	}
+
+	if d == nil || d.Protocol == TRANSPORT_DO53 {
+		if h.Do53 == nil {
+			return nil, custom_errors.NewQueryConfigError(custom_errors.ErrQueryHandlerNil, true).AddInfoString(TRANSPORT_DO53)
+		}
+
+		do53Query := *q
+		if d != nil && d.Port != 0 {
+			do53Query.Port = d.Port
+		}
+
+		return &Do53Transport{Query: &do53Query, QueryHandler: h.Do53}, nil
+	}
+
+	switch d.Protocol {
+	case TRANSPORT_DOT:
+		if h.DoT == nil {
+			return nil, custom_errors.NewQueryConfigError(custom_errors.ErrQueryHandlerNil, true).AddInfoString(TRANSPORT_DOT)
+		}
+
+		dotQuery := NewDoTQuery()
+		setDoEQueryFromTransport(&dotQuery.DoEQuery, q, d)
+
+		return &DoTTransport{Query: dotQuery, QueryHandler: h.DoT}, nil
+	case TRANSPORT_DOH:
+		if h.DoH == nil {
+			return nil, custom_errors.NewQueryConfigError(custom_errors.ErrQueryHandlerNil, true).AddInfoString(TRANSPORT_DOH)
+		}
+
+		dohQuery := NewDoHQuery()
+		setDoEQueryFromTransport(&dohQuery.DoEQuery, q, d)
+		if d.DoHPath != "" {
+			dohQuery.URI = d.DoHPath
+		}
+		if d.HTTPVersion != "" {
+			dohQuery.HTTPVersion = d.HTTPVersion
+		}
+
+		return &DoHTransport{Query: dohQuery, QueryHandler: h.DoH}, nil
+	case TRANSPORT_DOQ:
+		if h.DoQ == nil {
+			return nil, custom_errors.NewQueryConfigError(custom_errors.ErrQueryHandlerNil, true).AddInfoString(TRANSPORT_DOQ)
+		}
+
+		doqQuery := NewDoQQuery()
+		setDoEQueryFromTransport(&doqQuery.DoEQuery, q, d)
+
+		return &DoQTransport{Query: doqQuery, QueryHandler: h.DoQ}, nil
+	default:
+		return nil, custom_errors.NewQueryConfigError(custom_errors.ErrInvalidProtocol, true).AddInfoString(d.Protocol)
+	}
+}
+
+// Query sends the conventional query over the transport of the descriptor, Do53 queries are passed to the Do53 handler as is
+func (h *DNSTransportHandler) Query(q *ConventionalDNSQuery, d *DNSTransportDescriptor) (*ConventionalDNSResponse, custom_errors.DoEErrors) {
+	res := &ConventionalDNSResponse{}
+
+	transport, err := h.NewTransport(q, d)
+	if err != nil {
+		return res, err
+	}
+
+	if do53, ok := transport.(*Do53Transport); ok {
+		return h.Do53.Query(do53.Query)
+	}
+
+	msg, meta, err := transport.Exchange(q.QueryMsg)
+	res.Transport = meta
+	if msg != nil {
+		res.Response = &DNSResponse{ResponseMsg: msg, RTT: meta.RTT}
+		setEDNSInfoToResponse(res.Response)
+	}
+
+	return res, err
+}
+
+func NewDNSTransportHandler(config *QueryConfig) (*DNSTransportHandler, error) {
+	dohQueryHandler, err := NewDoHQueryHandler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	doqQueryHandler, err := NewDoQQueryHandler(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DNSTransportHandler{
+		Do53: NewConventionalDNSQueryHandler(config),
+		DoT:  NewDefaultDoTHandler(config),
+		DoH:  dohQueryHandler,
+		DoQ:  doqQueryHandler,
+	}, nil
+}
+
+func setDoEQueryFromTransport(doeQuery *DoEQuery, q *ConventionalDNSQuery, d *DNSTransportDescriptor) {
+	doeQuery.Host = q.Host
+	doeQuery.DNSSEC = q.DNSSEC
+	doeQuery.SNI = d.SNI
+	doeQuery.SkipCertificateVerify = d.SkipCertificateVerify
+
+	if d.Port != 0 {
+		doeQuery.Port = d.Port
+	}
+
+	// conventional queries use -1 to fall back to the UDP/TCP timeouts
+	if q.Timeout > 0 {
+		doeQuery.Timeout = q.Timeout
+	}
+}
+
+func newDoETransportMeta(protocol string, q *DoEQuery, res *DoEResponse) *DNSTransportMeta {
+	meta := &DNSTransportMeta{Protocol: protocol, Host: q.Host, Port: q.Port}
+
+	if res != nil {
+		doe := *res
+		doe.ResponseMsg = nil
+
+		meta.RTT = res.RTT
+		meta.DoE = &doe
+	}
+
+	return meta
+}
+
+func getResponseMsgFromConventional(res *ConventionalDNSResponse, meta *DNSTransportMeta) *dns.Msg {
+	if res == nil || res.Response == nil {
+		return nil
+	}
+
+	meta.RTT = res.Response.RTT
+	return res.Response.ResponseMsg
+}
@@ -0,0 +1,253 @@
+package query_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockedDoQTransportHandler struct {
+	mock.Mock
+}
+
+func (m *mockedDoQTransportHandler) Query(q *query.DoQQuery) (*query.DoQResponse, custom_errors.DoEErrors) {
+	args := m.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.DoQResponse), nil
+	}
+
+	return args.Get(0).(*query.DoQResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+type mockedDoHTransportHandler struct {
+	mock.Mock
+}
+
+func (m *mockedDoHTransportHandler) Query(q *query.DoHQuery) (*query.DoHResponse, custom_errors.DoEErrors) {
+	args := m.Called(q)
+
+	if args.Get(1) == nil {
+		return args.Get(0).(*query.DoHResponse), nil
+	}
+
+	return args.Get(0).(*query.DoHResponse), args.Get(1).(custom_errors.DoEErrors)
+}
+
+func newTransportTestQuery(host string) *query.ConventionalDNSQuery {
+	q := query.NewConventionalQuery()
+	q.Host = host
+	q.DNSSEC = false
+	q.QueryMsg.SetQuestion("version.bind.", dns.TypeTXT)
+	q.QueryMsg.Question[0].Qclass = dns.ClassCHAOS
+	return q
+}
+
+func TestDNSTransportHandler_NewTransport(t *testing.T) {
+	t.Parallel()
+
+	th := &query.DNSTransportHandler{
+		Do53: &mockedConventionalQueryHandler{},
+		DoT:  query.NewDefaultDoTHandler(nil),
+		DoH:  &mockedDoHTransportHandler{},
+		DoQ:  &mockedDoQTransportHandler{},
+	}
+
+	t.Run("Do53 if no descriptor is given", func(t *testing.T) {
+		t.Parallel()
+
+		transport, err := th.NewTransport(newTransportTestQuery("8.8.8.8"), nil)
+
+		require.Nil(t, err)
+		do53, ok := transport.(*query.Do53Transport)
+		require.True(t, ok)
+		assert.Equal(t, query.DEFAULT_DNS_PORT, do53.Query.Port)
+	})
+
+	t.Run("Do53 with port", func(t *testing.T) {
+		t.Parallel()
+
+		q := newTransportTestQuery("8.8.8.8")
+		transport, err := th.NewTransport(q, &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DO53, Port: 5353})
+
+		require.Nil(t, err)
+		assert.Equal(t, 5353, transport.(*query.Do53Transport).Query.Port)
+		assert.Equal(t, query.DEFAULT_DNS_PORT, q.Port, "should not have modified the query")
+	})
+
+	t.Run("DoH with descriptor", func(t *testing.T) {
+		t.Parallel()
+
+		transport, err := th.NewTransport(newTransportTestQuery("8.8.8.8"), &query.DNSTransportDescriptor{
+			Protocol:    query.TRANSPORT_DOH,
+			SNI:         "dns.google",
+			DoHPath:     "/resolve{?dns}",
+			HTTPVersion: query.HTTP_VERSION_3,
+		})
+
+		require.Nil(t, err)
+		doh, ok := transport.(*query.DoHTransport)
+		require.True(t, ok)
+		assert.Equal(t, "8.8.8.8", doh.Query.Host)
+		assert.Equal(t, query.DEFAULT_DOH_PORT, doh.Query.Port)
+		assert.Equal(t, "dns.google", doh.Query.SNI)
+		assert.Equal(t, "/resolve{?dns}", doh.Query.URI)
+		assert.Equal(t, query.HTTP_VERSION_3, doh.Query.HTTPVersion)
+		assert.False(t, doh.Query.DNSSEC, "should have taken the DNSSEC flag of the query")
+	})
+
+	t.Run("DoQ", func(t *testing.T) {
+		t.Parallel()
+
+		transport, err := th.NewTransport(newTransportTestQuery("8.8.8.8"), &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DOQ, Port: 8853})
+
+		require.Nil(t, err)
+		assert.Equal(t, 8853, transport.(*query.DoQTransport).Query.Port)
+	})
+
+	t.Run("invalid protocol", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := th.NewTransport(newTransportTestQuery("8.8.8.8"), &query.DNSTransportDescriptor{Protocol: "smtp"})
+
+		require.NotNil(t, err)
+		assert.True(t, err.IsCritical())
+		assert.Contains(t, err.Error(), custom_errors.ErrInvalidProtocol.Error())
+	})
+
+	t.Run("missing handler", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := (&query.DNSTransportHandler{}).NewTransport(newTransportTestQuery("8.8.8.8"), &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DOT})
+
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), custom_errors.ErrQueryHandlerNil.Error())
+	})
+}
+
+func TestDNSTransport_Exchange(t *testing.T) {
+	t.Parallel()
+
+	t.Run("DoT", func(t *testing.T) {
+		t.Parallel()
+
+		addr := startTestDoTServer(t, &tls.Config{
+			Certificates: []tls.Certificate{createTestTLSCertificate(t)},
+		})
+		host, port, err := net.SplitHostPort(addr)
+		require.NoError(t, err)
+		portNumber, err := net.LookupPort("tcp", port)
+		require.NoError(t, err)
+
+		q := newTransportTestQuery(host)
+		q.Timeout = 2 * time.Second
+
+		th := &query.DNSTransportHandler{DoT: query.NewDefaultDoTHandler(nil)}
+		transport, qErr := th.NewTransport(q, &query.DNSTransportDescriptor{
+			Protocol:              query.TRANSPORT_DOT,
+			Port:                  portNumber,
+			SNI:                   "dot.example.com",
+			SkipCertificateVerify: true,
+		})
+		require.Nil(t, qErr)
+
+		msg, meta, qErr := transport.Exchange(q.QueryMsg)
+
+		require.Nil(t, qErr)
+		require.NotNil(t, msg)
+		assert.Equal(t, "version.bind.", msg.Question[0].Name)
+		assert.Equal(t, query.TRANSPORT_DOT, meta.Protocol)
+		assert.Equal(t, host, meta.Host)
+		assert.Equal(t, portNumber, meta.Port)
+		require.NotNil(t, meta.DoE)
+		assert.NotEmpty(t, meta.DoE.TLSVersion)
+		assert.Nil(t, meta.DoE.ResponseMsg, "should not have duplicated the response")
+		assert.Nil(t, meta.Conventional)
+	})
+
+	t.Run("Do53", func(t *testing.T) {
+		t.Parallel()
+
+		response := &dns.Msg{}
+		response.SetQuestion("version.bind.", dns.TypeTXT)
+
+		qh := &mockedConventionalQueryHandler{}
+		qh.On("Query", mock.Anything).Return(&query.ConventionalDNSResponse{
+			Response:    &query.DNSResponse{ResponseMsg: response, RTT: time.Millisecond},
+			UDPAttempts: 1,
+		}, nil)
+
+		q := newTransportTestQuery("8.8.8.8")
+		transport, qErr := (&query.DNSTransportHandler{Do53: qh}).NewTransport(q, nil)
+		require.Nil(t, qErr)
+
+		msg, meta, qErr := transport.Exchange(q.QueryMsg)
+
+		require.Nil(t, qErr)
+		assert.Equal(t, response, msg)
+		assert.Equal(t, query.TRANSPORT_DO53, meta.Protocol)
+		assert.Equal(t, time.Millisecond, meta.RTT)
+		assert.Equal(t, 1, meta.Conventional.UDPAttempts)
+		assert.NotSame(t, q.QueryMsg, qh.Calls[0].Arguments.Get(0).(*query.ConventionalDNSQuery).QueryMsg, "should have sent a copy of the message")
+	})
+}
+
+func TestDNSTransportHandler_Query(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Do53 is passed to the conventional handler", func(t *testing.T) {
+		t.Parallel()
+
+		res := &query.ConventionalDNSResponse{AttemptErrors: []string{"timeout"}}
+		qh := &mockedConventionalQueryHandler{}
+		qh.On("Query", mock.Anything).Return(res, nil)
+
+		got, err := (&query.DNSTransportHandler{Do53: qh}).Query(newTransportTestQuery("8.8.8.8"), nil)
+
+		assert.Nil(t, err)
+		assert.Same(t, res, got)
+		assert.Nil(t, got.Transport)
+	})
+
+	t.Run("DoQ response is wrapped", func(t *testing.T) {
+		t.Parallel()
+
+		doqRes := &query.DoQResponse{}
+		doqRes.ResponseMsg = new(dns.Msg)
+		doqRes.RTT = 5 * time.Millisecond
+		doqRes.TLSVersion = "TLS 1.3"
+
+		dqh := &mockedDoQTransportHandler{}
+		dqh.On("Query", mock.Anything).Return(doqRes, nil)
+
+		got, err := (&query.DNSTransportHandler{DoQ: dqh}).Query(newTransportTestQuery("8.8.8.8"), &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DOQ})
+
+		require.Nil(t, err)
+		assert.Equal(t, doqRes.ResponseMsg, got.Response.ResponseMsg)
+		assert.Equal(t, 5*time.Millisecond, got.Response.RTT)
+		require.NotNil(t, got.Transport)
+		assert.Equal(t, query.TRANSPORT_DOQ, got.Transport.Protocol)
+		assert.Equal(t, "TLS 1.3", got.Transport.DoE.TLSVersion)
+	})
+
+	t.Run("DoH error", func(t *testing.T) {
+		t.Parallel()
+
+		dhqh := &mockedDoHTransportHandler{}
+		dhqh.On("Query", mock.Anything).Return(&query.DoHResponse{}, custom_errors.NewQueryError(custom_errors.ErrDoHRequestError, true))
+
+		got, err := (&query.DNSTransportHandler{DoH: dhqh}).Query(newTransportTestQuery("8.8.8.8"), &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DOH})
+
+		require.NotNil(t, err)
+		assert.Nil(t, got.Response)
+		assert.Equal(t, query.TRANSPORT_DOH, got.Transport.Protocol)
+	})
+}
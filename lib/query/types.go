@@ -1,6 +1,7 @@
 package query
 
 import (
+	"crypto/x509"
 	"net"
 	"time"
 
@@ -21,10 +22,14 @@ type DNSResponse struct {
 	ResponseMsg *dns.Msg `json:"responsemsg"`
 	// RTT is the round-trip time
 	RTT time.Duration `json:"rtt"`
+	// EDNS holds the OPT record of the response, nil if the response has none
+	EDNS *EDNSInfo `json:"edns"`
 }
 
 type QueryConfig struct {
 	LocalAddr net.IP
+	// RootBundle is an additional pool certificate chains are verified against (optional)
+	RootBundle *x509.CertPool
 }
 
 type DNSQuery struct {
@@ -38,6 +43,10 @@ type DNSQuery struct {
 	Timeout time.Duration `json:"timeout"`
 	// DNSSEC
 	DNSSEC bool `json:"dnssec"`
+	// Cookie sends a random client cookie, see RFC 7873 (default: false)
+	Cookie bool `json:"cookie"`
+	// NSID requests the name server identifier, see RFC 5001 (default: false, true for encrypted queries)
+	NSID bool `json:"nsid"`
 }
 
 // SetDNSSEC sets the DNSSEC flag in the query message
@@ -47,6 +56,12 @@ func (q *DNSQuery) SetDNSSEC() {
 		if q.QueryMsg == nil {
 			q.QueryMsg = new(dns.Msg)
 		}
+
+		// keep the options of an existing OPT record, e.g., the cookie of a probe
+		if opt := q.QueryMsg.IsEdns0(); opt != nil {
+			opt.SetDo()
+			return
+		}
 		q.QueryMsg.SetEdns0(1232, true)
 	}
 }
@@ -64,6 +79,12 @@ type DoEQuery struct {
 
 	SkipCertificateVerify bool   `json:"skip_certificate_verify"`
 	SNI                   string `json:"sni"`
+
+	// ECHConfigList enables Encrypted Client Hello for DoT and DoH (optional)
+	ECHConfigList []byte `json:"ech_config_list"`
+
+	// PaddingBlockLength pads the query to a multiple of the block length with EDNS(0) padding, 0 disables padding (default: 128)
+	PaddingBlockLength int `json:"padding_block_length"`
 }
 
 type DoEResponse struct {
@@ -73,4 +94,31 @@ type DoEResponse struct {
 	TLSCipherSuite      string `json:"tls_cipher_suite"`
 	CertificateVerified bool   `json:"certificate_verified"`
 	CertificateValid    bool   `json:"certificate_valid"`
+
+	// negotiated ALPN protocol, empty if the server did not select any
+	TLSALPN             string `json:"tls_alpn"`
+	TLSKeyExchangeGroup string `json:"tls_key_exchange_group"`
+	TLSResumed          bool   `json:"tls_resumed"`
+	// status of the stapled OCSP response (none, good, revoked, unknown or invalid)
+	TLSOCSPStatus string `json:"tls_ocsp_status"`
+	// number of SCTs sent in the TLS extension and embedded in the leaf certificate
+	TLSSCTCount int `json:"tls_sct_count"`
+	// SHA-256 fingerprints of the presented certificate chain
+	PeerCertificateFingerprints []string `json:"peer_certificate_fingerprints"`
+	// TLS alert sent by the server if the handshake failed (0 if none)
+	TLSAlert            int    `json:"tls_alert"`
+	TLSAlertDescription string `json:"tls_alert_description"`
+
+	// outcome of the ECH handshake (accepted, rejected, retry_configs or failed), empty if ECH was not attempted
+	ECHStatus string `json:"ech_status"`
+	// ECHRetryConfigList is the ECHConfigList the server sent on rejection
+	ECHRetryConfigList []byte `json:"ech_retry_config_list"`
+
+	// ResponseSize is the size of the response message in bytes
+	ResponseSize int `json:"response_size"`
+	// ResponsePadded is set if the response contains the EDNS(0) padding option
+	ResponsePadded        bool `json:"response_padded"`
+	ResponsePaddingLength int  `json:"response_padding_length"`
+	// ResponseBlockPadded is set if the padded response is a multiple of 468 bytes, see RFC 8467
+	ResponseBlockPadded bool `json:"response_block_padded"`
 }
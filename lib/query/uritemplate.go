@@ -0,0 +1,315 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+)
+
+// the variable of the base64url encoded DNS message in DoH URI templates, see https://www.rfc-editor.org/rfc/rfc8484.html#section-4.1
+const DOH_URI_TEMPLATE_VARIABLE = "dns"
+
+// the characters of the reserved set of RFC 3986
+const uriReservedChars = ":/?#[]@!$&'()*+,;="
+
+type uriTemplateOperator struct {
+	first         string
+	sep           string
+	named         bool
+	ifEmpty       string
+	allowReserved bool
+}
+
+// getURITemplateOperator returns the expansion rules of an operator, see https://www.rfc-editor.org/rfc/rfc6570.html#appendix-A
+func getURITemplateOperator(op byte) (uriTemplateOperator, bool) {
+	switch op {
+	case '+':
+		return uriTemplateOperator{sep: ",", allowReserved: true}, true
+	case '#':
+		return uriTemplateOperator{first: "#", sep: ",", allowReserved: true}, true
+	case '.':
+		return uriTemplateOperator{first: ".", sep: "."}, true
+	case '/':
+		return uriTemplateOperator{first: "/", sep: "/"}, true
+	case ';':
+		return uriTemplateOperator{first: ";", sep: ";", named: true}, true
+	case '?':
+		return uriTemplateOperator{first: "?", sep: "&", named: true, ifEmpty: "="}, true
+	case '&':
+		return uriTemplateOperator{first: "&", sep: "&", named: true, ifEmpty: "="}, true
+	default:
+		return uriTemplateOperator{}, false
+	}
+}
+
+type uriTemplateVarSpec struct {
+	name      string
+	maxLength int
+}
+
+type uriTemplateExpression struct {
+	operator uriTemplateOperator
+	varSpecs []uriTemplateVarSpec
+}
+
+// ExpandURITemplate expands a URI template with string values, see https://www.rfc-editor.org/rfc/rfc6570.html
+// variables without value are undefined, malformed expressions are copied as is and reported
+// by the error while the remaining template is still expanded (see section 3 of RFC 6570)
+func ExpandURITemplate(template string, values map[string]string) (string, error) {
+	var expansion strings.Builder
+	var templateErr error
+
+	rest := template
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			expansion.WriteString(encodeURITemplateValue(rest, true))
+			break
+		}
+		expansion.WriteString(encodeURITemplateValue(rest[:start], true))
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			expansion.WriteString(rest[start:])
+			if templateErr == nil {
+				templateErr = fmt.Errorf("%w: unclosed expression %s", custom_errors.ErrMalformedURITemplate, rest[start:])
+			}
+			break
+		}
+		end += start
+
+		expr, err := parseURITemplateExpression(rest[start+1 : end])
+		if err != nil {
+			expansion.WriteString(rest[start : end+1])
+			if templateErr == nil {
+				templateErr = err
+			}
+		} else {
+			expansion.WriteString(expr.expand(values))
+		}
+
+		rest = rest[end+1:]
+	}
+
+	return expansion.String(), templateErr
+}
+
+// GetURITemplateVariables returns the variable names of all well-formed expressions of a URI template
+func GetURITemplateVariables(template string) []string {
+	variables := []string{}
+
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			return variables
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return variables
+		}
+		end += start
+
+		if expr, err := parseURITemplateExpression(rest[start+1 : end]); err == nil {
+			for _, spec := range expr.varSpecs {
+				variables = append(variables, spec.name)
+			}
+		}
+
+		rest = rest[end+1:]
+	}
+}
+
+// ExpandDoHURITemplate expands the URI template of a DoH resolver with the base64url encoded DNS message,
+// an empty message leaves the dns variable undefined as required for POST requests (see RFC 8484, section 4.1)
+// if the template lacks the dns variable, the message is added as dns query parameter to still reach the resolver
+func ExpandDoHURITemplate(template string, dnsParam string) (string, error) {
+	values := map[string]string{}
+	if dnsParam != "" {
+		values[DOH_URI_TEMPLATE_VARIABLE] = dnsParam
+	}
+
+	expansion, err := ExpandURITemplate(template, values)
+
+	// an unclosed expression cannot be part of any path on the server, the error still reports it
+	if start := getUnclosedURITemplateExpression(template); start >= 0 {
+		template = template[:start]
+		expansion, _ = ExpandURITemplate(template, values)
+	}
+
+	if dnsParam == "" || hasDoHURITemplateVariable(template) {
+		return expansion, err
+	}
+
+	u, parseErr := url.Parse(expansion)
+	if parseErr != nil {
+		sep := "?"
+		if strings.Contains(expansion, "?") {
+			sep = "&"
+		}
+		return fmt.Sprintf("%s%s%s=%s", expansion, sep, DOH_URI_TEMPLATE_VARIABLE, dnsParam), err
+	}
+
+	params := u.Query()
+	params.Set(DOH_URI_TEMPLATE_VARIABLE, dnsParam)
+	u.RawQuery = params.Encode()
+
+	return u.String(), err
+}
+
+// getUnclosedURITemplateExpression returns the index of the expression without closing brace, -1 if there is none
+func getUnclosedURITemplateExpression(template string) int {
+	offset := 0
+	for {
+		start := strings.IndexByte(template[offset:], '{')
+		if start < 0 {
+			return -1
+		}
+		start += offset
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return start
+		}
+		offset = start + end + 1
+	}
+}
+
+func hasDoHURITemplateVariable(template string) bool {
+	for _, variable := range GetURITemplateVariables(template) {
+		if variable == DOH_URI_TEMPLATE_VARIABLE {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseURITemplateExpression(raw string) (*uriTemplateExpression, error) {
+	expr := &uriTemplateExpression{}
+
+	if raw == "" {
+		return nil, fmt.Errorf("%w: empty expression", custom_errors.ErrMalformedURITemplate)
+	}
+
+	if op, ok := getURITemplateOperator(raw[0]); ok {
+		expr.operator = op
+		raw = raw[1:]
+	} else if strings.ContainsRune("=,!@|", rune(raw[0])) {
+		// operators reserved for future extensions
+		return nil, fmt.Errorf("%w: reserved operator %c", custom_errors.ErrMalformedURITemplate, raw[0])
+	} else {
+		expr.operator = uriTemplateOperator{sep: ","}
+	}
+
+	for _, rawSpec := range strings.Split(raw, ",") {
+		spec := uriTemplateVarSpec{}
+
+		// explode modifiers have no effect on string values
+		rawSpec = strings.TrimSuffix(rawSpec, "*")
+
+		if name, prefix, found := strings.Cut(rawSpec, ":"); found {
+			maxLength, err := strconv.Atoi(prefix)
+			if err != nil || maxLength <= 0 || maxLength >= 10000 || strings.HasPrefix(prefix, "+") {
+				return nil, fmt.Errorf("%w: invalid prefix modifier %s", custom_errors.ErrMalformedURITemplate, rawSpec)
+			}
+			rawSpec = name
+			spec.maxLength = maxLength
+		}
+
+		if !isValidURITemplateVarName(rawSpec) {
+			return nil, fmt.Errorf("%w: invalid variable name %s", custom_errors.ErrMalformedURITemplate, rawSpec)
+		}
+		spec.name = rawSpec
+
+		expr.varSpecs = append(expr.varSpecs, spec)
+	}
+
+	return expr, nil
+}
+
+func isValidURITemplateVarName(name string) bool {
+	if name == "" || name[0] == '.' || name[len(name)-1] == '.' || strings.Contains(name, "..") {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.':
+		case c == '%' && i+2 < len(name) && isHexDigit(name[i+1]) && isHexDigit(name[i+2]):
+			i += 2
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (expr *uriTemplateExpression) expand(values map[string]string) string {
+	var expansion strings.Builder
+
+	first := true
+	for _, spec := range expr.varSpecs {
+		value, defined := values[spec.name]
+		if !defined {
+			continue
+		}
+
+		if first {
+			expansion.WriteString(expr.operator.first)
+			first = false
+		} else {
+			expansion.WriteString(expr.operator.sep)
+		}
+
+		if expr.operator.named {
+			expansion.WriteString(spec.name)
+			if value == "" {
+				expansion.WriteString(expr.operator.ifEmpty)
+				continue
+			}
+			expansion.WriteString("=")
+		}
+
+		if spec.maxLength > 0 && utf8.RuneCountInString(value) > spec.maxLength {
+			value = string([]rune(value)[:spec.maxLength])
+		}
+
+		expansion.WriteString(encodeURITemplateValue(value, expr.operator.allowReserved))
+	}
+
+	return expansion.String()
+}
+
+// encodeURITemplateValue percent-encodes all characters except unreserved ones,
+// reserved characters and percent-encoded triplets are kept if allowed
+func encodeURITemplateValue(value string, allowReserved bool) string {
+	var encoded strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			encoded.WriteByte(c)
+		case allowReserved && strings.IndexByte(uriReservedChars, c) >= 0:
+			encoded.WriteByte(c)
+		case allowReserved && c == '%' && i+2 < len(value) && isHexDigit(value[i+1]) && isHexDigit(value[i+2]):
+			encoded.WriteString(value[i : i+3])
+			i += 2
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+
+	return encoded.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,135 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandURITemplate(t *testing.T) {
+	t.Parallel()
+
+	// examples of RFC 6570, section 1.2 and 3.2
+	values := map[string]string{
+		"var":   "value",
+		"hello": "Hello World!",
+		"path":  "/foo/bar",
+		"x":     "1024",
+		"y":     "768",
+		"empty": "",
+	}
+
+	tests := map[string]string{
+		"{var}":              "value",
+		"{hello}":            "Hello%20World%21",
+		"{+hello}":           "Hello%20World!",
+		"{+path}/here":       "/foo/bar/here",
+		"{#path,x}/here":     "#/foo/bar,1024/here",
+		"map?{x,y}":          "map?1024,768",
+		"X{.var}":            "X.value",
+		"{/var,x}/here":      "/value/1024/here",
+		"{;x,y,empty}":       ";x=1024;y=768;empty",
+		"{?x,y,empty}":       "?x=1024&y=768&empty=",
+		"?fixed=yes{&x}":     "?fixed=yes&x=1024",
+		"{var:3}":            "val",
+		"{?undef}":           "",
+		"{/undef,var}":       "/value",
+		"/dns-query{?dns*}":  "/dns-query",
+		"{?var,undef,x}/end": "?var=value&x=1024/end",
+	}
+
+	for template, expected := range tests {
+		t.Run(template, func(t *testing.T) {
+			t.Parallel()
+
+			expansion, err := query.ExpandURITemplate(template, values)
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected, expansion)
+		})
+	}
+
+	t.Run("malformed expressions", func(t *testing.T) {
+		t.Parallel()
+
+		for _, template := range []string{"/a{}b", "/a{=var}b", "/a{va r}b", "/a{var:0}b", "/a{.var.}b"} {
+			expansion, err := query.ExpandURITemplate(template, values)
+
+			assert.Error(t, err, template)
+			assert.Contains(t, err.Error(), custom_errors.ErrMalformedURITemplate.Error())
+			assert.Contains(t, expansion, "/a{", "should copy the malformed expression")
+		}
+	})
+
+	t.Run("continue after malformed expression", func(t *testing.T) {
+		t.Parallel()
+
+		expansion, err := query.ExpandURITemplate("/{!x}{/var}", values)
+
+		assert.Error(t, err)
+		assert.Equal(t, "/{!x}/value", expansion)
+	})
+
+	t.Run("unclosed expression", func(t *testing.T) {
+		t.Parallel()
+
+		expansion, err := query.ExpandURITemplate("/dns-query{?dns", values)
+
+		assert.Error(t, err)
+		assert.Equal(t, "/dns-query{?dns", expansion)
+	})
+}
+
+func TestGetURITemplateVariables(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"dns", "version", "x"}, query.GetURITemplateVariables("/q{dns}{/version}{?x:3}{!y}{?z"))
+	assert.Empty(t, query.GetURITemplateVariables("/dns-query?dns"))
+}
+
+func TestExpandDoHURITemplate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		template string
+		dns      string
+		expected string
+	}{
+		{name: "standard", template: "/dns-query{?dns}", dns: "AAAB", expected: "/dns-query?dns=AAAB"},
+		{name: "POST", template: "/dns-query{?dns}", dns: "", expected: "/dns-query"},
+		{name: "extra query parameters", template: "/dns-query{?dns}&foo=bar", dns: "AAAB", expected: "/dns-query?dns=AAAB&foo=bar"},
+		{name: "multiple variables", template: "/dns-query{?dns,other}", dns: "AAAB", expected: "/dns-query?dns=AAAB"},
+		{name: "path expansion", template: "/resolve{/dns}", dns: "AAAB", expected: "/resolve/AAAB"},
+		{name: "without variable", template: "/dns-query", dns: "AAAB", expected: "/dns-query?dns=AAAB"},
+		{name: "literal dns parameter", template: "/dns-query?dns", dns: "AAAB", expected: "/dns-query?dns=AAAB"},
+		{name: "other variable", template: "/dns-query{?query}", dns: "AAAB", expected: "/dns-query?dns=AAAB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			expansion, err := query.ExpandDoHURITemplate(tt.template, tt.dns)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, expansion)
+		})
+	}
+
+	t.Run("unclosed expression", func(t *testing.T) {
+		t.Parallel()
+
+		expansion, err := query.ExpandDoHURITemplate("/dns-query{?dns", "AAAB")
+
+		assert.ErrorIs(t, err, custom_errors.ErrMalformedURITemplate)
+		assert.Equal(t, "/dns-query?dns=AAAB", expansion, "should drop the unclosed expression")
+
+		expansion, err = query.ExpandDoHURITemplate("/dns-query{?dns", "")
+
+		assert.ErrorIs(t, err, custom_errors.ErrMalformedURITemplate)
+		assert.Equal(t, "/dns-query", expansion, "POST requests should drop the unclosed expression as well")
+	})
+}
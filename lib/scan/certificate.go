@@ -12,6 +12,11 @@ const CERTIFICATE_SCAN_TYPE = "certificate"
 
 type CertificateScanMetaInformation struct {
 	ScanMetaInformation
+
+	// OriginResolver is the unencrypted resolver of the DDR scan that scheduled this scan (if any)
+	OriginResolver string `json:"origin_resolver"`
+	// TargetName is the SVCB target name of the designated resolver (if any)
+	TargetName string `json:"target_name"`
 }
 
 type CertificateScan struct {
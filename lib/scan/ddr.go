@@ -3,6 +3,7 @@ package scan
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"slices"
 
 	"github.com/miekg/dns"
@@ -14,6 +15,9 @@ import (
 
 const DDR_SCAN_TYPE = "DDR"
 
+// see https://www.rfc-editor.org/rfc/rfc9460.html#section-2.4.2
+const MAX_DDR_ALIAS_DEPTH = 8
+
 type DDRScanMetaInformation struct {
 	ScanMetaInformation
 
@@ -21,6 +25,14 @@ type DDRScanMetaInformation struct {
 	ScheduleDoEScans        bool   `json:"schedule_doe_scans"`
 	ScheduleFingerprintScan bool   `json:"schedule_fingerprint_scan"`
 	PTRScheduled            bool   `json:"ptr_scheduled"`
+	// ScheduleTLSEnumScans schedules TLS version and cipher suite enumeration scans for the discovered DoT and DoH endpoints
+	ScheduleTLSEnumScans bool `json:"schedule_tls_enum_scans"`
+	// ScheduleSessionScans schedules connection reuse and pipelining scans for the discovered DoT, DoH and DoQ endpoints
+	ScheduleSessionScans bool `json:"schedule_session_scans"`
+	// ScheduleResumptionScans schedules TLS session resumption and 0-RTT scans for the discovered DoT, DoH and DoQ endpoints
+	ScheduleResumptionScans bool `json:"schedule_resumption_scans"`
+	// AliasDepth is the number of AliasMode records followed to reach this scan
+	AliasDepth int `json:"alias_depth"`
 }
 
 type DDRScan struct {
@@ -29,6 +41,8 @@ type DDRScan struct {
 	Meta   *DDRScanMetaInformation        `json:"meta"`
 	Query  *query.ConventionalDNSQuery    `json:"query"`
 	Result *query.ConventionalDNSResponse `json:"result"`
+	// Compliance holds the RFC 9460 violations of the SVCB RRset
+	Compliance []*svcb.ComplianceFinding `json:"compliance"`
 }
 
 func (scan *DDRScan) Marshal() (bytes []byte, err error) {
@@ -48,10 +62,17 @@ func (scan *DDRScan) GetType() string {
 }
 
 func (scan *DDRScan) GetIdentifier() string {
-	return fmt.Sprintf("%s|%s|%d",
+	// the query name differs for scans that follow an AliasMode record
+	name := ""
+	if scan.Query.QueryMsg != nil && len(scan.Query.QueryMsg.Question) > 0 {
+		name = scan.Query.QueryMsg.Question[0].Name
+	}
+
+	return fmt.Sprintf("%s|%s|%d|%s",
 		DDR_SCAN_TYPE,
 		scan.Query.Host,
-		scan.Query.Port)
+		scan.Query.Port,
+		name)
 }
 
 func (scan *DDRScan) CreateScansFromResponse() ([]Scan, []custom_errors.DoEErrors) {
@@ -71,7 +92,9 @@ func (scan *DDRScan) CreateScansFromResponse() ([]Scan, []custom_errors.DoEError
 	}
 
 	dnssecOrigins := []string{}
+	obliviousOrigins := []string{}
 
+	svcbRecords := []*dns.SVCB{}
 	for _, answer := range scan.Result.Response.ResponseMsg.Answer {
 		svcbRecord, ok := answer.(*dns.SVCB)
 		if !ok {
@@ -79,7 +102,19 @@ func (scan *DDRScan) CreateScansFromResponse() ([]Scan, []custom_errors.DoEError
 			errorColl = append(errorColl, custom_errors.NewQueryError(custom_errors.ErrInvalidSVCBRR, false).AddInfoString("could not cast DNS answer to SVCB"))
 			continue
 		}
+		svcbRecords = append(svcbRecords, svcbRecord)
+	}
+
+	scan.Compliance = svcb.CheckCompliance(svcbRecords)
 
+	aliases, services := svcb.SplitByMode(svcbRecords)
+
+	// ServiceMode records must be ignored if there is an AliasMode record, see https://www.rfc-editor.org/rfc/rfc9460.html#section-2.4.1
+	if len(aliases) > 0 {
+		return scan.produceAliasScans(aliases), errorColl
+	}
+
+	for _, svcbRecord := range services {
 		svcb, err := svcb.ParseDDRSVCB(scan.Meta.ScanId, svcbRecord)
 		errorColl = append(errorColl, err...)
 		if custom_errors.ContainsCriticalErr(err) {
@@ -94,16 +129,26 @@ func (scan *DDRScan) CreateScansFromResponse() ([]Scan, []custom_errors.DoEError
 			dnssecOrigins = append(dnssecOrigins, dnssec.GetIdentifier())
 		}
 
+		// create ODoH and OHTTP scans for the target name and ip hints if the resolver announces oblivious support (SVCB key 8)
+		if svcb.ODoH {
+			for _, oblivious := range produceObliviousScans(scan.Meta.ScanId, scan.Meta.RunId, scan.Meta.VantagePoint, svcb) {
+				if !slices.Contains(obliviousOrigins, oblivious.GetIdentifier()) {
+					scans = append(scans, oblivious)
+					obliviousOrigins = append(obliviousOrigins, oblivious.GetIdentifier())
+				}
+			}
+		}
+
 		// create DoE scans for each ALPN and ip hint
 		for _, alpn := range svcb.Alpn.Alpn {
-			s, e := produceScansFromAlpn(scan.Meta.ScanId, scan.Meta.RunId, scan.Meta.VantagePoint, svcb.Target, svcb.Target, alpn, svcb)
+			s, e := produceScansFromAlpn(scan.Meta.ScanId, scan.Meta.RunId, scan.Meta.VantagePoint, scan.Query.Host, svcb.Target, svcb.Target, alpn, svcb, scan.Meta.ScheduleTLSEnumScans, scan.Meta.ScheduleSessionScans, scan.Meta.ScheduleResumptionScans)
 			scans = append(scans, s...)
 			errorColl = append(errorColl, e...)
 
 			if svcb.IPv4Hint != nil {
 				for _, ipv4 := range svcb.IPv4Hint.Hint {
 					// create DoE scans for IPv4 hints
-					s, e := produceScansFromAlpn(scan.Meta.ScanId, scan.Meta.RunId, scan.Meta.VantagePoint, svcb.Target, ipv4.String(), alpn, svcb)
+					s, e := produceScansFromAlpn(scan.Meta.ScanId, scan.Meta.RunId, scan.Meta.VantagePoint, scan.Query.Host, svcb.Target, ipv4.String(), alpn, svcb, scan.Meta.ScheduleTLSEnumScans, scan.Meta.ScheduleSessionScans, scan.Meta.ScheduleResumptionScans)
 					scans = append(scans, s...)
 					errorColl = append(errorColl, e...)
 
@@ -118,7 +163,7 @@ func (scan *DDRScan) CreateScansFromResponse() ([]Scan, []custom_errors.DoEError
 
 			if svcb.IPv6Hint != nil {
 				for _, ipv6 := range svcb.IPv6Hint.Hint {
-					s, e := produceScansFromAlpn(scan.Meta.ScanId, scan.Meta.RunId, scan.Meta.VantagePoint, svcb.Target, ipv6.String(), alpn, svcb)
+					s, e := produceScansFromAlpn(scan.Meta.ScanId, scan.Meta.RunId, scan.Meta.VantagePoint, scan.Query.Host, svcb.Target, ipv6.String(), alpn, svcb, scan.Meta.ScheduleTLSEnumScans, scan.Meta.ScheduleSessionScans, scan.Meta.ScheduleResumptionScans)
 					scans = append(scans, s...)
 					errorColl = append(errorColl, e...)
 
@@ -164,6 +209,65 @@ func (scan *DDRScan) CreateScansFromResponse() ([]Scan, []custom_errors.DoEError
 	return scans, errorColl
 }
 
+// produceAliasScans follows AliasMode records by querying the alias target at the same resolver
+func (scan *DDRScan) produceAliasScans(aliases []*dns.SVCB) []Scan {
+	scans := []Scan{}
+	targets := []string{}
+
+	name := ""
+	if scan.Query.QueryMsg != nil && len(scan.Query.QueryMsg.Question) > 0 {
+		name = scan.Query.QueryMsg.Question[0].Name
+	}
+
+	for _, alias := range aliases {
+		target := dns.Fqdn(alias.Target)
+
+		// the root name indicates that the service is not available, see https://www.rfc-editor.org/rfc/rfc9460.html#section-2.5.1
+		if target == "." || slices.Contains(targets, target) {
+			continue
+		}
+		targets = append(targets, target)
+
+		if target == name {
+			scan.Compliance = append(scan.Compliance, svcb.NewComplianceFinding(svcb.COMPLIANCE_ALIAS_LOOP, alias, fmt.Sprintf("%s aliases itself", name), true))
+			continue
+		}
+
+		if scan.Meta.AliasDepth >= MAX_DDR_ALIAS_DEPTH {
+			logrus.Warnf("parsing DDR scan %s: alias chain exceeds %d records, do not follow %s", scan.Meta.ScanId, MAX_DDR_ALIAS_DEPTH, target)
+			scan.Compliance = append(scan.Compliance, svcb.NewComplianceFinding(svcb.COMPLIANCE_ALIAS_CHAIN_TOO_LONG, alias, fmt.Sprintf("more than %d AliasMode records", MAX_DDR_ALIAS_DEPTH), true))
+			continue
+		}
+
+		q := *scan.Query
+		q.QueryMsg = new(dns.Msg)
+		if scan.Query.QueryMsg != nil {
+			q.QueryMsg = scan.Query.QueryMsg.Copy()
+		}
+		q.QueryMsg.SetQuestion(target, dns.TypeSVCB)
+
+		rootScanId := scan.Meta.RootScanId
+		if rootScanId == "" {
+			rootScanId = scan.Meta.ScanId
+		}
+
+		aliasScan := NewDDRScan(&q, scan.Meta.ScheduleDoEScans, scan.Meta.RunId, scan.Meta.VantagePoint)
+		aliasScan.Meta.ScanMetaInformation = *NewScanMetaInformation(scan.Meta.ScanId, rootScanId, scan.Meta.RunId, scan.Meta.VantagePoint)
+		aliasScan.Meta.IpVersion = scan.Meta.IpVersion
+		aliasScan.Meta.ScheduleTLSEnumScans = scan.Meta.ScheduleTLSEnumScans
+		aliasScan.Meta.ScheduleSessionScans = scan.Meta.ScheduleSessionScans
+		aliasScan.Meta.ScheduleResumptionScans = scan.Meta.ScheduleResumptionScans
+		aliasScan.Meta.AliasDepth = scan.Meta.AliasDepth + 1
+		// the resolver is fingerprinted by the origin DDR scan already
+		aliasScan.Meta.ScheduleFingerprintScan = false
+
+		scans = append(scans, aliasScan)
+		logrus.Debugf("produced DDR scan for alias target %s of %s", target, name)
+	}
+
+	return scans
+}
+
 func NewDDRScan(q *query.ConventionalDNSQuery, scheduleDoEScans bool, runId string, vantagePoint string) *DDRScan {
 	if q == nil {
 		q = query.NewDDRQuery()
@@ -185,10 +289,14 @@ func produceScansFromAlpn(
 	parentScanId string,
 	runId string,
 	vantagePoint string,
+	originResolver string,
 	targetName string,
 	host string,
 	alpn string,
 	svcb *svcb.SVCBRR,
+	scheduleTLSEnumScan bool,
+	scheduleSessionScan bool,
+	scheduleResumptionScan bool,
 ) (
 	scans []Scan,
 	err []custom_errors.DoEErrors,
@@ -223,6 +331,9 @@ func produceScansFromAlpn(
 
 	var doeScan DoEScan
 
+	// TLS enumeration is limited to endpoints on top of TCP
+	tlsEnumerable := false
+
 	switch alpn {
 	case "doq":
 		q := query.NewDoQQuery()
@@ -250,6 +361,7 @@ func produceScansFromAlpn(
 
 		// empty ALPN for DoT
 		certQuery.Port = doeScan.GetDoEQuery().Port
+		tlsEnumerable = true
 
 		logrus.Debugf("produced DoT scan from ALPN %s for %s on %d with SNI %s", alpn, host, q.Port, targetName)
 	case "h1", "http/1.0", "http/1.1":
@@ -258,6 +370,7 @@ func produceScansFromAlpn(
 		if sErr == nil || !sErr.IsCritical() {
 			certQuery.Port = dohScan.Query.Port
 			doeScan = dohScan
+			tlsEnumerable = true
 
 			logrus.Debugf("produced DoH http1 scan from ALPN %s for %s on %d with SNI %s", alpn, host, dohScan.Query.Port, targetName)
 		} else {
@@ -273,6 +386,7 @@ func produceScansFromAlpn(
 		if sErr == nil || !sErr.IsCritical() {
 			certQuery.Port = dohScan.Query.Port
 			doeScan = dohScan
+			tlsEnumerable = true
 
 			logrus.Debugf("produced DoH http2 scan from ALPN %s for %s on %d with SNI %s", alpn, host, dohScan.Query.Port, targetName)
 		} else {
@@ -303,10 +417,25 @@ func produceScansFromAlpn(
 	}
 
 	if doeScan != nil {
+		// attempt ECH on DoT and DoH if the resolver announces an ECHConfigList
+		if svcb.ECH != nil {
+			switch doeScan.(type) {
+			case *DoTScan, *DoHScan:
+				doeScan.GetDoEQuery().ECHConfigList = svcb.ECH.ECH
+			}
+		}
+
 		scans = append(scans, doeScan)
 
+		// the DoH scan falls back to the default path, let's probe common paths to check the fallback
+		if dohScan, ok := doeScan.(*DoHScan); ok && dohpath == nil {
+			scans = append(scans, NewDoHPathScanFromDoHScan(dohScan, parentScanId, runId, vantagePoint))
+			logrus.Debugf("produced DoH path discovery scan for ALPN %s", alpn)
+		}
+
 		// let's create an EDSR scan for the discovered protocol
 		edsrScan := NewEDSRScan(targetName, host, alpn, doeScan.GetMetaInformation().ScanId, parentScanId, runId, vantagePoint)
+		edsrScan.SVCB = svcb
 		scans = append(scans, edsrScan)
 
 		// Resinfo scan
@@ -316,13 +445,95 @@ func produceScansFromAlpn(
 		// create certificate scan
 		certScan := NewCertificateScan(certQuery, parentScanId, doeScan.GetMetaInformation().ScanId, runId, vantagePoint)
 		certScan.Meta.Children = []string{doeScan.GetMetaInformation().ScanId}
+		// link the certificate scan to the DDR scan for verified discovery, see https://www.rfc-editor.org/rfc/rfc9462.html#section-4.2
+		certScan.Meta.OriginResolver = originResolver
+		certScan.Meta.TargetName = targetName
 		scans = append(scans, certScan)
 		logrus.Debugf("produced certificate scan for ALPN %s", alpn)
+
+		if scheduleTLSEnumScan && tlsEnumerable {
+			enumQuery := query.NewTLSEnumQuery()
+			enumQuery.Host = certQuery.Host
+			enumQuery.Port = certQuery.Port
+			enumQuery.SNI = certQuery.SNI
+			enumQuery.ALPN = certQuery.ALPN
+
+			scans = append(scans, NewTLSEnumScan(enumQuery, doeScan.GetMetaInformation().ScanId, parentScanId, runId, vantagePoint))
+			logrus.Debugf("produced TLS enumeration scan for ALPN %s", alpn)
+		}
+
+		if scheduleSessionScan {
+			if sessionScan := NewSessionScanFromDoEScan(doeScan, parentScanId, runId, vantagePoint); sessionScan != nil {
+				scans = append(scans, sessionScan)
+				logrus.Debugf("produced session scan for ALPN %s", alpn)
+			}
+		}
+
+		if scheduleResumptionScan {
+			if resumptionScan := NewResumptionScanFromDoEScan(doeScan, parentScanId, runId, vantagePoint); resumptionScan != nil {
+				scans = append(scans, resumptionScan)
+				logrus.Debugf("produced resumption scan for ALPN %s", alpn)
+			}
+		}
 	}
 
 	return
 }
 
+func produceObliviousScans(parentScanId string, runId string, vantagePoint string, svcb *svcb.SVCBRR) []Scan {
+	hosts := []string{svcb.Target}
+	if svcb.IPv4Hint != nil {
+		for _, ipv4 := range svcb.IPv4Hint.Hint {
+			hosts = append(hosts, ipv4.String())
+		}
+	}
+	if svcb.IPv6Hint != nil {
+		for _, ipv6 := range svcb.IPv6Hint.Hint {
+			hosts = append(hosts, ipv6.String())
+		}
+	}
+
+	// the target path is the DoH path of the target, see https://www.rfc-editor.org/rfc/rfc9540.html#section-4
+	targetPath := query.DEFAULT_ODOH_TARGET_PATH
+	if svcb.DoHPath != nil {
+		// query parameters of the template are not part of the target path
+		expansion, _ := query.ExpandDoHURITemplate(svcb.DoHPath.Template, "")
+		if u, err := url.Parse(expansion); err == nil && u.Path != "" {
+			targetPath = u.Path
+		}
+	}
+
+	scans := []Scan{}
+	for _, host := range hosts {
+		q := query.NewODoHQuery()
+		q.Host = host
+		q.SNI = svcb.Target
+		q.TargetPath = targetPath
+		if svcb.Port != nil {
+			q.Port = int(svcb.Port.Port)
+		}
+
+		scans = append(scans, NewODoHScan(q, parentScanId, parentScanId, runId, vantagePoint))
+
+		logrus.Debugf("produced ODoH scan for %s on %d with SNI %s", host, q.Port, svcb.Target)
+
+		// the OHTTP gateway is located on the same host, see https://www.rfc-editor.org/rfc/rfc9540.html#section-3
+		oq := query.NewOHTTPQuery()
+		oq.Host = host
+		oq.SNI = svcb.Target
+		oq.TargetPath = targetPath
+		if svcb.Port != nil {
+			oq.Port = int(svcb.Port.Port)
+		}
+
+		scans = append(scans, NewOHTTPScan(oq, parentScanId, parentScanId, runId, vantagePoint))
+
+		logrus.Debugf("produced OHTTP scan for %s on %d with SNI %s", host, oq.Port, svcb.Target)
+	}
+
+	return scans
+}
+
 func createDoHScan(
 	parentScanId string,
 	runId string,
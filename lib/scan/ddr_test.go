@@ -9,6 +9,7 @@ import (
 	"github.com/miekg/dns"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/svcb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -201,6 +202,7 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 		assert.Equal(t, 3, c[scan.CERTIFICATE_SCAN_TYPE])
 		assert.Equal(t, 3, c[scan.EDSR_SCAN_TYPE])
 		assert.Equal(t, 1, c[scan.DDR_DNSSEC_SCAN_TYPE])
+		assert.Equal(t, 3, c[scan.DOH_PATH_SCAN_TYPE], "should probe common paths for each HTTP version")
 
 		for _, err := range errors {
 			assert.NotNil(t, err, "should have returned an error")
@@ -208,7 +210,7 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 		}
 
 		for _, ss := range scans {
-			assert.Contains(t, []string{scan.CERTIFICATE_SCAN_TYPE, scan.DOH_SCAN_TYPE, scan.EDSR_SCAN_TYPE, scan.RESINFO_SCAN_TYPE, scan.DDR_DNSSEC_SCAN_TYPE}, ss.GetType(), "should have returned DoH or certificate scan types")
+			assert.Contains(t, []string{scan.CERTIFICATE_SCAN_TYPE, scan.DOH_SCAN_TYPE, scan.EDSR_SCAN_TYPE, scan.RESINFO_SCAN_TYPE, scan.DDR_DNSSEC_SCAN_TYPE, scan.DOH_PATH_SCAN_TYPE}, ss.GetType(), "should have returned DoH or certificate scan types")
 
 			switch ss.GetType() {
 			case scan.CERTIFICATE_SCAN_TYPE:
@@ -227,6 +229,13 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 				assert.Equal(t, SAMPLE_TARGET, dohScan.Query.Host, "should have returned SAMPLE_TARGET")
 				assert.Equal(t, query.DEFAULT_DOH_PATH, dohScan.Query.URI, "should have returned default template URI")
 				assert.Equal(t, query.DEFAULT_DOH_PORT, dohScan.Query.Port, "should have returned default port")
+			case scan.DOH_PATH_SCAN_TYPE:
+				pathScan, ok := ss.(*scan.DoHPathScan)
+				require.True(t, ok, "should have returned a DoH path scan")
+
+				assert.Equal(t, SAMPLE_TARGET, pathScan.Query.Host)
+				assert.Equal(t, query.DEFAULT_DOH_PORT, pathScan.Query.Port)
+				assert.Equal(t, query.DEFAULT_DOH_DISCOVERY_PATHS, pathScan.Query.Paths)
 			case scan.EDSR_SCAN_TYPE:
 				// cast to DoH scan
 				edsrScan, ok := ss.(*scan.EDSRScan)
@@ -290,6 +299,7 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 		assert.Equal(t, 3, c[scan.CERTIFICATE_SCAN_TYPE])
 		assert.Equal(t, 3, c[scan.EDSR_SCAN_TYPE])
 		assert.Equal(t, 1, c[scan.DDR_DNSSEC_SCAN_TYPE])
+		assert.Equal(t, 3, c[scan.DOH_PATH_SCAN_TYPE], "should probe common paths for each HTTP version")
 
 		for _, err := range errors {
 			assert.NotNil(t, err, "should have returned an error")
@@ -297,7 +307,7 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 		}
 
 		for _, ss := range scans {
-			assert.Contains(t, []string{scan.CERTIFICATE_SCAN_TYPE, scan.DOH_SCAN_TYPE, scan.EDSR_SCAN_TYPE, scan.RESINFO_SCAN_TYPE, scan.DDR_DNSSEC_SCAN_TYPE}, ss.GetType(), "should have returned DoH or certificate scan types")
+			assert.Contains(t, []string{scan.CERTIFICATE_SCAN_TYPE, scan.DOH_SCAN_TYPE, scan.EDSR_SCAN_TYPE, scan.RESINFO_SCAN_TYPE, scan.DDR_DNSSEC_SCAN_TYPE, scan.DOH_PATH_SCAN_TYPE}, ss.GetType(), "should have returned DoH or certificate scan types")
 
 			switch ss.GetType() {
 			case scan.CERTIFICATE_SCAN_TYPE:
@@ -316,6 +326,11 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 				assert.Equal(t, SAMPLE_TARGET, dohScan.Query.Host, "should have returned target")
 				assert.Equal(t, query.DEFAULT_DOH_PATH, dohScan.Query.URI, "should have returned default template URI")
 				assert.Equal(t, int(port), dohScan.Query.Port, "should have returned default port")
+			case scan.DOH_PATH_SCAN_TYPE:
+				pathScan, ok := ss.(*scan.DoHPathScan)
+				require.True(t, ok, "should have returned a DoH path scan")
+
+				assert.Equal(t, int(port), pathScan.Query.Port)
 			case scan.EDSR_SCAN_TYPE:
 				// cast to DoH scan
 				edsrScan, ok := ss.(*scan.EDSRScan)
@@ -382,6 +397,7 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 		assert.Equal(t, 3, c[scan.CERTIFICATE_SCAN_TYPE])
 		assert.Equal(t, 3, c[scan.EDSR_SCAN_TYPE])
 		assert.Equal(t, 1, c[scan.DDR_DNSSEC_SCAN_TYPE])
+		assert.Zero(t, c[scan.DOH_PATH_SCAN_TYPE], "should not probe paths if the dohpath is given")
 
 		for _, err := range errors {
 			require.Nil(t, err, "should have returned an error")
@@ -436,6 +452,7 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 		t.Parallel()
 
 		q := query.NewDDRQuery()
+		q.Host = "1.1.1.1"
 		s := scan.NewDDRScan(q, false, "test", "runid")
 
 		port := uint16(4443)
@@ -502,6 +519,8 @@ func TestDDRScan_CreateScansFromResponse_DoH(t *testing.T) {
 				require.True(t, ok, "should have returned a certificate scan")
 
 				assert.Equal(t, int(port), certScan.Query.Port, "should have returned default port")
+				assert.Equal(t, SAMPLE_TARGET, certScan.Meta.TargetName, "should have linked the SVCB target name")
+				assert.Equal(t, q.Host, certScan.Meta.OriginResolver, "should have linked the origin resolver")
 				if certScan.Query.Host == ipv4HintHost {
 					assert.NotEmpty(t, certScan.Query.SNI, "should not have returned empty SNI")
 					certIPConsidered = true
@@ -1298,6 +1317,119 @@ func TestDDRScan_CreateScansFromResponse_DoQ(t *testing.T) {
 	})
 }
 
+func TestDDRScan_CreateScansFromResponse_ODoH(t *testing.T) {
+	t.Parallel()
+
+	createSVCB := func(ohttp bool, ipv4Hint net.IP) *dns.SVCB {
+		rr := &dns.SVCB{
+			Priority: 1,
+			Target:   SAMPLE_TARGET,
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{
+					Alpn: []string{"h2", "h3"},
+				},
+				&dns.SVCBPort{
+					Port: 443,
+				},
+				&dns.SVCBDoHPath{
+					Template: VALID_QUERY_PATH,
+				},
+			},
+		}
+
+		if ipv4Hint != nil {
+			rr.Value = append(rr.Value, &dns.SVCBIPv4Hint{Hint: []net.IP{ipv4Hint}})
+		}
+
+		if ohttp {
+			// ohttp key code, see https://www.rfc-editor.org/rfc/rfc9540.html
+			rr.Value = append(rr.Value, &dns.SVCBLocal{KeyCode: 0x08, Data: []byte{}})
+		}
+
+		return rr
+	}
+
+	t.Run("key 8 schedules ODoH scans", func(t *testing.T) {
+		t.Parallel()
+
+		s := scan.NewDDRScan(query.NewDDRQuery(), false, "test", "runid")
+
+		s.Result = &query.ConventionalDNSResponse{}
+		s.Result.Response = &query.DNSResponse{
+			ResponseMsg: &dns.Msg{
+				Answer: []dns.RR{createSVCB(true, net.ParseIP("8.8.8.8"))},
+			},
+		}
+
+		scans, _ := s.CreateScansFromResponse()
+
+		c := scanCounter(scans)
+		assert.Equal(t, 2, c[scan.ODOH_SCAN_TYPE], "targetName + ipv4Hint")
+		assert.Equal(t, 2, c[scan.OHTTP_SCAN_TYPE], "targetName + ipv4Hint")
+
+		for _, ss := range scans {
+			if ohttpScan, ok := ss.(*scan.OHTTPScan); ok {
+				assert.Contains(t, []string{SAMPLE_TARGET, "8.8.8.8"}, ohttpScan.Query.Host)
+				assert.Equal(t, SAMPLE_TARGET, ohttpScan.Query.SNI)
+				assert.Equal(t, "/query", ohttpScan.Query.TargetPath, "should have used the DoH path as target path")
+				assert.Equal(t, query.OHTTP_GATEWAY_PATH, ohttpScan.Query.GatewayPath)
+				continue
+			}
+
+			if ss.GetType() != scan.ODOH_SCAN_TYPE {
+				continue
+			}
+
+			odohScan, ok := ss.(*scan.ODoHScan)
+			require.True(t, ok, "should have returned an ODoH scan")
+
+			assert.Contains(t, []string{SAMPLE_TARGET, "8.8.8.8"}, odohScan.Query.Host)
+			assert.Equal(t, SAMPLE_TARGET, odohScan.Query.SNI)
+			assert.Equal(t, "/query", odohScan.Query.TargetPath, "should have used the DoH path as target path")
+			assert.Equal(t, 443, odohScan.Query.Port)
+			assert.Equal(t, s.Meta.ScanId, odohScan.Meta.ParentScanId)
+		}
+	})
+
+	t.Run("duplicated SVCB records", func(t *testing.T) {
+		t.Parallel()
+
+		s := scan.NewDDRScan(query.NewDDRQuery(), false, "test", "runid")
+
+		s.Result = &query.ConventionalDNSResponse{}
+		s.Result.Response = &query.DNSResponse{
+			ResponseMsg: &dns.Msg{
+				Answer: []dns.RR{createSVCB(true, nil), createSVCB(true, nil)},
+			},
+		}
+
+		scans, _ := s.CreateScansFromResponse()
+
+		c := scanCounter(scans)
+		assert.Equal(t, 1, c[scan.ODOH_SCAN_TYPE], "ODoH scans should be unique")
+		assert.Equal(t, 1, c[scan.OHTTP_SCAN_TYPE], "OHTTP scans should be unique")
+	})
+
+	t.Run("no key 8", func(t *testing.T) {
+		t.Parallel()
+
+		s := scan.NewDDRScan(query.NewDDRQuery(), false, "test", "runid")
+
+		s.Result = &query.ConventionalDNSResponse{}
+		s.Result.Response = &query.DNSResponse{
+			ResponseMsg: &dns.Msg{
+				Answer: []dns.RR{createSVCB(false, nil)},
+			},
+		}
+
+		scans, _ := s.CreateScansFromResponse()
+
+		c := scanCounter(scans)
+		assert.Equal(t, 0, c[scan.ODOH_SCAN_TYPE], "should not have scheduled ODoH scans")
+		assert.Equal(t, 0, c[scan.OHTTP_SCAN_TYPE], "should not have scheduled OHTTP scans")
+	})
+}
+
 func TestDDRScan_CreateScansFromResponse_UnkownALPN(t *testing.T) {
 	t.Parallel()
 
@@ -1348,3 +1480,364 @@ func scanCounter(sc []scan.Scan) map[string]int {
 
 	return sM
 }
+
+func TestDDRScan_CreateScansFromResponse_TLSEnum(t *testing.T) {
+	t.Parallel()
+
+	createDDRScan := func(scheduleTLSEnumScans bool) *scan.DDRScan {
+		s := scan.NewDDRScan(query.NewDDRQuery(), true, "test", "runid")
+		s.Meta.ScheduleTLSEnumScans = scheduleTLSEnumScans
+
+		s.Result = &query.ConventionalDNSResponse{}
+		s.Result.Response = &query.DNSResponse{
+			ResponseMsg: &dns.Msg{
+				Answer: []dns.RR{
+					&dns.SVCB{
+						Priority: 1,
+						Target:   SAMPLE_TARGET,
+						Value: []dns.SVCBKeyValue{
+							&dns.SVCBAlpn{
+								Alpn: []string{"dot", "doq", "h2", "h3"},
+							},
+							&dns.SVCBDoHPath{
+								Template: VALID_QUERY_PATH,
+							},
+							&dns.SVCBIPv4Hint{
+								Hint: []net.IP{net.ParseIP("8.8.8.8")},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		return s
+	}
+
+	t.Run("schedules TLS enumeration for DoT and DoH over TCP", func(t *testing.T) {
+		t.Parallel()
+
+		scans, errColl := createDDRScan(true).CreateScansFromResponse()
+
+		assert.Empty(t, errColl)
+
+		c := scanCounter(scans)
+		assert.Equal(t, 4, c[scan.TLS_ENUM_SCAN_TYPE], "dot + h2 for targetName and ipv4Hint")
+
+		for _, ss := range scans {
+			enumScan, ok := ss.(*scan.TLSEnumScan)
+			if !ok {
+				continue
+			}
+
+			assert.Contains(t, []string{SAMPLE_TARGET, "8.8.8.8"}, enumScan.Query.Host)
+			assert.Contains(t, []int{853, 443}, enumScan.Query.Port)
+			assert.NotEmpty(t, enumScan.GetMetaInformation().ParentScanId)
+			if enumScan.Query.Host == "8.8.8.8" {
+				assert.Equal(t, SAMPLE_TARGET, enumScan.Query.SNI)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+
+		scans, _ := createDDRScan(false).CreateScansFromResponse()
+
+		c := scanCounter(scans)
+		assert.Equal(t, 0, c[scan.TLS_ENUM_SCAN_TYPE], "should not have scheduled TLS enumeration scans")
+	})
+}
+
+func TestDDRScan_CreateScansFromResponse_Session(t *testing.T) {
+	t.Parallel()
+
+	s := scan.NewDDRScan(query.NewDDRQuery(), true, "test", "runid")
+	s.Meta.ScheduleSessionScans = true
+
+	s.Result = &query.ConventionalDNSResponse{}
+	s.Result.Response = &query.DNSResponse{
+		ResponseMsg: &dns.Msg{
+			Answer: []dns.RR{
+				&dns.SVCB{
+					Priority: 1,
+					Target:   SAMPLE_TARGET,
+					Value: []dns.SVCBKeyValue{
+						&dns.SVCBAlpn{
+							Alpn: []string{"dot", "doq", "h2", "h3"},
+						},
+						&dns.SVCBDoHPath{
+							Template: VALID_QUERY_PATH,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	scans, errColl := s.CreateScansFromResponse()
+
+	assert.Empty(t, errColl)
+
+	c := scanCounter(scans)
+	assert.Equal(t, 4, c[scan.SESSION_SCAN_TYPE], "one session scan per ALPN")
+
+	protocols := []string{}
+	for _, ss := range scans {
+		if sessionScan, ok := ss.(*scan.SessionScan); ok {
+			protocols = append(protocols, sessionScan.Query.Protocol+"|"+sessionScan.Query.HTTPVersion)
+			assert.Equal(t, SAMPLE_TARGET, sessionScan.Query.Host)
+			assert.Equal(t, s.Meta.ScanId, sessionScan.Meta.RootScanId)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"dot|" + query.HTTP_VERSION_2,
+		"doq|" + query.HTTP_VERSION_2,
+		"doh|" + query.HTTP_VERSION_2,
+		"doh|" + query.HTTP_VERSION_3,
+	}, protocols)
+
+	s.Meta.ScheduleSessionScans = false
+	scans, _ = s.CreateScansFromResponse()
+	assert.Equal(t, 0, scanCounter(scans)[scan.SESSION_SCAN_TYPE], "should not have scheduled session scans")
+}
+
+func TestDDRScan_CreateScansFromResponse_Resumption(t *testing.T) {
+	t.Parallel()
+
+	s := scan.NewDDRScan(query.NewDDRQuery(), true, "test", "runid")
+	s.Meta.ScheduleResumptionScans = true
+
+	s.Result = &query.ConventionalDNSResponse{}
+	s.Result.Response = &query.DNSResponse{
+		ResponseMsg: &dns.Msg{
+			Answer: []dns.RR{
+				&dns.SVCB{
+					Priority: 1,
+					Target:   SAMPLE_TARGET,
+					Value: []dns.SVCBKeyValue{
+						&dns.SVCBAlpn{
+							Alpn: []string{"dot", "doq", "h2", "h3"},
+						},
+						&dns.SVCBDoHPath{
+							Template: VALID_QUERY_PATH,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	scans, errColl := s.CreateScansFromResponse()
+
+	assert.Empty(t, errColl)
+
+	c := scanCounter(scans)
+	assert.Equal(t, 4, c[scan.RESUMPTION_SCAN_TYPE], "one resumption scan per ALPN")
+	assert.Equal(t, 0, c[scan.SESSION_SCAN_TYPE], "should not have scheduled session scans")
+
+	for _, ss := range scans {
+		if resumptionScan, ok := ss.(*scan.ResumptionScan); ok {
+			assert.Equal(t, SAMPLE_TARGET, resumptionScan.Query.Host)
+			assert.Equal(t, s.Meta.ScanId, resumptionScan.Meta.RootScanId)
+			assert.True(t, resumptionScan.Query.EarlyData)
+		}
+	}
+
+	s.Meta.ScheduleResumptionScans = false
+	scans, _ = s.CreateScansFromResponse()
+	assert.Equal(t, 0, scanCounter(scans)[scan.RESUMPTION_SCAN_TYPE], "should not have scheduled resumption scans")
+}
+
+func TestDDRScan_CreateScansFromResponse_ECH(t *testing.T) {
+	t.Parallel()
+
+	echConfigList := []byte{0x00, 0x02, 0xfe, 0x0d}
+
+	s := scan.NewDDRScan(query.NewDDRQuery(), true, "test", "runid")
+	s.Result = &query.ConventionalDNSResponse{}
+	s.Result.Response = &query.DNSResponse{
+		ResponseMsg: &dns.Msg{
+			Answer: []dns.RR{
+				&dns.SVCB{
+					Priority: 1,
+					Target:   SAMPLE_TARGET,
+					Value: []dns.SVCBKeyValue{
+						&dns.SVCBAlpn{
+							Alpn: []string{"dot", "doq", "h2"},
+						},
+						&dns.SVCBDoHPath{
+							Template: VALID_QUERY_PATH,
+						},
+						&dns.SVCBECHConfig{
+							ECH: echConfigList,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	scans, errColl := s.CreateScansFromResponse()
+	assert.Empty(t, errColl)
+
+	for _, ss := range scans {
+		switch ss.GetType() {
+		case scan.DOT_SCAN_TYPE, scan.DOH_SCAN_TYPE:
+			assert.Equal(t, echConfigList, ss.(scan.DoEScan).GetDoEQuery().ECHConfigList, ss.GetType())
+		case scan.DOQ_SCAN_TYPE:
+			assert.Empty(t, ss.(scan.DoEScan).GetDoEQuery().ECHConfigList, "ECH is not attempted over DoQ")
+		case scan.EDSR_SCAN_TYPE:
+			require.NotNil(t, ss.(*scan.EDSRScan).SVCB, "EDSR scan should carry the SVCB parameters")
+			assert.Equal(t, VALID_QUERY_PATH, ss.(*scan.EDSRScan).SVCB.DoHPath.Template)
+		}
+	}
+}
+
+func newDDRScanWithAnswers(answers ...dns.RR) *scan.DDRScan {
+	s := scan.NewDDRScan(query.NewDDRQuery(), true, "test", "runid")
+	s.Query.Host = "8.8.8.8"
+	s.Result = &query.ConventionalDNSResponse{}
+	s.Result.Response = &query.DNSResponse{
+		ResponseMsg: &dns.Msg{
+			Answer: answers,
+		},
+	}
+	return s
+}
+
+func TestDDRScan_CreateScansFromResponse_Priority(t *testing.T) {
+	t.Parallel()
+
+	s := newDDRScanWithAnswers(
+		&dns.SVCB{
+			Priority: 2,
+			Target:   "second.example.com.",
+			Value:    []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: []string{"dot"}}},
+		},
+		&dns.SVCB{
+			Priority: 1,
+			Target:   "first.example.com.",
+			Value:    []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: []string{"dot"}}},
+		},
+	)
+
+	scans, errColl := s.CreateScansFromResponse()
+	assert.Empty(t, errColl)
+	assert.Empty(t, s.Compliance)
+
+	sni := []string{}
+	for _, ss := range scans {
+		if ss.GetType() == scan.DOT_SCAN_TYPE {
+			sni = append(sni, ss.(*scan.DoTScan).Query.SNI)
+		}
+	}
+	assert.Equal(t, []string{"first.example.com.", "second.example.com."}, sni, "should have processed the records in priority order")
+}
+
+func TestDDRScan_CreateScansFromResponse_Compliance(t *testing.T) {
+	t.Parallel()
+
+	s := newDDRScanWithAnswers(
+		&dns.SVCB{
+			Priority: 1,
+			Target:   SAMPLE_TARGET,
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBMandatory{Code: []dns.SVCBKey{dns.SVCB_PORT}},
+				&dns.SVCBAlpn{Alpn: []string{"dot"}},
+			},
+		},
+	)
+
+	scans, errColl := s.CreateScansFromResponse()
+
+	assert.Empty(t, scans, "should have ignored the RR")
+	require.Len(t, errColl, 1)
+	assert.True(t, errColl[0].IsCritical())
+	require.Len(t, s.Compliance, 1)
+	assert.Equal(t, svcb.COMPLIANCE_MANDATORY_KEY_MISSING, s.Compliance[0].Rule)
+
+	bytes, err := s.Marshal()
+	require.NoError(t, err)
+	assert.Contains(t, string(bytes), svcb.COMPLIANCE_MANDATORY_KEY_MISSING)
+}
+
+func TestDDRScan_CreateScansFromResponse_AliasMode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("follow alias target", func(t *testing.T) {
+		t.Parallel()
+
+		s := newDDRScanWithAnswers(
+			&dns.SVCB{
+				Priority: 0,
+				Target:   "alias.example.com.",
+			},
+			&dns.SVCB{
+				Priority: 1,
+				Target:   SAMPLE_TARGET,
+				Value:    []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: []string{"dot"}}},
+			},
+		)
+		s.Meta.ScheduleTLSEnumScans = true
+
+		scans, errColl := s.CreateScansFromResponse()
+		assert.Empty(t, errColl)
+
+		require.Len(t, scans, 1, "should have ignored the ServiceMode record")
+		aliasScan, ok := scans[0].(*scan.DDRScan)
+		require.True(t, ok)
+
+		assert.Equal(t, "alias.example.com.", aliasScan.Query.QueryMsg.Question[0].Name)
+		assert.Equal(t, dns.TypeSVCB, aliasScan.Query.QueryMsg.Question[0].Qtype)
+		assert.Equal(t, "8.8.8.8", aliasScan.Query.Host)
+		assert.Equal(t, "_dns.resolver.arpa.", s.Query.QueryMsg.Question[0].Name, "should not have modified the origin query")
+		assert.Equal(t, s.Meta.ScanId, aliasScan.Meta.ParentScanId)
+		assert.Equal(t, s.Meta.ScanId, aliasScan.Meta.RootScanId)
+		assert.Equal(t, 1, aliasScan.Meta.AliasDepth)
+		assert.True(t, aliasScan.Meta.ScheduleDoEScans)
+		assert.True(t, aliasScan.Meta.ScheduleTLSEnumScans)
+		assert.False(t, aliasScan.Meta.ScheduleFingerprintScan)
+		assert.NotEqual(t, s.GetIdentifier(), aliasScan.GetIdentifier())
+
+		require.Len(t, s.Compliance, 1)
+		assert.Equal(t, svcb.COMPLIANCE_MIXED_MODES, s.Compliance[0].Rule)
+	})
+
+	t.Run("service not available", func(t *testing.T) {
+		t.Parallel()
+
+		s := newDDRScanWithAnswers(&dns.SVCB{Priority: 0, Target: "."})
+
+		scans, errColl := s.CreateScansFromResponse()
+
+		assert.Empty(t, errColl)
+		assert.Empty(t, scans)
+		assert.Empty(t, s.Compliance)
+	})
+
+	t.Run("alias loop", func(t *testing.T) {
+		t.Parallel()
+
+		s := newDDRScanWithAnswers(&dns.SVCB{Priority: 0, Target: "_dns.resolver.arpa."})
+
+		scans, _ := s.CreateScansFromResponse()
+
+		assert.Empty(t, scans)
+		require.Len(t, s.Compliance, 1)
+		assert.Equal(t, svcb.COMPLIANCE_ALIAS_LOOP, s.Compliance[0].Rule)
+	})
+
+	t.Run("alias chain too long", func(t *testing.T) {
+		t.Parallel()
+
+		s := newDDRScanWithAnswers(&dns.SVCB{Priority: 0, Target: "alias.example.com."})
+		s.Meta.AliasDepth = scan.MAX_DDR_ALIAS_DEPTH
+
+		scans, _ := s.CreateScansFromResponse()
+
+		assert.Empty(t, scans)
+		require.Len(t, s.Compliance, 1)
+		assert.Equal(t, svcb.COMPLIANCE_ALIAS_CHAIN_TOO_LONG, s.Compliance[0].Rule)
+	})
+}
@@ -21,6 +21,11 @@ type DDRDNSSECScan struct {
 	Meta   *DDRDNSSECScanMetaInformation  `json:"meta"`
 	Query  *query.ConventionalDNSQuery    `json:"query"`
 	Result *query.ConventionalDNSResponse `json:"result"`
+	// Validation is the DNSSEC chain validation of the result
+	Validation *query.DNSSECValidation `json:"validation"`
+
+	// Transport the DNS queries are sent over, Do53 if nil
+	Transport *query.DNSTransportDescriptor `json:"transport"`
 }
 
 func (scan *DDRDNSSECScan) Marshal() (bytes []byte, err error) {
@@ -41,10 +46,11 @@ func (scan *DDRDNSSECScan) GetType() string {
 
 func (scan *DDRDNSSECScan) GetIdentifier() string {
 	// host, port, method, path, http_version, skip_tls_verify
-	return fmt.Sprintf("%s|%s|%s",
+	return fmt.Sprintf("%s|%s|%s|%s",
 		DDR_DNSSEC_SCAN_TYPE,
 		scan.Meta.OriginTargetName,
 		scan.Query.Host,
+		scan.Transport,
 	)
 }
 
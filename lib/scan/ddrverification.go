@@ -0,0 +1,128 @@
+package scan
+
+import (
+	"crypto/x509"
+	"net"
+	"slices"
+	"time"
+)
+
+// verdicts of the DDR discovery check, see https://www.rfc-editor.org/rfc/rfc9462.html#section-4
+const DDR_VERIFICATION_VERIFIED = "verified"
+const DDR_VERIFICATION_OPPORTUNISTIC_ONLY = "opportunistic-only"
+const DDR_VERIFICATION_FAILED = "failed"
+
+const DDR_VERIFICATION_REASON_NO_CERTIFICATE = "no certificate"
+const DDR_VERIFICATION_REASON_CHAIN_INVALID = "certificate chain invalid"
+const DDR_VERIFICATION_REASON_IP_SAN_MISSING = "origin resolver IP not in certificate IP SANs"
+const DDR_VERIFICATION_REASON_TARGET_NAME_MISMATCH = "certificate not valid for SVCB target name"
+const DDR_VERIFICATION_REASON_OPPORTUNISTIC_NOT_APPLICABLE = "opportunistic discovery requires the designated resolver to share the private IP of the origin resolver"
+
+// DDRVerification is the verdict whether verified discovery succeeds for a designated resolver
+type DDRVerification struct {
+	// CertificateScanId is the scan id of the certificate scan the verdict is based on
+	CertificateScanId string `json:"certificate_scan_id"`
+	// DDRScanId is the scan id of the DDR scan that discovered the designated resolver
+	DDRScanId    string `json:"ddr_scan_id"`
+	RunId        string `json:"run_id"`
+	VantagePoint string `json:"vantage_point"`
+
+	// OriginResolver is the IP address of the unencrypted resolver we sent the DDR query to
+	OriginResolver string `json:"origin_resolver"`
+	// TargetName is the SVCB target name of the designated resolver
+	TargetName string `json:"target_name"`
+	// Host and Port of the designated resolver endpoint
+	Host string `json:"host"`
+	Port int    `json:"port"`
+
+	ChainValid      bool `json:"chain_valid"`
+	IPSANMatch      bool `json:"ip_san_match"`
+	TargetNameMatch bool `json:"target_name_match"`
+
+	Verdict string   `json:"verdict"`
+	Reasons []string `json:"reasons"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Verify checks the certificate chain of the designated resolver against the DDR rules of RFC 9462,
+// roots is the pool to verify the chain against (nil for the system pool)
+func (v *DDRVerification) Verify(certs []*x509.Certificate, roots *x509.CertPool) {
+	v.Reasons = []string{}
+	v.Timestamp = time.Now()
+
+	if len(certs) == 0 || certs[0] == nil {
+		v.Verdict = DDR_VERIFICATION_FAILED
+		v.Reasons = append(v.Reasons, DDR_VERIFICATION_REASON_NO_CERTIFICATE)
+		return
+	}
+
+	leaf := certs[0]
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	// chain validity only, names are checked separately
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	v.ChainValid = err == nil
+	if !v.ChainValid {
+		v.Reasons = append(v.Reasons, DDR_VERIFICATION_REASON_CHAIN_INVALID)
+	}
+
+	// see https://www.rfc-editor.org/rfc/rfc9462.html#section-4.2
+	originIP := net.ParseIP(v.OriginResolver)
+	v.IPSANMatch = originIP != nil && slices.ContainsFunc(leaf.IPAddresses, originIP.Equal)
+	if !v.IPSANMatch {
+		v.Reasons = append(v.Reasons, DDR_VERIFICATION_REASON_IP_SAN_MISSING)
+	}
+
+	v.TargetNameMatch = v.TargetName != "" && leaf.VerifyHostname(v.TargetName) == nil
+	if !v.TargetNameMatch {
+		v.Reasons = append(v.Reasons, DDR_VERIFICATION_REASON_TARGET_NAME_MISMATCH)
+	}
+
+	if v.ChainValid && v.IPSANMatch && v.TargetNameMatch {
+		v.Verdict = DDR_VERIFICATION_VERIFIED
+		return
+	}
+
+	// see https://www.rfc-editor.org/rfc/rfc9462.html#section-4.3
+	if isOpportunisticDiscoveryApplicable(originIP, net.ParseIP(v.Host)) {
+		v.Verdict = DDR_VERIFICATION_OPPORTUNISTIC_ONLY
+	} else {
+		v.Verdict = DDR_VERIFICATION_FAILED
+		v.Reasons = append(v.Reasons, DDR_VERIFICATION_REASON_OPPORTUNISTIC_NOT_APPLICABLE)
+	}
+}
+
+func isOpportunisticDiscoveryApplicable(originIP net.IP, designatedIP net.IP) bool {
+	if originIP == nil || designatedIP == nil || !originIP.Equal(designatedIP) {
+		return false
+	}
+
+	return originIP.IsPrivate() || originIP.IsLoopback() || originIP.IsLinkLocalUnicast()
+}
+
+// NewDDRVerification creates the verification of a certificate scan that was scheduled by a DDR scan,
+// returns nil if the certificate scan is not linked to an origin resolver
+func NewDDRVerification(certScan *CertificateScan) *DDRVerification {
+	if certScan == nil || certScan.Meta == nil || certScan.Query == nil || certScan.Meta.OriginResolver == "" {
+		return nil
+	}
+
+	return &DDRVerification{
+		CertificateScanId: certScan.Meta.ScanId,
+		DDRScanId:         certScan.Meta.RootScanId,
+		RunId:             certScan.Meta.RunId,
+		VantagePoint:      certScan.Meta.VantagePoint,
+		OriginResolver:    certScan.Meta.OriginResolver,
+		TargetName:        certScan.Meta.TargetName,
+		Host:              certScan.Query.Host,
+		Port:              certScan.Query.Port,
+	}
+}
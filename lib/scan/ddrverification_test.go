@@ -0,0 +1,188 @@
+package scan_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestCertificateChain creates a leaf certificate signed by a fresh CA and returns the chain and the CA pool
+func createTestCertificateChain(t *testing.T, dnsNames []string, ips []net.IP) ([]*x509.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.Nil(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.Nil(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	require.Nil(t, err)
+	leaf, err := x509.ParseCertificate(leafDER)
+	require.Nil(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	return []*x509.Certificate{leaf, ca}, pool
+}
+
+func TestDDRVerification_Verify(t *testing.T) {
+	t.Parallel()
+
+	t.Run("verified", func(t *testing.T) {
+		t.Parallel()
+
+		certs, roots := createTestCertificateChain(t, []string{"dns.example.com"}, []net.IP{net.ParseIP("8.8.8.8")})
+
+		v := &scan.DDRVerification{OriginResolver: "8.8.8.8", TargetName: "dns.example.com.", Host: "8.8.4.4"}
+		v.Verify(certs, roots)
+
+		assert.Equal(t, scan.DDR_VERIFICATION_VERIFIED, v.Verdict)
+		assert.True(t, v.ChainValid)
+		assert.True(t, v.IPSANMatch)
+		assert.True(t, v.TargetNameMatch)
+		assert.Empty(t, v.Reasons)
+	})
+
+	t.Run("missing IP SAN", func(t *testing.T) {
+		t.Parallel()
+
+		certs, roots := createTestCertificateChain(t, []string{"dns.example.com"}, []net.IP{net.ParseIP("8.8.4.4")})
+
+		v := &scan.DDRVerification{OriginResolver: "8.8.8.8", TargetName: "dns.example.com", Host: "8.8.4.4"}
+		v.Verify(certs, roots)
+
+		assert.Equal(t, scan.DDR_VERIFICATION_FAILED, v.Verdict)
+		assert.True(t, v.ChainValid)
+		assert.False(t, v.IPSANMatch)
+		assert.Contains(t, v.Reasons, scan.DDR_VERIFICATION_REASON_IP_SAN_MISSING)
+	})
+
+	t.Run("target name mismatch", func(t *testing.T) {
+		t.Parallel()
+
+		certs, roots := createTestCertificateChain(t, []string{"other.example.com"}, []net.IP{net.ParseIP("8.8.8.8")})
+
+		v := &scan.DDRVerification{OriginResolver: "8.8.8.8", TargetName: "dns.example.com", Host: "dns.example.com"}
+		v.Verify(certs, roots)
+
+		assert.Equal(t, scan.DDR_VERIFICATION_FAILED, v.Verdict)
+		assert.False(t, v.TargetNameMatch)
+		assert.Contains(t, v.Reasons, scan.DDR_VERIFICATION_REASON_TARGET_NAME_MISMATCH)
+	})
+
+	t.Run("invalid chain", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, []string{"dns.example.com"}, []net.IP{net.ParseIP("8.8.8.8")})
+
+		v := &scan.DDRVerification{OriginResolver: "8.8.8.8", TargetName: "dns.example.com", Host: "8.8.8.8"}
+		v.Verify(certs, x509.NewCertPool())
+
+		assert.Equal(t, scan.DDR_VERIFICATION_FAILED, v.Verdict, "public origin resolvers must not fall back to opportunistic discovery")
+		assert.False(t, v.ChainValid)
+		assert.Contains(t, v.Reasons, scan.DDR_VERIFICATION_REASON_CHAIN_INVALID)
+	})
+
+	t.Run("opportunistic only", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, []string{"dns.example.com"}, nil)
+
+		v := &scan.DDRVerification{OriginResolver: "192.168.1.1", TargetName: "dns.example.com", Host: "192.168.1.1"}
+		v.Verify(certs, x509.NewCertPool())
+
+		assert.Equal(t, scan.DDR_VERIFICATION_OPPORTUNISTIC_ONLY, v.Verdict)
+		assert.NotEmpty(t, v.Reasons)
+	})
+
+	t.Run("private origin on different designated IP", func(t *testing.T) {
+		t.Parallel()
+
+		certs, _ := createTestCertificateChain(t, []string{"dns.example.com"}, nil)
+
+		v := &scan.DDRVerification{OriginResolver: "192.168.1.1", TargetName: "dns.example.com", Host: "192.168.1.2"}
+		v.Verify(certs, x509.NewCertPool())
+
+		assert.Equal(t, scan.DDR_VERIFICATION_FAILED, v.Verdict)
+		assert.Contains(t, v.Reasons, scan.DDR_VERIFICATION_REASON_OPPORTUNISTIC_NOT_APPLICABLE)
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		t.Parallel()
+
+		v := &scan.DDRVerification{OriginResolver: "8.8.8.8", TargetName: "dns.example.com"}
+		v.Verify(nil, nil)
+
+		assert.Equal(t, scan.DDR_VERIFICATION_FAILED, v.Verdict)
+		assert.Equal(t, []string{scan.DDR_VERIFICATION_REASON_NO_CERTIFICATE}, v.Reasons)
+	})
+}
+
+func TestNewDDRVerification(t *testing.T) {
+	t.Parallel()
+
+	t.Run("linked certificate scan", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewCertificateQuery()
+		q.Host = "8.8.4.4"
+		certScan := scan.NewCertificateScan(q, "ddr", "doe", "run", "vp")
+		certScan.Meta.OriginResolver = "8.8.8.8"
+		certScan.Meta.TargetName = "dns.google."
+
+		v := scan.NewDDRVerification(certScan)
+
+		require.NotNil(t, v)
+		assert.Equal(t, "ddr", v.DDRScanId)
+		assert.Equal(t, certScan.Meta.ScanId, v.CertificateScanId)
+		assert.Equal(t, "8.8.8.8", v.OriginResolver)
+		assert.Equal(t, "dns.google.", v.TargetName)
+		assert.Equal(t, "8.8.4.4", v.Host)
+		assert.Equal(t, 443, v.Port)
+	})
+
+	t.Run("unlinked certificate scan", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, scan.NewDDRVerification(scan.NewCertificateScan(nil, "", "", "", "")))
+		assert.Nil(t, scan.NewDDRVerification(nil))
+	})
+}
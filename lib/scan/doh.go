@@ -11,6 +11,9 @@ const DOH_SCAN_TYPE = "DoH"
 
 type DoHScanMetaInformation struct {
 	ScanMetaInformation
+
+	// AltSvcDiscovered is set if the scan was scheduled from the Alt-Svc header of its parent DoH scan
+	AltSvcDiscovered bool `json:"alt_svc_discovered"`
 }
 
 type DoHScan struct {
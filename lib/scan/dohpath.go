@@ -0,0 +1,73 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+const DOH_PATH_SCAN_TYPE = "DoHPath"
+
+type DoHPathScanMetaInformation struct {
+	ScanMetaInformation
+}
+
+type DoHPathScan struct {
+	Scan
+
+	Meta   *DoHPathScanMetaInformation `json:"meta"`
+	Query  *query.DoHPathQuery         `json:"query"`
+	Result *query.DoHPathResponse      `json:"result"`
+}
+
+func (scan *DoHPathScan) Marshal() (bytes []byte, err error) {
+	return json.Marshal(scan)
+}
+
+func (scan *DoHPathScan) GetScanId() string {
+	return scan.Meta.ScanId
+}
+
+func (scan *DoHPathScan) GetMetaInformation() *ScanMetaInformation {
+	return &scan.Meta.ScanMetaInformation
+}
+
+func (scan *DoHPathScan) GetType() string {
+	return DOH_PATH_SCAN_TYPE
+}
+
+func (scan *DoHPathScan) GetIdentifier() string {
+	// host, port, sni, http version
+	return fmt.Sprintf("%s|%s|%d|%s|%s",
+		DOH_PATH_SCAN_TYPE,
+		scan.Query.Host,
+		scan.Query.Port,
+		scan.Query.SNI,
+		scan.Query.HTTPVersion)
+}
+
+// NewDoHPathScanFromDoHScan creates a path discovery scan for the endpoint of a DoH scan
+func NewDoHPathScanFromDoHScan(dohScan *DoHScan, rootScanId, runId, vantagePoint string) *DoHPathScan {
+	q := query.NewDoHPathQuery()
+	q.Host = dohScan.Query.Host
+	q.Port = dohScan.Query.Port
+	q.SNI = dohScan.Query.SNI
+	q.SkipCertificateVerify = dohScan.Query.SkipCertificateVerify
+	q.HTTPVersion = dohScan.Query.HTTPVersion
+
+	return NewDoHPathScan(q, dohScan.Meta.ScanId, rootScanId, runId, vantagePoint)
+}
+
+func NewDoHPathScan(q *query.DoHPathQuery, parentScanId, rootScanId, runId, vantagePoint string) *DoHPathScan {
+	if q == nil {
+		q = query.NewDoHPathQuery()
+	}
+
+	scan := &DoHPathScan{
+		Meta: &DoHPathScanMetaInformation{},
+	}
+	scan.Meta.ScanMetaInformation = *NewScanMetaInformation(parentScanId, rootScanId, runId, vantagePoint)
+	scan.Query = q
+	return scan
+}
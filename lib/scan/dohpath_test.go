@@ -0,0 +1,81 @@
+package scan_test
+
+import (
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoHPathScan_Constructor(t *testing.T) {
+	t.Parallel()
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+		scan := scan.NewDoHPathScan(nil, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, "DoHPath", scan.GetType(), "should have returned DoHPath")
+		assert.NotNil(t, scan.Meta, "meta should not be nil")
+		assert.NotNil(t, scan.Query, "query should not be nil")
+		assert.Nil(t, scan.Result, "result should be nil")
+		assert.Equal(t, "parent", scan.GetMetaInformation().ParentScanId, "should have returned parent")
+		assert.Equal(t, "root", scan.GetMetaInformation().RootScanId, "should have returned root")
+		assert.Equal(t, "run", scan.GetMetaInformation().RunId, "should have returned run")
+		assert.Equal(t, "vantagepoint", scan.GetMetaInformation().VantagePoint, "should have returned vantagepoint")
+	})
+
+	t.Run("non-nil query", func(t *testing.T) {
+		t.Parallel()
+		q := query.NewDoHPathQuery()
+		scan := scan.NewDoHPathScan(q, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, q, scan.Query, "should have attached query")
+		assert.NotEmpty(t, scan.GetScanId(), "should have generated a scan id")
+	})
+}
+
+func TestDoHPathScan_Marshall(t *testing.T) {
+	t.Parallel()
+	scan := scan.NewDoHPathScan(nil, "parent", "root", "run", "vantagepoint")
+	bytes, err := scan.Marshal()
+
+	// test
+	assert.Nil(t, err, "should not have returned an error")
+	assert.NotNil(t, bytes, "should have returned bytes")
+}
+
+func TestDoHPathScan_Identifier(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewDoHPathQuery()
+	q.Host = "8.8.8.8"
+	q.SNI = "dns.google"
+	s := scan.NewDoHPathScan(q, "parent", "root", "run", "vantagepoint")
+
+	assert.Equal(t, "DoHPath|8.8.8.8|443|dns.google|HTTP2", s.GetIdentifier())
+}
+
+func TestNewDoHPathScanFromDoHScan(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewDoHQuery()
+	q.Host = "8.8.8.8"
+	q.Port = 8443
+	q.SNI = "dns.google"
+	q.HTTPVersion = query.HTTP_VERSION_3
+	dohScan := scan.NewDoHScan(q, "parent", "root", "run", "vantagepoint")
+
+	s := scan.NewDoHPathScanFromDoHScan(dohScan, "root", "run", "vantagepoint")
+
+	require.NotNil(t, s)
+	assert.Equal(t, "8.8.8.8", s.Query.Host)
+	assert.Equal(t, 8443, s.Query.Port)
+	assert.Equal(t, "dns.google", s.Query.SNI)
+	assert.Equal(t, query.HTTP_VERSION_3, s.Query.HTTPVersion)
+	assert.Equal(t, []string{"/dns-query", "/resolve", "/query", "/"}, s.Query.Paths)
+	assert.Equal(t, dohScan.GetScanId(), s.Meta.ParentScanId)
+	assert.Equal(t, "root", s.Meta.RootScanId)
+}
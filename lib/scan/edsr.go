@@ -40,6 +40,17 @@ type EDSRHop struct {
 	Result         *query.ConventionalDNSResponse `json:"result"`
 	ConsideredSVCB *svcb.SVCBRR                   `json:"considered_svcb"`
 	GlueRecords    []*GlueRecord                  `json:"glue_records"`
+	// Transport the query is sent over, Do53 if nil
+	Transport *query.DNSTransportDescriptor `json:"transport"`
+
+	// the hop is queried over the protocol being redirected as well, only one of the queries is set
+	// see https://www.ietf.org/id/draft-jt-add-dns-server-redirection-04.html
+	DoHQuery        *query.DoHQuery    `json:"doh_query"`
+	DoTQuery        *query.DoTQuery    `json:"dot_query"`
+	DoQQuery        *query.DoQQuery    `json:"doq_query"`
+	EncryptedResult *query.DoEResponse `json:"encrypted_result"`
+	// true if the answer or glue records of the encrypted and unencrypted response differ
+	AnswersDiffer bool `json:"answers_differ"`
 }
 
 func NewEDSRHop(parentHop int, query *query.ConventionalDNSQuery) *EDSRHop {
@@ -52,6 +63,44 @@ func NewEDSRHop(parentHop int, query *query.ConventionalDNSQuery) *EDSRHop {
 	}
 }
 
+// SetEncryptedQuery creates the query of the hop for the given protocol (ALPN), the SVCB record of the previous hop
+// provides the port and DoH path if given
+func (hop *EDSRHop) SetEncryptedQuery(protocol string, targetName string, svcbRR *svcb.SVCBRR) {
+	var doeQuery *query.DoEQuery
+
+	switch protocol {
+	case "dot":
+		hop.DoTQuery = query.NewDoTQuery()
+		doeQuery = &hop.DoTQuery.DoEQuery
+	case "doq":
+		hop.DoQQuery = query.NewDoQQuery()
+		doeQuery = &hop.DoQQuery.DoEQuery
+	case "h1", "http/1.0", "http/1.1", "h2", "http/2", "doh", "h3", "http/3":
+		hop.DoHQuery = query.NewDoHQuery()
+		switch protocol {
+		case "h1", "http/1.0", "http/1.1":
+			hop.DoHQuery.HTTPVersion = query.HTTP_VERSION_1
+		case "h3", "http/3":
+			hop.DoHQuery.HTTPVersion = query.HTTP_VERSION_3
+		}
+		if svcbRR != nil && svcbRR.DoHPath != nil {
+			hop.DoHQuery.URI = svcbRR.DoHPath.Template
+		}
+		doeQuery = &hop.DoHQuery.DoEQuery
+	default:
+		logrus.Warnf("EDSR: unknown protocol %s, query hop unencrypted only", protocol)
+		return
+	}
+
+	doeQuery.Host = hop.Query.Host
+	doeQuery.QueryMsg = hop.Query.QueryMsg.Copy()
+	doeQuery.DNSSEC = hop.Query.DNSSEC
+	doeQuery.SNI = targetName
+	if svcbRR != nil && svcbRR.Port != nil {
+		doeQuery.Port = int(svcbRR.Port.Port)
+	}
+}
+
 // see https://www.ietf.org/id/draft-jt-add-dns-server-redirection-04.html
 type EDSRScan struct {
 	Scan
@@ -67,6 +116,12 @@ type EDSRScan struct {
 	// the host to start the EDSR scan from
 	Host string `json:"host"`
 
+	// Transport the unencrypted hop queries are sent over, Do53 if nil
+	Transport *query.DNSTransportDescriptor `json:"transport"`
+
+	// the SVCB record the EDSR scan was created from, it provides the port and DoH path of the first hop (optional)
+	SVCB *svcb.SVCBRR `json:"svcb"`
+
 	Result *EDSRResult `json:"result"`
 }
 
@@ -88,11 +143,12 @@ func (scan *EDSRScan) GetType() string {
 
 func (scan *EDSRScan) GetIdentifier() string {
 	// host, port
-	return fmt.Sprintf("%s|%s|%s|%s",
+	return fmt.Sprintf("%s|%s|%s|%s|%s",
 		EDSR_SCAN_TYPE,
 		scan.Host,
 		scan.TargetName,
-		scan.Protocol)
+		scan.Protocol,
+		scan.Transport)
 }
 
 func NewEDSRScan(targetName, host, protocol, parentScanId, rootScanId, runId, vantagePoint string) *EDSRScan {
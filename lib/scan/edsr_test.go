@@ -7,6 +7,7 @@ import (
 	"github.com/miekg/dns"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/steffsas/doe-hunter/lib/svcb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -210,3 +211,56 @@ func TestEDSR_NewEDSRHop(t *testing.T) {
 		assert.Equal(t, q, edsrHop.Query)
 	})
 }
+
+func TestEDSRHop_SetEncryptedQuery(t *testing.T) {
+	t.Parallel()
+
+	newHop := func() *scan.EDSRHop {
+		q := query.NewEDSRQuery("dns.google.")
+		q.Host = "8.8.8.8"
+		return scan.NewEDSRHop(-1, q)
+	}
+
+	t.Run("DoH with SVCB parameters", func(t *testing.T) {
+		t.Parallel()
+
+		hop := newHop()
+		hop.SetEncryptedQuery("h3", "dns.google.", &svcb.SVCBRR{
+			Port:    &dns.SVCBPort{Port: 8443},
+			DoHPath: &dns.SVCBDoHPath{Template: "/query{?dns}"},
+		})
+
+		require.NotNil(t, hop.DoHQuery)
+		assert.Nil(t, hop.DoTQuery)
+		assert.Nil(t, hop.DoQQuery)
+		assert.Equal(t, query.HTTP_VERSION_3, hop.DoHQuery.HTTPVersion)
+		assert.Equal(t, "/query{?dns}", hop.DoHQuery.URI)
+		assert.Equal(t, 8443, hop.DoHQuery.Port)
+		assert.Equal(t, "8.8.8.8", hop.DoHQuery.Host)
+		assert.Equal(t, "dns.google.", hop.DoHQuery.SNI)
+		assert.False(t, hop.DoHQuery.DNSSEC)
+		assert.Equal(t, hop.Query.QueryMsg.Question, hop.DoHQuery.QueryMsg.Question)
+		assert.NotSame(t, hop.Query.QueryMsg, hop.DoHQuery.QueryMsg)
+	})
+
+	t.Run("DoQ with defaults", func(t *testing.T) {
+		t.Parallel()
+
+		hop := newHop()
+		hop.SetEncryptedQuery("doq", "dns.google.", nil)
+
+		require.NotNil(t, hop.DoQQuery)
+		assert.Equal(t, query.DEFAULT_DOQ_PORT, hop.DoQQuery.Port)
+	})
+
+	t.Run("unknown protocol", func(t *testing.T) {
+		t.Parallel()
+
+		hop := newHop()
+		hop.SetEncryptedQuery("unknown", "dns.google.", nil)
+
+		assert.Nil(t, hop.DoHQuery)
+		assert.Nil(t, hop.DoTQuery)
+		assert.Nil(t, hop.DoQQuery)
+	})
+}
@@ -3,8 +3,10 @@ package scan
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 
 	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
 	"github.com/steffsas/doe-hunter/lib/query"
 )
 
@@ -14,6 +16,13 @@ type FingerprintScanMetaInformation struct {
 	ScanMetaInformation
 }
 
+// FingerprintBanner is a banner probe of a management interface of the host
+type FingerprintBanner struct {
+	Query  *query.BannerQuery    `json:"query"`
+	Result *query.BannerResponse `json:"result"`
+	Error  string                `json:"error"`
+}
+
 type FingerprintScan struct {
 	Scan
 
@@ -22,10 +31,28 @@ type FingerprintScan struct {
 	VersionBindQuery   *query.ConventionalDNSQuery `json:"version_bind_query"`
 	VersionServerQuery *query.ConventionalDNSQuery `json:"version_server_query"`
 	SSHQuery           *query.SSHQuery             `json:"ssh_query"`
+	// CookieQuery detects DNS cookie support, see RFC 7873
+	CookieQuery *query.CookieQuery `json:"cookie_query"`
 
 	VersionBindResult   *query.ConventionalDNSResponse `json:"version_bind_result"`
 	VersionServerResult *query.ConventionalDNSResponse `json:"version_server_result"`
 	SSHResult           *query.SSHResponse             `json:"ssh_result"`
+	CookieResult        *query.CookieResponse          `json:"cookie_result"`
+
+	// VersionBind and VersionServer are the normalized version strings, nil if the server did not respond
+	VersionBind   *NormalizedVersion `json:"version_bind"`
+	VersionServer *NormalizedVersion `json:"version_server"`
+
+	// Probes are the behavioural probes besides version.bind and version.server
+	Probes []*fingerprint.Probe `json:"probes"`
+	// Classification is the software the rules attribute the observations to
+	Classification *fingerprint.Classification `json:"classification"`
+
+	// Banners are the optional banner probes, e.g., of the web interfaces of CPE routers
+	Banners []*FingerprintBanner `json:"banners"`
+
+	// Transport the version.bind and version.server queries are sent over, Do53 if nil
+	Transport *query.DNSTransportDescriptor `json:"transport"`
 }
 
 func (scan *FingerprintScan) Marshal() (bytes []byte, err error) {
@@ -47,12 +74,65 @@ func (scan *FingerprintScan) GetType() string {
 func (scan *FingerprintScan) GetIdentifier() string {
 	// host, port, protocol, alpn
 	// tls_skip_verify is not part of the identifier because we will get the certificate in a second query if certificate is not valid
-	return fmt.Sprintf("%s|%s",
+	return fmt.Sprintf("%s|%s|%s",
 		FINGERPRINT_SCAN_TYPE,
 		scan.SSHQuery.Host,
+		scan.Transport,
 	)
 }
 
+// GetObservations observes the version.bind, version.server and probe responses
+func (scan *FingerprintScan) GetObservations() fingerprint.Observations {
+	responses := map[string]*query.ConventionalDNSResponse{
+		fingerprint.PROBE_VERSION_BIND:   scan.VersionBindResult,
+		fingerprint.PROBE_VERSION_SERVER: scan.VersionServerResult,
+	}
+
+	for _, probe := range scan.Probes {
+		responses[probe.Name] = probe.Result
+	}
+
+	return fingerprint.NewObservations(responses)
+}
+
+// Classify classifies the software with the rule set and the rules of the pattern table, so that the
+// classification attributes version strings to the same products as Normalize
+func (scan *FingerprintScan) Classify(ruleSet *fingerprint.RuleSet, table *VersionPatternTable) {
+	scan.Classification = classify(scan.GetObservations(), ruleSet, table)
+}
+
+func classify(observations fingerprint.Observations, ruleSet *fingerprint.RuleSet, table *VersionPatternTable) *fingerprint.Classification {
+	return fingerprint.Classify(observations, &fingerprint.RuleSet{
+		Revision: ruleSet.Revision,
+		Rules:    slices.Concat(table.Rules(), ruleSet.Rules),
+	})
+}
+
+// Normalize parses the version.bind and version.server answers, NOERROR answers without TXT records hide the version
+func (scan *FingerprintScan) Normalize(table *VersionPatternTable) {
+	scan.VersionBind = normalizeVersionResult(scan.VersionBindResult, table)
+	scan.VersionServer = normalizeVersionResult(scan.VersionServerResult, table)
+}
+
+func normalizeVersionResult(res *query.ConventionalDNSResponse, table *VersionPatternTable) *NormalizedVersion {
+	if res == nil || res.Response == nil || res.Response.ResponseMsg == nil {
+		return nil
+	}
+
+	return table.Normalize(fingerprint.NewObservation(fingerprint.PROBE_VERSION_BIND, res).Text, res.Response.ResponseMsg.Rcode)
+}
+
+func NewFingerprintBanners(host string, targets []*query.BannerTarget) []*FingerprintBanner {
+	banners := []*FingerprintBanner{}
+	for _, target := range targets {
+		banners = append(banners, &FingerprintBanner{
+			Query: query.NewBannerQuery(host, target),
+		})
+	}
+
+	return banners
+}
+
 func NewFingerprintScan(host string, rootScanId, parentScanId, runId, vantagePoint string) *FingerprintScan {
 	scan := &FingerprintScan{
 		Meta: &FingerprintScanMetaInformation{},
@@ -96,5 +176,9 @@ func NewFingerprintScan(host string, rootScanId, parentScanId, runId, vantagePoi
 	sshQuery := query.NewSSHQuery(host)
 	scan.SSHQuery = sshQuery
 
+	scan.CookieQuery = query.NewCookieQuery(host)
+
+	scan.Probes = fingerprint.NewProbes(host)
+
 	return scan
 }
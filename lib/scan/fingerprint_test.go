@@ -1,11 +1,15 @@
 package scan_test
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
 	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFingerprintScan_RealWorld(t *testing.T) {
@@ -62,7 +66,149 @@ func TestFingerprintScan_New(t *testing.T) {
 	assert.NotNil(t, s.VersionBindQuery, "query should not be nil")
 	assert.NotNil(t, s.VersionServerQuery, "query should not be nil")
 	assert.NotNil(t, s.SSHQuery, "query should not be nil")
+	assert.NotNil(t, s.CookieQuery, "query should not be nil")
+	assert.Equal(t, "host", s.CookieQuery.Host)
 	assert.Nil(t, s.VersionBindResult, "result should be nil")
 	assert.Nil(t, s.VersionServerResult, "result should be nil")
 	assert.Nil(t, s.SSHResult, "result should be nil")
+	assert.Nil(t, s.CookieResult, "result should be nil")
+	assert.NotEmpty(t, s.Probes, "probes should not be empty")
+	assert.Nil(t, s.Classification, "classification should be nil")
+	assert.Nil(t, s.Banners, "banners should be added by the consumer")
+}
+
+func TestNewFingerprintBanners(t *testing.T) {
+	t.Parallel()
+
+	targets, err := query.ParseBannerTargets("http:80,https:443,http:8080,telnet:23")
+	require.NoError(t, err)
+
+	banners := scan.NewFingerprintBanners("host", targets)
+
+	require.Len(t, banners, len(targets))
+	for i, banner := range banners {
+		assert.Equal(t, "host", banner.Query.Host)
+		assert.Equal(t, targets[i].Port, banner.Query.Port)
+		assert.Equal(t, targets[i].Timeout, banner.Query.Timeout)
+		assert.Nil(t, banner.Result)
+	}
+
+	assert.Empty(t, scan.NewFingerprintBanners("host", nil))
+}
+
+func TestFingerprintScan_Marshal(t *testing.T) {
+	t.Parallel()
+
+	s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+
+	b, err := s.Marshal()
+	require.NoError(t, err)
+
+	unmarshaled := &scan.FingerprintScan{}
+	require.NoError(t, json.Unmarshal(b, unmarshaled), "probes should not carry resource records in the query messages")
+	assert.Len(t, unmarshaled.Probes, len(s.Probes))
+}
+
+func TestFingerprintScan_GetObservations(t *testing.T) {
+	t.Parallel()
+
+	s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+	s.VersionBindResult = &query.ConventionalDNSResponse{}
+
+	observations := s.GetObservations()
+
+	assert.Len(t, observations, len(s.Probes)+2, "should observe version.bind, version.server and each probe")
+	assert.Equal(t, fingerprint.SIGNATURE_NO_RESPONSE, observations[fingerprint.PROBE_VERSION_BIND].Signature)
+	assert.Contains(t, observations, fingerprint.PROBE_HOSTNAME_BIND)
+}
+
+func TestFingerprintScan_Normalize(t *testing.T) {
+	t.Parallel()
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: "version.bind.", Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+		Txt: []string{"dnsmasq-2.80"},
+	}}
+
+	s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+	s.VersionBindResult = &query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: msg}}
+	s.VersionServerResult = &query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: new(dns.Msg)}}
+
+	s.Normalize(scan.DEFAULT_VERSION_PATTERN_TABLE)
+
+	require.NotNil(t, s.VersionBind)
+	assert.Equal(t, "dnsmasq", s.VersionBind.Product)
+	assert.Equal(t, "2.80", s.VersionBind.Version)
+	assert.False(t, s.VersionBind.IsHidden)
+
+	require.NotNil(t, s.VersionServer, "a response without TXT records hides the version")
+	assert.True(t, s.VersionServer.IsHidden)
+
+	refused := new(dns.Msg)
+	refused.Rcode = dns.RcodeRefused
+	s.VersionServerResult = &query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: refused}}
+	s.Normalize(scan.DEFAULT_VERSION_PATTERN_TABLE)
+	require.NotNil(t, s.VersionServer)
+	assert.False(t, s.VersionServer.IsHidden, "a refused query does not hide the version")
+
+	s.VersionServerResult = nil
+	s.Normalize(scan.DEFAULT_VERSION_PATTERN_TABLE)
+	assert.Nil(t, s.VersionServer)
+}
+
+func TestFingerprintScan_Classify(t *testing.T) {
+	t.Parallel()
+
+	for _, txt := range []string{
+		"9.18.28-0ubuntu0.22.04.1-Ubuntu",
+		"BIND 9.20.4",
+		"dnsmasq-pi-hole-v2.90+1",
+		"  unbound 1.19.2  ",
+		"PowerDNS Recursor 4.8.4",
+		"Microsoft DNS 6.1.7601 (1DB15CD4)",
+		"unbound",
+	} {
+		t.Run(txt, func(t *testing.T) {
+			t.Parallel()
+
+			s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+			s.VersionBindResult = newTestVersionResult(txt)
+
+			s.Classify(fingerprint.DEFAULT_RULE_SET, scan.DEFAULT_VERSION_PATTERN_TABLE)
+			s.Normalize(scan.DEFAULT_VERSION_PATTERN_TABLE)
+
+			require.NotNil(t, s.Classification)
+			assert.Equal(t, s.VersionBind.Product, s.Classification.Software, "classification and normalization should agree")
+			assert.Equal(t, s.VersionBind.Version, s.Classification.Version)
+			assert.Equal(t, fingerprint.DEFAULT_RULE_SET.Revision, s.Classification.Revision)
+		})
+	}
+
+	t.Run("version.server", func(t *testing.T) {
+		t.Parallel()
+
+		s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+		s.VersionServerResult = newTestVersionResult("nsd 4.8.0")
+
+		s.Classify(fingerprint.DEFAULT_RULE_SET, scan.DEFAULT_VERSION_PATTERN_TABLE)
+
+		assert.Equal(t, fingerprint.SOFTWARE_NSD, s.Classification.Software)
+		assert.Equal(t, []string{"nsd_version_server"}, s.Classification.Candidates[0].Rules)
+	})
+
+	t.Run("custom pattern table", func(t *testing.T) {
+		t.Parallel()
+
+		table, err := scan.ParseVersionPatternTable([]byte(testVersionPatternTable))
+		require.NoError(t, err)
+
+		s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+		s.VersionBindResult = newTestVersionResult("custom 7")
+
+		s.Classify(fingerprint.DEFAULT_RULE_SET, table)
+
+		assert.Equal(t, "Custom DNS", s.Classification.Software)
+		assert.Equal(t, "7", s.Classification.Version)
+	})
 }
@@ -0,0 +1,68 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+const ODOH_SCAN_TYPE = "ODoH"
+
+type ODoHScanMetaInformation struct {
+	ScanMetaInformation
+}
+
+type ODoHScan struct {
+	Scan
+
+	Meta   *ODoHScanMetaInformation `json:"meta"`
+	Query  *query.ODoHQuery         `json:"query"`
+	Result *query.ODoHResponse      `json:"result"`
+}
+
+func (scan *ODoHScan) Marshal() (bytes []byte, err error) {
+	return json.Marshal(scan)
+}
+
+func (scan *ODoHScan) GetMetaInformation() *ScanMetaInformation {
+	return &scan.Meta.ScanMetaInformation
+}
+
+func (scan *ODoHScan) GetScanId() string {
+	return scan.Meta.ScanId
+}
+
+func (scan *ODoHScan) GetType() string {
+	return ODOH_SCAN_TYPE
+}
+
+func (scan *ODoHScan) GetDoEQuery() *query.DoEQuery {
+	return &scan.Query.DoEQuery
+}
+
+func (scan *ODoHScan) GetIdentifier() string {
+	// host, port, target path, proxy, skip_tls_verify
+	return fmt.Sprintf("%s|%s|%d|%s|%s|skip_tls_verify_%t",
+		ODOH_SCAN_TYPE,
+		scan.Query.Host,
+		scan.Query.Port,
+		scan.Query.TargetPath,
+		scan.Query.Proxy,
+		scan.Query.SkipCertificateVerify)
+}
+
+func NewODoHScan(q *query.ODoHQuery, parentScanId, rootScanId, runId, vantagePoint string) *ODoHScan {
+	if q == nil {
+		q = query.NewODoHQuery()
+	}
+
+	scan := &ODoHScan{
+		Meta: &ODoHScanMetaInformation{},
+	}
+	scan.Meta.ScanMetaInformation = *NewScanMetaInformation(parentScanId, rootScanId, runId, vantagePoint)
+
+	scan.Query = q
+
+	return scan
+}
@@ -0,0 +1,72 @@
+package scan_test
+
+import (
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestODoHScan_Constructor(t *testing.T) {
+	t.Parallel()
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+		scan := scan.NewODoHScan(nil, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, "ODoH", scan.GetType(), "should have returned ODoH")
+		assert.NotNil(t, scan.Meta, "meta should not be nil")
+		assert.NotNil(t, scan.Query, "query should not be nil")
+		assert.Nil(t, scan.Result, "result should be nil")
+		assert.Equal(t, "parent", scan.GetMetaInformation().ParentScanId, "should have returned parent")
+		assert.Equal(t, "root", scan.GetMetaInformation().RootScanId, "should have returned root")
+		assert.Equal(t, "run", scan.GetMetaInformation().RunId, "should have returned run")
+		assert.Equal(t, "vantagepoint", scan.GetMetaInformation().VantagePoint, "should have returned vantagepoint")
+	})
+
+	t.Run("non-nil query", func(t *testing.T) {
+		t.Parallel()
+		q := query.NewODoHQuery()
+		scan := scan.NewODoHScan(q, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, q, scan.Query, "should have attached query")
+		assert.NotEmpty(t, scan.GetScanId(), "should have generated a scan id")
+	})
+}
+
+func TestODoHScan_Marshall(t *testing.T) {
+	t.Parallel()
+	scan := scan.NewODoHScan(nil, "parent", "root", "run", "vantagepoint")
+	bytes, err := scan.Marshal()
+
+	// test
+	assert.Nil(t, err, "should not have returned an error")
+	assert.NotNil(t, bytes, "should have returned bytes")
+}
+
+func TestODoHScan_DoEFunctions(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewODoHQuery()
+	scan := scan.NewODoHScan(q, "parent", "root", "run", "vantagepoint")
+
+	assert.Equal(t, &q.DoEQuery, scan.GetDoEQuery(), "should have returned DoE query")
+}
+
+func TestODoHScan_Identifier(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewODoHQuery()
+	q.Host = "example.com"
+	s1 := scan.NewODoHScan(q, "parent", "root", "run", "vantagepoint")
+
+	q2 := query.NewODoHQuery()
+	q2.Host = "example.com"
+	q2.Proxy = "https://proxy.example.com/proxy"
+	s2 := scan.NewODoHScan(q2, "parent", "root", "run", "vantagepoint")
+
+	assert.Contains(t, s1.GetIdentifier(), "ODoH|example.com|443|/dns-query")
+	assert.NotEqual(t, s1.GetIdentifier(), s2.GetIdentifier(), "proxy should be part of the identifier")
+}
@@ -0,0 +1,68 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+const OHTTP_SCAN_TYPE = "OHTTP"
+
+type OHTTPScanMetaInformation struct {
+	ScanMetaInformation
+}
+
+type OHTTPScan struct {
+	Scan
+
+	Meta   *OHTTPScanMetaInformation `json:"meta"`
+	Query  *query.OHTTPQuery         `json:"query"`
+	Result *query.OHTTPResponse      `json:"result"`
+}
+
+func (scan *OHTTPScan) Marshal() (bytes []byte, err error) {
+	return json.Marshal(scan)
+}
+
+func (scan *OHTTPScan) GetMetaInformation() *ScanMetaInformation {
+	return &scan.Meta.ScanMetaInformation
+}
+
+func (scan *OHTTPScan) GetScanId() string {
+	return scan.Meta.ScanId
+}
+
+func (scan *OHTTPScan) GetType() string {
+	return OHTTP_SCAN_TYPE
+}
+
+func (scan *OHTTPScan) GetDoEQuery() *query.DoEQuery {
+	return &scan.Query.DoEQuery
+}
+
+func (scan *OHTTPScan) GetIdentifier() string {
+	// host, port, gateway path, target path, skip_tls_verify
+	return fmt.Sprintf("%s|%s|%d|%s|%s|skip_tls_verify_%t",
+		OHTTP_SCAN_TYPE,
+		scan.Query.Host,
+		scan.Query.Port,
+		scan.Query.GatewayPath,
+		scan.Query.TargetPath,
+		scan.Query.SkipCertificateVerify)
+}
+
+func NewOHTTPScan(q *query.OHTTPQuery, parentScanId, rootScanId, runId, vantagePoint string) *OHTTPScan {
+	if q == nil {
+		q = query.NewOHTTPQuery()
+	}
+
+	scan := &OHTTPScan{
+		Meta: &OHTTPScanMetaInformation{},
+	}
+	scan.Meta.ScanMetaInformation = *NewScanMetaInformation(parentScanId, rootScanId, runId, vantagePoint)
+
+	scan.Query = q
+
+	return scan
+}
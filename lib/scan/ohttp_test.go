@@ -0,0 +1,66 @@
+package scan_test
+
+import (
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOHTTPScan_Constructor(t *testing.T) {
+	t.Parallel()
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+		scan := scan.NewOHTTPScan(nil, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, "OHTTP", scan.GetType(), "should have returned OHTTP")
+		assert.NotNil(t, scan.Meta, "meta should not be nil")
+		assert.NotNil(t, scan.Query, "query should not be nil")
+		assert.Nil(t, scan.Result, "result should be nil")
+		assert.Equal(t, "parent", scan.GetMetaInformation().ParentScanId, "should have returned parent")
+		assert.Equal(t, "root", scan.GetMetaInformation().RootScanId, "should have returned root")
+		assert.Equal(t, "run", scan.GetMetaInformation().RunId, "should have returned run")
+		assert.Equal(t, "vantagepoint", scan.GetMetaInformation().VantagePoint, "should have returned vantagepoint")
+	})
+
+	t.Run("non-nil query", func(t *testing.T) {
+		t.Parallel()
+		q := query.NewOHTTPQuery()
+		scan := scan.NewOHTTPScan(q, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, q, scan.Query, "should have attached query")
+		assert.NotEmpty(t, scan.GetScanId(), "should have generated a scan id")
+	})
+}
+
+func TestOHTTPScan_Marshall(t *testing.T) {
+	t.Parallel()
+	scan := scan.NewOHTTPScan(nil, "parent", "root", "run", "vantagepoint")
+	bytes, err := scan.Marshal()
+
+	// test
+	assert.Nil(t, err, "should not have returned an error")
+	assert.NotNil(t, bytes, "should have returned bytes")
+}
+
+func TestOHTTPScan_DoEFunctions(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewOHTTPQuery()
+	scan := scan.NewOHTTPScan(q, "parent", "root", "run", "vantagepoint")
+
+	assert.Equal(t, &q.DoEQuery, scan.GetDoEQuery(), "should have returned DoE query")
+}
+
+func TestOHTTPScan_Identifier(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewOHTTPQuery()
+	q.Host = "example.com"
+	s := scan.NewOHTTPScan(q, "parent", "root", "run", "vantagepoint")
+
+	assert.Equal(t, "OHTTP|example.com|443|/.well-known/ohttp-gateway|/dns-query|skip_tls_verify_false", s.GetIdentifier())
+}
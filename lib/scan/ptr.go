@@ -19,6 +19,9 @@ type PTRScan struct {
 	Meta   *PTRScanMetaInformation        `json:"meta"`
 	Query  *query.ConventionalDNSQuery    `json:"query"`
 	Result *query.ConventionalDNSResponse `json:"result"`
+
+	// Transport the DNS queries are sent over, Do53 if nil
+	Transport *query.DNSTransportDescriptor `json:"transport"`
 }
 
 func (scan *PTRScan) Marshal() (bytes []byte, err error) {
@@ -35,10 +38,11 @@ func (scan *PTRScan) GetType() string {
 
 func (scan *PTRScan) GetIdentifier() string {
 	// host, port
-	return fmt.Sprintf("%s|%s|%d",
+	return fmt.Sprintf("%s|%s|%d|%s",
 		PTR_SCAN_TYPE,
 		scan.Query.Host,
-		scan.Query.Port)
+		scan.Query.Port,
+		scan.Transport)
 }
 
 // TODO: Just pass meta information as a struct
@@ -30,6 +30,9 @@ type ResInfoScan struct {
 	// The host to query
 	Host string `json:"host"`
 
+	// Transport the DNS queries are sent over, Do53 if nil
+	Transport *query.DNSTransportDescriptor `json:"transport"`
+
 	Result   *ResInfoResult                 `json:"result"`
 	Response *query.ConventionalDNSResponse `json:"response"`
 }
@@ -52,10 +55,11 @@ func (scan *ResInfoScan) GetScanId() string {
 
 func (scan *ResInfoScan) GetIdentifier() string {
 	// host, targetname
-	return fmt.Sprintf("%s|%s|%s",
+	return fmt.Sprintf("%s|%s|%s|%s",
 		RESINFO_SCAN_TYPE,
 		scan.Host,
-		scan.TargetName)
+		scan.TargetName,
+		scan.Transport)
 }
 
 func NewResInfoScan(targetName, host, parentScanId, rootScanId, runId, vantagePoint string) *ResInfoScan {
@@ -3,6 +3,7 @@ package scan_test
 import (
 	"testing"
 
+	"github.com/steffsas/doe-hunter/lib/query"
 	"github.com/steffsas/doe-hunter/lib/scan"
 	"github.com/stretchr/testify/assert"
 )
@@ -23,3 +24,14 @@ func TestResinfo_NewResInfoScan(t *testing.T) {
 		assert.Equal(t, host, s.Host, "should have returned the correct host")
 	})
 }
+
+func TestResinfo_GetIdentifier(t *testing.T) {
+	t.Parallel()
+
+	do53 := scan.NewResInfoScan("dns.google.", "8.8.8.8", "", "", "", "")
+	doq := scan.NewResInfoScan("dns.google.", "8.8.8.8", "", "", "", "")
+	doq.Transport = &query.DNSTransportDescriptor{Protocol: query.TRANSPORT_DOQ}
+
+	assert.Equal(t, "ResInfo|8.8.8.8|dns.google.|do53", do53.GetIdentifier())
+	assert.NotEqual(t, do53.GetIdentifier(), doq.GetIdentifier(), "transport should be part of the identifier")
+}
@@ -0,0 +1,89 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+const RESUMPTION_SCAN_TYPE = "Resumption"
+
+type ResumptionScanMetaInformation struct {
+	ScanMetaInformation
+}
+
+type ResumptionScan struct {
+	Scan
+
+	Meta   *ResumptionScanMetaInformation `json:"meta"`
+	Query  *query.ResumptionQuery         `json:"query"`
+	Result *query.ResumptionResponse      `json:"result"`
+}
+
+func (scan *ResumptionScan) Marshal() (bytes []byte, err error) {
+	return json.Marshal(scan)
+}
+
+func (scan *ResumptionScan) GetScanId() string {
+	return scan.Meta.ScanId
+}
+
+func (scan *ResumptionScan) GetMetaInformation() *ScanMetaInformation {
+	return &scan.Meta.ScanMetaInformation
+}
+
+func (scan *ResumptionScan) GetType() string {
+	return RESUMPTION_SCAN_TYPE
+}
+
+func (scan *ResumptionScan) GetIdentifier() string {
+	// protocol, host, port, sni, uri, http version
+	return fmt.Sprintf("%s|%s|%s|%d|%s|%s|%s",
+		RESUMPTION_SCAN_TYPE,
+		scan.Query.Protocol,
+		scan.Query.Host,
+		scan.Query.Port,
+		scan.Query.SNI,
+		scan.Query.URI,
+		scan.Query.HTTPVersion)
+}
+
+// NewResumptionScanFromDoEScan creates a resumption scan for the endpoint of a DoT, DoH or DoQ scan, nil for other scans
+func NewResumptionScanFromDoEScan(doeScan DoEScan, rootScanId, runId, vantagePoint string) *ResumptionScan {
+	q := query.NewResumptionQuery()
+
+	switch s := doeScan.(type) {
+	case *DoTScan:
+		q.Protocol = query.TRANSPORT_DOT
+	case *DoHScan:
+		q.Protocol = query.TRANSPORT_DOH
+		q.URI = s.Query.URI
+		q.HTTPVersion = s.Query.HTTPVersion
+	case *DoQScan:
+		q.Protocol = query.TRANSPORT_DOQ
+	default:
+		return nil
+	}
+
+	doeQuery := doeScan.GetDoEQuery()
+	q.Host = doeQuery.Host
+	q.Port = doeQuery.Port
+	q.SNI = doeQuery.SNI
+	q.SkipCertificateVerify = doeQuery.SkipCertificateVerify
+
+	return NewResumptionScan(q, doeScan.GetMetaInformation().ScanId, rootScanId, runId, vantagePoint)
+}
+
+func NewResumptionScan(q *query.ResumptionQuery, parentScanId, rootScanId, runId, vantagePoint string) *ResumptionScan {
+	if q == nil {
+		q = query.NewResumptionQuery()
+	}
+
+	scan := &ResumptionScan{
+		Meta: &ResumptionScanMetaInformation{},
+	}
+	scan.Meta.ScanMetaInformation = *NewScanMetaInformation(parentScanId, rootScanId, runId, vantagePoint)
+	scan.Query = q
+	return scan
+}
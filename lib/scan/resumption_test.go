@@ -0,0 +1,148 @@
+package scan_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumptionScan_Marshal(t *testing.T) {
+	t.Parallel()
+
+	marshal := func(t *testing.T, res *query.ResumptionResponse) map[string]interface{} {
+		t.Helper()
+
+		s := scan.NewResumptionScan(nil, "parent", "root", "run", "vantagepoint")
+		s.Result = res
+
+		b, err := s.Marshal()
+		require.NoError(t, err)
+
+		doc := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(b, &doc))
+		return doc["result"].(map[string]interface{})
+	}
+
+	t.Run("no session ticket issued", func(t *testing.T) {
+		t.Parallel()
+
+		result := marshal(t, &query.ResumptionResponse{
+			Initial: &query.DoEResponse{TLSVersion: "TLS 1.3"},
+		})
+
+		assert.Equal(t, false, result["ticket_issued"])
+		assert.Nil(t, result["resumed"])
+		assert.Equal(t, false, result["resumption_accepted"])
+		assert.Empty(t, result["early_data_status"], "should not attempt 0-RTT")
+	})
+
+	t.Run("resumption rejected by the server", func(t *testing.T) {
+		t.Parallel()
+
+		result := marshal(t, &query.ResumptionResponse{
+			Initial:      &query.DoEResponse{TLSVersion: "TLS 1.3"},
+			Resumed:      &query.DoEResponse{TLSVersion: "TLS 1.3", TLSResumed: false},
+			TicketIssued: true,
+		})
+
+		assert.Equal(t, true, result["ticket_issued"])
+		assert.NotNil(t, result["resumed"])
+		assert.Equal(t, false, result["resumption_accepted"])
+	})
+
+	t.Run("0-RTT accepted and rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, status := range []string{query.EARLY_DATA_ACCEPTED, query.EARLY_DATA_REJECTED} {
+			result := marshal(t, &query.ResumptionResponse{
+				Resumed:            &query.DoEResponse{TLSResumed: true},
+				TicketIssued:       true,
+				TicketEarlyData:    true,
+				ResumptionAccepted: true,
+				EarlyDataStatus:    status,
+			})
+
+			assert.Equal(t, true, result["ticket_early_data"], status)
+			assert.Equal(t, true, result["resumption_accepted"], status)
+			assert.Equal(t, status, result["early_data_status"], status)
+		}
+	})
+}
+
+func TestResumptionScan_Identifier(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewResumptionQuery()
+	q.Host = "8.8.8.8"
+	q.SNI = "dns.google"
+	s := scan.NewResumptionScan(q, "parent", "root", "run", "vantagepoint")
+
+	assert.Equal(t, "Resumption|dot|8.8.8.8|853|dns.google|/dns-query{?dns}|HTTP2", s.GetIdentifier())
+}
+
+func TestNewResumptionScanFromDoEScan(t *testing.T) {
+	t.Parallel()
+
+	t.Run("DoH", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+		q.SNI = "dns.google"
+		q.URI = "/query{?dns}"
+		q.HTTPVersion = query.HTTP_VERSION_3
+		dohScan := scan.NewDoHScan(q, "parent", "root", "run", "vantagepoint")
+
+		s := scan.NewResumptionScanFromDoEScan(dohScan, "root", "run", "vantagepoint")
+
+		require.NotNil(t, s)
+		assert.Equal(t, query.TRANSPORT_DOH, s.Query.Protocol)
+		assert.Equal(t, "8.8.8.8", s.Query.Host)
+		assert.Equal(t, 443, s.Query.Port)
+		assert.Equal(t, "dns.google", s.Query.SNI)
+		assert.Equal(t, "/query{?dns}", s.Query.URI)
+		assert.Equal(t, query.HTTP_VERSION_3, s.Query.HTTPVersion)
+		assert.Equal(t, dohScan.GetScanId(), s.Meta.ParentScanId)
+		assert.Equal(t, "root", s.Meta.RootScanId)
+	})
+
+	t.Run("DoT", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoTQuery()
+		q.Host = "8.8.8.8"
+		q.SkipCertificateVerify = true
+
+		s := scan.NewResumptionScanFromDoEScan(scan.NewDoTScan(q, "parent", "root", "run", "vantagepoint"), "root", "run", "vantagepoint")
+
+		require.NotNil(t, s)
+		assert.Equal(t, query.TRANSPORT_DOT, s.Query.Protocol)
+		assert.True(t, s.Query.SkipCertificateVerify)
+		assert.Equal(t, 853, s.Query.Port)
+	})
+
+	t.Run("ODoH", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, scan.NewResumptionScanFromDoEScan(scan.NewODoHScan(nil, "parent", "root", "run", "vantagepoint"), "root", "run", "vantagepoint"))
+	})
+
+	t.Run("DoQ", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoQQuery()
+		q.Host = "8.8.8.8"
+		q.Port = 8853
+
+		s := scan.NewResumptionScanFromDoEScan(scan.NewDoQScan(q, "parent", "root", "run", "vantagepoint"), "root", "run", "vantagepoint")
+
+		require.NotNil(t, s)
+		assert.Equal(t, query.TRANSPORT_DOQ, s.Query.Protocol)
+		assert.Equal(t, 8853, s.Query.Port)
+		assert.True(t, s.Query.EarlyData)
+	})
+}
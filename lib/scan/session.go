@@ -0,0 +1,89 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+const SESSION_SCAN_TYPE = "Session"
+
+type SessionScanMetaInformation struct {
+	ScanMetaInformation
+}
+
+type SessionScan struct {
+	Scan
+
+	Meta   *SessionScanMetaInformation `json:"meta"`
+	Query  *query.SessionQuery         `json:"query"`
+	Result *query.SessionResponse      `json:"result"`
+}
+
+func (scan *SessionScan) Marshal() (bytes []byte, err error) {
+	return json.Marshal(scan)
+}
+
+func (scan *SessionScan) GetScanId() string {
+	return scan.Meta.ScanId
+}
+
+func (scan *SessionScan) GetMetaInformation() *ScanMetaInformation {
+	return &scan.Meta.ScanMetaInformation
+}
+
+func (scan *SessionScan) GetType() string {
+	return SESSION_SCAN_TYPE
+}
+
+func (scan *SessionScan) GetIdentifier() string {
+	// protocol, host, port, sni, uri, http version
+	return fmt.Sprintf("%s|%s|%s|%d|%s|%s|%s",
+		SESSION_SCAN_TYPE,
+		scan.Query.Protocol,
+		scan.Query.Host,
+		scan.Query.Port,
+		scan.Query.SNI,
+		scan.Query.URI,
+		scan.Query.HTTPVersion)
+}
+
+// NewSessionScanFromDoEScan creates a session scan for the endpoint of a DoT, DoH or DoQ scan, nil for other scans
+func NewSessionScanFromDoEScan(doeScan DoEScan, rootScanId, runId, vantagePoint string) *SessionScan {
+	q := query.NewSessionQuery()
+
+	switch s := doeScan.(type) {
+	case *DoTScan:
+		q.Protocol = query.TRANSPORT_DOT
+	case *DoHScan:
+		q.Protocol = query.TRANSPORT_DOH
+		q.URI = s.Query.URI
+		q.HTTPVersion = s.Query.HTTPVersion
+	case *DoQScan:
+		q.Protocol = query.TRANSPORT_DOQ
+	default:
+		return nil
+	}
+
+	doeQuery := doeScan.GetDoEQuery()
+	q.Host = doeQuery.Host
+	q.Port = doeQuery.Port
+	q.SNI = doeQuery.SNI
+	q.SkipCertificateVerify = doeQuery.SkipCertificateVerify
+
+	return NewSessionScan(q, doeScan.GetMetaInformation().ScanId, rootScanId, runId, vantagePoint)
+}
+
+func NewSessionScan(q *query.SessionQuery, parentScanId, rootScanId, runId, vantagePoint string) *SessionScan {
+	if q == nil {
+		q = query.NewSessionQuery()
+	}
+
+	scan := &SessionScan{
+		Meta: &SessionScanMetaInformation{},
+	}
+	scan.Meta.ScanMetaInformation = *NewScanMetaInformation(parentScanId, rootScanId, runId, vantagePoint)
+	scan.Query = q
+	return scan
+}
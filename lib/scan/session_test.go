@@ -0,0 +1,100 @@
+package scan_test
+
+import (
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionScan_Constructor(t *testing.T) {
+	t.Parallel()
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+		scan := scan.NewSessionScan(nil, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, "Session", scan.GetType(), "should have returned Session")
+		assert.NotNil(t, scan.Meta, "meta should not be nil")
+		assert.NotNil(t, scan.Query, "query should not be nil")
+		assert.Nil(t, scan.Result, "result should be nil")
+		assert.Equal(t, "parent", scan.GetMetaInformation().ParentScanId, "should have returned parent")
+		assert.Equal(t, "root", scan.GetMetaInformation().RootScanId, "should have returned root")
+		assert.Equal(t, "run", scan.GetMetaInformation().RunId, "should have returned run")
+		assert.Equal(t, "vantagepoint", scan.GetMetaInformation().VantagePoint, "should have returned vantagepoint")
+	})
+
+	t.Run("non-nil query", func(t *testing.T) {
+		t.Parallel()
+		q := query.NewSessionQuery()
+		scan := scan.NewSessionScan(q, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, q, scan.Query, "should have attached query")
+		assert.NotEmpty(t, scan.GetScanId(), "should have generated a scan id")
+	})
+}
+
+func TestSessionScan_Marshall(t *testing.T) {
+	t.Parallel()
+	scan := scan.NewSessionScan(nil, "parent", "root", "run", "vantagepoint")
+	bytes, err := scan.Marshal()
+
+	// test
+	assert.Nil(t, err, "should not have returned an error")
+	assert.NotNil(t, bytes, "should have returned bytes")
+}
+
+func TestSessionScan_Identifier(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewSessionQuery()
+	q.Host = "8.8.8.8"
+	q.SNI = "dns.google"
+	s := scan.NewSessionScan(q, "parent", "root", "run", "vantagepoint")
+
+	assert.Equal(t, "Session|dot|8.8.8.8|853|dns.google|/dns-query{?dns}|HTTP2", s.GetIdentifier())
+}
+
+func TestNewSessionScanFromDoEScan(t *testing.T) {
+	t.Parallel()
+
+	t.Run("DoH", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoHQuery()
+		q.Host = "8.8.8.8"
+		q.SNI = "dns.google"
+		q.URI = "/query{?dns}"
+		q.HTTPVersion = query.HTTP_VERSION_3
+		dohScan := scan.NewDoHScan(q, "parent", "root", "run", "vantagepoint")
+
+		s := scan.NewSessionScanFromDoEScan(dohScan, "root", "run", "vantagepoint")
+
+		require.NotNil(t, s)
+		assert.Equal(t, query.TRANSPORT_DOH, s.Query.Protocol)
+		assert.Equal(t, "8.8.8.8", s.Query.Host)
+		assert.Equal(t, 443, s.Query.Port)
+		assert.Equal(t, "dns.google", s.Query.SNI)
+		assert.Equal(t, "/query{?dns}", s.Query.URI)
+		assert.Equal(t, query.HTTP_VERSION_3, s.Query.HTTPVersion)
+		assert.Equal(t, dohScan.GetScanId(), s.Meta.ParentScanId)
+		assert.Equal(t, "root", s.Meta.RootScanId)
+	})
+
+	t.Run("DoQ", func(t *testing.T) {
+		t.Parallel()
+
+		q := query.NewDoQQuery()
+		q.Host = "8.8.8.8"
+		q.Port = 8853
+
+		s := scan.NewSessionScanFromDoEScan(scan.NewDoQScan(q, "parent", "root", "run", "vantagepoint"), "root", "run", "vantagepoint")
+
+		require.NotNil(t, s)
+		assert.Equal(t, query.TRANSPORT_DOQ, s.Query.Protocol)
+		assert.Equal(t, 8853, s.Query.Port)
+	})
+}
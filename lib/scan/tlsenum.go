@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+const TLS_ENUM_SCAN_TYPE = "TLSEnum"
+
+type TLSEnumScanMetaInformation struct {
+	ScanMetaInformation
+}
+
+type TLSEnumScan struct {
+	Scan
+
+	Meta   *TLSEnumScanMetaInformation `json:"meta"`
+	Query  *query.TLSEnumQuery         `json:"query"`
+	Result *query.TLSEnumResponse      `json:"result"`
+}
+
+func (scan *TLSEnumScan) Marshal() (bytes []byte, err error) {
+	return json.Marshal(scan)
+}
+
+func (scan *TLSEnumScan) GetScanId() string {
+	return scan.Meta.ScanId
+}
+
+func (scan *TLSEnumScan) GetMetaInformation() *ScanMetaInformation {
+	return &scan.Meta.ScanMetaInformation
+}
+
+func (scan *TLSEnumScan) GetType() string {
+	return TLS_ENUM_SCAN_TYPE
+}
+
+func (scan *TLSEnumScan) GetIdentifier() string {
+	// host, port, sni, alpn
+	// enumerate each endpoint only once since it is expensive
+	alpn := slices.Clone(scan.Query.ALPN)
+	slices.Sort(alpn)
+
+	return fmt.Sprintf("%s|%s|%d|%s|%s",
+		TLS_ENUM_SCAN_TYPE,
+		scan.Query.Host,
+		scan.Query.Port,
+		scan.Query.SNI,
+		alpn)
+}
+
+func NewTLSEnumScan(q *query.TLSEnumQuery, parentScanId, rootScanId, runId, vantagePoint string) *TLSEnumScan {
+	if q == nil {
+		q = query.NewTLSEnumQuery()
+	}
+
+	scan := &TLSEnumScan{
+		Meta: &TLSEnumScanMetaInformation{},
+	}
+	scan.Meta.ScanMetaInformation = *NewScanMetaInformation(parentScanId, rootScanId, runId, vantagePoint)
+	scan.Query = q
+	return scan
+}
@@ -0,0 +1,60 @@
+package scan_test
+
+import (
+	"testing"
+
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSEnumScan_Constructor(t *testing.T) {
+	t.Parallel()
+	t.Run("nil query", func(t *testing.T) {
+		t.Parallel()
+		scan := scan.NewTLSEnumScan(nil, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, "TLSEnum", scan.GetType(), "should have returned TLSEnum")
+		assert.NotNil(t, scan.Meta, "meta should not be nil")
+		assert.NotNil(t, scan.Query, "query should not be nil")
+		assert.Nil(t, scan.Result, "result should be nil")
+		assert.Equal(t, "parent", scan.GetMetaInformation().ParentScanId, "should have returned parent")
+		assert.Equal(t, "root", scan.GetMetaInformation().RootScanId, "should have returned root")
+		assert.Equal(t, "run", scan.GetMetaInformation().RunId, "should have returned run")
+		assert.Equal(t, "vantagepoint", scan.GetMetaInformation().VantagePoint, "should have returned vantagepoint")
+	})
+
+	t.Run("non-nil query", func(t *testing.T) {
+		t.Parallel()
+		q := query.NewTLSEnumQuery()
+		scan := scan.NewTLSEnumScan(q, "parent", "root", "run", "vantagepoint")
+
+		// test
+		assert.Equal(t, q, scan.Query, "should have attached query")
+		assert.NotEmpty(t, scan.GetScanId(), "should have generated a scan id")
+	})
+}
+
+func TestTLSEnumScan_Marshall(t *testing.T) {
+	t.Parallel()
+	scan := scan.NewTLSEnumScan(nil, "parent", "root", "run", "vantagepoint")
+	bytes, err := scan.Marshal()
+
+	// test
+	assert.Nil(t, err, "should not have returned an error")
+	assert.NotNil(t, bytes, "should have returned bytes")
+}
+
+func TestTLSEnumScan_Identifier(t *testing.T) {
+	t.Parallel()
+
+	q := query.NewTLSEnumQuery()
+	q.Host = "8.8.8.8"
+	q.SNI = "dns.google"
+	q.ALPN = []string{"h2", "h1"}
+	s := scan.NewTLSEnumScan(q, "parent", "root", "run", "vantagepoint")
+
+	assert.Equal(t, "TLSEnum|8.8.8.8|443|dns.google|[h1 h2]", s.GetIdentifier())
+	assert.Equal(t, []string{"h2", "h1"}, q.ALPN, "should not have modified the query")
+}
@@ -0,0 +1,529 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
+	"github.com/steffsas/doe-hunter/lib/query"
+)
+
+// VERSION_PATTERN_VERSION_GROUP is the named group of a pattern that extracts the version
+const VERSION_PATTERN_VERSION_GROUP = "version"
+
+// MAX_FINGERPRINT_DOCUMENT_SIZE is the maximum size of a stored fingerprint scan to re-normalize
+const MAX_FINGERPRINT_DOCUMENT_SIZE = 64 * 1024 * 1024
+
+// VersionPattern attributes a version.bind or version.server string to a product
+type VersionPattern struct {
+	Name string `json:"name"`
+	// Pattern is matched against the string, the group version extracts the version (optional)
+	Pattern string `json:"pattern"`
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	// Weight is the probability that a match identifies the product when classifying the software,
+	// patterns without product or weight do not take part in the classification
+	Weight float64 `json:"weight"`
+
+	regexp *regexp.Regexp
+}
+
+// DistroPattern attributes a version string to the distribution that packaged the software,
+// e.g., "9.18.28-0ubuntu0.22.04.1-Ubuntu"
+type DistroPattern struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+
+	regexp *regexp.Regexp
+}
+
+// VersionPatternTable normalizes version strings, tables are JSON files, see versionbind_patterns.json
+type VersionPatternTable struct {
+	// Revision must be increased whenever the patterns change to tell stale normalizations apart
+	Revision int `json:"revision"`
+	// Patterns are tried in order, the first match wins
+	Patterns []*VersionPattern `json:"patterns"`
+	// Distros are tried in order, the first match wins
+	Distros []*DistroPattern `json:"distros"`
+
+	rules []*fingerprint.Rule
+}
+
+// NormalizedVersion is a version.bind or version.server string split into its parts
+type NormalizedVersion struct {
+	Raw     string `json:"raw"`
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Version string `json:"version"`
+	Distro  string `json:"distro"`
+	// Rcode is the response code of the answer
+	Rcode string `json:"rcode"`
+	// IsHidden is set if the server answered but does not disclose a version, e.g., "none", "unbound" or a joke,
+	// servers refusing or not implementing the query do not hide the version
+	IsHidden bool `json:"is_hidden"`
+	// Pattern is the name of the matched pattern, empty if no pattern matches
+	Pattern string `json:"pattern"`
+	// Revision is the revision of the table the string was normalized with
+	Revision int `json:"revision"`
+}
+
+//go:embed versionbind_patterns.json
+var defaultVersionPatternTable []byte // nolint: gochecknoglobals
+
+// DEFAULT_VERSION_PATTERN_TABLE covers the version strings of common DNS software
+//
+// nolint: gochecknoglobals
+var DEFAULT_VERSION_PATTERN_TABLE = mustParseVersionPatternTable(defaultVersionPatternTable)
+
+// Normalize splits the version string of an answer with the response code, strings that match no pattern are
+// considered obfuscated
+func (t *VersionPatternTable) Normalize(raw string, rcode int) *NormalizedVersion {
+	normalized := &NormalizedVersion{
+		Raw:      raw,
+		Rcode:    dns.RcodeToString[rcode],
+		Revision: t.Revision,
+	}
+
+	s := strings.TrimSpace(raw)
+
+	for _, pattern := range t.Patterns {
+		match := pattern.regexp.FindStringSubmatch(s)
+		if match == nil {
+			continue
+		}
+
+		normalized.Pattern = pattern.Name
+		normalized.Vendor = pattern.Vendor
+		normalized.Product = pattern.Product
+		if i := pattern.regexp.SubexpIndex(VERSION_PATTERN_VERSION_GROUP); i > 0 {
+			normalized.Version = match[i]
+		}
+
+		break
+	}
+
+	for _, distro := range t.Distros {
+		if distro.regexp.MatchString(s) {
+			normalized.Distro = distro.Name
+			break
+		}
+	}
+
+	normalized.IsHidden = rcode == dns.RcodeSuccess && normalized.Version == ""
+
+	return normalized
+}
+
+// Rules attribute the version.bind, version.server and version.pdns strings to the products of the patterns,
+// so that the classification agrees with the normalization
+func (t *VersionPatternTable) Rules() []*fingerprint.Rule {
+	return t.rules
+}
+
+func (t *VersionPatternTable) compile() (err error) {
+	t.rules = []*fingerprint.Rule{}
+	for _, pattern := range t.Patterns {
+		pattern.regexp, err = regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", pattern.Name, err)
+		}
+
+		if pattern.Product == "" || pattern.Weight <= 0 {
+			continue
+		}
+
+		t.rules = append(t.rules,
+			fingerprint.NewTextRule(pattern.Name, pattern.Product, fingerprint.PROBE_VERSION_BIND, pattern.regexp, pattern.Weight),
+			fingerprint.NewTextRule(pattern.Name+"_server", pattern.Product, fingerprint.PROBE_VERSION_SERVER, pattern.regexp, pattern.Weight),
+			fingerprint.NewTextRule(pattern.Name+"_pdns", pattern.Product, fingerprint.PROBE_VERSION_PDNS, pattern.regexp, pattern.Weight),
+		)
+	}
+
+	for _, distro := range t.Distros {
+		distro.regexp, err = regexp.Compile(distro.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid distro pattern %s: %w", distro.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ParseVersionPatternTable parses and compiles a JSON pattern table
+func ParseVersionPatternTable(data []byte) (*VersionPatternTable, error) {
+	table := &VersionPatternTable{}
+	if err := json.Unmarshal(data, table); err != nil {
+		return nil, fmt.Errorf("failed to parse version pattern table: %w", err)
+	}
+
+	if err := table.compile(); err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// LoadVersionPatternTable reads a JSON pattern table from a file
+func LoadVersionPatternTable(path string) (*VersionPatternTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseVersionPatternTable(data)
+}
+
+func mustParseVersionPatternTable(data []byte) *VersionPatternTable {
+	table, err := ParseVersionPatternTable(data)
+	if err != nil {
+		panic(err)
+	}
+
+	return table
+}
+
+// RenormalizeFingerprintScans normalizes the version strings of stored fingerprint scans again, e.g., after
+// the pattern table has been updated, and classifies the scans again so that the classification agrees
+// with the normalized versions. The scans are read and written as one JSON document per line, as
+// written by mongoexport. The documents are handled generically since stored DNS messages cannot be
+// unmarshaled into a scan, both the JSON field names of the scan and the field names of the BSON encoder
+// are understood.
+func RenormalizeFingerprintScans(r io.Reader, w io.Writer, ruleSet *fingerprint.RuleSet, table *VersionPatternTable) (count int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MAX_FINGERPRINT_DOCUMENT_SIZE)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		// keep numbers as they are, e.g., int64 timestamps
+		doc := map[string]interface{}{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err = decoder.Decode(&doc); err != nil {
+			return count, fmt.Errorf("failed to decode scan in line %d: %w", line, err)
+		}
+
+		observations := getStoredObservations(doc)
+
+		for _, v := range []struct {
+			probe      string
+			name       string
+			resultName string
+		}{
+			{fingerprint.PROBE_VERSION_BIND, "version_bind", "version_bind_result"},
+			{fingerprint.PROBE_VERSION_SERVER, "version_server", "version_server_result"},
+		} {
+			normalized, err := renormalizeVersion(doc, v.name, v.resultName, table)
+			if err != nil {
+				return count, err
+			}
+
+			// the result is gone, the stored raw string is still observed
+			if normalized != nil && observations[v.probe].Signature == fingerprint.SIGNATURE_NO_RESPONSE {
+				observations[v.probe] = &fingerprint.Observation{Text: normalized.Raw}
+			}
+		}
+
+		if err = reclassify(doc, observations, ruleSet, table); err != nil {
+			return count, err
+		}
+
+		data, err = json.Marshal(doc)
+		if err != nil {
+			return count, fmt.Errorf("failed to encode scan in line %d: %w", line, err)
+		}
+
+		if _, err = w.Write(append(data, '\n')); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, scanner.Err()
+}
+
+// renormalizeVersion normalizes the raw string of the stored normalization, or the answer of the
+// result if the scan predates normalization
+func renormalizeVersion(doc map[string]interface{}, name string, resultName string, table *VersionPatternTable) (*NormalizedVersion, error) {
+	key, normalized := lookupKey(doc, name)
+	resultKey, result := lookupKey(doc, resultName)
+
+	if key == "" {
+		key = name
+		// the BSON encoder lowercases field names
+		if resultKey != "" && !strings.Contains(resultKey, "_") {
+			key = canonicalKey(name)
+		}
+	}
+
+	existing, _ := normalized.(map[string]interface{})
+	text, rcode, ok := getAnswer(result)
+	if raw, stored := existing["raw"].(string); stored {
+		text = raw
+		if !ok {
+			// the result is gone, keep the stored response code
+			_, storedRcode := lookupKey(existing, "rcode")
+			rcode = getRcode(storedRcode)
+			ok = true
+		}
+	}
+	if !ok {
+		doc[key] = nil
+		return nil, nil
+	}
+
+	version := table.Normalize(text, rcode)
+	value, err := toDocument(version, !strings.Contains(key, "_"))
+	if err != nil {
+		return nil, err
+	}
+	doc[key] = value
+
+	return version, nil
+}
+
+// reclassify replaces the stored classification by the classification of the observations
+func reclassify(doc map[string]interface{}, observations fingerprint.Observations, ruleSet *fingerprint.RuleSet, table *VersionPatternTable) error {
+	key, _ := lookupKey(doc, "classification")
+	if key == "" {
+		key = "classification"
+	}
+
+	value, err := toDocument(classify(observations, ruleSet, table), false)
+	if err != nil {
+		return err
+	}
+	doc[key] = value
+
+	return nil
+}
+
+// getStoredObservations observes the stored responses of the version.bind, version.server and probe
+// queries like GetObservations
+func getStoredObservations(doc map[string]interface{}) fingerprint.Observations {
+	_, versionBind := lookupKey(doc, "version_bind_result")
+	_, versionServer := lookupKey(doc, "version_server_result")
+
+	responses := map[string]*query.ConventionalDNSResponse{
+		fingerprint.PROBE_VERSION_BIND:   newStoredResponse(getStoredMessage(versionBind)),
+		fingerprint.PROBE_VERSION_SERVER: newStoredResponse(getStoredMessage(versionServer)),
+	}
+
+	_, probes := lookupKey(doc, "probes")
+	list, _ := probes.([]interface{})
+	for _, probe := range list {
+		_, name := lookupKey(probe, "name")
+		_, result := lookupKey(probe, "result")
+		if probeName, ok := name.(string); ok {
+			responses[probeName] = newStoredResponse(getStoredMessage(result))
+		}
+	}
+
+	return fingerprint.NewObservations(responses)
+}
+
+func newStoredResponse(msg *dns.Msg) *query.ConventionalDNSResponse {
+	if msg == nil {
+		return nil
+	}
+
+	return &query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: msg}}
+}
+
+// getAnswer observes the answer of a stored ConventionalDNSResponse like the scan and returns the
+// response code of the answer
+func getAnswer(result interface{}) (string, int, bool) {
+	msg := getStoredMessage(result)
+	if msg == nil {
+		return "", dns.RcodeSuccess, false
+	}
+
+	return fingerprint.NewObservation(fingerprint.PROBE_VERSION_BIND, newStoredResponse(msg)).Text, msg.Rcode, true
+}
+
+// getStoredMessage rebuilds what observations are made of from the stored message of a ConventionalDNSResponse,
+// i.e., the header, TXT answers, the NSID and the number of records per section, nil if there is no message
+func getStoredMessage(result interface{}) *dns.Msg {
+	_, response := lookupKey(result, "response")
+	_, stored := lookupKey(response, "responsemsg")
+	if stored == nil {
+		return nil
+	}
+
+	// the header is embedded in JSON and a nested document in BSON
+	_, header := lookupKey(stored, "msghdr")
+	if header == nil {
+		header = stored
+	}
+
+	msg := new(dns.Msg)
+
+	_, opcode := lookupKey(header, "opcode")
+	msg.Opcode, _ = getNumber(opcode)
+	_, rcode := lookupKey(header, "rcode")
+	msg.Rcode = getRcode(rcode)
+
+	for flag, value := range map[string]*bool{
+		"response":            &msg.Response,
+		"authoritative":       &msg.Authoritative,
+		"truncated":           &msg.Truncated,
+		"recursion_desired":   &msg.RecursionDesired,
+		"recursion_available": &msg.RecursionAvailable,
+		"zero":                &msg.Zero,
+		"authenticated_data":  &msg.AuthenticatedData,
+		"checking_disabled":   &msg.CheckingDisabled,
+	} {
+		_, set := lookupKey(header, flag)
+		*value, _ = set.(bool)
+	}
+
+	msg.Answer = getStoredRecords(stored, "answer")
+	msg.Ns = getStoredRecords(stored, "ns")
+	msg.Extra = getStoredRecords(stored, "extra")
+
+	return msg
+}
+
+// getStoredRecords rebuilds TXT and OPT records of a section, other records only count
+func getStoredRecords(msg interface{}, section string) []dns.RR {
+	_, value := lookupKey(msg, section)
+	docs, _ := value.([]interface{})
+
+	rrs := []dns.RR{}
+	for _, doc := range docs {
+		_, hdr := lookupKey(doc, "hdr")
+		_, rrtype := lookupKey(hdr, "rrtype")
+		t, _ := getNumber(rrtype)
+		header := dns.RR_Header{Rrtype: uint16(t)}
+
+		_, txt := lookupKey(doc, "txt")
+		if strs, ok := txt.([]interface{}); ok {
+			record := &dns.TXT{Hdr: header}
+			for _, str := range strs {
+				if s, ok := str.(string); ok {
+					record.Txt = append(record.Txt, s)
+				}
+			}
+			rrs = append(rrs, record)
+			continue
+		}
+
+		if header.Rrtype == dns.TypeOPT {
+			record := &dns.OPT{Hdr: header}
+			_, options := lookupKey(doc, "option")
+			list, _ := options.([]interface{})
+			for _, option := range list {
+				if _, nsid := lookupKey(option, "nsid"); nsid != nil {
+					s, _ := nsid.(string)
+					record.Option = append(record.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: s})
+				}
+			}
+			rrs = append(rrs, record)
+			continue
+		}
+
+		rrs = append(rrs, &dns.RFC3597{Hdr: header})
+	}
+
+	return rrs
+}
+
+// getRcode returns the stored response code, either numeric or by name, NOERROR if unknown
+func getRcode(value interface{}) int {
+	if s, ok := value.(string); ok {
+		if rcode, ok := dns.StringToRcode[s]; ok {
+			return rcode
+		}
+	}
+
+	if rcode, ok := getNumber(value); ok {
+		return rcode
+	}
+
+	return dns.RcodeSuccess
+}
+
+// getNumber returns a stored number, the number may be a string or canonical extended JSON
+func getNumber(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n), true
+		}
+	case float64:
+		return int(v), true
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, true
+		}
+	case map[string]interface{}:
+		// canonical extended JSON of mongoexport, e.g., {"$numberInt": "5"}
+		for _, number := range v {
+			return getNumber(number)
+		}
+	}
+
+	return 0, false
+}
+
+// lookupKey finds the field of a document regardless of case and underscores
+func lookupKey(doc interface{}, name string) (string, interface{}) {
+	m, ok := doc.(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+
+	if value, ok := m[name]; ok {
+		return name, value
+	}
+
+	for key, value := range m {
+		if canonicalKey(key) == canonicalKey(name) {
+			return key, value
+		}
+	}
+
+	return "", nil
+}
+
+func canonicalKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "")
+}
+
+func toDocument(v interface{}, canonical bool) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if !canonical {
+		return doc, nil
+	}
+
+	canonicalDoc := map[string]interface{}{}
+	for key, value := range doc {
+		canonicalDoc[canonicalKey(key)] = value
+	}
+
+	return canonicalDoc, nil
+}
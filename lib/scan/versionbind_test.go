@@ -0,0 +1,384 @@
+package scan_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
+	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testVersionPatternTable = `{
+	"revision": 2,
+	"patterns": [
+		{"name": "joke", "pattern": "^go away$", "vendor": "", "product": ""},
+		{"name": "custom", "pattern": "^custom (?P<version>\\d+)$", "vendor": "ACME", "product": "Custom DNS", "weight": 0.9}
+	],
+	"distros": [
+		{"name": "Ubuntu", "pattern": "(?i)ubuntu"}
+	]
+}`
+
+func TestVersionPatternTable_Normalize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw     string
+		vendor  string
+		product string
+		version string
+		distro  string
+		hidden  bool
+	}{
+		{"9.18.28-0ubuntu0.22.04.1-Ubuntu", "ISC", "BIND", "9.18.28", "Ubuntu", false},
+		{"9.18.1-1ubuntu1", "ISC", "BIND", "9.18.1", "Ubuntu", false},
+		{"9.11.4-P2-RedHat-9.11.4-26.P2.el7_9.16", "ISC", "BIND", "9.11.4-P2", "Red Hat", false},
+		{"9.16.48-Debian", "ISC", "BIND", "9.16.48", "Debian", false},
+		{"BIND 9.20.4", "ISC", "BIND", "9.20.4", "", false},
+		{"bind", "ISC", "BIND", "", "", true},
+		{"dnsmasq-2.80", "Simon Kelley", "dnsmasq", "2.80", "", false},
+		{"dnsmasq-pi-hole-v2.90+1", "Simon Kelley", "dnsmasq", "2.90", "", false},
+		{"dnsmasq", "Simon Kelley", "dnsmasq", "", "", true},
+		{"unbound 1.13.1", "NLnet Labs", "Unbound", "1.13.1", "", false},
+		{"  unbound 1.19.2  ", "NLnet Labs", "Unbound", "1.19.2", "", false},
+		{"PowerDNS Recursor 4.8.4", "PowerDNS", "PowerDNS Recursor", "4.8.4", "", false},
+		{"PowerDNS Authoritative Server 4.9.0 (built Jan 01 2024)", "PowerDNS", "PowerDNS Authoritative", "4.9.0", "", false},
+		{"Knot Resolver 5.7.1", "CZ.NIC", "Knot Resolver", "5.7.1", "", false},
+		{"Microsoft DNS 6.1.7601 (1DB15CD4)", "Microsoft", "Microsoft DNS", "6.1.7601", "", false},
+		{"none", "", "", "", "", true},
+		{"[secured]", "", "", "", "", true},
+		{"Go away, there is nothing to see here", "", "", "", "", true},
+		{"", "", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			t.Parallel()
+
+			normalized := scan.DEFAULT_VERSION_PATTERN_TABLE.Normalize(test.raw, dns.RcodeSuccess)
+
+			assert.Equal(t, test.raw, normalized.Raw)
+			assert.Equal(t, test.vendor, normalized.Vendor)
+			assert.Equal(t, test.product, normalized.Product)
+			assert.Equal(t, test.version, normalized.Version)
+			assert.Equal(t, test.distro, normalized.Distro)
+			assert.Equal(t, test.hidden, normalized.IsHidden)
+			assert.Equal(t, "NOERROR", normalized.Rcode)
+			assert.Equal(t, scan.DEFAULT_VERSION_PATTERN_TABLE.Revision, normalized.Revision)
+		})
+	}
+
+	t.Run("query not answered", func(t *testing.T) {
+		t.Parallel()
+
+		for _, rcode := range []int{dns.RcodeRefused, dns.RcodeNotImplemented, dns.RcodeServerFailure, dns.RcodeNameError} {
+			normalized := scan.DEFAULT_VERSION_PATTERN_TABLE.Normalize("", rcode)
+
+			assert.False(t, normalized.IsHidden, "a server not answering the query does not hide its version")
+			assert.Equal(t, dns.RcodeToString[rcode], normalized.Rcode)
+		}
+	})
+
+	t.Run("matched pattern", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, "hidden_placeholder", scan.DEFAULT_VERSION_PATTERN_TABLE.Normalize("not disclosed", dns.RcodeSuccess).Pattern)
+		assert.Empty(t, scan.DEFAULT_VERSION_PATTERN_TABLE.Normalize("Go away", dns.RcodeSuccess).Pattern)
+	})
+}
+
+func TestVersionPatternTable_Rules(t *testing.T) {
+	t.Parallel()
+
+	table, err := scan.ParseVersionPatternTable([]byte(testVersionPatternTable))
+	require.NoError(t, err)
+
+	rules := table.Rules()
+
+	require.Len(t, rules, 3, "should skip patterns without product")
+	for _, rule := range rules {
+		assert.Equal(t, "Custom DNS", rule.Software)
+		assert.Equal(t, 0.9, rule.Weight)
+
+		matched, version := rule.Match(&fingerprint.Observation{Text: "custom 7"})
+		assert.True(t, matched)
+		assert.Equal(t, "7", version)
+	}
+	assert.Equal(t, []string{fingerprint.PROBE_VERSION_BIND, fingerprint.PROBE_VERSION_SERVER, fingerprint.PROBE_VERSION_PDNS},
+		[]string{rules[0].Probe, rules[1].Probe, rules[2].Probe})
+}
+
+func TestParseVersionPatternTable(t *testing.T) {
+	t.Parallel()
+
+	t.Run("custom table", func(t *testing.T) {
+		t.Parallel()
+
+		table, err := scan.ParseVersionPatternTable([]byte(testVersionPatternTable))
+		require.NoError(t, err)
+
+		normalized := table.Normalize("custom 7", dns.RcodeSuccess)
+		assert.Equal(t, "ACME", normalized.Vendor)
+		assert.Equal(t, "7", normalized.Version)
+		assert.Equal(t, 2, normalized.Revision)
+
+		assert.Equal(t, "joke", table.Normalize("go away", dns.RcodeSuccess).Pattern)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := scan.ParseVersionPatternTable([]byte(`{"patterns": [{"name": "broken", "pattern": "("}]}`))
+		assert.ErrorContains(t, err, "broken")
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := scan.ParseVersionPatternTable([]byte(`{`))
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadVersionPatternTable(t *testing.T) {
+	t.Parallel()
+
+	t.Run("load file", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "patterns.json")
+		require.NoError(t, os.WriteFile(path, []byte(testVersionPatternTable), 0600))
+
+		table, err := scan.LoadVersionPatternTable(path)
+		require.NoError(t, err)
+		assert.Equal(t, 2, table.Revision)
+		assert.Len(t, table.Patterns, 2)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := scan.LoadVersionPatternTable(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+}
+
+func newTestVersionResult(txt string) *query.ConventionalDNSResponse {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: "version.bind.", Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+		Txt: []string{txt},
+	}}
+
+	return &query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: msg}}
+}
+
+// setTestProbeResults answers some behavioural probes of the scan like BIND
+func setTestProbeResults(t *testing.T, s *scan.FingerprintScan) {
+	t.Helper()
+
+	for _, probe := range s.Probes {
+		reply := new(dns.Msg)
+		reply.SetReply(probe.Query.QueryMsg)
+
+		switch probe.Name {
+		case fingerprint.PROBE_HOSTNAME_BIND:
+			reply.Answer = []dns.RR{&dns.TXT{
+				Hdr: dns.RR_Header{Name: "hostname.bind.", Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+				Txt: []string{"ns1"},
+			}}
+		case fingerprint.PROBE_NSID:
+			reply.SetEdns0(1232, false)
+			opt := reply.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: "6e7331"}, &dns.EDNS0_PADDING{Padding: make([]byte, 4)})
+		case fingerprint.PROBE_UNKNOWN_OPCODE:
+			reply.Rcode = dns.RcodeNotImplemented
+		case fingerprint.PROBE_NO_QUESTION:
+			reply.Rcode = dns.RcodeFormatError
+		default:
+			continue
+		}
+
+		probe.Result = &query.ConventionalDNSResponse{Response: &query.DNSResponse{ResponseMsg: reply}}
+	}
+}
+
+func renormalize(t *testing.T, input string) []map[string]interface{} {
+	t.Helper()
+
+	table, err := scan.ParseVersionPatternTable([]byte(testVersionPatternTable))
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	count, err := scan.RenormalizeFingerprintScans(strings.NewReader(input), out, fingerprint.DEFAULT_RULE_SET, table)
+	require.NoError(t, err)
+
+	docs := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		doc := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &doc))
+		docs = append(docs, doc)
+	}
+	require.Len(t, docs, count)
+
+	return docs
+}
+
+func TestRenormalizeFingerprintScans(t *testing.T) {
+	t.Parallel()
+
+	t.Run("stored normalization", func(t *testing.T) {
+		t.Parallel()
+
+		s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+		s.VersionBindResult = newTestVersionResult("custom 7")
+		s.Normalize(scan.DEFAULT_VERSION_PATTERN_TABLE)
+		require.True(t, s.VersionBind.IsHidden, "the default table should not know the custom software")
+
+		b, err := s.Marshal()
+		require.NoError(t, err)
+
+		docs := renormalize(t, string(b)+"\n\n")
+		require.Len(t, docs, 1)
+
+		versionBind := docs[0]["version_bind"].(map[string]interface{})
+		assert.Equal(t, "Custom DNS", versionBind["product"])
+		assert.Equal(t, "7", versionBind["version"])
+		assert.Equal(t, false, versionBind["is_hidden"])
+		assert.Equal(t, float64(2), versionBind["revision"])
+		assert.Nil(t, docs[0]["version_server"], "should not normalize without response")
+		assert.Equal(t, "host", docs[0]["ssh_query"].(map[string]interface{})["host"], "should keep the other fields")
+	})
+
+	t.Run("scan before normalization", func(t *testing.T) {
+		t.Parallel()
+
+		s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+		s.VersionServerResult = newTestVersionResult("go away")
+
+		b, err := s.Marshal()
+		require.NoError(t, err)
+
+		docs := renormalize(t, string(b))
+
+		versionServer := docs[0]["version_server"].(map[string]interface{})
+		assert.Equal(t, "go away", versionServer["raw"])
+		assert.Equal(t, "joke", versionServer["pattern"])
+		assert.Equal(t, true, versionServer["is_hidden"])
+	})
+
+	t.Run("refused query", func(t *testing.T) {
+		t.Parallel()
+
+		s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+		s.VersionBindResult = newTestVersionResult("")
+		s.VersionBindResult.Response.ResponseMsg.Answer = nil
+		s.VersionBindResult.Response.ResponseMsg.Rcode = dns.RcodeRefused
+
+		b, err := s.Marshal()
+		require.NoError(t, err)
+
+		docs := renormalize(t, string(b))
+
+		versionBind := docs[0]["version_bind"].(map[string]interface{})
+		assert.Equal(t, "REFUSED", versionBind["rcode"])
+		assert.Equal(t, false, versionBind["is_hidden"])
+	})
+
+	t.Run("BSON field names", func(t *testing.T) {
+		t.Parallel()
+
+		docs := renormalize(t, `{"_id":{"$oid":"66f0"},"versionbindresult":{"response":{"responsemsg":{"answer":[{"hdr":{"name":"version.bind."},"txt":["custom ","9"]}]},"rtt":{"$numberLong":"9007199254740993"}}}}`)
+
+		versionBind := docs[0]["versionbind"].(map[string]interface{})
+		assert.Equal(t, "custom 9", versionBind["raw"])
+		assert.Equal(t, "9", versionBind["version"])
+		assert.Equal(t, false, versionBind["ishidden"])
+		assert.Equal(t, "NOERROR", versionBind["rcode"])
+		assert.NotContains(t, docs[0], "version_bind")
+
+		docs = renormalize(t, `{"versionserverresult":{"response":{"responsemsg":{"msghdr":{"rcode":{"$numberInt":"4"}},"answer":null}}}}`)
+
+		versionServer := docs[0]["versionserver"].(map[string]interface{})
+		assert.Equal(t, "NOTIMP", versionServer["rcode"])
+		assert.Equal(t, false, versionServer["ishidden"])
+	})
+
+	t.Run("classification", func(t *testing.T) {
+		t.Parallel()
+
+		table, err := scan.ParseVersionPatternTable([]byte(testVersionPatternTable))
+		require.NoError(t, err)
+
+		s := scan.NewFingerprintScan("host", "parent", "root", "run", "vantagepoint")
+		s.VersionBindResult = newTestVersionResult("custom 7")
+		setTestProbeResults(t, s)
+
+		s.Classify(fingerprint.DEFAULT_RULE_SET, scan.DEFAULT_VERSION_PATTERN_TABLE)
+		require.NotEqual(t, "Custom DNS", s.Classification.Software, "the default table should not know the custom software")
+
+		b, err := s.Marshal()
+		require.NoError(t, err)
+
+		docs := renormalize(t, string(b))
+
+		// the offline classification has to agree with classifying the scan with the new table
+		s.Classify(fingerprint.DEFAULT_RULE_SET, table)
+		expected, err := json.Marshal(s.Classification)
+		require.NoError(t, err)
+		classification, err := json.Marshal(docs[0]["classification"])
+		require.NoError(t, err)
+
+		assert.JSONEq(t, string(expected), string(classification))
+		assert.Equal(t, "Custom DNS", s.Classification.Software)
+		assert.Contains(t, s.Classification.Candidates[1].Rules, "bind_unknown_opcode_notimp", "should observe the stored probe results")
+	})
+
+	t.Run("classification of BSON documents", func(t *testing.T) {
+		t.Parallel()
+
+		docs := renormalize(t, `{"versionbindresult":{"response":{"responsemsg":{"answer":[{"hdr":{"rrtype":{"$numberInt":"16"}},"txt":["custom 9"]}]}}},`+
+			`"probes":[{"name":"unknown_opcode","result":{"response":{"responsemsg":{"msghdr":{"response":true,"opcode":{"$numberInt":"15"},"rcode":{"$numberInt":"4"}}}}}}],`+
+			`"classification":{"software":"unknown","revision":{"$numberInt":"1"}}}`)
+
+		classification := docs[0]["classification"].(map[string]interface{})
+		assert.Equal(t, "Custom DNS", classification["software"])
+		assert.Equal(t, "9", classification["version"])
+		assert.Equal(t, float64(fingerprint.DEFAULT_RULE_SET.Revision), classification["revision"])
+
+		candidates := classification["candidates"].([]interface{})
+		require.Len(t, candidates, 3)
+		assert.Equal(t, "BIND", candidates[1].(map[string]interface{})["software"])
+	})
+
+	t.Run("keep numbers", func(t *testing.T) {
+		t.Parallel()
+
+		table, err := scan.ParseVersionPatternTable([]byte(testVersionPatternTable))
+		require.NoError(t, err)
+
+		out := &bytes.Buffer{}
+		_, err = scan.RenormalizeFingerprintScans(strings.NewReader(`{"timestamp":9007199254740993}`), out, fingerprint.DEFAULT_RULE_SET, table)
+		require.NoError(t, err)
+
+		assert.Contains(t, out.String(), "9007199254740993")
+	})
+
+	t.Run("invalid document", func(t *testing.T) {
+		t.Parallel()
+
+		out := &bytes.Buffer{}
+		count, err := scan.RenormalizeFingerprintScans(strings.NewReader("{}\n{"), out, fingerprint.DEFAULT_RULE_SET, scan.DEFAULT_VERSION_PATTERN_TABLE)
+
+		assert.ErrorContains(t, err, "line 2")
+		assert.Equal(t, 1, count)
+	})
+}
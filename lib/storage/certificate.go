@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CertificateSighting is a single observation of a certificate at an endpoint
+type CertificateSighting struct {
+	// Fingerprint is the SHA-256 fingerprint of the certificate and the key of the stored document
+	Fingerprint string
+	// Certificate is the parsed certificate, it is only written on the first sighting
+	Certificate  interface{}
+	VantagePoint string
+	// Endpoint is the endpoint that presented the certificate, e.g. host:port/protocol
+	Endpoint  string
+	Timestamp time.Time
+}
+
+type CertificateStorageHandler interface {
+	StoreCertificate(sighting *CertificateSighting) (err error)
+	Open() (err error)
+	Close() (err error)
+}
+
+// MongoCertificateStorageHandler upserts each certificate once by fingerprint and
+// keeps track of first/last seen, the vantage points and the endpoints it was seen at
+type MongoCertificateStorageHandler struct {
+	CertificateStorageHandler
+	MongoStorageHandler
+}
+
+func (mch *MongoCertificateStorageHandler) StoreCertificate(sighting *CertificateSighting) (err error) {
+	if sighting == nil || sighting.Fingerprint == "" {
+		return errors.New("certificate sighting without fingerprint")
+	}
+
+	c, err := mch.getCollection()
+	if err != nil {
+		return err
+	}
+
+	ts := sighting.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	update := bson.M{
+		"$setOnInsert": bson.M{"certificate": sighting.Certificate},
+		"$min":         bson.M{"first_seen": ts},
+		"$max":         bson.M{"last_seen": ts},
+		"$inc":         bson.M{"sightings": 1},
+	}
+
+	addToSet := bson.M{}
+	if sighting.VantagePoint != "" {
+		addToSet["vantage_points"] = sighting.VantagePoint
+	}
+	if sighting.Endpoint != "" {
+		addToSet["endpoints"] = sighting.Endpoint
+	}
+	if len(addToSet) > 0 {
+		update["$addToSet"] = addToSet
+	}
+
+	_, err = c.UpdateOne(
+		context.Background(),
+		bson.M{"_id": sighting.Fingerprint},
+		update,
+		options.Update().SetUpsert(true),
+	)
+
+	return
+}
+
+func (mch *MongoCertificateStorageHandler) Open() (err error) {
+	return mch.MongoStorageHandler.Open()
+}
+
+func (mch *MongoCertificateStorageHandler) Close() (err error) {
+	return mch.MongoStorageHandler.Close()
+}
+
+func NewDefaultMongoCertificateStorageHandler(ctx context.Context, collectionName string, databaseURL string) *MongoCertificateStorageHandler {
+	return &MongoCertificateStorageHandler{
+		MongoStorageHandler: MongoStorageHandler{
+			Connect: func(ctx context.Context, opts ...*options.ClientOptions) (MongoClient, error) {
+				client, err := mongo.Connect(ctx, opts...)
+				if err != nil {
+					return nil, err
+				}
+				return &MongoClientWrapper{Client: client}, nil
+			},
+			ConnectionString: databaseURL,
+			DatabaseName:     DEFAULT_DATABASE,
+			CollectionName:   collectionName,
+		},
+	}
+}
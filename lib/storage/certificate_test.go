@@ -0,0 +1,111 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/steffsas/doe-hunter/lib/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func newMockedCertificateStorageHandler(collection *MockedMongoCollection) *storage.MongoCertificateStorageHandler {
+	database := &MockedMongoDatabase{}
+	database.On("Collection", mock.Anything).Return(collection)
+
+	client := &MockedMongoClient{}
+	client.On("Database", mock.Anything).Return(database)
+	client.On("Disconnect", mock.Anything).Return(nil)
+
+	return &storage.MongoCertificateStorageHandler{
+		MongoStorageHandler: storage.MongoStorageHandler{
+			Connect: func(ctx context.Context, opts ...*options.ClientOptions) (storage.MongoClient, error) {
+				return client, nil
+			},
+			DatabaseName:   "test",
+			CollectionName: storage.DEFAULT_CERTIFICATE_STORE_COLLECTION,
+		},
+	}
+}
+
+func TestMongoCertificateStorageHandler_StoreCertificate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("upsert by fingerprint", func(t *testing.T) {
+		t.Parallel()
+
+		collection := &MockedMongoCollection{}
+		collection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(&mongo.UpdateResult{}, nil)
+
+		mch := newMockedCertificateStorageHandler(collection)
+		require.Nil(t, mch.Open())
+
+		ts := time.Now()
+		err := mch.StoreCertificate(&storage.CertificateSighting{
+			Fingerprint:  "abcd",
+			Certificate:  "cert",
+			VantagePoint: "vp",
+			Endpoint:     "8.8.8.8:853/tcp",
+			Timestamp:    ts,
+		})
+
+		assert.Nil(t, err)
+		require.Len(t, collection.Calls, 1)
+
+		filter := collection.Calls[0].Arguments.Get(1).(bson.M)
+		assert.Equal(t, "abcd", filter["_id"])
+
+		update := collection.Calls[0].Arguments.Get(2).(bson.M)
+		assert.Equal(t, bson.M{"certificate": "cert"}, update["$setOnInsert"])
+		assert.Equal(t, bson.M{"first_seen": ts}, update["$min"])
+		assert.Equal(t, bson.M{"last_seen": ts}, update["$max"])
+		assert.Equal(t, bson.M{"vantage_points": "vp", "endpoints": "8.8.8.8:853/tcp"}, update["$addToSet"])
+
+		opts := collection.Calls[0].Arguments.Get(3).([]*options.UpdateOptions)
+		require.Len(t, opts, 1)
+		require.NotNil(t, opts[0].Upsert)
+		assert.True(t, *opts[0].Upsert)
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		t.Parallel()
+
+		collection := &MockedMongoCollection{}
+		collection.On("UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("error"))
+
+		mch := newMockedCertificateStorageHandler(collection)
+		require.Nil(t, mch.Open())
+
+		err := mch.StoreCertificate(&storage.CertificateSighting{Fingerprint: "abcd"})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("missing fingerprint", func(t *testing.T) {
+		t.Parallel()
+
+		collection := &MockedMongoCollection{}
+		mch := newMockedCertificateStorageHandler(collection)
+		require.Nil(t, mch.Open())
+
+		assert.NotNil(t, mch.StoreCertificate(nil))
+		assert.NotNil(t, mch.StoreCertificate(&storage.CertificateSighting{}))
+		collection.AssertNotCalled(t, "UpdateOne", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("client not opened", func(t *testing.T) {
+		t.Parallel()
+
+		mch := newMockedCertificateStorageHandler(&MockedMongoCollection{})
+
+		err := mch.StoreCertificate(&storage.CertificateSighting{Fingerprint: "abcd"})
+
+		assert.NotNil(t, err)
+	})
+}
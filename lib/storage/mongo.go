@@ -26,9 +26,18 @@ const DEFAULT_FINGERPRINT_COLLECTION = "fingerprint-scans"
 const DEFAULT_DDR_DNSSEC_COLLECTION = "ddr-dnssec-scans"
 const DEFAULT_CANARAY_COLLECTION = "canary-scans"
 const DEFAULT_RESINFO_COLLECTION = "resinfo-scans"
+const DEFAULT_ODOH_COLLECTION = "odoh-scans"
+const DEFAULT_OHTTP_COLLECTION = "ohttp-scans"
+const DEFAULT_TLS_ENUM_COLLECTION = "tls-enum-scans"
+const DEFAULT_SESSION_COLLECTION = "session-scans"
+const DEFAULT_RESUMPTION_COLLECTION = "resumption-scans"
+const DEFAULT_DOH_PATH_COLLECTION = "doh-path-scans"
+const DEFAULT_DDR_VERIFICATION_COLLECTION = "ddr-verifications"
+const DEFAULT_CERTIFICATE_STORE_COLLECTION = "certificates"
 
 type MongoCollection interface {
 	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
 }
 
 type MongoDatabase interface {
@@ -72,22 +81,31 @@ func (msh *MongoStorageHandler) Open() (err error) {
 }
 
 func (msh *MongoStorageHandler) Store(data interface{}) (err error) {
+	c, err := msh.getCollection()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.InsertOne(context.Background(), data)
+
+	return
+}
+
+func (msh *MongoStorageHandler) getCollection() (MongoCollection, error) {
 	if msh.Client == nil {
-		return errors.New("mongo client not initialized")
+		return nil, errors.New("mongo client not initialized")
 	}
 
 	d := msh.Client.Database(msh.DatabaseName)
 	if d == nil {
-		return errors.New("mongo database not initialized")
+		return nil, errors.New("mongo database not initialized")
 	}
 	c := d.Collection(msh.CollectionName)
 	if c == nil {
-		return errors.New("mongo collection not initialized")
+		return nil, errors.New("mongo collection not initialized")
 	}
 
-	_, err = c.InsertOne(context.Background(), data)
-
-	return
+	return c, nil
 }
 
 func (msh *MongoStorageHandler) Close() (err error) {
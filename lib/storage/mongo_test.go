@@ -24,6 +24,16 @@ func (mmc *MockedMongoCollection) InsertOne(ctx context.Context, document interf
 	return args.Get(0).(*mongo.InsertOneResult), args.Error(1)
 }
 
+func (mmc *MockedMongoCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	args := mmc.Called(ctx, filter, update, opts)
+
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*mongo.UpdateResult), args.Error(1)
+}
+
 type MockedMongoDatabase struct {
 	mock.Mock
 }
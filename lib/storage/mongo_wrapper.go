@@ -15,6 +15,10 @@ func (mcw *MongoCollectionWrapper) InsertOne(ctx context.Context, document inter
 	return mcw.Collection.InsertOne(ctx, document, opts...)
 }
 
+func (mcw *MongoCollectionWrapper) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return mcw.Collection.UpdateOne(ctx, filter, update, opts...)
+}
+
 type MongoDatabaseWrapper struct {
 	Database *mongo.Database
 }
@@ -0,0 +1,129 @@
+package svcb
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// see https://www.rfc-editor.org/rfc/rfc9460.html
+const COMPLIANCE_ALIAS_MODE_WITH_PARAMS = "alias_mode_with_params"
+const COMPLIANCE_MULTIPLE_ALIAS_RECORDS = "multiple_alias_records"
+const COMPLIANCE_MIXED_MODES = "mixed_alias_and_service_mode"
+const COMPLIANCE_ALIAS_CHAIN_TOO_LONG = "alias_chain_too_long"
+const COMPLIANCE_ALIAS_LOOP = "alias_loop"
+const COMPLIANCE_MANDATORY_LISTS_MANDATORY = "mandatory_lists_mandatory"
+const COMPLIANCE_MANDATORY_NOT_ORDERED = "mandatory_keys_not_strictly_increasing"
+const COMPLIANCE_MANDATORY_KEY_MISSING = "mandatory_key_missing"
+const COMPLIANCE_NO_DEFAULT_ALPN_WITHOUT_ALPN = "no_default_alpn_without_alpn"
+
+// see https://www.rfc-editor.org/rfc/rfc9461.html#section-4.1
+const COMPLIANCE_ALPN_MISSING = "alpn_missing"
+
+// ComplianceFinding is a violation of RFC 9460 (or RFC 9461 for DNS servers) found in an SVCB RRset
+type ComplianceFinding struct {
+	Rule     string `json:"rule"`
+	Target   string `json:"target"`
+	Priority uint16 `json:"priority"`
+	Info     string `json:"info"`
+	// Ignored is set if clients must ignore the RR because of the violation
+	Ignored bool `json:"ignored"`
+}
+
+func NewComplianceFinding(rule string, rr *dns.SVCB, info string, ignored bool) *ComplianceFinding {
+	return &ComplianceFinding{
+		Rule:     rule,
+		Target:   rr.Target,
+		Priority: rr.Priority,
+		Info:     info,
+		Ignored:  ignored,
+	}
+}
+
+// CheckCompliance checks each SVCB RR and the RRset as a whole
+func CheckCompliance(rrs []*dns.SVCB) []*ComplianceFinding {
+	findings := []*ComplianceFinding{}
+
+	aliases, services := SplitByMode(rrs)
+
+	// see https://www.rfc-editor.org/rfc/rfc9460.html#section-2.4.1
+	if len(aliases) > 0 && len(services) > 0 {
+		findings = append(findings, NewComplianceFinding(COMPLIANCE_MIXED_MODES, services[0],
+			fmt.Sprintf("%d AliasMode and %d ServiceMode records, ServiceMode records must be ignored", len(aliases), len(services)), true))
+	}
+
+	// see https://www.rfc-editor.org/rfc/rfc9460.html#section-2.4.2
+	if len(aliases) > 1 {
+		findings = append(findings, NewComplianceFinding(COMPLIANCE_MULTIPLE_ALIAS_RECORDS, aliases[1],
+			fmt.Sprintf("%d AliasMode records", len(aliases)), false))
+	}
+
+	for _, rr := range aliases {
+		if len(rr.Value) > 0 {
+			findings = append(findings, NewComplianceFinding(COMPLIANCE_ALIAS_MODE_WITH_PARAMS, rr,
+				fmt.Sprintf("%d SvcParams", len(rr.Value)), false))
+		}
+	}
+
+	for _, rr := range services {
+		findings = append(findings, checkServiceMode(rr)...)
+	}
+
+	return findings
+}
+
+func checkServiceMode(rr *dns.SVCB) []*ComplianceFinding {
+	findings := []*ComplianceFinding{}
+
+	// see https://www.rfc-editor.org/rfc/rfc9460.html#section-8
+	for _, value := range rr.Value {
+		mandatory, ok := value.(*dns.SVCBMandatory)
+		if !ok {
+			continue
+		}
+
+		for i, key := range mandatory.Code {
+			if key == dns.SVCB_MANDATORY {
+				findings = append(findings, NewComplianceFinding(COMPLIANCE_MANDATORY_LISTS_MANDATORY, rr, "", true))
+			} else if !hasKey(rr, key) {
+				findings = append(findings, NewComplianceFinding(COMPLIANCE_MANDATORY_KEY_MISSING, rr, fmt.Sprintf("key: %s", key), true))
+			}
+
+			if i > 0 && key <= mandatory.Code[i-1] {
+				findings = append(findings, NewComplianceFinding(COMPLIANCE_MANDATORY_NOT_ORDERED, rr, mandatory.String(), true))
+			}
+		}
+	}
+
+	// see https://www.rfc-editor.org/rfc/rfc9460.html#section-7.1.1
+	if hasKey(rr, dns.SVCB_NO_DEFAULT_ALPN) && !hasKey(rr, dns.SVCB_ALPN) {
+		findings = append(findings, NewComplianceFinding(COMPLIANCE_NO_DEFAULT_ALPN_WITHOUT_ALPN, rr, "", true))
+	} else if !hasKey(rr, dns.SVCB_ALPN) {
+		findings = append(findings, NewComplianceFinding(COMPLIANCE_ALPN_MISSING, rr, "", true))
+	}
+
+	return findings
+}
+
+// SplitByMode splits the RRset into AliasMode (priority 0) and ServiceMode records, the latter ordered by priority
+func SplitByMode(rrs []*dns.SVCB) (aliases []*dns.SVCB, services []*dns.SVCB) {
+	aliases = []*dns.SVCB{}
+	services = []*dns.SVCB{}
+
+	for _, rr := range rrs {
+		if rr.Priority == 0 {
+			aliases = append(aliases, rr)
+		} else {
+			services = append(services, rr)
+		}
+	}
+
+	// lower values are preferred, see https://www.rfc-editor.org/rfc/rfc9460.html#section-2.4.1
+	slices.SortStableFunc(services, func(a, b *dns.SVCB) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+
+	return
+}
@@ -0,0 +1,135 @@
+package svcb_test
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/svcb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getRules(findings []*svcb.ComplianceFinding) []string {
+	rules := []string{}
+	for _, f := range findings {
+		rules = append(rules, f.Rule)
+	}
+	return rules
+}
+
+func TestCheckCompliance(t *testing.T) {
+	t.Parallel()
+
+	t.Run("compliant RRset", func(t *testing.T) {
+		t.Parallel()
+
+		findings := svcb.CheckCompliance([]*dns.SVCB{
+			{
+				Priority: 1,
+				Target:   "dns.example.com.",
+				Value: []dns.SVCBKeyValue{
+					&dns.SVCBMandatory{Code: []dns.SVCBKey{dns.SVCB_ALPN, dns.SVCB_PORT}},
+					&dns.SVCBAlpn{Alpn: []string{"dot"}},
+					&dns.SVCBPort{Port: 853},
+				},
+			},
+		})
+
+		assert.Empty(t, findings)
+	})
+
+	t.Run("mandatory violations", func(t *testing.T) {
+		t.Parallel()
+
+		findings := svcb.CheckCompliance([]*dns.SVCB{
+			{
+				Priority: 1,
+				Target:   "dns.example.com.",
+				Value: []dns.SVCBKeyValue{
+					&dns.SVCBMandatory{Code: []dns.SVCBKey{dns.SVCB_PORT, dns.SVCB_MANDATORY, dns.SVCB_ALPN}},
+					&dns.SVCBAlpn{Alpn: []string{"dot"}},
+				},
+			},
+		})
+
+		assert.ElementsMatch(t, []string{
+			svcb.COMPLIANCE_MANDATORY_KEY_MISSING,
+			svcb.COMPLIANCE_MANDATORY_LISTS_MANDATORY,
+			svcb.COMPLIANCE_MANDATORY_NOT_ORDERED,
+		}, getRules(findings))
+
+		for _, f := range findings {
+			assert.True(t, f.Ignored)
+			assert.Equal(t, "dns.example.com.", f.Target)
+			assert.Equal(t, uint16(1), f.Priority)
+		}
+	})
+
+	t.Run("no-default-alpn without alpn", func(t *testing.T) {
+		t.Parallel()
+
+		findings := svcb.CheckCompliance([]*dns.SVCB{
+			{
+				Priority: 1,
+				Target:   "dns.example.com.",
+				Value:    []dns.SVCBKeyValue{&dns.SVCBNoDefaultAlpn{}},
+			},
+			{
+				Priority: 2,
+				Target:   "dns.example.com.",
+			},
+		})
+
+		assert.Equal(t, []string{svcb.COMPLIANCE_NO_DEFAULT_ALPN_WITHOUT_ALPN, svcb.COMPLIANCE_ALPN_MISSING}, getRules(findings))
+	})
+
+	t.Run("AliasMode violations", func(t *testing.T) {
+		t.Parallel()
+
+		findings := svcb.CheckCompliance([]*dns.SVCB{
+			{
+				Priority: 0,
+				Target:   "alias1.example.com.",
+				Value:    []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: []string{"dot"}}},
+			},
+			{
+				Priority: 0,
+				Target:   "alias2.example.com.",
+			},
+			{
+				Priority: 1,
+				Target:   "dns.example.com.",
+				Value:    []dns.SVCBKeyValue{&dns.SVCBAlpn{Alpn: []string{"dot"}}},
+			},
+		})
+
+		assert.ElementsMatch(t, []string{
+			svcb.COMPLIANCE_MIXED_MODES,
+			svcb.COMPLIANCE_MULTIPLE_ALIAS_RECORDS,
+			svcb.COMPLIANCE_ALIAS_MODE_WITH_PARAMS,
+		}, getRules(findings))
+	})
+}
+
+func TestSplitByMode(t *testing.T) {
+	t.Parallel()
+
+	rrs := []*dns.SVCB{
+		{Priority: 3, Target: "c."},
+		{Priority: 0, Target: "alias."},
+		{Priority: 1, Target: "a."},
+		{Priority: 3, Target: "d."},
+		{Priority: 2, Target: "b."},
+	}
+
+	aliases, services := svcb.SplitByMode(rrs)
+
+	require.Len(t, aliases, 1)
+	assert.Equal(t, "alias.", aliases[0].Target)
+
+	targets := []string{}
+	for _, rr := range services {
+		targets = append(targets, rr.Target)
+	}
+	assert.Equal(t, []string{"a.", "b.", "c.", "d."}, targets, "should be ordered by priority and keep the order of equal priorities")
+}
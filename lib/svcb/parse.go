@@ -9,12 +9,18 @@ import (
 )
 
 type SVCBRR struct {
-	Target   string
-	Alpn     *dns.SVCBAlpn
-	Port     *dns.SVCBPort
-	IPv4Hint *dns.SVCBIPv4Hint
-	IPv6Hint *dns.SVCBIPv6Hint
-	DoHPath  *dns.SVCBDoHPath
+	Priority  uint16
+	Target    string
+	Mandatory *dns.SVCBMandatory
+	Alpn      *dns.SVCBAlpn
+	// see https://www.rfc-editor.org/rfc/rfc9460.html#section-7.1.1
+	NoDefaultAlpn bool
+	Port          *dns.SVCBPort
+	IPv4Hint      *dns.SVCBIPv4Hint
+	IPv6Hint      *dns.SVCBIPv6Hint
+	DoHPath       *dns.SVCBDoHPath
+	// see https://datatracker.ietf.org/doc/draft-ietf-tls-svcb-ech/
+	ECH *dns.SVCBECHConfig
 	// see https://datatracker.ietf.org/doc/rfc9540/
 	ODoH bool
 }
@@ -22,6 +28,7 @@ type SVCBRR struct {
 func ParseDDRSVCB(scanId string, rr *dns.SVCB) (*SVCBRR, []custom_errors.DoEErrors) {
 	svcb := &SVCBRR{}
 	svcb.Alpn = &dns.SVCBAlpn{}
+	svcb.Priority = rr.Priority
 	svcb.Target = rr.Target
 	svcb.ODoH = false
 
@@ -29,6 +36,15 @@ func ParseDDRSVCB(scanId string, rr *dns.SVCB) (*SVCBRR, []custom_errors.DoEErro
 
 	for _, value := range rr.Value {
 		switch value.Key() {
+		case dns.SVCB_MANDATORY:
+			mandatory, ok := value.(*dns.SVCBMandatory)
+			if !ok {
+				logrus.Errorf("parsing DDR scan %s: could not cast SVCB value %s to mandatory", scanId, value.String())
+				err := custom_errors.NewQueryError(custom_errors.ErrParsingSvcbKey, true).AddInfoString(fmt.Sprintf("could not cast SVCB value %s to mandatory", value.String()))
+				errs = append(errs, err)
+				return nil, errs
+			}
+			svcb.Mandatory = mandatory
 		case dns.SVCB_ALPN:
 			alpn, ok := value.(*dns.SVCBAlpn)
 			if !ok {
@@ -38,6 +54,8 @@ func ParseDDRSVCB(scanId string, rr *dns.SVCB) (*SVCBRR, []custom_errors.DoEErro
 				return nil, errs
 			}
 			svcb.Alpn = alpn
+		case dns.SVCB_NO_DEFAULT_ALPN:
+			svcb.NoDefaultAlpn = true
 		case dns.SVCB_PORT:
 			port, ok := value.(*dns.SVCBPort)
 			if !ok {
@@ -75,9 +93,17 @@ func ParseDDRSVCB(scanId string, rr *dns.SVCB) (*SVCBRR, []custom_errors.DoEErro
 			} else {
 				svcb.DoHPath = dohPath
 			}
-		// this is not yet implemented in miekg/dns
+		case dns.SVCB_ECHCONFIG:
+			ech, ok := value.(*dns.SVCBECHConfig)
+			if !ok {
+				logrus.Warnf("parsing DDR scan %s: Could not cast SVCB value %s to ECHConfig, ignore ECH", scanId, value.String())
+				err := custom_errors.NewQueryError(custom_errors.ErrParsingSvcbKey, false).AddInfoString(fmt.Sprintf("could not cast SVCB value %s to ECHConfig", value.String()))
+				errs = append(errs, err)
+			} else {
+				svcb.ECH = ech
+			}
 		// OHTTP, see https://www.rfc-editor.org/rfc/rfc9540.html#name-svcb-service-parameter
-		case 8:
+		case dns.SVCB_OHTTP:
 			svcb.ODoH = true
 		default:
 			logrus.Warnf("parsing DDR scan %s: got unknown SVCB key %s and value %s, ignore", scanId, value.Key(), value.String())
@@ -87,6 +113,26 @@ func ParseDDRSVCB(scanId string, rr *dns.SVCB) (*SVCBRR, []custom_errors.DoEErro
 		}
 	}
 
+	// clients must ignore the RR if they do not support all mandatory keys or if a mandatory key is missing
+	// see https://www.rfc-editor.org/rfc/rfc9460.html#section-8
+	if svcb.Mandatory != nil {
+		for _, key := range svcb.Mandatory.Code {
+			if !IsSupportedKey(key) {
+				logrus.Errorf("parsing DDR scan %s: mandatory SVCB key %s is not supported", scanId, key)
+				err := custom_errors.NewQueryError(custom_errors.ErrUnsupportedMandatorySvcbKey, true).AddInfoString(fmt.Sprintf("key: %s", key))
+				errs = append(errs, err)
+				return nil, errs
+			}
+
+			if !hasKey(rr, key) {
+				logrus.Errorf("parsing DDR scan %s: mandatory SVCB key %s is missing", scanId, key)
+				err := custom_errors.NewQueryError(custom_errors.ErrMandatorySvcbKeyMissing, true).AddInfoString(fmt.Sprintf("key: %s", key))
+				errs = append(errs, err)
+				return nil, errs
+			}
+		}
+	}
+
 	// check SVCBs
 	if len(svcb.Alpn.Alpn) == 0 {
 		logrus.Errorf("parsing DDR scan %s: ALPN is empty", scanId)
@@ -105,3 +151,17 @@ func ParseDDRSVCB(scanId string, rr *dns.SVCB) (*SVCBRR, []custom_errors.DoEErro
 
 	return svcb, errs
 }
+
+// IsSupportedKey returns true if the SvcParamKey is interpreted by ParseDDRSVCB
+func IsSupportedKey(key dns.SVCBKey) bool {
+	return key <= dns.SVCB_OHTTP
+}
+
+func hasKey(rr *dns.SVCB, key dns.SVCBKey) bool {
+	for _, value := range rr.Value {
+		if value.Key() == key {
+			return true
+		}
+	}
+	return false
+}
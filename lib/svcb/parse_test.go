@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/miekg/dns"
+	"github.com/steffsas/doe-hunter/lib/custom_errors"
 	"github.com/steffsas/doe-hunter/lib/svcb"
 	"github.com/stretchr/testify/assert"
 )
@@ -180,6 +181,128 @@ func TestParseDDRSVCB(t *testing.T) {
 		assert.True(t, svcbRR.ODoH)
 	})
 
+	t.Run("ECH", func(t *testing.T) {
+		t.Parallel()
+
+		s := &dns.SVCB{
+			Priority: 1,
+			Target:   "example.com",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{
+					Alpn: []string{"h2"},
+				},
+				&dns.SVCBECHConfig{
+					ECH: []byte{0x00, 0x02, 0xfe, 0x0d},
+				},
+			},
+		}
+
+		svcbRR, errs := svcb.ParseDDRSVCB("scanId", s)
+
+		assert.NotNil(t, svcbRR, "svcbRR should not be nil")
+		assert.Empty(t, errs, "errs should be empty")
+		assert.Equal(t, []byte{0x00, 0x02, 0xfe, 0x0d}, svcbRR.ECH.ECH)
+	})
+
+	t.Run("OHTTP", func(t *testing.T) {
+		t.Parallel()
+
+		s := &dns.SVCB{
+			Priority: 1,
+			Target:   "example.com",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{Alpn: []string{"h2"}},
+				&dns.SVCBOhttp{},
+			},
+		}
+
+		svcbRR, errs := svcb.ParseDDRSVCB("scanId", s)
+
+		assert.NotNil(t, svcbRR, "svcbRR should not be nil")
+		assert.Empty(t, errs, "errs should be empty")
+		assert.True(t, svcbRR.ODoH)
+	})
+
+	t.Run("no-default-alpn", func(t *testing.T) {
+		t.Parallel()
+
+		s := &dns.SVCB{
+			Priority: 2,
+			Target:   "example.com",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{Alpn: []string{"dot"}},
+				&dns.SVCBNoDefaultAlpn{},
+			},
+		}
+
+		svcbRR, errs := svcb.ParseDDRSVCB("scanId", s)
+
+		assert.NotNil(t, svcbRR, "svcbRR should not be nil")
+		assert.Empty(t, errs, "errs should be empty")
+		assert.True(t, svcbRR.NoDefaultAlpn)
+		assert.Equal(t, uint16(2), svcbRR.Priority)
+	})
+
+	t.Run("mandatory", func(t *testing.T) {
+		t.Parallel()
+
+		s := &dns.SVCB{
+			Priority: 1,
+			Target:   "example.com",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBMandatory{Code: []dns.SVCBKey{dns.SVCB_PORT}},
+				&dns.SVCBAlpn{Alpn: []string{"dot"}},
+				&dns.SVCBPort{Port: 853},
+			},
+		}
+
+		svcbRR, errs := svcb.ParseDDRSVCB("scanId", s)
+
+		assert.NotNil(t, svcbRR, "svcbRR should not be nil")
+		assert.Empty(t, errs, "errs should be empty")
+		assert.Equal(t, []dns.SVCBKey{dns.SVCB_PORT}, svcbRR.Mandatory.Code)
+	})
+
+	t.Run("missing mandatory key", func(t *testing.T) {
+		t.Parallel()
+
+		s := &dns.SVCB{
+			Priority: 1,
+			Target:   "example.com",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBMandatory{Code: []dns.SVCBKey{dns.SVCB_PORT}},
+				&dns.SVCBAlpn{Alpn: []string{"dot"}},
+			},
+		}
+
+		svcbRR, errs := svcb.ParseDDRSVCB("scanId", s)
+
+		assert.Nil(t, svcbRR, "svcbRR should be nil")
+		assert.Len(t, errs, 1, "errs should have one error")
+		assert.True(t, errs[0].IsCritical(), "error should be critical")
+		assert.Contains(t, errs[0].Error(), custom_errors.ErrMandatorySvcbKeyMissing.Error())
+	})
+
+	t.Run("unsupported mandatory key", func(t *testing.T) {
+		t.Parallel()
+
+		s := &dns.SVCB{
+			Priority: 1,
+			Target:   "example.com",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBMandatory{Code: []dns.SVCBKey{dns.SVCBKey(0x10)}},
+				&dns.SVCBAlpn{Alpn: []string{"dot"}},
+				&dns.SVCBLocal{KeyCode: 0x10, Data: []byte{}},
+			},
+		}
+
+		svcbRR, errs := svcb.ParseDDRSVCB("scanId", s)
+
+		assert.Nil(t, svcbRR, "svcbRR should be nil")
+		assert.True(t, errs[len(errs)-1].IsCritical(), "error should be critical")
+		assert.Contains(t, errs[len(errs)-1].Error(), custom_errors.ErrUnsupportedMandatorySvcbKey.Error())
+	})
+
 	t.Run("Invalid ALPN", func(t *testing.T) {
 		t.Parallel()
 
@@ -318,6 +441,31 @@ func TestParseDDRSVCB(t *testing.T) {
 		assert.NotEmpty(t, errs, "errs should not be empty")
 	})
 
+	t.Run("Invalid ech cast", func(t *testing.T) {
+		t.Parallel()
+
+		s := &dns.SVCB{
+			Priority: 1,
+			Target:   "example.com",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{
+					Alpn: []string{"h2"},
+				},
+				&dns.SVCBLocal{
+					KeyCode: 0x05,
+					Data:    []byte{},
+				},
+			},
+		}
+
+		svcbRR, errs := svcb.ParseDDRSVCB("scanId", s)
+
+		assert.NotNil(t, svcbRR, "svcbRR should not be nil")
+		assert.Nil(t, svcbRR.ECH)
+		assert.Len(t, errs, 1)
+		assert.False(t, errs[0].IsCritical(), "error should not be critical")
+	})
+
 	t.Run("unknown svcb key", func(t *testing.T) {
 		t.Parallel()
 
@@ -4,15 +4,18 @@ import (
 	"context"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 	"github.com/steffsas/doe-hunter/lib/consumer"
+	"github.com/steffsas/doe-hunter/lib/fingerprint"
 	"github.com/steffsas/doe-hunter/lib/helper"
 	"github.com/steffsas/doe-hunter/lib/kafka"
 	"github.com/steffsas/doe-hunter/lib/producer"
 	"github.com/steffsas/doe-hunter/lib/query"
+	"github.com/steffsas/doe-hunter/lib/scan"
 	"github.com/steffsas/doe-hunter/lib/storage"
 )
 
@@ -43,6 +46,12 @@ func main() {
 		return
 	}
 
+	// re-normalizing stored scans neither scans nor needs a vantage point
+	if toRun == "normalize" {
+		normalizeFingerprintScans()
+		return
+	}
+
 	vp, err := helper.GetEnvVar(helper.VANTAGE_POINT_ENV, true)
 	if err != nil {
 		return
@@ -124,6 +133,89 @@ func setLogger() {
 	logrus.SetOutput(os.Stdout)
 }
 
+// loadFingerprintRuleSet loads the rule set of the environment, nil for the built-in rule set
+func loadFingerprintRuleSet() (*fingerprint.RuleSet, error) {
+	path, _ := helper.GetEnvVar(helper.FINGERPRINT_RULE_SET_FILE_PATH_ENV, false)
+	if path == "" {
+		return nil, nil
+	}
+
+	ruleSet, err := fingerprint.LoadRuleSet(path)
+	if err != nil {
+		logrus.Fatalf("failed to load fingerprint rule set %s: %v", path, err)
+		return nil, err
+	}
+
+	return ruleSet, nil
+}
+
+// loadVersionPatternTable loads the pattern table of the environment, nil for the built-in table
+func loadVersionPatternTable() (*scan.VersionPatternTable, error) {
+	path, _ := helper.GetEnvVar(helper.VERSION_PATTERN_TABLE_FILE_PATH_ENV, false)
+	if path == "" {
+		return nil, nil
+	}
+
+	table, err := scan.LoadVersionPatternTable(path)
+	if err != nil {
+		logrus.Fatalf("failed to load version pattern table %s: %v", path, err)
+		return nil, err
+	}
+
+	return table, nil
+}
+
+func normalizeFingerprintScans() {
+	inputFile, err := helper.GetEnvVar(helper.NORMALIZE_INPUT_FILE_ENV, true)
+	if err != nil {
+		return
+	}
+
+	// the logger writes to stdout, hence the scans are written to a file
+	outputFile, err := helper.GetEnvVar(helper.NORMALIZE_OUTPUT_FILE_ENV, true)
+	if err != nil {
+		return
+	}
+
+	table, err := loadVersionPatternTable()
+	if err != nil {
+		return
+	}
+	if table == nil {
+		table = scan.DEFAULT_VERSION_PATTERN_TABLE
+	}
+
+	ruleSet, err := loadFingerprintRuleSet()
+	if err != nil {
+		return
+	}
+	if ruleSet == nil {
+		ruleSet = fingerprint.DEFAULT_RULE_SET
+	}
+
+	in, err := os.Open(inputFile)
+	if err != nil {
+		logrus.Fatalf("failed to open %s: %v", inputFile, err)
+		return
+	}
+	defer in.Close()
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		logrus.Fatalf("failed to create %s: %v", outputFile, err)
+		return
+	}
+	defer out.Close()
+
+	count, err := scan.RenormalizeFingerprintScans(in, out, ruleSet, table)
+	if err != nil {
+		logrus.Fatalf("failed to re-normalize fingerprint scans after %d scans: %v", count, err)
+		return
+	}
+
+	logrus.Infof("re-normalized %d fingerprint scans with version pattern table revision %d and rule set revision %d", count, table.Revision, ruleSet.Revision)
+}
+
 func startProducerFromFile(newScans producer.GetProducibleScans, file string) {
 	sp, err := producer.NewKafkaScanProducer(producer.GetDefaultKafkaProducerConfig())
 	if err != nil {
@@ -196,6 +288,20 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 		}
 	}
 
+	// the root bundle is optional, certificate chains are always verified against the system pool
+	if rootBundlePath, _ := helper.GetEnvVar(helper.CERTIFICATE_ROOT_BUNDLE_PATH_ENV, false); rootBundlePath != "" {
+		rootBundle, err := query.LoadRootBundle(rootBundlePath)
+		if err != nil {
+			logrus.Fatalf("failed to load root bundle %s: %v", rootBundlePath, err)
+			return
+		}
+
+		if queryConfig == nil {
+			queryConfig = &query.QueryConfig{}
+		}
+		queryConfig.RootBundle = rootBundle
+	}
+
 	config := producer.GetDefaultKafkaProducerConfig()
 	config.Server = kafkaServer
 
@@ -224,8 +330,35 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 
 		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_DDR_COLLECTION, mongoServer)
 
+		scheduleTLSEnumScans := false
+		if value, _ := helper.GetEnvVar(helper.SCHEDULE_TLS_ENUM_SCANS_ENV, false); value != "" {
+			scheduleTLSEnumScans, err = strconv.ParseBool(value)
+			if err != nil {
+				logrus.Fatalf("invalid value %s for %s: %v", value, helper.SCHEDULE_TLS_ENUM_SCANS_ENV, err)
+				return
+			}
+		}
+
+		scheduleSessionScans := false
+		if value, _ := helper.GetEnvVar(helper.SCHEDULE_SESSION_SCANS_ENV, false); value != "" {
+			scheduleSessionScans, err = strconv.ParseBool(value)
+			if err != nil {
+				logrus.Fatalf("invalid value %s for %s: %v", value, helper.SCHEDULE_SESSION_SCANS_ENV, err)
+				return
+			}
+		}
+
+		scheduleResumptionScans := false
+		if value, _ := helper.GetEnvVar(helper.SCHEDULE_RESUMPTION_SCANS_ENV, false); value != "" {
+			scheduleResumptionScans, err = strconv.ParseBool(value)
+			if err != nil {
+				logrus.Fatalf("invalid value %s for %s: %v", value, helper.SCHEDULE_RESUMPTION_SCANS_ENV, err)
+				return
+			}
+		}
+
 		//nolint:contextcheck
-		pc, err := consumer.NewKafkaDDREventConsumer(consumerConfig, prod, sh, queryConfig)
+		pc, err := consumer.NewKafkaDDREventConsumer(consumerConfig, prod, sh, queryConfig, scheduleTLSEnumScans, scheduleSessionScans, scheduleResumptionScans)
 		if err != nil {
 			logrus.Fatalf("failed to create parallel consumer: %v", err)
 			return
@@ -350,8 +483,24 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 
 		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_CERTIFICATE_COLLECTION, mongoServer)
 
+		// verified discovery verdicts are stored in a dedicated collection
+		vsh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_DDR_VERIFICATION_COLLECTION, mongoServer)
+		if err := vsh.Open(); err != nil {
+			logrus.Fatalf("failed to open storage handler: %v", err)
+			return
+		}
+		defer vsh.Close()
+
+		// certificates are stored once by fingerprint, scans only reference them
+		csh := storage.NewDefaultMongoCertificateStorageHandler(ctx, storage.DEFAULT_CERTIFICATE_STORE_COLLECTION, mongoServer)
+		if err := csh.Open(); err != nil {
+			logrus.Fatalf("failed to open certificate storage handler: %v", err)
+			return
+		}
+		defer csh.Close()
+
 		//nolint:contextcheck
-		pc, err := consumer.NewKafkaCertificateEventConsumer(consumerConfig, sh, queryConfig)
+		pc, err := consumer.NewKafkaCertificateEventConsumer(consumerConfig, sh, vsh, csh, queryConfig)
 		if err != nil {
 			logrus.Fatalf("failed to create parallel consumer: %v", err)
 			return
@@ -371,8 +520,28 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 
 		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_FINGERPRINT_COLLECTION, mongoServer)
 
+		ruleSet, err := loadFingerprintRuleSet()
+		if err != nil {
+			return
+		}
+
+		versionPatterns, err := loadVersionPatternTable()
+		if err != nil {
+			return
+		}
+
+		// the banner probes are optional, without targets no banners are grabbed
+		bannerTargets := []*query.BannerTarget{}
+		if value, _ := helper.GetEnvVar(helper.FINGERPRINT_BANNER_TARGETS_ENV, false); value != "" {
+			bannerTargets, err = query.ParseBannerTargets(value)
+			if err != nil {
+				logrus.Fatalf("invalid value %s for %s: %v", value, helper.FINGERPRINT_BANNER_TARGETS_ENV, err)
+				return
+			}
+		}
+
 		//nolint:contextcheck
-		pc, err := consumer.NewKafkaFingerprintEventConsumer(consumerConfig, sh, queryConfig)
+		pc, err := consumer.NewKafkaFingerprintEventConsumer(consumerConfig, sh, queryConfig, ruleSet, versionPatterns, bannerTargets)
 		if err != nil {
 			logrus.Fatalf("failed to create parallel consumer: %v", err)
 			return
@@ -386,6 +555,17 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 			return
 		}
 
+		// the trust anchor is optional, without it the root KSKs are used
+		trustAnchor := ""
+		if path, _ := helper.GetEnvVar(helper.DNSSEC_TRUST_ANCHOR_FILE_PATH_ENV, false); path != "" {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				logrus.Fatalf("failed to read DNSSEC trust anchor file %s: %v", path, err)
+				return
+			}
+			trustAnchor = string(content)
+		}
+
 		consumerConfig.Threads = threads
 		consumerConfig.Topic = helper.GetTopicFromNameAndVP(kafka.DEFAULT_DDR_DNSSEC_TOPIC, vp)
 		consumerConfig.ConsumerGroup = consumer.DEFAULT_DDR_DNSSEC_CONSUMER_GROUP
@@ -393,7 +573,7 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_DDR_DNSSEC_COLLECTION, mongoServer)
 
 		//nolint:contextcheck
-		pc, err := consumer.NewKafkaDDRDNSSECEventConsumer(consumerConfig, sh, queryConfig)
+		pc, err := consumer.NewKafkaDDRDNSSECEventConsumer(consumerConfig, sh, queryConfig, trustAnchor)
 		if err != nil {
 			logrus.Fatalf("failed to create parallel consumer: %v", err)
 			return
@@ -414,7 +594,7 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_CANARAY_COLLECTION, mongoServer)
 
 		//nolint:contextcheck
-		pc, err := consumer.NewKafkaDDREventConsumer(consumerConfig, prod, sh, queryConfig)
+		pc, err := consumer.NewKafkaDDREventConsumer(consumerConfig, prod, sh, queryConfig, false, false, false)
 		if err != nil {
 			logrus.Fatalf("failed to create parallel consumer: %v", err)
 			return
@@ -443,6 +623,145 @@ func startConsumer(ctx context.Context, protocol, vp string) {
 			logrus.Infof("created parallel consumer %s with %d parallel consumers", protocol, pc.Config.Threads)
 		}
 		_ = pc.Consume(ctx)
+	case "odoh":
+		threads, err := helper.GetThreads(helper.THREADS_ODOH_ENV)
+		if err != nil {
+			return
+		}
+
+		// the oblivious proxy is optional, without proxy the target is queried directly
+		proxy, _ := helper.GetEnvVar(helper.ODOH_PROXY_ENV, false)
+
+		consumerConfig.Threads = threads
+		consumerConfig.Topic = helper.GetTopicFromNameAndVP(kafka.DEFAULT_ODOH_TOPIC, vp)
+		consumerConfig.ConsumerGroup = consumer.DEFAULT_ODOH_CONSUMER_GROUP
+
+		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_ODOH_COLLECTION, mongoServer)
+
+		//nolint:contextcheck
+		pc, err := consumer.NewKafkaODoHEventConsumer(consumerConfig, prod, sh, queryConfig, proxy)
+		if err != nil {
+			logrus.Fatalf("failed to create parallel consumer: %v", err)
+			return
+		} else {
+			logrus.Infof("created parallel consumer %s with %d parallel consumers", protocol, pc.Config.Threads)
+		}
+		_ = pc.Consume(ctx)
+	case "ohttp":
+		threads, err := helper.GetThreads(helper.THREADS_OHTTP_ENV)
+		if err != nil {
+			return
+		}
+
+		consumerConfig.Threads = threads
+		consumerConfig.Topic = helper.GetTopicFromNameAndVP(kafka.DEFAULT_OHTTP_TOPIC, vp)
+		consumerConfig.ConsumerGroup = consumer.DEFAULT_OHTTP_CONSUMER_GROUP
+
+		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_OHTTP_COLLECTION, mongoServer)
+
+		//nolint:contextcheck
+		pc, err := consumer.NewKafkaOHTTPEventConsumer(consumerConfig, prod, sh, queryConfig)
+		if err != nil {
+			logrus.Fatalf("failed to create parallel consumer: %v", err)
+			return
+		} else {
+			logrus.Infof("created parallel consumer %s with %d parallel consumers", protocol, pc.Config.Threads)
+		}
+		_ = pc.Consume(ctx)
+	case "tls-enum":
+		threads, err := helper.GetThreads(helper.THREADS_TLS_ENUM_ENV)
+		if err != nil {
+			return
+		}
+
+		consumerConfig.Threads = threads
+		consumerConfig.Topic = helper.GetTopicFromNameAndVP(kafka.DEFAULT_TLS_ENUM_TOPIC, vp)
+		consumerConfig.ConsumerGroup = consumer.DEFAULT_TLS_ENUM_CONSUMER_GROUP
+
+		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_TLS_ENUM_COLLECTION, mongoServer)
+
+		//nolint:contextcheck
+		pc, err := consumer.NewKafkaTLSEnumEventConsumer(consumerConfig, sh, queryConfig)
+		if err != nil {
+			logrus.Fatalf("failed to create parallel consumer: %v", err)
+			return
+		} else {
+			logrus.Infof("created parallel consumer %s with %d parallel consumers", protocol, pc.Config.Threads)
+		}
+		_ = pc.Consume(ctx)
+	case "session":
+		threads, err := helper.GetThreads(helper.THREADS_SESSION_ENV)
+		if err != nil {
+			return
+		}
+
+		consumerConfig.Threads = threads
+		consumerConfig.Topic = helper.GetTopicFromNameAndVP(kafka.DEFAULT_SESSION_TOPIC, vp)
+		consumerConfig.ConsumerGroup = consumer.DEFAULT_SESSION_CONSUMER_GROUP
+
+		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_SESSION_COLLECTION, mongoServer)
+
+		//nolint:contextcheck
+		pc, err := consumer.NewKafkaSessionEventConsumer(consumerConfig, sh, queryConfig)
+		if err != nil {
+			logrus.Fatalf("failed to create parallel consumer: %v", err)
+			return
+		} else {
+			logrus.Infof("created parallel consumer %s with %d parallel consumers", protocol, pc.Config.Threads)
+		}
+		_ = pc.Consume(ctx)
+	case "resumption":
+		threads, err := helper.GetThreads(helper.THREADS_RESUMPTION_ENV)
+		if err != nil {
+			return
+		}
+
+		consumerConfig.Threads = threads
+		consumerConfig.Topic = helper.GetTopicFromNameAndVP(kafka.DEFAULT_RESUMPTION_TOPIC, vp)
+		consumerConfig.ConsumerGroup = consumer.DEFAULT_RESUMPTION_CONSUMER_GROUP
+
+		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_RESUMPTION_COLLECTION, mongoServer)
+
+		//nolint:contextcheck
+		pc, err := consumer.NewKafkaResumptionEventConsumer(consumerConfig, sh, queryConfig)
+		if err != nil {
+			logrus.Fatalf("failed to create parallel consumer: %v", err)
+			return
+		} else {
+			logrus.Infof("created parallel consumer %s with %d parallel consumers", protocol, pc.Config.Threads)
+		}
+		_ = pc.Consume(ctx)
+	case "doh-path":
+		threads, err := helper.GetThreads(helper.THREADS_DOH_PATH_ENV)
+		if err != nil {
+			return
+		}
+
+		// the paths are optional, without paths the scans probe the default paths
+		paths := []string{}
+		if value, _ := helper.GetEnvVar(helper.DOH_DISCOVERY_PATHS_ENV, false); value != "" {
+			for _, path := range strings.Split(value, ",") {
+				if path = strings.TrimSpace(path); path != "" {
+					paths = append(paths, path)
+				}
+			}
+		}
+
+		consumerConfig.Threads = threads
+		consumerConfig.Topic = helper.GetTopicFromNameAndVP(kafka.DEFAULT_DOH_PATH_TOPIC, vp)
+		consumerConfig.ConsumerGroup = consumer.DEFAULT_DOH_PATH_CONSUMER_GROUP
+
+		sh := storage.NewDefaultMongoStorageHandler(ctx, storage.DEFAULT_DOH_PATH_COLLECTION, mongoServer)
+
+		//nolint:contextcheck
+		pc, err := consumer.NewKafkaDoHPathEventConsumer(consumerConfig, sh, queryConfig, paths)
+		if err != nil {
+			logrus.Fatalf("failed to create parallel consumer: %v", err)
+			return
+		} else {
+			logrus.Infof("created parallel consumer %s with %d parallel consumers", protocol, pc.Config.Threads)
+		}
+		_ = pc.Consume(ctx)
 	default:
 		logrus.Fatalf("unsupported protocol type %s", protocol)
 	}